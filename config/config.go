@@ -1,11 +1,17 @@
 package config
 
 import (
+	"encoding/hex"
 	"fmt"
+	"log"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/spf13/viper"
+
+	"tron-monitor/models"
+	"tron-monitor/tronaddr"
 )
 
 // Config 系统配置结构体
@@ -17,51 +23,251 @@ type Config struct {
 		Timeout    time.Duration `mapstructure:"timeout"`
 		RetryMax   int           `mapstructure:"retry_max"`
 		RetryDelay time.Duration `mapstructure:"retry_delay"`
+		// 按接口单独配置的超时（接口名 -> 超时），如 gettransactioninfobyid: 60s
+		Timeouts map[string]time.Duration `mapstructure:"timeouts"`
+		// 连接池配置，工作线程并发请求同一节点时需要足够的空闲连接
+		MaxIdleConnsPerHost int           `mapstructure:"max_idle_conns_per_host"` // 每个主机保留的空闲连接数
+		MaxConnsPerHost     int           `mapstructure:"max_conns_per_host"`      // 每个主机的最大连接数，0表示不限制
+		IdleConnTimeout     time.Duration `mapstructure:"idle_conn_timeout"`       // 空闲连接保留时间
+		// 成功率告警：最近success_rate_window次请求的成功率低于success_rate_threshold（百分比）时告警，恢复后解除
+		SuccessRateWindow    int     `mapstructure:"success_rate_window"` // 0表示关闭
+		SuccessRateThreshold float64 `mapstructure:"success_rate_threshold"`
+		// 状态码200但响应体带Error字段（如合约校验失败）的错误通常重试也不会成功，默认不重试
+		RetryAPIErrors bool `mapstructure:"retry_api_errors"`
 	} `mapstructure:"trongrid"`
 
 	// Redis配置
 	Redis struct {
-		Addr     string `mapstructure:"addr"`
-		Password string `mapstructure:"password"`
-		DB       int    `mapstructure:"db"`
-		PoolSize int    `mapstructure:"pool_size"`
+		Addr             string        `mapstructure:"addr"`
+		Password         string        `mapstructure:"password"`
+		DB               int           `mapstructure:"db"`
+		PoolSize         int           `mapstructure:"pool_size"`
+		StreamChunkSize  int64         `mapstructure:"stream_chunk_size"`  // 流式读取转账记录时每次LRANGE的条数
+		SaveRetryMax     int           `mapstructure:"save_retry_max"`     // 保存转账事件失败后的最大重试次数
+		SaveRetryBackoff time.Duration `mapstructure:"save_retry_backoff"` // 首次重试等待时间，之后每次翻倍
+		MinIdleConns     int           `mapstructure:"min_idle_conns"`     // 连接池最少空闲连接数
+		PoolTimeout      time.Duration `mapstructure:"pool_timeout"`       // 连接池无可用连接时的等待时间
+		MaxConcurrentOps int           `mapstructure:"max_concurrent_ops"` // 热点操作（获取监控地址、保存转账）最大并发数，0表示不限制
+		OpAcquireTimeout time.Duration `mapstructure:"op_acquire_timeout"` // 等待热点操作名额的最长时间，超时快速失败
+		QueueCodec       string        `mapstructure:"queue_codec"`        // 区块队列编码格式: json 或 gob（更紧凑），转账记录始终使用JSON
+		BlockOrdered     bool          `mapstructure:"block_ordered"`      // 读取最近转账时按区块从新到旧、区块内按交易和合约序号排序，需要monitor.record_tx_index
+		Namespace        string        `mapstructure:"namespace"`          // 发布订阅频道的命名空间前缀（频道不区分数据库），多个实例共用一个Redis时设置
+
+		// 按代币类型的转账列表（transfers:<代币类型>）保留条数，token_list_sizes按代币类型覆盖默认值，0表示不保存该列表
+		TokenListSize  int64            `mapstructure:"token_list_size"`
+		TokenListSizes map[string]int64 `mapstructure:"token_list_sizes"`
 	} `mapstructure:"redis"`
 
 	// 监控配置
 	Monitor struct {
-		BlockInterval    time.Duration `mapstructure:"block_interval"`     // 区块查询间隔，默认1秒
-		WorkerCount      int           `mapstructure:"worker_count"`       // 工作线程数
-		QueueSize        int           `mapstructure:"queue_size"`         // 队列大小
-		BatchSize        int           `mapstructure:"batch_size"`         // 批处理大小
-		MaxBlockHeight   int64         `mapstructure:"max_block_height"`   // 最大区块高度
-		StartBlockHeight int64         `mapstructure:"start_block_height"` // 起始区块高度
+		BlockInterval           time.Duration       `mapstructure:"block_interval"`             // 区块查询间隔，默认1秒
+		WorkerCount             int                 `mapstructure:"worker_count"`               // 工作线程数
+		QueueSize               int                 `mapstructure:"queue_size"`                 // 队列大小
+		QueueFullPolicy         string              `mapstructure:"queue_full_policy"`          // 队列满时的处理策略: block（等待队列消化，不丢弃区块）或 drop_oldest（丢弃最早未处理的区块）
+		BatchSize               int                 `mapstructure:"batch_size"`                 // 批处理大小
+		MaxBlockHeight          int64               `mapstructure:"max_block_height"`           // 最大区块高度
+		StartBlockHeight        int64               `mapstructure:"start_block_height"`         // 起始区块高度
+		IdlePollInterval        time.Duration       `mapstructure:"idle_poll_interval"`         // 队列为空时的阻塞等待时间（BRPOP超时）
+		ErrorBackoff            time.Duration       `mapstructure:"error_backoff"`              // 获取队列数据出错后的退避时间
+		MaxWorkerRestarts       int                 `mapstructure:"max_worker_restarts"`        // 每个工作线程每分钟最多因panic重启的次数
+		TrackPermissionUpdates  bool                `mapstructure:"track_permission_updates"`   // 是否记录监控地址的权限变更
+		ResolveDuplicateTxs     bool                `mapstructure:"resolve_duplicate_txs"`      // 保存前检查同一转账是否已按其他区块保存，按链上所在区块保留一条
+		RetainRaw               bool                `mapstructure:"retain_raw"`                 // 是否保留产生转账的原始交易JSON（压缩）
+		RawTTL                  time.Duration       `mapstructure:"raw_ttl"`                    // 原始交易保留时间
+		RawMaxBytes             int                 `mapstructure:"raw_max_bytes"`              // 单条原始交易压缩后的最大字节数，超过则不保留
+		CatchUpThreshold        int64               `mapstructure:"catchup_threshold"`          // 落后区块数超过该值时进入追赶模式，0表示关闭
+		CatchUpBatch            int64               `mapstructure:"catchup_batch"`              // 追赶模式下每轮连续处理的区块数
+		WarmupLookback          int64               `mapstructure:"warmup_lookback"`            // 首次启动时从最新区块往前补齐的区块数，0表示从最新区块开始
+		ReorderWindow           int                 `mapstructure:"reorder_window"`             // 处理游标等待乱序区块的最大数量
+		Mode                    string              `mapstructure:"mode"`                       // 运行模式: queue（Redis队列+工作线程池）或 direct（监控器直接处理）
+		BlockSource             string              `mapstructure:"block_source"`               // 区块来源: polling 或 stream
+		StreamURL               string              `mapstructure:"stream_url"`                 // 区块事件流地址（block_source为stream时使用）
+		StreamReconnectDelay    time.Duration       `mapstructure:"stream_reconnect_delay"`     // 事件流断开后的重连间隔
+		StreamStaleAfter        time.Duration       `mapstructure:"stream_stale_after"`         // 超过该时间未收到区块时回退到轮询
+		HistoricalChunkSize     int64               `mapstructure:"historical_chunk_size"`      // 历史区块每块处理的区块数，块之间等待队列消化
+		HistoricalWorkers       int                 `mapstructure:"historical_workers"`         // 并发处理历史区块和追赶模式分块的协程数，1表示按顺序处理
+		FollowSolidified        bool                `mapstructure:"follow_solidified"`          // 是否只跟踪固化（不可逆）区块
+		RecordDecodeFailures    bool                `mapstructure:"record_decode_failures"`     // 是否记录无法解码的合约调用
+		KeepUnparsedAmount      bool                `mapstructure:"keep_unparsed_amount"`       // TRC20金额无法解析但接收方为监控地址时，仍保存转账并标记amount_parse_error
+		DecodeFailureMaxData    int                 `mapstructure:"decode_failure_max_data"`    // 解码失败记录中原始数据的最大长度（十六进制字符）
+		DecodeFailureMaxRecords int64               `mapstructure:"decode_failure_max_records"` // 最多保留的解码失败记录数
+		MaxBlockAttempts        int                 `mapstructure:"max_block_attempts"`         // 区块最多处理次数，仍失败则进入死信队列
+		MaxTransfersPerBlock    int                 `mapstructure:"max_transfers_per_block"`    // 单个区块最多处理的转账数，超过后截断该区块，0表示不限制
+		TRC20DecodeMode         string              `mapstructure:"trc20_decode_mode"`          // TRC20转账解码方式: calldata（解析transfer调用数据）或 logs（解析交易日志中的Transfer事件，每笔交易需额外请求一次）
+		SyncWatchAddresses      bool                `mapstructure:"sync_watch_addresses"`       // 启动时使Redis中的监控地址与配置完全一致（移除配置中不存在的地址）
+		NormalizeHexWatch       bool                `mapstructure:"normalize_hex_watch"`        // 添加监控地址时将十六进制地址转换为base58，关闭时拒绝十六进制地址
+		BalanceSnapshot         bool                `mapstructure:"balance_snapshot"`           // 是否为监控地址的转账附加转账后余额（每个地址在缓存期内只查询一次）
+		BalanceCacheTTL         time.Duration       `mapstructure:"balance_cache_ttl"`          // 地址余额缓存时间，同时限制每个地址的查询频率
+		MaxBackfillSpan         int64               `mapstructure:"max_backfill_span"`          // 一次补齐（启动时处理游标或预热起点到最新区块、历史区块处理）允许的最大区块数，0表示不限制
+		ForceBackfill           bool                `mapstructure:"force_backfill"`             // 允许超过max_backfill_span的补齐（也可用--force启动参数）
+		EmptyWatchMode          string              `mapstructure:"empty_watch_mode"`           // 监控地址为空时的行为: warn（只在启动时警告）或 sample（抽样保存全链TRC10/TRC20转账）
+		SampleRate              int                 `mapstructure:"sample_rate"`                // sample模式下约每N笔交易保存一笔
+		SkipOverrunTicks        bool                `mapstructure:"skip_overrun_ticks"`         // 单轮处理超过block_interval时丢弃期间积压的tick，避免紧接着再处理一轮
+		SaveWorkers             int                 `mapstructure:"save_workers"`               // 独立保存线程数，解码线程只提取转账，标签和余额并行补充，保存和通知按区块内顺序进行；0表示在解码线程内保存
+		SaveQueueSize           int                 `mapstructure:"save_queue_size"`            // 解码线程与保存线程之间的转账队列大小
+		RecordTxIndex           bool                `mapstructure:"record_tx_index"`            // 是否记录转账所在交易在区块中的序号和合约在交易中的序号
+		RecordBlockHash         bool                `mapstructure:"record_block_hash"`          // 是否在转账事件中记录所在区块的哈希
+		TagStandard             bool                `mapstructure:"tag_standard"`               // 是否标记合约转账的合约标准（TRC20/TRC721），启用时同时解码TRC721转账
+		EnableTRX               bool                `mapstructure:"enable_trx"`                 // 是否处理TRX转账
+		EnableTRC10             bool                `mapstructure:"enable_trc10"`               // 是否处理TRC10转账
+		EnableTRC20             bool                `mapstructure:"enable_trc20"`               // 是否处理USDT以外的TRC20（及TRC721）转账，USDT由usdt.enable_monitoring控制
+		ThroughputWindow        int                 `mapstructure:"throughput_window"`          // 跟踪最近多少个区块的转账数用于突增告警，0表示关闭
+		ThroughputK             float64             `mapstructure:"throughput_k"`               // 区块转账数超过 均值+k·标准差 时告警
+		ThroughputCap           int                 `mapstructure:"throughput_cap"`             // 区块转账数超过该值时直接告警，0表示不限制
+		WatchOnlyPrefilter      bool                `mapstructure:"watch_only_prefilter"`       // 只解码引用了监控地址的交易（字符串预检），不再保存与监控地址无关的TRX转账
+		SkipFailedTransactions  bool                `mapstructure:"skip_failed_transactions"`   // 跳过执行结果不是SUCCESS的合约
+		IncludeUnknownResult    bool                `mapstructure:"include_unknown_result"`     // 跳过失败交易时，没有执行结果（ret为空）的合约是否仍然处理
+		IgnoreSelfTransfers     bool                `mapstructure:"ignore_self_transfers"`      // 是否忽略自转账（发送方与接收方相同或属于同一所有者分组）
+		SkipZeroAmount          bool                `mapstructure:"skip_zero_amount"`           // 是否丢弃金额为0的转账
+		OwnerGroups             map[string][]string `mapstructure:"owner_groups"`               // 所有者分组（分组名 -> 地址列表），组内互转视为自转账
 	} `mapstructure:"monitor"`
 
 	// 监控地址列表
 	WatchAddresses []string `mapstructure:"watch_addresses"`
 
+	// 自定义合约事件（通过交易日志解码）
+	ContractEvents []ContractEventConfig `mapstructure:"contract_events"`
+
+	// 同一进程中独立监控的多个网络（如主网和测试网），为空时只监控上面配置的单个网络
+	Networks []NetworkConfig `mapstructure:"networks"`
+	// 当前配置所属的网络名称，由ForNetwork设置，未配置networks时为空
+	Network string `mapstructure:"-"`
+
 	// USDT监控配置
 	USDT struct {
-		ContractAddress  string  `mapstructure:"contract_address"`
-		EnableMonitoring bool    `mapstructure:"enable_monitoring"`
-		MinAmount        float64 `mapstructure:"min_amount"`
-		MaxAmount        float64 `mapstructure:"max_amount"`
-		Decimals         int     `mapstructure:"decimals"`
+		ContractAddress    string  `mapstructure:"contract_address"`
+		EnableMonitoring   bool    `mapstructure:"enable_monitoring"`
+		MinAmount          float64 `mapstructure:"min_amount"`
+		MaxAmount          float64 `mapstructure:"max_amount"`
+		Decimals           int     `mapstructure:"decimals"`
+		UseLivePrice       bool    `mapstructure:"use_live_price"`       // 是否使用实时价格计算USD价值（默认按1:1）
+		UseHistoricalPrice bool    `mapstructure:"use_historical_price"` // 使用区块时间的历史价格（需启用use_live_price）
+		WhaleThresholdUSD  float64 `mapstructure:"whale_threshold_usd"`  // 全链大额USDT转账阈值（USD），不论是否涉及监控地址都保存并通知，0表示关闭
 	} `mapstructure:"usdt"`
 
+	// 价格查询配置
+	Pricing struct {
+		BaseURL    string        `mapstructure:"base_url"`
+		USDTCoinID string        `mapstructure:"usdt_coin_id"`
+		Timeout    time.Duration `mapstructure:"timeout"`
+		CacheTTL   time.Duration `mapstructure:"cache_ttl"`
+	} `mapstructure:"pricing"`
+
+	// 地址标签配置
+	Labels struct {
+		Enabled        bool          `mapstructure:"enabled"`         // 是否启用地址标签
+		File           string        `mapstructure:"file"`            // 标签文件路径（JSON: 地址 -> 标签）
+		ReloadInterval time.Duration `mapstructure:"reload_interval"` // 标签热加载间隔
+	} `mapstructure:"labels"`
+
+	// 通知配置
+	Notify struct {
+		Enabled             bool          `mapstructure:"enabled"`              // 是否启用转账通知
+		WebhookURL          string        `mapstructure:"webhook_url"`          // Webhook通知地址
+		WebhookURLs         []string      `mapstructure:"webhook_urls"`         // 额外的Webhook通知地址，每条通知同时发送到所有地址
+		WebhookSecret       string        `mapstructure:"webhook_secret"`       // Webhook签名密钥，设置后请求携带X-Timestamp和X-Signature头
+		Timeout             time.Duration `mapstructure:"timeout"`              // 单次通知发送超时
+		PerAddressRate      int           `mapstructure:"per_address_rate"`     // 每个地址每分钟最多单独通知的条数，超出部分合并为汇总，0表示不限制
+		BufferSize          int           `mapstructure:"buffer_size"`          // 通知发送队列大小
+		OverflowPolicy      string        `mapstructure:"overflow_policy"`      // 队列已满时的策略: drop_oldest, drop_newest（block已废弃，按drop_oldest处理）
+		MinConfirmations    int64         `mapstructure:"min_confirmations"`    // 转账所在区块达到该确认数后才通知，0表示立即通知
+		ConfirmationsSource string        `mapstructure:"confirmations_source"` // 确认数计算依据: cursor（以处理游标为链头）或 solidified（以固化区块高度计算，与不可逆一致）
+		RevertReorged       bool          `mapstructure:"revert_reorged"`       // 区块被重组时删除已保存的转账并在transfers_reverted频道发布撤销事件，需要min_confirmations大于0
+		QuietHours          []string      `mapstructure:"quiet_hours"`          // 静默时段（HH:MM-HH:MM），时段内只发送critical级别通知（目前仅TronGrid成功率告警）
+		QuietTimezone       string        `mapstructure:"quiet_timezone"`       // 静默时段的时区，如 Asia/Shanghai
+		QuietMode           string        `mapstructure:"quiet_mode"`           // 静默时段内非紧急通知的处理方式: suppress（丢弃）或 digest（时段结束后合并发送）
+	} `mapstructure:"notify"`
+
+	// 金额显示配置
+	Display struct {
+		TRXPrecision int  `mapstructure:"trx_precision"` // TRX金额显示的小数位数（0-6），用于日志和API展示
+		PlainAmounts bool `mapstructure:"plain_amounts"` // 转账事件JSON中的金额始终输出为十进制小数，不使用科学计数法
+	} `mapstructure:"display"`
+
+	// 统计历史配置
+	Stats struct {
+		SnapshotInterval   time.Duration `mapstructure:"snapshot_interval"`    // 统计快照间隔，0表示不记录历史
+		HistoryRetention   time.Duration `mapstructure:"history_retention"`    // 统计历史保留时长
+		AmountBuckets      []float64     `mapstructure:"amount_buckets"`       // 转账金额分布的桶上界（升序），用于 /metrics
+		MaxMetricAddresses int           `mapstructure:"max_metric_addresses"` // /metrics 中按地址输出的监控地址数上限，0表示不输出按地址指标
+		SaveInterval       time.Duration `mapstructure:"save_interval"`        // 系统统计（/status 的 http 字段）保存间隔
+		MaxStatusAge       time.Duration `mapstructure:"max_status_age"`       // 系统统计超过该时长未更新时 /status 标记为过期，0表示不检查
+	} `mapstructure:"stats"`
+
 	// 日志配置
 	Log struct {
 		Level string `mapstructure:"level"`
 		File  string `mapstructure:"file"`
 	} `mapstructure:"log"`
 
+	// 本地JSONL文件输出：每笔保存成功的转账追加一行JSON
+	FileSink struct {
+		Enabled       bool          `mapstructure:"enabled"`
+		Path          string        `mapstructure:"path"`           // 当前写入的文件，轮转后重命名为 路径.时间戳
+		MaxBytes      int64         `mapstructure:"max_bytes"`      // 文件超过该大小时轮转，0表示不按大小轮转
+		MaxAge        time.Duration `mapstructure:"max_age"`        // 文件打开超过该时长时轮转，0表示不按时间轮转
+		Fsync         string        `mapstructure:"fsync"`          // fsync策略: always、interval 或 never
+		FsyncInterval time.Duration `mapstructure:"fsync_interval"` // interval策略的fsync间隔
+		QueueSize     int           `mapstructure:"queue_size"`     // 异步写入队列大小，队列满时等待而不丢弃
+	} `mapstructure:"file_sink"`
+
+	// SQL转账存储：与Redis双写，保存不受Redis列表长度和过期时间限制的历史转账，区块范围查询优先使用
+	SQLStore struct {
+		Enabled          bool   `mapstructure:"enabled"`
+		Path             string `mapstructure:"path"`               // SQLite数据库文件，不存在时创建
+		VerifySampleRate int    `mapstructure:"verify_sample_rate"` // 双写校验：约每N笔转账抽一笔，从Redis和SQL存储读回比较，0表示不校验
+		VerifyQueueSize  int    `mapstructure:"verify_queue_size"`  // 异步校验队列大小，队列满时跳过校验而不阻塞保存
+	} `mapstructure:"sql_store"`
+
+	// 启动配置
+	Startup struct {
+		RequireHealthy bool          `mapstructure:"require_healthy"` // 健康检查失败时按退避重试，超时仍不通过则启动失败；关闭时只记录警告并继续启动
+		HealthTimeout  time.Duration `mapstructure:"health_timeout"`  // 健康检查重试的总时长
+		HealthBackoff  time.Duration `mapstructure:"health_backoff"`  // 首次重试等待时间，之后每次翻倍，最长30秒
+	} `mapstructure:"startup"`
+
 	// HTTP服务配置
 	Server struct {
-		Port string `mapstructure:"port"`
-		Host string `mapstructure:"host"`
+		Port             string        `mapstructure:"port"`
+		Host             string        `mapstructure:"host"`
+		MaxStreamClients int64         `mapstructure:"max_stream_clients"` // 流式接口最大并发客户端数，0表示不限制
+		MaxStreamReplay  int64         `mapstructure:"max_stream_replay"`  // 流式接口按since补发历史事件的最大条数
+		MaxBlockRange    int64         `mapstructure:"max_block_range"`    // 按区块范围查询转账时允许的最大跨度
+		RequestTimeout   time.Duration `mapstructure:"request_timeout"`    // 非流式请求的处理超时，超时返回503，0表示不限制
+		MaxBodyBytes     int64         `mapstructure:"max_body_bytes"`     // 请求体最大字节数
+		ReadOnly         bool          `mapstructure:"read_only"`          // 只读模式，所有修改类请求（POST/PUT/PATCH/DELETE）返回405
+		BasePath         string        `mapstructure:"base_path"`          // API路径前缀（如 /tron-monitor），用于反向代理按前缀转发，为空表示挂载在根路径
+		RootHealth       bool          `mapstructure:"root_health"`        // 配置了base_path时是否同时在根路径提供 /health
+		LogBufferSize    int           `mapstructure:"log_buffer_size"`    // 内存中保留的最近日志条数，供 /logs 查询，0表示关闭
+		LogsToken        string        `mapstructure:"logs_token"`         // /logs 和 /logs/stream 的访问令牌，只读模式下未设置时不开放日志端点
+		TransferFields   []string      `mapstructure:"transfer_fields"`    // /transfers 默认输出的字段（JSON字段名），为空表示全部字段
+		// 解码端点（/tx/{txhash}、/blocks/{height}/transfers）raw=true时输出合约原始参数的大小限制
+		RawParamMaxBytes   int `mapstructure:"raw_param_max_bytes"`   // 单个合约参数的最大字节数，超过时只输出开头部分
+		RawParamMaxEntries int `mapstructure:"raw_param_max_entries"` // 每次请求最多输出的合约参数条数
 	} `mapstructure:"server"`
 }
 
+// NetworkConfig 单个网络的配置，未设置的项沿用全局配置
+//
+// 每个网络有独立的TronGrid客户端、区块监控器、处理器和Redis数据库，API端点挂载在 /networks/{name} 下。
+type NetworkConfig struct {
+	Name             string   `mapstructure:"name"`               // 网络名称，用于API路径和日志
+	BaseURL          string   `mapstructure:"base_url"`           // TronGrid API地址
+	APIKey           string   `mapstructure:"api_key"`            // TronGrid API密钥
+	RedisDB          int      `mapstructure:"redis_db"`           // 该网络使用的Redis数据库，各网络不能相同
+	StartBlockHeight int64    `mapstructure:"start_block_height"` // 起始区块高度
+	USDTContract     string   `mapstructure:"usdt_contract"`      // USDT合约地址，测试网通常不同
+	WatchAddresses   []string `mapstructure:"watch_addresses"`    // 监控地址
+}
+
+// ContractEventConfig 自定义合约事件配置
+type ContractEventConfig struct {
+	Contract       string            `mapstructure:"contract"`        // 合约地址（base58）
+	EventSignature string            `mapstructure:"event_signature"` // 事件签名，如 Approval(address,address,uint256)
+	Topic          string            `mapstructure:"topic"`           // 事件签名的keccak256哈希，即日志的topics[0]；为空时由event_signature计算，两者都填时必须一致
+	FieldMappings  map[string]string `mapstructure:"field_mappings"`  // 字段名 -> 来源，如 owner: topic1:address, value: data0:uint256
+}
+
 // LoadConfig 加载配置文件
 func LoadConfig(configPath string) (*Config, error) {
 	viper.SetConfigFile(configPath)
@@ -95,34 +301,177 @@ func setDefaults() {
 	viper.SetDefault("trongrid.timeout", "30s")
 	viper.SetDefault("trongrid.retry_max", 3)
 	viper.SetDefault("trongrid.retry_delay", "1s")
+	viper.SetDefault("trongrid.max_idle_conns_per_host", 32)
+	viper.SetDefault("trongrid.max_conns_per_host", 0)
+	viper.SetDefault("trongrid.idle_conn_timeout", "90s")
+	viper.SetDefault("trongrid.success_rate_window", 100)
+	viper.SetDefault("trongrid.success_rate_threshold", 90)
+	viper.SetDefault("trongrid.retry_api_errors", false)
 	viper.SetDefault("trongrid.api_key", "849cc081-79af-4d12-9db1-48ec1c16417e")
 
 	// Redis默认配置
 	viper.SetDefault("redis.addr", "localhost:6379")
 	viper.SetDefault("redis.db", 0)
 	viper.SetDefault("redis.pool_size", 10)
+	viper.SetDefault("redis.stream_chunk_size", 500)
+	viper.SetDefault("redis.save_retry_max", 3)
+	viper.SetDefault("redis.save_retry_backoff", "200ms")
+	viper.SetDefault("redis.min_idle_conns", 0)
+	viper.SetDefault("redis.pool_timeout", "4s")
+	viper.SetDefault("redis.max_concurrent_ops", 0)
+	viper.SetDefault("redis.op_acquire_timeout", "1s")
+	viper.SetDefault("redis.queue_codec", "json")
+	viper.SetDefault("redis.block_ordered", false)
+	viper.SetDefault("redis.namespace", "")
+	viper.SetDefault("redis.token_list_size", 10000)
 
 	// 监控默认配置
 	viper.SetDefault("monitor.block_interval", "1s") // 每秒一次查询
 	viper.SetDefault("monitor.worker_count", 4)
 	viper.SetDefault("monitor.queue_size", 1000)
+	viper.SetDefault("monitor.queue_full_policy", "block")
 	viper.SetDefault("monitor.batch_size", 10)
 	viper.SetDefault("monitor.max_block_height", 0) // 0表示不限制
+	viper.SetDefault("monitor.idle_poll_interval", "5s")
+	viper.SetDefault("monitor.error_backoff", "1s")
+	viper.SetDefault("monitor.max_worker_restarts", 5)
+	viper.SetDefault("monitor.track_permission_updates", false)
+	viper.SetDefault("monitor.resolve_duplicate_txs", true)
+	viper.SetDefault("monitor.retain_raw", false)
+	viper.SetDefault("monitor.raw_ttl", "72h")
+	viper.SetDefault("monitor.raw_max_bytes", 65536)
+	viper.SetDefault("monitor.catchup_threshold", 20)
+	viper.SetDefault("monitor.catchup_batch", 100)
+	viper.SetDefault("monitor.reorder_window", 1000)
+	viper.SetDefault("monitor.follow_solidified", false)
+	viper.SetDefault("monitor.historical_chunk_size", 1000)
+	viper.SetDefault("monitor.historical_workers", 1)
+	viper.SetDefault("monitor.mode", "queue")
+	viper.SetDefault("monitor.warmup_lookback", 0)
+	viper.SetDefault("monitor.tag_standard", false)
+	viper.SetDefault("monitor.record_block_hash", true)
+	viper.SetDefault("monitor.enable_trx", true)
+	viper.SetDefault("monitor.enable_trc10", true)
+	viper.SetDefault("monitor.enable_trc20", true)
+	viper.SetDefault("monitor.throughput_window", 0)
+	viper.SetDefault("monitor.throughput_k", 3.0)
+	viper.SetDefault("monitor.throughput_cap", 0)
+	viper.SetDefault("monitor.skip_failed_transactions", false)
+	viper.SetDefault("monitor.include_unknown_result", true)
+	viper.SetDefault("monitor.watch_only_prefilter", false)
+	viper.SetDefault("monitor.record_tx_index", true)
+	viper.SetDefault("monitor.save_workers", 0)
+	viper.SetDefault("monitor.save_queue_size", 1000)
+	viper.SetDefault("monitor.skip_overrun_ticks", true)
+	viper.SetDefault("monitor.empty_watch_mode", "warn")
+	viper.SetDefault("monitor.sample_rate", 100)
+	viper.SetDefault("monitor.max_backfill_span", 100000)
+	viper.SetDefault("monitor.force_backfill", false)
+	viper.SetDefault("monitor.balance_snapshot", false)
+	viper.SetDefault("monitor.balance_cache_ttl", "10s")
+	viper.SetDefault("monitor.sync_watch_addresses", false)
+	viper.SetDefault("monitor.normalize_hex_watch", true)
+	viper.SetDefault("monitor.trc20_decode_mode", "calldata")
+	viper.SetDefault("monitor.max_transfers_per_block", 10000)
+	viper.SetDefault("monitor.block_source", "polling")
+	viper.SetDefault("monitor.stream_reconnect_delay", "5s")
+	viper.SetDefault("monitor.stream_stale_after", "10s")
+	viper.SetDefault("monitor.max_block_attempts", 3)
+	viper.SetDefault("monitor.record_decode_failures", false)
+	viper.SetDefault("monitor.keep_unparsed_amount", true)
+	viper.SetDefault("monitor.decode_failure_max_data", 512)
+	viper.SetDefault("monitor.decode_failure_max_records", 1000)
+	viper.SetDefault("monitor.ignore_self_transfers", false)
+	viper.SetDefault("monitor.skip_zero_amount", true)
+
+	// 地址标签默认配置
+	viper.SetDefault("labels.enabled", false)
+	viper.SetDefault("labels.file", "")
+	viper.SetDefault("labels.reload_interval", "1m")
+
+	// 通知默认配置
+	viper.SetDefault("notify.enabled", false)
+	viper.SetDefault("notify.webhook_url", "")
+	viper.SetDefault("notify.webhook_secret", "")
+	viper.SetDefault("notify.timeout", "10s")
+	viper.SetDefault("notify.per_address_rate", 10)
+	viper.SetDefault("notify.buffer_size", 1000)
+	viper.SetDefault("notify.overflow_policy", "drop_oldest")
+	viper.SetDefault("notify.min_confirmations", 0)
+	viper.SetDefault("notify.revert_reorged", false)
+	viper.SetDefault("notify.quiet_hours", []string{})
+	viper.SetDefault("notify.quiet_timezone", "UTC")
+	viper.SetDefault("notify.quiet_mode", "digest")
+	viper.SetDefault("notify.confirmations_source", "cursor")
+
+	// 金额显示默认配置
+	viper.SetDefault("display.trx_precision", 6)
+	viper.SetDefault("display.plain_amounts", true)
+
+	// 统计历史默认配置
+	viper.SetDefault("stats.snapshot_interval", "1m")
+	viper.SetDefault("stats.history_retention", "168h")
+	viper.SetDefault("stats.save_interval", "10s")
+	viper.SetDefault("stats.max_status_age", "1m")
+	viper.SetDefault("stats.amount_buckets", []float64{1, 10, 100, 1000, 10000, 100000, 1000000})
+	viper.SetDefault("stats.max_metric_addresses", 500)
 
 	// 日志默认配置
 	viper.SetDefault("log.level", "info")
 	viper.SetDefault("log.file", "")
 
+	// 文件输出默认配置
+	viper.SetDefault("file_sink.enabled", false)
+	viper.SetDefault("file_sink.path", "transfers.jsonl")
+	viper.SetDefault("file_sink.max_bytes", 100*1024*1024)
+	viper.SetDefault("file_sink.max_age", "24h")
+	viper.SetDefault("file_sink.fsync", "interval")
+	viper.SetDefault("file_sink.fsync_interval", "1s")
+	viper.SetDefault("file_sink.queue_size", 10000)
+
+	// SQL转账存储默认配置
+	viper.SetDefault("sql_store.enabled", false)
+	viper.SetDefault("sql_store.path", "transfers.db")
+	viper.SetDefault("sql_store.verify_sample_rate", 0)
+	viper.SetDefault("sql_store.verify_queue_size", 1000)
+
+	// 启动默认配置
+	viper.SetDefault("startup.require_healthy", false)
+	viper.SetDefault("startup.health_timeout", "2m")
+	viper.SetDefault("startup.health_backoff", "2s")
+
 	// USDT默认配置
 	viper.SetDefault("usdt.contract_address", "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t")
 	viper.SetDefault("usdt.enable_monitoring", true)
 	viper.SetDefault("usdt.min_amount", 100.0)
 	viper.SetDefault("usdt.max_amount", 1000000.0)
 	viper.SetDefault("usdt.decimals", 6)
+	viper.SetDefault("usdt.use_live_price", false)
+	viper.SetDefault("usdt.use_historical_price", false)
+	viper.SetDefault("usdt.whale_threshold_usd", 0.0)
+
+	// 价格查询默认配置
+	viper.SetDefault("pricing.base_url", "https://api.coingecko.com/api/v3")
+	viper.SetDefault("pricing.usdt_coin_id", "tether")
+	viper.SetDefault("pricing.timeout", "10s")
+	viper.SetDefault("pricing.cache_ttl", "1m")
 
 	// HTTP服务默认配置
 	viper.SetDefault("server.port", "8080")
 	viper.SetDefault("server.host", "0.0.0.0")
+	viper.SetDefault("server.max_stream_clients", 100)
+	viper.SetDefault("server.max_stream_replay", 1000)
+	viper.SetDefault("server.max_block_range", 10000)
+	viper.SetDefault("server.max_body_bytes", 65536)
+	viper.SetDefault("server.request_timeout", "30s")
+	viper.SetDefault("server.read_only", false)
+	viper.SetDefault("server.base_path", "")
+	viper.SetDefault("server.root_health", true)
+	viper.SetDefault("server.log_buffer_size", 0)
+	viper.SetDefault("server.logs_token", "")
+	viper.SetDefault("server.transfer_fields", []string{})
+	viper.SetDefault("server.raw_param_max_bytes", 8192)
+	viper.SetDefault("server.raw_param_max_entries", 1000)
 }
 
 // validateConfig 验证配置
@@ -132,14 +481,76 @@ func validateConfig(config *Config) error {
 		return fmt.Errorf("TronGrid BaseURL不能为空")
 	}
 
+	for endpoint, timeout := range config.TronGrid.Timeouts {
+		if timeout <= 0 {
+			return fmt.Errorf("接口 %s 的超时时间必须大于0", endpoint)
+		}
+	}
+
+	if config.TronGrid.MaxIdleConnsPerHost <= 0 {
+		return fmt.Errorf("每个主机的空闲连接数必须大于0")
+	}
+
+	if config.TronGrid.MaxConnsPerHost < 0 {
+		return fmt.Errorf("每个主机的最大连接数不能为负数")
+	}
+
+	if config.TronGrid.IdleConnTimeout <= 0 {
+		return fmt.Errorf("空闲连接保留时间必须大于0")
+	}
+
+	if config.TronGrid.SuccessRateWindow < 0 {
+		return fmt.Errorf("成功率窗口大小不能为负数")
+	}
+
+	if config.TronGrid.SuccessRateThreshold < 0 || config.TronGrid.SuccessRateThreshold > 100 {
+		return fmt.Errorf("成功率阈值必须在0-100之间")
+	}
+
 	// 验证Redis配置
 	if config.Redis.Addr == "" {
 		return fmt.Errorf("Redis地址不能为空")
 	}
 
-	// 验证监控配置
+	if config.Redis.StreamChunkSize <= 0 {
+		return fmt.Errorf("流式读取块大小必须大于0")
+	}
+
+	if config.Redis.SaveRetryMax < 0 || config.Redis.SaveRetryBackoff <= 0 {
+		return fmt.Errorf("保存重试次数不能为负数，重试等待时间必须大于0")
+	}
+
+	if config.Redis.MinIdleConns < 0 || config.Redis.MinIdleConns > config.Redis.PoolSize {
+		return fmt.Errorf("最少空闲连接数必须在0到连接池大小之间")
+	}
+
+	if config.Redis.PoolTimeout <= 0 {
+		return fmt.Errorf("连接池等待时间必须大于0")
+	}
+
+	if config.Redis.MaxConcurrentOps < 0 {
+		return fmt.Errorf("Redis最大并发操作数不能为负数")
+	}
+
+	if config.Redis.MaxConcurrentOps > 0 && config.Redis.OpAcquireTimeout <= 0 {
+		return fmt.Errorf("等待Redis操作名额的时间必须大于0")
+	}
+
+	if config.Redis.QueueCodec != "json" && config.Redis.QueueCodec != "gob" {
+		return fmt.Errorf("无效的区块队列编码格式: %s", config.Redis.QueueCodec)
+	}
+
+	if config.Redis.BlockOrdered && !config.Monitor.RecordTxIndex {
+		return fmt.Errorf("按区块顺序读取转账需要启用monitor.record_tx_index")
+	}
+
+	// 验证监控配置，低于1秒只警告（私有节点可以承受更频繁的查询），低于下限拒绝启动
+	if config.Monitor.BlockInterval < minBlockInterval {
+		return fmt.Errorf("区块查询间隔不能小于 %v", minBlockInterval)
+	}
 	if config.Monitor.BlockInterval < time.Second {
-		return fmt.Errorf("区块查询间隔不能小于1秒")
+		log.Printf("警告: 区块查询间隔 %v 小于1秒。Tron约3秒出一个块，更频繁的查询不会更快发现新区块，"+
+			"只会成倍增加请求量，使用TronGrid公共节点时容易触发限流；仅建议在自建节点上使用", config.Monitor.BlockInterval)
 	}
 
 	if config.Monitor.WorkerCount <= 0 {
@@ -150,27 +561,494 @@ func validateConfig(config *Config) error {
 		return fmt.Errorf("队列大小必须大于0")
 	}
 
-	// 验证监控地址格式
+	if config.Monitor.QueueFullPolicy != "block" && config.Monitor.QueueFullPolicy != "drop_oldest" {
+		return fmt.Errorf("无效的队列满处理策略: %s", config.Monitor.QueueFullPolicy)
+	}
+
+	// BRPOP的超时精度为秒
+	if config.Monitor.IdlePollInterval < time.Second {
+		return fmt.Errorf("空闲轮询间隔不能小于1秒")
+	}
+
+	if config.Monitor.ErrorBackoff <= 0 {
+		return fmt.Errorf("错误退避时间必须大于0")
+	}
+
+	if config.Monitor.MaxWorkerRestarts < 0 {
+		return fmt.Errorf("工作线程最大重启次数不能为负数")
+	}
+
+	if config.Monitor.CatchUpThreshold < 0 {
+		return fmt.Errorf("追赶模式阈值不能为负数")
+	}
+
+	if config.Monitor.ThroughputWindow < 0 || config.Monitor.ThroughputCap < 0 {
+		return fmt.Errorf("转账量窗口和上限不能为负数")
+	}
+
+	if config.Monitor.ThroughputWindow > 0 && config.Monitor.ThroughputK <= 0 {
+		return fmt.Errorf("转账量告警的k值必须大于0")
+	}
+
+	if config.Monitor.WarmupLookback < 0 {
+		return fmt.Errorf("预热补齐区块数不能为负数")
+	}
+
+	// 未启用追赶模式时每轮最多补齐10个缺失区块，超出部分会被跳过
+	if config.Monitor.CatchUpThreshold == 0 && config.Monitor.WarmupLookback > 10 {
+		return fmt.Errorf("预热补齐区块数超过10时需要启用追赶模式（catchup_threshold）")
+	}
+
+	if config.Monitor.CatchUpThreshold > 0 && config.Monitor.CatchUpBatch <= 0 {
+		return fmt.Errorf("追赶模式每轮区块数必须大于0")
+	}
+
+	if config.Monitor.ReorderWindow <= 0 {
+		return fmt.Errorf("乱序等待窗口必须大于0")
+	}
+
+	if config.Monitor.MaxTransfersPerBlock < 0 {
+		return fmt.Errorf("单个区块最大转账数不能为负数")
+	}
+
+	if config.Monitor.TRC20DecodeMode != "calldata" && config.Monitor.TRC20DecodeMode != "logs" {
+		return fmt.Errorf("无效的TRC20解码方式: %s", config.Monitor.TRC20DecodeMode)
+	}
+
+	if config.Monitor.BalanceSnapshot && config.Monitor.BalanceCacheTTL <= 0 {
+		return fmt.Errorf("余额缓存时间必须大于0")
+	}
+
+	if config.Monitor.MaxBackfillSpan < 0 {
+		return fmt.Errorf("最大补齐区块数不能为负数")
+	}
+
+	if config.Monitor.EmptyWatchMode != "warn" && config.Monitor.EmptyWatchMode != "sample" {
+		return fmt.Errorf("无效的空监控地址处理方式: %s", config.Monitor.EmptyWatchMode)
+	}
+
+	if config.Monitor.SampleRate <= 0 {
+		return fmt.Errorf("抽样比例必须大于0")
+	}
+
+	if config.Monitor.SaveWorkers < 0 {
+		return fmt.Errorf("保存线程数不能为负数")
+	}
+
+	if config.Monitor.SaveWorkers > 0 && config.Monitor.SaveQueueSize <= 0 {
+		return fmt.Errorf("保存队列大小必须大于0")
+	}
+
+	if config.Monitor.WatchOnlyPrefilter {
+		// 日志中的Transfer事件和全链大额转账都可能不出现在调用参数里，预检会漏掉
+		if config.Monitor.TRC20DecodeMode == "logs" {
+			return fmt.Errorf("watch_only_prefilter不能与logs解码方式同时使用")
+		}
+		if config.USDT.WhaleThresholdUSD > 0 {
+			return fmt.Errorf("watch_only_prefilter不能与全链大额转账监控（usdt.whale_threshold_usd）同时使用")
+		}
+	}
+
+	if config.Redis.TokenListSize < 0 {
+		return fmt.Errorf("代币转账列表保留条数不能为负数")
+	}
+	for token, size := range config.Redis.TokenListSizes {
+		if size < 0 {
+			return fmt.Errorf("代币 %s 的转账列表保留条数不能为负数", token)
+		}
+	}
+
+	if config.Monitor.Mode != "queue" && config.Monitor.Mode != "direct" {
+		return fmt.Errorf("无效的运行模式: %s", config.Monitor.Mode)
+	}
+
+	switch config.Monitor.BlockSource {
+	case "polling":
+	case "stream":
+		if config.Monitor.StreamURL == "" {
+			return fmt.Errorf("区块来源为stream时必须配置事件流地址")
+		}
+		if config.Monitor.FollowSolidified {
+			return fmt.Errorf("事件流推送的是最新区块，不能与follow_solidified同时使用")
+		}
+		if config.Monitor.StreamReconnectDelay <= 0 || config.Monitor.StreamStaleAfter <= 0 {
+			return fmt.Errorf("事件流重连间隔和过期时间必须大于0")
+		}
+	default:
+		return fmt.Errorf("无效的区块来源: %s", config.Monitor.BlockSource)
+	}
+
+	if config.Monitor.HistoricalChunkSize <= 0 {
+		return fmt.Errorf("历史区块分块大小必须大于0")
+	}
+
+	if config.Monitor.HistoricalWorkers <= 0 {
+		return fmt.Errorf("历史区块并发协程数必须大于0")
+	}
+
+	if config.Monitor.RecordDecodeFailures && (config.Monitor.DecodeFailureMaxData <= 0 || config.Monitor.DecodeFailureMaxRecords <= 0) {
+		return fmt.Errorf("记录解码失败时必须设置大于0的原始数据长度和记录数")
+	}
+
+	if config.Monitor.MaxBlockAttempts <= 0 {
+		return fmt.Errorf("区块最多处理次数必须大于0")
+	}
+
+	ownerGroupOf := make(map[string]string)
+	for group, addresses := range config.Monitor.OwnerGroups {
+		for i, addr := range addresses {
+			// 与监控地址相同的校验和规范化，否则大小写错误或十六进制的地址永远不会匹配
+			addr, err := tronaddr.NormalizeWatchAddress(addr, config.Monitor.NormalizeHexWatch)
+			if err != nil {
+				return fmt.Errorf("所有者分组 %s 中的地址无效: %w", group, err)
+			}
+			addresses[i] = addr
+			if other, ok := ownerGroupOf[addr]; ok && other != group {
+				return fmt.Errorf("地址 %s 同时属于所有者分组 %s 和 %s", addr, other, group)
+			}
+			ownerGroupOf[addr] = group
+		}
+	}
+
+	if config.Monitor.RetainRaw && (config.Monitor.RawTTL <= 0 || config.Monitor.RawMaxBytes <= 0) {
+		return fmt.Errorf("保留原始交易时必须设置大于0的保留时间和最大字节数")
+	}
+
+	if config.Labels.Enabled && config.Labels.ReloadInterval <= 0 {
+		return fmt.Errorf("标签热加载间隔必须大于0")
+	}
+
+	// 合约地址统一为base58，与解码出的合约地址直接比较
+	usdtContract, err := tronaddr.Normalize(config.USDT.ContractAddress)
+	if err != nil {
+		return fmt.Errorf("无效的USDT合约地址: %w", err)
+	}
+	config.USDT.ContractAddress = usdtContract
+
+	if config.USDT.UseLivePrice && config.Pricing.BaseURL == "" {
+		return fmt.Errorf("启用实时USDT价格时价格接口地址不能为空")
+	}
+
+	if config.USDT.WhaleThresholdUSD < 0 {
+		return fmt.Errorf("大额转账阈值不能为负数")
+	}
+
+	if config.USDT.UseHistoricalPrice && !config.USDT.UseLivePrice {
+		return fmt.Errorf("启用历史价格需要同时启用usdt.use_live_price")
+	}
+
+	if config.Notify.Enabled && config.Notify.WebhookURL == "" && len(config.Notify.WebhookURLs) == 0 {
+		return fmt.Errorf("启用通知时Webhook地址不能为空")
+	}
+
+	for _, url := range config.Notify.WebhookURLs {
+		if url == "" {
+			return fmt.Errorf("webhook_urls中不能有空地址")
+		}
+	}
+
+	if config.Notify.PerAddressRate < 0 {
+		return fmt.Errorf("每地址通知速率不能为负数")
+	}
+
+	if config.Notify.BufferSize <= 0 {
+		return fmt.Errorf("通知队列大小必须大于0")
+	}
+
+	switch config.Notify.OverflowPolicy {
+	case "block":
+		// 阻塞入队会让一个慢Webhook拖住所有渠道和区块处理，不再支持
+		log.Printf("警告: notify.overflow_policy: block 已废弃，通知入队不再阻塞，按 drop_oldest 处理")
+		config.Notify.OverflowPolicy = "drop_oldest"
+	case "drop_oldest", "drop_newest":
+	default:
+		return fmt.Errorf("无效的通知队列溢出策略: %s", config.Notify.OverflowPolicy)
+	}
+
+	if config.Display.TRXPrecision < 0 || config.Display.TRXPrecision > 6 {
+		return fmt.Errorf("TRX显示精度必须在0到6之间")
+	}
+
+	if config.Stats.SnapshotInterval < 0 {
+		return fmt.Errorf("统计快照间隔不能为负数")
+	}
+
+	if config.Stats.SnapshotInterval > 0 && config.Stats.HistoryRetention < config.Stats.SnapshotInterval {
+		return fmt.Errorf("统计历史保留时长不能小于快照间隔")
+	}
+
+	if config.Stats.SaveInterval <= 0 {
+		return fmt.Errorf("系统统计保存间隔必须大于0")
+	}
+
+	if config.Stats.MaxStatusAge < 0 {
+		return fmt.Errorf("系统统计最大时效不能为负数")
+	}
+
+	if config.FileSink.Enabled {
+		if config.FileSink.Path == "" {
+			return fmt.Errorf("启用文件输出时file_sink.path不能为空")
+		}
+		if config.FileSink.MaxBytes < 0 || config.FileSink.MaxAge < 0 {
+			return fmt.Errorf("文件输出的轮转大小和时长不能为负数")
+		}
+		switch config.FileSink.Fsync {
+		case "always", "never":
+		case "interval":
+			if config.FileSink.FsyncInterval <= 0 {
+				return fmt.Errorf("file_sink.fsync为interval时fsync_interval必须大于0")
+			}
+		default:
+			return fmt.Errorf("无效的file_sink.fsync: %s（可选 always、interval、never）", config.FileSink.Fsync)
+		}
+		if config.FileSink.QueueSize <= 0 {
+			return fmt.Errorf("文件输出队列大小必须大于0")
+		}
+	}
+
+	if config.SQLStore.Enabled && config.SQLStore.Path == "" {
+		return fmt.Errorf("启用SQL转账存储时sql_store.path不能为空")
+	}
+	if config.SQLStore.VerifySampleRate < 0 {
+		return fmt.Errorf("sql_store.verify_sample_rate不能为负数")
+	}
+	if config.SQLStore.VerifySampleRate > 0 && config.SQLStore.VerifyQueueSize <= 0 {
+		return fmt.Errorf("启用双写校验时sql_store.verify_queue_size必须大于0")
+	}
+
+	if config.Startup.RequireHealthy && (config.Startup.HealthTimeout <= 0 || config.Startup.HealthBackoff <= 0) {
+		return fmt.Errorf("启用startup.require_healthy时健康检查超时和重试间隔必须大于0")
+	}
+
+	if config.Stats.MaxMetricAddresses < 0 {
+		return fmt.Errorf("按地址指标的地址数上限不能为负数")
+	}
+
+	for i, bound := range config.Stats.AmountBuckets {
+		if i > 0 && bound <= config.Stats.AmountBuckets[i-1] {
+			return fmt.Errorf("金额分布的桶上界必须严格递增")
+		}
+	}
+
+	if config.Notify.MinConfirmations < 0 {
+		return fmt.Errorf("通知所需确认数不能为负数")
+	}
+
+	if config.Notify.ConfirmationsSource != "cursor" && config.Notify.ConfirmationsSource != "solidified" {
+		return fmt.Errorf("无效的确认数计算依据: %s", config.Notify.ConfirmationsSource)
+	}
+
+	if config.Notify.RevertReorged && (!config.Notify.Enabled || config.Notify.MinConfirmations == 0) {
+		return fmt.Errorf("撤销重组转账需要启用通知并设置min_confirmations")
+	}
+
+	for _, spec := range config.Notify.QuietHours {
+		if _, _, err := ParseQuietWindow(spec); err != nil {
+			return err
+		}
+	}
+	if _, err := time.LoadLocation(config.Notify.QuietTimezone); err != nil {
+		return fmt.Errorf("无效的静默时段时区 %s: %w", config.Notify.QuietTimezone, err)
+	}
+	if config.Notify.QuietMode != "suppress" && config.Notify.QuietMode != "digest" {
+		return fmt.Errorf("无效的静默时段处理方式: %s", config.Notify.QuietMode)
+	}
+
+	if config.Server.RawParamMaxBytes <= 0 || config.Server.RawParamMaxEntries <= 0 {
+		return fmt.Errorf("合约原始参数的大小限制必须大于0")
+	}
+
+	if _, err := models.ParseTransferFields(config.Server.TransferFields); err != nil {
+		return err
+	}
+
+	if config.Server.LogBufferSize < 0 {
+		return fmt.Errorf("日志缓冲区大小不能为负数")
+	}
+
+	if config.Server.MaxStreamReplay < 0 {
+		return fmt.Errorf("流式补发最大条数不能为负数")
+	}
+
+	if config.Server.MaxBlockRange <= 0 {
+		return fmt.Errorf("区块范围查询最大跨度必须大于0")
+	}
+
+	if config.Server.RequestTimeout < 0 {
+		return fmt.Errorf("请求超时不能为负数")
+	}
+
+	if config.Server.MaxBodyBytes <= 0 {
+		return fmt.Errorf("请求体最大字节数必须大于0")
+	}
+
+	// 路径前缀需以/开头且不以/结尾
+	if config.Server.BasePath != "" && (!strings.HasPrefix(config.Server.BasePath, "/") || strings.HasSuffix(config.Server.BasePath, "/")) {
+		return fmt.Errorf("无效的API路径前缀: %s", config.Server.BasePath)
+	}
+
+	// 验证自定义合约事件，同一合约的同一事件只保留第一条配置，避免重复保存
+	contractEvents := config.ContractEvents[:0]
+	seenContractEvents := make(map[string]int)
+	for i := range config.ContractEvents {
+		event := config.ContractEvents[i]
+		if err := validateContractEvent(&event); err != nil {
+			return fmt.Errorf("自定义合约事件配置无效 (索引: %d): %w", i, err)
+		}
+		key := event.Contract + ":" + event.Topic
+		if first, ok := seenContractEvents[key]; ok {
+			log.Printf("警告: 自定义合约事件配置 (索引: %d) 与索引 %d 重复（合约 %s，topic %s），已忽略", i, first, event.Contract, event.Topic)
+			continue
+		}
+		seenContractEvents[key] = i
+		contractEvents = append(contractEvents, event)
+	}
+	config.ContractEvents = contractEvents
+
+	// 验证监控地址格式，base58区分大小写，大小写错误的地址永远不会匹配
 	for i, addr := range config.WatchAddresses {
-		if !isValidTronAddress(addr) {
-			return fmt.Errorf("无效的Tron地址格式: %s (索引: %d)", addr, i)
+		normalized, err := tronaddr.NormalizeWatchAddress(addr, config.Monitor.NormalizeHexWatch)
+		if err != nil {
+			return fmt.Errorf("无效的监控地址 (索引: %d): %w", i, err)
+		}
+		config.WatchAddresses[i] = normalized
+	}
+
+	names := make(map[string]bool)
+	dbs := make(map[int]string)
+	for i := range config.Networks {
+		network := &config.Networks[i]
+		if network.Name == "" || strings.ContainsAny(network.Name, "/ ") {
+			return fmt.Errorf("网络名称不能为空且不能包含空格或斜杠 (索引: %d)", i)
+		}
+		if names[network.Name] {
+			return fmt.Errorf("网络名称重复: %s", network.Name)
+		}
+		names[network.Name] = true
+		if other, ok := dbs[network.RedisDB]; ok {
+			return fmt.Errorf("网络 %s 与 %s 使用了相同的Redis数据库 %d", network.Name, other, network.RedisDB)
+		}
+		dbs[network.RedisDB] = network.Name
+		if network.StartBlockHeight < 0 {
+			return fmt.Errorf("网络 %s 的起始区块高度不能为负数", network.Name)
+		}
+		if network.USDTContract != "" {
+			usdtContract, err := tronaddr.Normalize(network.USDTContract)
+			if err != nil {
+				return fmt.Errorf("网络 %s 的USDT合约地址无效: %w", network.Name, err)
+			}
+			network.USDTContract = usdtContract
+		}
+		for j, addr := range network.WatchAddresses {
+			normalized, err := tronaddr.NormalizeWatchAddress(addr, config.Monitor.NormalizeHexWatch)
+			if err != nil {
+				return fmt.Errorf("网络 %s 的监控地址无效 (索引: %d): %w", network.Name, j, err)
+			}
+			network.WatchAddresses[j] = normalized
 		}
 	}
 
 	return nil
 }
 
-// isValidTronAddress 验证Tron地址格式
-func isValidTronAddress(address string) bool {
-	// Tron地址格式验证
-	// 地址长度应该是34个字符，以T开头
-	if len(address) != 34 || !strings.HasPrefix(address, "T") {
-		return false
+// minBlockInterval 区块查询间隔的下限，防止误配置对节点造成过大压力
+const minBlockInterval = 100 * time.Millisecond
+
+// ForNetwork 返回指定网络的配置：复制全局配置并按网络配置覆盖，
+// Redis发布订阅频道和转账输出文件以网络名称为命名空间
+func (c *Config) ForNetwork(network NetworkConfig) *Config {
+	cfg := *c
+	cfg.Networks = nil
+	cfg.WatchAddresses = append([]string(nil), c.WatchAddresses...)
+	if network.BaseURL != "" {
+		cfg.TronGrid.BaseURL = network.BaseURL
+	}
+	if network.APIKey != "" {
+		cfg.TronGrid.APIKey = network.APIKey
 	}
+	cfg.Redis.DB = network.RedisDB
+	cfg.Redis.Namespace = network.Name
+	cfg.Network = network.Name
+	cfg.FileSink.Path = networkFilePath(c.FileSink.Path, network.Name)
+	cfg.SQLStore.Path = networkFilePath(c.SQLStore.Path, network.Name)
+	if network.StartBlockHeight > 0 {
+		cfg.Monitor.StartBlockHeight = network.StartBlockHeight
+	}
+	if network.USDTContract != "" {
+		cfg.USDT.ContractAddress = network.USDTContract
+	}
+	if len(network.WatchAddresses) > 0 {
+		cfg.WatchAddresses = append([]string(nil), network.WatchAddresses...)
+	}
+	return &cfg
+}
 
-	// 这里可以添加更详细的地址格式验证
-	// 目前只做基本的长度和前缀检查
-	return true
+// networkFilePath 在文件名的扩展名前插入网络名称，如 transfers.jsonl -> transfers.nile.jsonl
+func networkFilePath(path, network string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + network + ext
+}
+
+// validateContractEvent 验证并规范化自定义合约事件配置
+func validateContractEvent(event *ContractEventConfig) error {
+	contract, err := tronaddr.NormalizeWatchAddress(event.Contract, true)
+	if err != nil {
+		return fmt.Errorf("无效的合约地址: %w", err)
+	}
+	event.Contract = contract
+
+	// 事件签名规范化后（去掉空格）计算topic，与配置的topic核对
+	event.EventSignature = strings.ReplaceAll(event.EventSignature, " ", "")
+	event.Topic = strings.ToLower(strings.TrimPrefix(event.Topic, "0x"))
+	if event.EventSignature != "" {
+		topic := hex.EncodeToString(tronaddr.Keccak256([]byte(event.EventSignature)))
+		if event.Topic == "" {
+			event.Topic = topic
+		} else if event.Topic != topic {
+			return fmt.Errorf("事件topic %s 与事件签名 %s 的哈希 %s 不一致", event.Topic, event.EventSignature, topic)
+		}
+	}
+	if len(event.Topic) != 64 {
+		return fmt.Errorf("事件topic必须是32字节的十六进制哈希: %s", event.Topic)
+	}
+	if _, err := hex.DecodeString(event.Topic); err != nil {
+		return fmt.Errorf("事件topic不是有效的十六进制: %s", event.Topic)
+	}
+
+	for field, source := range event.FieldMappings {
+		parts := strings.SplitN(source, ":", 2)
+		if len(parts) != 2 || (!strings.HasPrefix(parts[0], "topic") && !strings.HasPrefix(parts[0], "data")) {
+			return fmt.Errorf("字段 %s 的来源格式无效: %s（应为 topicN:类型 或 dataN:类型）", field, source)
+		}
+		switch parts[1] {
+		case "address", "uint256", "bytes32", "bool":
+		default:
+			return fmt.Errorf("字段 %s 的类型不支持: %s", field, parts[1])
+		}
+	}
+
+	return nil
+}
+
+// ParseQuietWindow 解析 "HH:MM-HH:MM" 格式的静默时段
+func ParseQuietWindow(spec string) (start, end int, err error) {
+	parts := strings.Split(spec, "-")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("静默时段格式应为 HH:MM-HH:MM: %s", spec)
+	}
+
+	minutes := make([]int, 2)
+	for i, part := range parts {
+		t, err := time.Parse("15:04", strings.TrimSpace(part))
+		if err != nil {
+			return 0, 0, fmt.Errorf("解析静默时段 %s 失败: %w", spec, err)
+		}
+		minutes[i] = t.Hour()*60 + t.Minute()
+	}
+	if minutes[0] == minutes[1] {
+		return 0, 0, fmt.Errorf("静默时段起止时间不能相同: %s", spec)
+	}
+	return minutes[0], minutes[1], nil
 }
 
 // GetWatchAddressesSet 获取监控地址集合
@@ -184,8 +1062,9 @@ func (c *Config) GetWatchAddressesSet() map[string]bool {
 
 // AddWatchAddress 添加监控地址
 func (c *Config) AddWatchAddress(address string) error {
-	if !isValidTronAddress(address) {
-		return fmt.Errorf("无效的Tron地址格式: %s", address)
+	address, err := tronaddr.NormalizeWatchAddress(address, c.Monitor.NormalizeHexWatch)
+	if err != nil {
+		return err
 	}
 
 	// 检查是否已存在
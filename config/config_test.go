@@ -0,0 +1,144 @@
+package config
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tron-monitor/tronaddr"
+)
+
+const testWatchAddr = "TJRabPrwbZy45sbavfcjinPJC18kjpRTv8"
+
+// loadYAML 从临时文件加载配置
+func loadYAML(t *testing.T, yaml string) (*Config, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return LoadConfig(path)
+}
+
+func TestValidateContractEventTopic(t *testing.T) {
+	const usdt = "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t"
+
+	event := ContractEventConfig{Contract: usdt, EventSignature: "Approval(address, address, uint256)"}
+	if err := validateContractEvent(&event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Topic != "8c5be1e5ebec7d5bd14f71427d1e84f3dd0314c0f7b2291e5b200ac8c7c3b925" {
+		t.Errorf("topic应由事件签名计算，实际 %s", event.Topic)
+	}
+
+	mismatch := ContractEventConfig{
+		Contract:       usdt,
+		EventSignature: "Approval(address,address,uint256)",
+		Topic:          "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef",
+	}
+	if err := validateContractEvent(&mismatch); err == nil || !strings.Contains(err.Error(), "不一致") {
+		t.Errorf("topic与事件签名不一致时应返回错误，实际 %v", err)
+	}
+}
+
+func TestValidateContractEventAddress(t *testing.T) {
+	// 校验和错误（最后一位被改写）
+	bad := ContractEventConfig{Contract: "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6u", Topic: "8c5be1e5ebec7d5bd14f71427d1e84f3dd0314c0f7b2291e5b200ac8c7c3b925"}
+	if err := validateContractEvent(&bad); err == nil {
+		t.Error("校验和错误的合约地址应返回错误")
+	}
+
+	hexAddr, err := tronaddr.Base58ToHex("TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := ContractEventConfig{Contract: hexAddr, Topic: "8c5be1e5ebec7d5bd14f71427d1e84f3dd0314c0f7b2291e5b200ac8c7c3b925"}
+	if err := validateContractEvent(&event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Contract != "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t" {
+		t.Errorf("十六进制合约地址应规范化为base58，实际 %s", event.Contract)
+	}
+}
+
+func TestOwnerGroupsValidateAddresses(t *testing.T) {
+	hexAddr, err := tronaddr.Base58ToHex(testWatchAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadYAML(t, "monitor:\n  owner_groups:\n    exchange:\n      - \""+hexAddr+"\"\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Monitor.OwnerGroups["exchange"]; len(got) != 1 || got[0] != testWatchAddr {
+		t.Errorf("十六进制地址应规范化为base58: %v", got)
+	}
+
+	for _, addr := range []string{strings.ToLower(testWatchAddr), "TQn9Y2khDD95J42FQtQTdwVVRKqKqQK9Kq"} {
+		if _, err := loadYAML(t, "monitor:\n  owner_groups:\n    exchange:\n      - \""+addr+"\"\n"); err == nil {
+			t.Errorf("所有者分组中的无效地址 %s 应导致加载失败", addr)
+		}
+	}
+}
+
+func TestUSDTContractAddressNormalized(t *testing.T) {
+	const usdt = "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t"
+	usdtHex, err := tronaddr.Base58ToHex(usdt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, input := range []string{usdt, usdtHex, strings.ToUpper(usdtHex), "0x" + usdtHex[2:]} {
+		cfg, err := loadYAML(t, "watch_addresses:\n  - \""+testWatchAddr+"\"\nusdt:\n  contract_address: \""+input+"\"\n")
+		if err != nil {
+			t.Fatalf("%s: %v", input, err)
+		}
+		if cfg.USDT.ContractAddress != usdt {
+			t.Errorf("%s 应规范化为 %s，实际 %s", input, usdt, cfg.USDT.ContractAddress)
+		}
+	}
+
+	if _, err := loadYAML(t, "watch_addresses:\n  - \""+testWatchAddr+"\"\nusdt:\n  contract_address: \"41abc\"\n"); err == nil || !strings.Contains(err.Error(), "USDT合约地址") {
+		t.Errorf("无效的USDT合约地址应报错，实际 %v", err)
+	}
+}
+
+// 区块查询间隔低于1秒时警告但允许启动，低于下限时拒绝
+func TestBlockIntervalFloor(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	for _, tc := range []struct {
+		interval string
+		warn     bool
+		reject   bool
+	}{
+		{"3s", false, false},
+		{"1s", false, false},
+		{"500ms", true, false},
+		{"100ms", true, false},
+		{"50ms", false, true},
+	} {
+		logs.Reset()
+		cfg, err := loadYAML(t, "monitor:\n  block_interval: "+tc.interval+"\n")
+		if tc.reject {
+			if err == nil || !strings.Contains(err.Error(), "区块查询间隔不能小于") {
+				t.Errorf("%s: 低于下限应拒绝启动，实际 %v", tc.interval, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tc.interval, err)
+		}
+		if cfg.Monitor.BlockInterval.String() != tc.interval {
+			t.Errorf("block_interval=%v，期望 %s", cfg.Monitor.BlockInterval, tc.interval)
+		}
+		if warned := strings.Contains(logs.String(), "小于1秒"); warned != tc.warn {
+			t.Errorf("%s: warned=%v，期望 %v", tc.interval, warned, tc.warn)
+		}
+	}
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/mux"
+
+	"tron-monitor/models"
+	"tron-monitor/tronaddr"
+)
+
+// 接口返回的TRX转账交易，地址为41前缀的十六进制
+const testTxHash = "a1b2c3d4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8f90"
+
+var testTxJSON = `{"txID":"` + testTxHash + `","ret":[{"contractRet":"SUCCESS"}],"raw_data":{"contract":[{"type":"TransferContract","parameter":{"type_url":"type.googleapis.com/protocol.TransferContract","value":{"amount":12345678901234567,"owner_address":"41d1e7a6bc354106cb410e65ff8b181c600ff14292","to_address":"415a523b449890854c8fc460ab602df9f31fe4293f"}}}],"timestamp":1700000000000}}`
+
+// newDecodeTestServer 启动只注册API路由的服务器，TronGrid接口由fake提供
+func newDecodeTestServer(t *testing.T) *httptest.Server {
+	api, _ := newAPITestServer(t, testTxJSON)
+	return api
+}
+
+// newAPITestServer 与newDecodeTestServer相同，fake接口返回txJSON（哈希为testTxHash），同时返回流水线以便读写Redis
+func newAPITestServer(t *testing.T, txJSON string) (*httptest.Server, *pipeline) {
+	t.Helper()
+	tronGrid := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/wallet/gettransactionbyid":
+			fmt.Fprint(w, txJSON)
+		case "/wallet/gettransactioninfobyid":
+			fmt.Fprintf(w, `{"id":"%s","blockNumber":100,"blockTimeStamp":1700000000000}`, testTxHash)
+		case "/wallet/getblockbynum":
+			fmt.Fprintf(w, `{"blockID":"00","block_header":{"raw_data":{"number":100,"timestamp":1700000000000}},"transactions":[%s]}`, txJSON)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(tronGrid.Close)
+	server := miniredis.RunT(t)
+
+	cfg := loadTestConfig(t, t.TempDir(), fmt.Sprintf(`trongrid:
+  base_url: %q
+  retry_max: 0
+redis:
+  addr: %q
+watch_addresses:
+  - "TJRabPrwbZy45sbavfcjinPJC18kjpRTv8"
+`, tronGrid.URL, server.Addr()))
+	p, err := newPipeline("", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.redisClient.Close() })
+
+	router := mux.NewRouter()
+	registerRoutes(router, p, &streamLimiter{})
+	api := httptest.NewServer(router)
+	t.Cleanup(api.Close)
+	return api, p
+}
+
+func TestDecodeEndpointsRawParameters(t *testing.T) {
+	api := newDecodeTestServer(t)
+
+	for _, path := range []string{"/tx/" + testTxHash + "?raw=true&all=true", "/blocks/100/transfers?raw=true"} {
+		resp, err := http.Get(api.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var result struct {
+			Transfers     []map[string]interface{} `json:"transfers"`
+			RawParameters []struct {
+				TxHash    string          `json:"tx_hash"`
+				Type      string          `json:"type"`
+				Parameter json.RawMessage `json:"parameter"`
+			} `json:"raw_parameters"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: 状态码 %d，错误 %v", path, resp.StatusCode, err)
+		}
+
+		if len(result.RawParameters) != 1 || result.RawParameters[0].TxHash != testTxHash || result.RawParameters[0].Type != "TransferContract" {
+			t.Fatalf("%s: raw_parameters不符: %+v", path, result.RawParameters)
+		}
+		// 原始参数保持接口返回的十六进制地址和整数金额，不受地址规范化影响
+		raw := string(result.RawParameters[0].Parameter)
+		for _, want := range []string{`"owner_address":"41d1e7a6bc354106cb410e65ff8b181c600ff14292"`, `"amount":12345678901234567`} {
+			if !strings.Contains(raw, want) {
+				t.Errorf("%s: 原始参数应包含 %s: %s", path, want, raw)
+			}
+		}
+	}
+
+	// 未请求raw时不返回
+	resp, err := http.Get(api.URL + "/tx/" + testTxHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var result map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := result["raw_parameters"]; ok {
+		t.Error("未请求raw时不应返回raw_parameters")
+	}
+}
+
+func TestNetFlowValidatesAddress(t *testing.T) {
+	api := newDecodeTestServer(t)
+
+	resp, err := http.Get(api.URL + "/addresses/TJRabPrwbZy45sbavfcjinPJC18kjpRTv9/netflow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("校验和错误的地址应返回400，实际 %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(api.URL + "/addresses/%20TJRabPrwbZy45sbavfcjinPJC18kjpRTv8/netflow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Address   string `json:"address"`
+		Truncated *bool  `json:"truncated"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Address != "TJRabPrwbZy45sbavfcjinPJC18kjpRTv8" || result.Truncated == nil || *result.Truncated {
+		t.Errorf("地址应规范化并返回truncated=false: %+v", result)
+	}
+}
+
+func TestTxEndpointDecodesUSDTTransfer(t *testing.T) {
+	owner, err := tronaddr.Base58ToHex("TUpMhErZL2fhh4sVNULAbNKLokS4GjC1F4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	contract, err := tronaddr.Base58ToHex("TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	to, err := tronaddr.Base58ToHex("TJRabPrwbZy45sbavfcjinPJC18kjpRTv8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := "a9059cbb" + strings.Repeat("0", 24) + to[2:] + fmt.Sprintf("%064x", 12_340_000)
+	txJSON := `{"txID":"` + testTxHash + `","ret":[{"contractRet":"SUCCESS"}],"raw_data":{"contract":[{"type":"TriggerSmartContract","parameter":{"type_url":"type.googleapis.com/protocol.TriggerSmartContract","value":{"owner_address":"` + owner + `","contract_address":"` + contract + `","data":"` + data + `"}}}],"timestamp":1700000000000}}`
+	api, p := newAPITestServer(t, txJSON)
+	if err := p.redisClient.AddWatchAddress(context.Background(), models.WatchAddress{Address: "TJRabPrwbZy45sbavfcjinPJC18kjpRTv8"}); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Get(api.URL + "/tx/" + testTxHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var result struct {
+		BlockHeight   int64                   `json:"block_height"`
+		ContractTypes []string                `json:"contract_types"`
+		Transfers     []*models.TransferEvent `json:"transfers"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("状态码 %d，错误 %v", resp.StatusCode, err)
+	}
+	if result.BlockHeight != 100 || len(result.ContractTypes) != 1 || result.ContractTypes[0] != "TriggerSmartContract" {
+		t.Errorf("区块高度或合约类型不正确: %+v", result)
+	}
+	if len(result.Transfers) != 1 {
+		t.Fatalf("应解码出1笔转账，实际 %d 笔", len(result.Transfers))
+	}
+	transfer := result.Transfers[0]
+	if !transfer.IsUSDT || transfer.Destination != "TJRabPrwbZy45sbavfcjinPJC18kjpRTv8" || transfer.AmountDecimal != "12.34" {
+		t.Errorf("USDT转账解码不正确: %+v", transfer)
+	}
+
+	// 按需解码不写入存储
+	stored, err := p.redisClient.GetRecentTransfers(context.Background(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 0 {
+		t.Errorf("按需解码不应保存转账: %+v", stored)
+	}
+}
+
+func TestTransfersFieldsProjection(t *testing.T) {
+	api, p := newAPITestServer(t, testTxJSON)
+	ctx := context.Background()
+	for i := int64(1); i <= 2; i++ {
+		event := &models.TransferEvent{TxHash: fmt.Sprintf("%064x", i), BlockHeight: 100 + i, Source: "TUpMhErZL2fhh4sVNULAbNKLokS4GjC1F4", Destination: "TJRabPrwbZy45sbavfcjinPJC18kjpRTv8", Amount: float64(i), TokenType: "TRX"}
+		if err := p.redisClient.SaveTransferEvent(ctx, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, path := range []string{"/transfers?fields=tx_hash,amount", "/transfers?fields=tx_hash,%20amount&from_block=100&to_block=110"} {
+		resp, err := http.Get(api.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var items []map[string]interface{}
+		err = json.NewDecoder(resp.Body).Decode(&items)
+		resp.Body.Close()
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: 状态码 %d，错误 %v", path, resp.StatusCode, err)
+		}
+		if len(items) != 2 {
+			t.Fatalf("%s: 应返回2笔转账，实际 %d 笔", path, len(items))
+		}
+		for _, item := range items {
+			if _, ok := item["tx_hash"]; !ok || item["amount"] == nil || len(item) != 2 {
+				t.Errorf("%s: 只应返回tx_hash和amount: %v", path, item)
+			}
+		}
+	}
+
+	resp, err := http.Get(api.URL + "/transfers?fields=tx_hash,nope")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("未知字段应返回400，实际 %d", resp.StatusCode)
+	}
+}
+
+func TestNetFlowMixedTransfers(t *testing.T) {
+	const watch, other = "TJRabPrwbZy45sbavfcjinPJC18kjpRTv8", "TUpMhErZL2fhh4sVNULAbNKLokS4GjC1F4"
+	api, p := newAPITestServer(t, testTxJSON)
+	ctx := context.Background()
+	events := []*models.TransferEvent{
+		{Source: other, Destination: watch, Amount: 10, TokenType: "TRX", BlockHeight: 100},
+		{Source: watch, Destination: other, Amount: 3, TokenType: "TRX", BlockHeight: 101},
+		{Source: other, Destination: watch, Amount: 100, TokenType: "USDT", IsUSDT: true, BlockHeight: 102},
+		{Source: watch, Destination: watch, Amount: 50, TokenType: "USDT", IsUSDT: true, BlockHeight: 103}, // 自转账
+		{Source: other, Destination: "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t", Amount: 7, TokenType: "TRX", BlockHeight: 104},
+		{Source: other, Destination: watch, Amount: 1000, TokenType: "TRX", BlockHeight: 200}, // 范围外
+	}
+	for i, event := range events {
+		event.TxHash = fmt.Sprintf("%064x", i+1)
+		event.Timestamp = 1700000000000 + event.BlockHeight*3000
+		if err := p.redisClient.SaveTransferEvent(ctx, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	get := func(query string) map[string]*models.TokenNetFlow {
+		t.Helper()
+		resp, err := http.Get(api.URL + "/addresses/" + watch + "/netflow?" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var result struct {
+			Tokens map[string]*models.TokenNetFlow `json:"tokens"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: 状态码 %d，错误 %v", query, resp.StatusCode, err)
+		}
+		return result.Tokens
+	}
+
+	// 区块窗口和对应的时间窗口结果相同
+	for _, query := range []string{"from_block=100&to_block=110", "from=1700000300&to=1700000330"} {
+		tokens := get(query)
+		trx, usdt := tokens["TRX"], tokens["USDT"]
+		if len(tokens) != 2 || trx == nil || usdt == nil {
+			t.Fatalf("%s: 应返回TRX和USDT的净流量: %v", query, tokens)
+		}
+		if trx.In != 10 || trx.Out != 3 || trx.Net != 7 || trx.Count != 2 {
+			t.Errorf("%s: TRX净流量不正确: %+v", query, trx)
+		}
+		if usdt.In != 150 || usdt.Out != 50 || usdt.Net != 100 || usdt.Count != 2 {
+			t.Errorf("%s: USDT净流量不正确（自转账应相抵）: %+v", query, usdt)
+		}
+	}
+
+	if tokens := get("from_block=100&to_block=110&token=USDT"); len(tokens) != 1 || tokens["USDT"] == nil {
+		t.Errorf("token=USDT时只应返回USDT: %v", tokens)
+	}
+}
+
+// 添加大小写被改写的地址时返回400并说明原因
+func TestAddWatchAddressRejectsLowercase(t *testing.T) {
+	api := newDecodeTestServer(t)
+
+	body := `{"address":"` + strings.ToLower("TJRabPrwbZy45sbavfcjinPJC18kjpRTv8") + `"}`
+	resp, err := http.Post(api.URL+"/addresses", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	message, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(string(message), "区分大小写") {
+		t.Errorf("小写地址应返回400并提示大小写问题，实际 %d: %s", resp.StatusCode, message)
+	}
+}
+
+func TestBlockTransfersEndpoint(t *testing.T) {
+	hexAddr := func(address string) string {
+		t.Helper()
+		hexAddr, err := tronaddr.Base58ToHex(address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hexAddr
+	}
+	watch, other := hexAddr("TJRabPrwbZy45sbavfcjinPJC18kjpRTv8"), hexAddr("TUpMhErZL2fhh4sVNULAbNKLokS4GjC1F4")
+	trxTx := func(id, from, to string, amount int64) string {
+		return fmt.Sprintf(`{"txID":"%064s","ret":[{"contractRet":"SUCCESS"}],"raw_data":{"contract":[{"type":"TransferContract","parameter":{"value":{"amount":%d,"owner_address":"%s","to_address":"%s"}}}]}}`, id, amount, from, to)
+	}
+	data := "a9059cbb" + strings.Repeat("0", 24) + watch[2:] + fmt.Sprintf("%064x", 12_340_000)
+	usdtTx := fmt.Sprintf(`{"txID":"%064s","ret":[{"contractRet":"SUCCESS"}],"raw_data":{"contract":[{"type":"TriggerSmartContract","parameter":{"value":{"owner_address":"%s","contract_address":"%s","data":"%s"}}}]}}`,
+		"2", other, hexAddr("TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t"), data)
+	// fake区块包含一笔TRX转入和一笔USDT转入
+	txs := trxTx("1", other, watch, 5_000_000) + "," + usdtTx
+	api, p := newAPITestServer(t, txs)
+	if err := p.redisClient.AddWatchAddress(context.Background(), models.WatchAddress{Address: "TJRabPrwbZy45sbavfcjinPJC18kjpRTv8"}); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Get(api.URL + "/blocks/100/transfers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Height    int64                   `json:"height"`
+		Transfers []*models.TransferEvent `json:"transfers"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("状态码 %d，错误 %v", resp.StatusCode, err)
+	}
+	if result.Height != 100 || len(result.Transfers) != 2 {
+		t.Fatalf("区块 %d 应解码出2笔转账，实际 %d 笔", result.Height, len(result.Transfers))
+	}
+	trx, usdt := result.Transfers[0], result.Transfers[1]
+	if trx.TokenType != "TRX" || trx.AmountSun != 5_000_000 || trx.Destination != "TJRabPrwbZy45sbavfcjinPJC18kjpRTv8" || trx.BlockHeight != 100 {
+		t.Errorf("TRX转账解码不正确: %+v", trx)
+	}
+	if !usdt.IsUSDT || usdt.AmountDecimal != "12.34" || usdt.Source != "TUpMhErZL2fhh4sVNULAbNKLokS4GjC1F4" {
+		t.Errorf("USDT转账解码不正确: %+v", usdt)
+	}
+
+	// 按需解码不写入存储
+	stored, err := p.redisClient.GetRecentTransfers(context.Background(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 0 {
+		t.Errorf("按需解码不应保存转账: %+v", stored)
+	}
+
+	resp, err = http.Get(api.URL + "/blocks/abc/transfers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("无效区块高度应返回400，实际 %d", resp.StatusCode)
+	}
+}
+
+func TestTransfersDedup(t *testing.T) {
+	api, p := newAPITestServer(t, testTxJSON)
+
+	// 区块重复处理时列表中留下的重复记录（LPUSH，最新的在前）
+	event := func(txHash string, amount float64) string {
+		data, err := json.Marshal(&models.TransferEvent{TxHash: txHash, Source: "TUpMhErZL2fhh4sVNULAbNKLokS4GjC1F4", Destination: "TJRabPrwbZy45sbavfcjinPJC18kjpRTv8", Amount: amount, TokenType: "TRX", BlockHeight: 100})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	client := redis.NewClient(&redis.Options{Addr: p.config.Redis.Addr})
+	defer client.Close()
+	if err := client.LPush(context.Background(), "transfers",
+		event("01", 1), event("02", 2), event("01", 1), event("01", 3), event("02", 2)).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(query string) []string {
+		resp, err := http.Get(api.URL + "/transfers" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var transfers []*models.TransferEvent
+		if err := json.NewDecoder(resp.Body).Decode(&transfers); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, transfer := range transfers {
+			got = append(got, fmt.Sprintf("%s/%v", transfer.TxHash, transfer.Amount))
+		}
+		return got
+	}
+
+	if got := get(""); len(got) != 5 {
+		t.Errorf("未设置dedup时应返回全部5条记录，实际 %v", got)
+	}
+	// 同一交易金额不同的记录不合并
+	if got, want := strings.Join(get("?dedup=true"), ","), "02/2,01/3,01/1"; got != want {
+		t.Errorf("dedup=true返回 %s，期望 %s", got, want)
+	}
+}
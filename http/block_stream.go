@@ -0,0 +1,88 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"tron-monitor/models"
+)
+
+// 单条区块消息的最大字节数
+const maxStreamMessageBytes = 16 * 1024 * 1024
+
+// StreamBlocks 连接区块事件流，每收到一个区块调用一次onBlock，连接断开或ctx取消时返回
+//
+// 事件流每条消息为一个与 wallet/getnowblock 响应格式相同的区块JSON，
+// 支持按行分隔的JSON（NDJSON）和SSE（data: 前缀）两种格式。
+func (c *HTTPClient) StreamBlocks(ctx context.Context, url string, onBlock func(*models.BlockData)) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("创建区块事件流请求失败: %w", err)
+	}
+	if c.config.TronGrid.APIKey != "" {
+		req.Header.Set("TRON-PRO-API-KEY", c.config.TronGrid.APIKey)
+	}
+	req.Header.Set("User-Agent", "TronMonitor/1.0")
+	req.Header.Set("Accept", "text/event-stream, application/x-ndjson")
+
+	// 事件流是长连接，不能使用带超时的客户端
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("连接区块事件流失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("连接区块事件流失败，状态码: %d", resp.StatusCode)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), maxStreamMessageBytes)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "data:") {
+			line = strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		}
+		if line == "" || !strings.HasPrefix(line, "{") {
+			continue // 空行、SSE注释或event/id等字段
+		}
+
+		var rawBlock struct {
+			BlockID      string                `json:"blockID"`
+			BlockHeader  *models.BlockHeader   `json:"block_header"`
+			Transactions []*models.Transaction `json:"transactions"`
+		}
+		if err := json.Unmarshal([]byte(line), &rawBlock); err != nil {
+			log.Printf("解析区块事件失败: %v", err)
+			continue
+		}
+		if rawBlock.BlockHeader == nil || rawBlock.BlockHeader.RawData == nil {
+			continue
+		}
+
+		blockData := &models.BlockData{
+			BlockHash: rawBlock.BlockID,
+			Height:    rawBlock.BlockHeader.RawData.Number,
+			Timestamp: normalizeBlockTimestamp(rawBlock.BlockHeader.RawData.Number, rawBlock.BlockHeader.RawData.Timestamp),
+			CreatedAt: time.Now(),
+			Block: &models.Block{
+				BlockHeader: rawBlock.BlockHeader,
+				Trans:       rawBlock.Transactions,
+			},
+		}
+		normalizeBlockAddresses(blockData.Block)
+
+		onBlock(blockData)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("读取区块事件流失败: %w", err)
+	}
+	return fmt.Errorf("区块事件流已关闭")
+}
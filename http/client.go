@@ -4,16 +4,72 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"strings"
 	"sync/atomic"
 	"time"
 
 	"tron-monitor/config"
 	"tron-monitor/models"
+	"tron-monitor/tronaddr"
 )
 
+// ErrUnexpectedResponse 响应不是JSON（如CDN或维护页面返回的HTML），按可重试错误处理
+var ErrUnexpectedResponse = errors.New("非预期的响应格式")
+
+// ErrTransactionNotFound 交易不存在（或尚未上链）
+var ErrTransactionNotFound = errors.New("交易不存在")
+
+// APIError TronGrid以状态码200返回的错误（响应体带Error或error字段），如合约校验失败
+type APIError struct {
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("TronGrid返回错误: %s", e.Message)
+}
+
+// 检查Error/error字段的响应体最大长度：TronGrid的错误响应很短，区块等正常响应较大，不做额外解析
+const maxErrorCheckBody = 4096
+
+// responseError 检查响应体顶层的Error/error字段，没有错误时返回nil
+//
+// 只解码这两个字段，其余字段由json跳过，不为每个字段分配内存。
+func responseError(body []byte) error {
+	var fields struct {
+		Upper json.RawMessage `json:"Error"`
+		Lower json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil // 不是JSON对象（如数组），交给后续解析
+	}
+
+	for _, raw := range []json.RawMessage{fields.Upper, fields.Lower} {
+		if len(raw) == 0 || string(raw) == "null" {
+			continue
+		}
+		// 错误信息通常为字符串，也可能是对象
+		var message string
+		if err := json.Unmarshal(raw, &message); err != nil {
+			message = string(raw)
+		}
+		if message == "" {
+			continue
+		}
+		return &APIError{Message: message}
+	}
+	return nil
+}
+
+// 错误信息中保留的响应体最大长度
+const maxErrorBodySnippet = 200
+
 // HTTPClient HTTP客户端
 type HTTPClient struct {
 	config     *config.Config
@@ -23,25 +79,75 @@ type HTTPClient struct {
 	retryMax   int
 	retryDelay time.Duration
 
-	// 请求统计相关字段
+	// 请求统计相关字段（统一使用atomic读写）
 	requestCount    int64
-	lastRequestTime time.Time
+	lastRequestTime int64 // UnixNano
 	errorCount      int64
 	successCount    int64
+
+	// 连接复用统计
+	connReused  int64
+	connCreated int64
+
+	// 最近请求的滑动窗口成功率，未启用时为nil
+	window *successWindow
 }
 
 // NewHTTPClient 创建HTTP客户端
 func NewHTTPClient(cfg *config.Config) *HTTPClient {
-	return &HTTPClient{
+	// 超时由每次请求的context控制，http.Client的超时只作为兜底，取所有配置中的最大值
+	clientTimeout := cfg.TronGrid.Timeout
+	for _, timeout := range cfg.TronGrid.Timeouts {
+		if timeout > clientTimeout {
+			clientTimeout = timeout
+		}
+	}
+
+	// 默认每个主机只保留2个空闲连接，工作线程并发请求同一节点时会反复新建连接
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = cfg.TronGrid.MaxIdleConnsPerHost * 2
+	transport.MaxIdleConnsPerHost = cfg.TronGrid.MaxIdleConnsPerHost
+	transport.MaxConnsPerHost = cfg.TronGrid.MaxConnsPerHost
+	transport.IdleConnTimeout = cfg.TronGrid.IdleConnTimeout
+
+	httpClient := &HTTPClient{
 		config:     cfg,
 		baseURL:    cfg.TronGrid.BaseURL,
 		timeout:    cfg.TronGrid.Timeout,
 		retryMax:   cfg.TronGrid.RetryMax,
 		retryDelay: cfg.TronGrid.RetryDelay,
 		client: &http.Client{
-			Timeout: cfg.TronGrid.Timeout,
+			Timeout:   clientTimeout,
+			Transport: transport,
 		},
 	}
+	if cfg.TronGrid.SuccessRateWindow > 0 {
+		httpClient.window = newSuccessWindow(cfg.TronGrid.SuccessRateWindow, cfg.TronGrid.SuccessRateThreshold)
+	}
+
+	return httpClient
+}
+
+// OnSuccessRateAlert 设置成功率告警回调，firing为true表示触发，false表示恢复
+//
+// 需在开始请求前设置；未启用trongrid.success_rate_window时不会回调。
+func (c *HTTPClient) OnSuccessRateAlert(fn func(firing bool, rate float64)) {
+	if c.window != nil {
+		c.window.onAlert = fn
+	}
+}
+
+// withConnTrace 在请求上下文中记录连接是否复用
+func (c *HTTPClient) withConnTrace(ctx context.Context) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				atomic.AddInt64(&c.connReused, 1)
+			} else {
+				atomic.AddInt64(&c.connCreated, 1)
+			}
+		},
+	})
 }
 
 // GetLatestBlock 获取最新区块
@@ -55,7 +161,7 @@ func (c *HTTPClient) GetLatestBlock(ctx context.Context) (*models.BlockData, err
 		Transactions []*models.Transaction `json:"transactions"`
 	}
 
-	err := c.makeRequest(ctx, "GET", url, nil, &rawResponse)
+	err := c.makeRequest(ctx, "getnowblock", "GET", url, nil, &rawResponse)
 	if err != nil {
 		return nil, fmt.Errorf("获取最新区块失败: %w", err)
 	}
@@ -69,7 +175,7 @@ func (c *HTTPClient) GetLatestBlock(ctx context.Context) (*models.BlockData, err
 	// 从区块头中获取区块高度和时间戳
 	if rawResponse.BlockHeader != nil && rawResponse.BlockHeader.RawData != nil {
 		blockData.Height = rawResponse.BlockHeader.RawData.Number
-		blockData.Timestamp = rawResponse.BlockHeader.RawData.Timestamp
+		blockData.Timestamp = normalizeBlockTimestamp(blockData.Height, rawResponse.BlockHeader.RawData.Timestamp)
 	}
 
 	// 构建 Block 结构
@@ -77,17 +183,114 @@ func (c *HTTPClient) GetLatestBlock(ctx context.Context) (*models.BlockData, err
 		BlockHeader: rawResponse.BlockHeader,
 		Trans:       rawResponse.Transactions,
 	}
+	normalizeBlockAddresses(blockData.Block)
 
 	// 更新统计信息
 	atomic.AddInt64(&c.successCount, 1)
-	atomic.StoreInt64(&c.requestCount, atomic.AddInt64(&c.requestCount, 1))
-	c.lastRequestTime = time.Now()
+	atomic.AddInt64(&c.requestCount, 1)
+	atomic.StoreInt64(&c.lastRequestTime, time.Now().UnixNano())
+
+	return blockData, nil
+}
+
+// GetSolidifiedBlock 获取最新的固化（不可逆）区块
+func (c *HTTPClient) GetSolidifiedBlock(ctx context.Context) (*models.BlockData, error) {
+	url := fmt.Sprintf("%s/walletsolidity/getnowblock", c.baseURL)
+
+	// 先解析为原始响应结构
+	var rawResponse struct {
+		BlockID      string                `json:"blockID"`
+		BlockHeader  *models.BlockHeader   `json:"block_header"`
+		Transactions []*models.Transaction `json:"transactions"`
+	}
+
+	err := c.makeRequest(ctx, "solidity_getnowblock", "GET", url, nil, &rawResponse)
+	if err != nil {
+		return nil, fmt.Errorf("获取固化区块失败: %w", err)
+	}
+
+	// 构建 BlockData
+	blockData := &models.BlockData{
+		BlockHash: rawResponse.BlockID,
+		CreatedAt: time.Now(),
+	}
+
+	// 从区块头中获取区块高度和时间戳
+	if rawResponse.BlockHeader != nil && rawResponse.BlockHeader.RawData != nil {
+		blockData.Height = rawResponse.BlockHeader.RawData.Number
+		blockData.Timestamp = normalizeBlockTimestamp(blockData.Height, rawResponse.BlockHeader.RawData.Timestamp)
+	}
+
+	// 构建 Block 结构
+	blockData.Block = &models.Block{
+		BlockHeader: rawResponse.BlockHeader,
+		Trans:       rawResponse.Transactions,
+	}
+	normalizeBlockAddresses(blockData.Block)
+
+	// 更新统计信息
+	atomic.AddInt64(&c.successCount, 1)
+	atomic.AddInt64(&c.requestCount, 1)
+	atomic.StoreInt64(&c.lastRequestTime, time.Now().UnixNano())
+
+	return blockData, nil
+}
+
+// GetBlockHeader 只获取区块头（不含交易）：blockNumber小于0时获取最新区块，solidified为true时通过固化节点接口获取，
+// 此时最新区块即最新固化区块。返回的Block只含区块头，用于只需要高度和哈希的场景
+func (c *HTTPClient) GetBlockHeader(ctx context.Context, blockNumber int64, solidified bool) (*models.BlockData, error) {
+	endpoint, api := "getblock", "wallet"
+	if solidified {
+		endpoint, api = "solidity_getblock", "walletsolidity"
+	}
+	url := fmt.Sprintf("%s/%s/getblock", c.baseURL, api)
+
+	requestBody := map[string]interface{}{
+		"detail": false,
+	}
+	if blockNumber >= 0 {
+		requestBody["id_or_num"] = strconv.FormatInt(blockNumber, 10)
+	}
+
+	var rawResponse struct {
+		BlockID     string              `json:"blockID"`
+		BlockHeader *models.BlockHeader `json:"block_header"`
+	}
+
+	err := c.makeRequest(ctx, endpoint, "POST", url, requestBody, &rawResponse)
+	if err != nil {
+		return nil, fmt.Errorf("获取区块头失败: %w", err)
+	}
+
+	blockData := &models.BlockData{
+		BlockHash: rawResponse.BlockID,
+		CreatedAt: time.Now(),
+		Block:     &models.Block{BlockHeader: rawResponse.BlockHeader},
+	}
+	if rawResponse.BlockHeader != nil && rawResponse.BlockHeader.RawData != nil {
+		blockData.Height = rawResponse.BlockHeader.RawData.Number
+		blockData.Timestamp = normalizeBlockTimestamp(blockData.Height, rawResponse.BlockHeader.RawData.Timestamp)
+	}
+
+	// 更新统计信息
+	atomic.AddInt64(&c.successCount, 1)
+	atomic.AddInt64(&c.requestCount, 1)
+	atomic.StoreInt64(&c.lastRequestTime, time.Now().UnixNano())
 
 	return blockData, nil
 }
 
 // GetBlockByNumber 根据区块号获取区块
 func (c *HTTPClient) GetBlockByNumber(ctx context.Context, blockNumber int64) (*models.BlockData, error) {
+	return c.getBlockByNumber(ctx, blockNumber, false)
+}
+
+// GetBlockByNumberRaw 与GetBlockByNumber相同，并在各合约的RawParameter中保留地址规范化之前的原始参数
+func (c *HTTPClient) GetBlockByNumberRaw(ctx context.Context, blockNumber int64) (*models.BlockData, error) {
+	return c.getBlockByNumber(ctx, blockNumber, true)
+}
+
+func (c *HTTPClient) getBlockByNumber(ctx context.Context, blockNumber int64, keepRaw bool) (*models.BlockData, error) {
 	url := fmt.Sprintf("%s/wallet/getblockbynum", c.baseURL)
 
 	requestBody := map[string]interface{}{
@@ -101,10 +304,24 @@ func (c *HTTPClient) GetBlockByNumber(ctx context.Context, blockNumber int64) (*
 		Transactions []*models.Transaction `json:"transactions"`
 	}
 
-	err := c.makeRequest(ctx, "POST", url, requestBody, &rawResponse)
+	var body json.RawMessage
+	err := c.makeRequest(ctx, "getblockbynum", "POST", url, requestBody, &body)
+	if err == nil {
+		err = json.Unmarshal(body, &rawResponse)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("获取区块 %d 失败: %w", blockNumber, err)
 	}
+	if keepRaw {
+		var rawTxs struct {
+			Transactions []json.RawMessage `json:"transactions"`
+		}
+		if err := json.Unmarshal(body, &rawTxs); err == nil && len(rawTxs.Transactions) == len(rawResponse.Transactions) {
+			for i, tx := range rawResponse.Transactions {
+				keepRawParameters(tx, rawTxs.Transactions[i])
+			}
+		}
+	}
 
 	// 构建 BlockData
 	blockData := &models.BlockData{
@@ -115,7 +332,7 @@ func (c *HTTPClient) GetBlockByNumber(ctx context.Context, blockNumber int64) (*
 	// 从区块头中获取区块高度和时间戳
 	if rawResponse.BlockHeader != nil && rawResponse.BlockHeader.RawData != nil {
 		blockData.Height = rawResponse.BlockHeader.RawData.Number
-		blockData.Timestamp = rawResponse.BlockHeader.RawData.Timestamp
+		blockData.Timestamp = normalizeBlockTimestamp(blockData.Height, rawResponse.BlockHeader.RawData.Timestamp)
 	}
 
 	// 构建 Block 结构
@@ -123,15 +340,54 @@ func (c *HTTPClient) GetBlockByNumber(ctx context.Context, blockNumber int64) (*
 		BlockHeader: rawResponse.BlockHeader,
 		Trans:       rawResponse.Transactions,
 	}
+	normalizeBlockAddresses(blockData.Block)
 
 	// 更新统计信息
 	atomic.AddInt64(&c.successCount, 1)
-	atomic.StoreInt64(&c.requestCount, atomic.AddInt64(&c.requestCount, 1))
-	c.lastRequestTime = time.Now()
+	atomic.AddInt64(&c.requestCount, 1)
+	atomic.StoreInt64(&c.lastRequestTime, time.Now().UnixNano())
 
 	return blockData, nil
 }
 
+// GetTransactionByID 根据交易哈希获取交易，交易不存在时返回ErrTransactionNotFound
+func (c *HTTPClient) GetTransactionByID(ctx context.Context, txID string) (*models.Transaction, error) {
+	return c.getTransactionByID(ctx, txID, false)
+}
+
+// GetTransactionByIDRaw 与GetTransactionByID相同，并在各合约的RawParameter中保留地址规范化之前的原始参数
+func (c *HTTPClient) GetTransactionByIDRaw(ctx context.Context, txID string) (*models.Transaction, error) {
+	return c.getTransactionByID(ctx, txID, true)
+}
+
+func (c *HTTPClient) getTransactionByID(ctx context.Context, txID string, keepRaw bool) (*models.Transaction, error) {
+	url := fmt.Sprintf("%s/wallet/gettransactionbyid", c.baseURL)
+
+	requestBody := map[string]string{
+		"value": txID,
+	}
+
+	// 交易不存在时接口返回空对象
+	var tx models.Transaction
+	var body json.RawMessage
+	err := c.makeRequest(ctx, "gettransactionbyid", "POST", url, requestBody, &body)
+	if err == nil {
+		err = json.Unmarshal(body, &tx)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("获取交易 %s 失败: %w", txID, err)
+	}
+	if tx.TxID == "" {
+		return nil, fmt.Errorf("获取交易 %s 失败: %w", txID, ErrTransactionNotFound)
+	}
+	if keepRaw {
+		keepRawParameters(&tx, body)
+	}
+	normalizeBlockAddresses(&models.Block{Trans: []*models.Transaction{&tx}})
+
+	return &tx, nil
+}
+
 // GetTransactionInfo 获取交易信息
 func (c *HTTPClient) GetTransactionInfo(ctx context.Context, txID string) (*models.TransactionInfo, error) {
 	url := fmt.Sprintf("%s/wallet/gettransactioninfobyid", c.baseURL)
@@ -141,7 +397,7 @@ func (c *HTTPClient) GetTransactionInfo(ctx context.Context, txID string) (*mode
 	}
 
 	var txInfo models.TransactionInfo
-	err := c.makeRequest(ctx, "POST", url, requestBody, &txInfo)
+	err := c.makeRequest(ctx, "gettransactioninfobyid", "POST", url, requestBody, &txInfo)
 	if err != nil {
 		return nil, fmt.Errorf("获取交易信息失败: %w", err)
 	}
@@ -149,12 +405,38 @@ func (c *HTTPClient) GetTransactionInfo(ctx context.Context, txID string) (*mode
 	return &txInfo, nil
 }
 
+// GetTransactionInfoByBlockNum 获取区块内所有交易的信息（含日志），一次请求代替逐笔gettransactioninfobyid
+func (c *HTTPClient) GetTransactionInfoByBlockNum(ctx context.Context, blockNumber int64) ([]*models.TransactionInfo, error) {
+	url := fmt.Sprintf("%s/wallet/gettransactioninfobyblocknum", c.baseURL)
+
+	requestBody := map[string]int64{
+		"num": blockNumber,
+	}
+
+	// 没有交易的区块返回 {} 而不是空数组
+	var raw json.RawMessage
+	err := c.makeRequest(ctx, "gettransactioninfobyblocknum", "POST", url, requestBody, &raw)
+	if err != nil {
+		return nil, fmt.Errorf("获取区块 %d 的交易信息失败: %w", blockNumber, err)
+	}
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) == 0 || trimmed[0] != '[' {
+		return nil, nil
+	}
+
+	var infos []*models.TransactionInfo
+	if err := json.Unmarshal(raw, &infos); err != nil {
+		return nil, fmt.Errorf("解析区块 %d 的交易信息失败: %w", blockNumber, err)
+	}
+
+	return infos, nil
+}
+
 // GetAccountInfo 获取账户信息
 func (c *HTTPClient) GetAccountInfo(ctx context.Context, address string) (map[string]interface{}, error) {
 	url := fmt.Sprintf("%s/v1/accounts/%s", c.baseURL, address)
 
 	var accountInfo map[string]interface{}
-	err := c.makeRequest(ctx, "GET", url, nil, &accountInfo)
+	err := c.makeRequest(ctx, "accounts", "GET", url, nil, &accountInfo)
 	if err != nil {
 		return nil, fmt.Errorf("获取账户信息失败: %w", err)
 	}
@@ -169,17 +451,89 @@ func (c *HTTPClient) GetTokenTransfers(ctx context.Context, address string, limi
 		url = fmt.Sprintf("%s?limit=%d", url, limit)
 	}
 
-	var transfers []map[string]interface{}
-	err := c.makeRequest(ctx, "GET", url, nil, &transfers)
+	// v1接口的响应格式: {"data": [...], "success": true, "meta": {...}}
+	var response struct {
+		Data []map[string]interface{} `json:"data"`
+	}
+	err := c.makeRequest(ctx, "trc20_transfers", "GET", url, nil, &response)
 	if err != nil {
 		return nil, fmt.Errorf("获取代币转账记录失败: %w", err)
 	}
 
-	return transfers, nil
+	// v1接口返回base58地址，统一处理以防个别字段为hex格式
+	for _, transfer := range response.Data {
+		for _, key := range []string{"from", "to"} {
+			if addr, ok := transfer[key].(string); ok {
+				transfer[key] = tronaddr.ToBase58(addr)
+			}
+		}
+		tronaddr.NormalizeFields(transfer)
+	}
+
+	return response.Data, nil
+}
+
+// normalizeBlockAddresses 将区块中合约参数的地址字段统一为base58格式
+//
+// wallet/*接口返回hex地址，v1接口返回base58地址，在入口处统一格式，下游代码无需关心地址格式。
+func normalizeBlockAddresses(block *models.Block) {
+	for _, tx := range block.Trans {
+		if tx == nil || tx.RawData == nil {
+			continue
+		}
+		for _, contract := range tx.RawData.Contract {
+			if contract != nil {
+				tronaddr.NormalizeFields(contract.Parameter)
+			}
+		}
+	}
+}
+
+// keepRawParameters 从交易的原始JSON中取出各合约的参数，保存到RawParameter（需在地址规范化之前调用）
+func keepRawParameters(tx *models.Transaction, raw json.RawMessage) {
+	if tx == nil || tx.RawData == nil {
+		return
+	}
+	var rawTx struct {
+		RawData struct {
+			Contract []struct {
+				Parameter json.RawMessage `json:"parameter"`
+			} `json:"contract"`
+		} `json:"raw_data"`
+	}
+	if err := json.Unmarshal(raw, &rawTx); err != nil || len(rawTx.RawData.Contract) != len(tx.RawData.Contract) {
+		return
+	}
+	for i, contract := range tx.RawData.Contract {
+		if contract != nil {
+			contract.RawParameter = rawTx.RawData.Contract[i].Parameter
+		}
+	}
+}
+
+// normalizeBlockTimestamp 将区块时间统一为毫秒，接口返回秒级或明显不合理的时间时记录警告
+func normalizeBlockTimestamp(height, timestamp int64) int64 {
+	millis, ok := models.NormalizeTimestampMillis(timestamp)
+	if millis != timestamp {
+		log.Printf("警告: 区块 %d 的时间戳 %d 不是毫秒，已换算为 %d", height, timestamp, millis)
+	}
+	if !ok {
+		log.Printf("警告: 区块 %d 的时间戳 %d 不合理（%s），时钟可能偏差或接口返回异常",
+			height, timestamp, time.UnixMilli(millis).UTC().Format(time.RFC3339))
+	}
+	return millis
+}
+
+// requestTimeout 获取接口的超时时间，未单独配置时使用trongrid.timeout
+func (c *HTTPClient) requestTimeout(endpoint string) time.Duration {
+	if timeout, ok := c.config.TronGrid.Timeouts[endpoint]; ok && timeout > 0 {
+		return timeout
+	}
+	return c.timeout
 }
 
-// makeRequest 执行HTTP请求
-func (c *HTTPClient) makeRequest(ctx context.Context, method, url string, body interface{}, result interface{}) error {
+// makeRequest 执行HTTP请求，endpoint为接口名，用于匹配trongrid.timeouts中的单独超时配置
+func (c *HTTPClient) makeRequest(ctx context.Context, endpoint, method, url string, body interface{}, result interface{}) error {
 	var requestBody []byte
 	var err error
 
@@ -202,7 +556,16 @@ func (c *HTTPClient) makeRequest(ctx context.Context, method, url string, body i
 			}
 		}
 
-		err := c.doRequest(ctx, method, url, requestBody, result)
+		// 每次尝试单独计算超时
+		attemptCtx, cancel := context.WithTimeout(ctx, c.requestTimeout(endpoint))
+		err := c.doRequest(attemptCtx, method, url, requestBody, result)
+		cancel()
+		// 调用方取消（如停止服务）不计入成功率窗口；接口返回的业务错误说明节点可用，按成功计入
+		var apiErr *APIError
+		isAPIError := errors.As(err, &apiErr)
+		if c.window != nil && ctx.Err() == nil {
+			c.window.record(err == nil || isAPIError)
+		}
 		if err == nil {
 			return nil
 		}
@@ -210,6 +573,10 @@ func (c *HTTPClient) makeRequest(ctx context.Context, method, url string, body i
 		lastErr = err
 		atomic.AddInt64(&c.errorCount, 1)
 
+		if isAPIError && !c.config.TronGrid.RetryAPIErrors {
+			return err
+		}
+
 		// 如果不是最后一次重试，继续重试
 		if i < c.retryMax {
 			continue
@@ -224,6 +591,8 @@ func (c *HTTPClient) doRequest(ctx context.Context, method, url string, body []b
 	var req *http.Request
 	var err error
 
+	ctx = c.withConnTrace(ctx)
+
 	if body != nil {
 		req, err = http.NewRequestWithContext(ctx, method, url, bytes.NewBuffer(body))
 		if err != nil {
@@ -264,6 +633,18 @@ func (c *HTTPClient) doRequest(ctx context.Context, method, url string, body []b
 
 	// 解析响应
 	if result != nil {
+		trimmed := bytes.TrimSpace(respBody)
+		contentType := resp.Header.Get("Content-Type")
+		if len(trimmed) == 0 || (trimmed[0] != '{' && trimmed[0] != '[') || strings.Contains(contentType, "text/html") {
+			return fmt.Errorf("%w（Content-Type: %s）: %s", ErrUnexpectedResponse, contentType, bodySnippet(trimmed))
+		}
+
+		if trimmed[0] == '{' && len(trimmed) <= maxErrorCheckBody {
+			if err := responseError(trimmed); err != nil {
+				return err
+			}
+		}
+
 		if err := json.Unmarshal(respBody, result); err != nil {
 			return fmt.Errorf("解析响应失败: %w", err)
 		}
@@ -272,13 +653,23 @@ func (c *HTTPClient) doRequest(ctx context.Context, method, url string, body []b
 	return nil
 }
 
+// bodySnippet 截断响应体用于错误信息
+func bodySnippet(body []byte) string {
+	if len(body) <= maxErrorBodySnippet {
+		return string(body)
+	}
+	return string(body[:maxErrorBodySnippet]) + "..."
+}
+
 // GetStats 获取请求统计信息
 func (c *HTTPClient) GetStats() map[string]interface{} {
-	return map[string]interface{}{
+	stats := map[string]interface{}{
 		"request_count":     atomic.LoadInt64(&c.requestCount),
 		"success_count":     atomic.LoadInt64(&c.successCount),
 		"error_count":       atomic.LoadInt64(&c.errorCount),
-		"last_request_time": c.lastRequestTime,
+		"last_request_time": c.lastRequestAt(),
+		"conn_reused":       atomic.LoadInt64(&c.connReused),
+		"conn_created":      atomic.LoadInt64(&c.connCreated),
 		"success_rate": func() float64 {
 			total := atomic.LoadInt64(&c.requestCount)
 			if total == 0 {
@@ -287,6 +678,14 @@ func (c *HTTPClient) GetStats() map[string]interface{} {
 			return float64(atomic.LoadInt64(&c.successCount)) / float64(total) * 100
 		}(),
 	}
+	if c.window != nil {
+		rate, samples, alerting := c.window.snapshot()
+		stats["window_success_rate"] = rate
+		stats["window_samples"] = samples
+		stats["success_rate_alert"] = alerting
+	}
+
+	return stats
 }
 
 // ResetStats 重置统计信息
@@ -294,5 +693,19 @@ func (c *HTTPClient) ResetStats() {
 	atomic.StoreInt64(&c.requestCount, 0)
 	atomic.StoreInt64(&c.successCount, 0)
 	atomic.StoreInt64(&c.errorCount, 0)
-	c.lastRequestTime = time.Time{}
+	atomic.StoreInt64(&c.lastRequestTime, 0)
+	atomic.StoreInt64(&c.connReused, 0)
+	atomic.StoreInt64(&c.connCreated, 0)
+	if c.window != nil {
+		c.window.reset()
+	}
+}
+
+// lastRequestAt 获取最后一次成功请求的时间
+func (c *HTTPClient) lastRequestAt() time.Time {
+	nanos := atomic.LoadInt64(&c.lastRequestTime)
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
 }
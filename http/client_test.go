@@ -0,0 +1,310 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"tron-monitor/config"
+	"tron-monitor/tronaddr"
+)
+
+func TestResponseError(t *testing.T) {
+	for _, tc := range []struct {
+		body string
+		want string // 为空表示没有错误
+	}{
+		{`{"Error":"class org.tron.core.exceptions.ContractValidateException"}`, "class org.tron.core.exceptions.ContractValidateException"},
+		{`{"error":{"code":400}}`, `{"code":400}`},
+		{`{"Error":null,"blockID":"00"}`, ""},
+		{`{"error":"","blockID":"00"}`, ""},
+		{`{"blockID":"00","transactions":[]}`, ""},
+		{`[{"Error":"x"}]`, ""},
+	} {
+		err := responseError([]byte(tc.body))
+		var apiErr *APIError
+		switch {
+		case tc.want == "" && err != nil:
+			t.Errorf("%s: 不应返回错误，实际 %v", tc.body, err)
+		case tc.want != "" && (!errors.As(err, &apiErr) || apiErr.Message != tc.want):
+			t.Errorf("%s: 期望错误 %q，实际 %v", tc.body, tc.want, err)
+		}
+	}
+}
+
+func TestDoRequestAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"Error":"class java.lang.NullPointerException : null"}`)
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{}
+	cfg.TronGrid.Timeout = 5 * time.Second
+	client := NewHTTPClient(cfg)
+
+	var result map[string]interface{}
+	err := client.doRequest(context.Background(), "POST", server.URL+"/wallet/getnowblock", []byte("{}"), &result)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !strings.Contains(apiErr.Message, "NullPointerException") {
+		t.Fatalf("状态码200的错误响应应返回APIError，实际 %v", err)
+	}
+}
+
+// 正常的区块响应较大，不再额外解析Error/error字段
+func BenchmarkDoRequestLargeBody(b *testing.B) {
+	var txs []string
+	for i := 0; i < 2000; i++ {
+		txs = append(txs, fmt.Sprintf(`{"txID":"%064x","raw_data":{"contract":[{"type":"TransferContract"}]}}`, i))
+	}
+	body := `{"blockID":"00","transactions":[` + strings.Join(txs, ",") + `]}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, body)
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{}
+	cfg.TronGrid.Timeout = 5 * time.Second
+	client := NewHTTPClient(cfg)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var result map[string]interface{}
+		if err := client.doRequest(context.Background(), "POST", server.URL, []byte("{}"), &result); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// 接口返回秒级区块时间时换算为毫秒
+func TestGetLatestBlockNormalizesTimestamp(t *testing.T) {
+	for _, ts := range []int64{1700000000, 1700000000000} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"blockID":"00","block_header":{"raw_data":{"number":100,"timestamp":%d}},"transactions":[]}`, ts)
+		}))
+
+		cfg := &config.Config{}
+		cfg.TronGrid.BaseURL = server.URL
+		cfg.TronGrid.Timeout = 5 * time.Second
+		blockData, err := NewHTTPClient(cfg).GetLatestBlock(context.Background())
+		server.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if blockData.Timestamp != 1700000000000 {
+			t.Errorf("时间戳 %d 应换算为 1700000000000，实际 %d", ts, blockData.Timestamp)
+		}
+	}
+}
+
+// 工作线程并发请求同一节点：比较默认连接池、调大空闲连接数的共享客户端和每个工作线程独立的客户端，
+// new_conns/op为平均每次请求新建的连接数
+func BenchmarkConcurrentRequests(b *testing.B) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond) // 模拟节点响应延迟
+		fmt.Fprint(w, `{"blockID":"00","block_header":{"raw_data":{"number":100,"timestamp":1700000000000}},"transactions":[]}`)
+	}))
+	defer server.Close()
+
+	newClient := func(maxIdleConnsPerHost int) *HTTPClient {
+		cfg := &config.Config{}
+		cfg.TronGrid.BaseURL = server.URL
+		cfg.TronGrid.Timeout = 5 * time.Second
+		cfg.TronGrid.MaxIdleConnsPerHost = maxIdleConnsPerHost
+		cfg.TronGrid.IdleConnTimeout = time.Minute
+		return NewHTTPClient(cfg)
+	}
+	connsCreated := func(clients ...*HTTPClient) (total int64) {
+		for _, client := range clients {
+			total += client.GetStats()["conn_created"].(int64)
+		}
+		return total
+	}
+	const workers = 16
+
+	for _, maxIdle := range []int{2, workers} {
+		b.Run(fmt.Sprintf("shared/max_idle=%d", maxIdle), func(b *testing.B) {
+			client := newClient(maxIdle)
+			b.SetParallelism(workers)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, err := client.GetLatestBlock(context.Background()); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+			b.ReportMetric(float64(connsCreated(client))/float64(b.N), "new_conns/op")
+		})
+	}
+
+	b.Run("per_worker", func(b *testing.B) {
+		var mu sync.Mutex
+		var clients []*HTTPClient
+		b.SetParallelism(workers)
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			client := newClient(2)
+			mu.Lock()
+			clients = append(clients, client)
+			mu.Unlock()
+			for pb.Next() {
+				if _, err := client.GetLatestBlock(context.Background()); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+		b.ReportMetric(float64(connsCreated(clients...))/float64(b.N), "new_conns/op")
+	})
+}
+
+// v1接口返回base58地址，wallet接口返回hex地址，同一地址在入口处统一为相同的base58格式
+func TestV1AndWalletAddressesNormalizeIdentically(t *testing.T) {
+	const base58 = "TJRabPrwbZy45sbavfcjinPJC18kjpRTv8"
+	hexAddr, err := tronaddr.Base58ToHex(base58)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/accounts/"):
+			// 个别字段为hex时同样统一
+			fmt.Fprintf(w, `{"success":true,"data":[{"transaction_id":"01","from":%q,"to":%q,"token_info":{"address":%q}}]}`, base58, hexAddr, hexAddr)
+		case r.URL.Path == "/wallet/getblockbynum":
+			fmt.Fprintf(w, `{"blockID":"00","block_header":{"raw_data":{"number":100,"timestamp":1700000000000}},"transactions":[`+
+				`{"txID":"02","raw_data":{"contract":[{"type":"TransferContract","parameter":{"value":{"owner_address":%q,"to_address":%q,"amount":1}}}]}}]}`, hexAddr, hexAddr)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{}
+	cfg.TronGrid.BaseURL = server.URL
+	cfg.TronGrid.Timeout = 5 * time.Second
+	client := NewHTTPClient(cfg)
+	ctx := context.Background()
+
+	transfers, err := client.GetTokenTransfers(ctx, base58, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transfers) != 1 {
+		t.Fatalf("应返回1笔代币转账，实际 %d 笔", len(transfers))
+	}
+	tokenInfo, _ := transfers[0]["token_info"].(map[string]interface{})
+	v1 := []interface{}{transfers[0]["from"], transfers[0]["to"], tokenInfo["address"]}
+
+	blockData, err := client.GetBlockByNumber(ctx, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	param, _ := blockData.Block.Trans[0].RawData.Contract[0].Parameter.(map[string]interface{})
+	value, _ := param["value"].(map[string]interface{})
+	wallet := []interface{}{value["owner_address"], value["to_address"]}
+
+	for _, addr := range append(v1, wallet...) {
+		if addr != base58 {
+			t.Errorf("v1地址 %v、wallet地址 %v 应统一为 %s", v1, wallet, base58)
+			break
+		}
+	}
+}
+
+// trongrid.timeouts中单独配置的慢接口使用更长的超时，区块查询仍使用trongrid.timeout
+func TestPerEndpointTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+		switch r.URL.Path {
+		case "/wallet/getnowblock":
+			fmt.Fprint(w, `{"blockID":"00","block_header":{"raw_data":{"number":100,"timestamp":1700000000000}},"transactions":[]}`)
+		case "/wallet/gettransactioninfobyid":
+			fmt.Fprint(w, `{"id":"01","blockNumber":100}`)
+		}
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{}
+	cfg.TronGrid.BaseURL = server.URL
+	cfg.TronGrid.Timeout = 100 * time.Millisecond
+	cfg.TronGrid.Timeouts = map[string]time.Duration{"gettransactioninfobyid": 2 * time.Second}
+	client := NewHTTPClient(cfg)
+	ctx := context.Background()
+
+	start := time.Now()
+	_, err := client.GetLatestBlock(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("区块查询应按trongrid.timeout超时，实际错误 %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+		t.Errorf("区块查询 %v 后才返回，应在约100ms时超时", elapsed)
+	}
+
+	info, err := client.GetTransactionInfo(ctx, "01")
+	if err != nil {
+		t.Fatalf("交易信息查询应使用单独配置的2s超时，实际错误 %v", err)
+	}
+	if info.BlockNumber != 100 {
+		t.Errorf("交易信息区块高度 %d，期望 100", info.BlockNumber)
+	}
+}
+
+// CDN/维护页面返回HTML时应得到ErrUnexpectedResponse并触发重试，而不是JSON解析错误
+func TestHTMLMaintenancePageRetried(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		n := calls
+		mu.Unlock()
+		if n == 1 {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, "<html><body><h1>503 Service Temporarily Unavailable</h1></body></html>")
+			return
+		}
+		fmt.Fprint(w, `{"blockID":"00","block_header":{"raw_data":{"number":100,"timestamp":1700000000000}},"transactions":[]}`)
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{}
+	cfg.TronGrid.BaseURL = server.URL
+	cfg.TronGrid.Timeout = 5 * time.Second
+	client := NewHTTPClient(cfg)
+
+	var result map[string]interface{}
+	err := client.doRequest(context.Background(), "POST", server.URL+"/wallet/getnowblock", []byte("{}"), &result)
+	if !errors.Is(err, ErrUnexpectedResponse) || !strings.Contains(err.Error(), "text/html") {
+		t.Fatalf("HTML响应应返回ErrUnexpectedResponse并带Content-Type，实际 %v", err)
+	}
+
+	mu.Lock()
+	calls = 0
+	mu.Unlock()
+	cfg.TronGrid.RetryMax = 1
+	cfg.TronGrid.RetryDelay = time.Millisecond
+	client = NewHTTPClient(cfg)
+	block, err := client.GetLatestBlock(context.Background())
+	if err != nil {
+		t.Fatalf("维护页面后应重试成功，实际错误 %v", err)
+	}
+	if block.Height != 100 {
+		t.Errorf("区块高度 %d，期望 100", block.Height)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 2 {
+		t.Errorf("请求次数 %d，期望维护页面后重试1次共2次", calls)
+	}
+}
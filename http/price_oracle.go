@@ -0,0 +1,226 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"tron-monitor/config"
+)
+
+// PriceOracle 代币价格查询（CoinGecko兼容接口），带本地缓存
+//
+// 请求价格接口时不持有锁：同一时间只有一个最新价格请求，其他调用方有旧价格时直接返回旧价格，
+// 没有时等待该请求完成。请求失败的结果缓存priceFailureTTL，避免接口不可用时每笔转账都等待超时。
+type PriceOracle struct {
+	config *config.Config
+	client *http.Client
+	mu     sync.Mutex
+
+	// 缓存的USDT价格
+	usdtPrice     float64
+	usdtFetchedAt time.Time
+	usdtErr       error         // 最近一次获取失败的错误，priceFailureTTL内直接返回
+	usdtFailedAt  time.Time     // 最近一次获取失败的时间
+	usdtFetching  chan struct{} // 进行中的最新价格请求，完成时关闭
+
+	// 缓存的USDT历史价格（日期 dd-mm-yyyy -> 价格）和获取失败的日期（日期 -> 失败时间）
+	historicalPrices map[string]float64
+	historicalFailed map[string]time.Time
+}
+
+// 历史价格缓存的最大天数
+const maxHistoricalPrices = 366
+
+// priceFailureTTL 价格获取失败后不再请求的时间
+const priceFailureTTL = 30 * time.Second
+
+// NewPriceOracle 创建价格查询客户端
+func NewPriceOracle(cfg *config.Config) *PriceOracle {
+	return &PriceOracle{
+		config: cfg,
+		client: &http.Client{
+			Timeout: cfg.Pricing.Timeout,
+		},
+		historicalPrices: make(map[string]float64),
+		historicalFailed: make(map[string]time.Time),
+	}
+}
+
+// GetUSDTPrice 获取USDT的美元价格，缓存有效期内直接返回缓存值
+func (o *PriceOracle) GetUSDTPrice(ctx context.Context) (float64, error) {
+	o.mu.Lock()
+	for {
+		if !o.usdtFetchedAt.IsZero() && time.Since(o.usdtFetchedAt) < o.config.Pricing.CacheTTL {
+			price := o.usdtPrice
+			o.mu.Unlock()
+			return price, nil
+		}
+		if o.usdtErr != nil && time.Since(o.usdtFailedAt) < priceFailureTTL {
+			err := o.usdtErr
+			o.mu.Unlock()
+			return 0, err
+		}
+		if o.usdtFetching == nil {
+			break
+		}
+
+		// 已有请求进行中：有旧价格时直接返回旧价格，否则等待请求完成
+		if !o.usdtFetchedAt.IsZero() {
+			price := o.usdtPrice
+			o.mu.Unlock()
+			return price, nil
+		}
+		fetching := o.usdtFetching
+		o.mu.Unlock()
+		select {
+		case <-fetching:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+		o.mu.Lock()
+	}
+	fetching := make(chan struct{})
+	o.usdtFetching = fetching
+	o.mu.Unlock()
+
+	price, err := o.fetchPrice(ctx, o.config.Pricing.USDTCoinID)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.usdtFetching = nil
+	close(fetching)
+	if err != nil {
+		// 调用方取消导致的失败不缓存，等待中的调用方会重新请求
+		if ctx.Err() == nil {
+			o.usdtErr = err
+			o.usdtFailedAt = time.Now()
+		}
+		return 0, err
+	}
+
+	o.usdtPrice = price
+	o.usdtFetchedAt = time.Now()
+	o.usdtErr = nil
+	return price, nil
+}
+
+// GetUSDTPriceAt 获取USDT在指定时间（按UTC日期）的历史美元价格
+//
+// 历史价格不可用时回退到最新价格，此时fallback为true。
+func (o *PriceOracle) GetUSDTPriceAt(ctx context.Context, at time.Time) (price float64, fallback bool, err error) {
+	date := at.UTC().Format("02-01-2006")
+
+	o.mu.Lock()
+	price, ok := o.historicalPrices[date]
+	failedAt, failed := o.historicalFailed[date]
+	o.mu.Unlock()
+	if ok {
+		return price, false, nil
+	}
+
+	recentlyFailed := failed && time.Since(failedAt) < priceFailureTTL
+	if recentlyFailed {
+		err = fmt.Errorf("%s 的历史价格最近获取失败", date)
+	} else {
+		price, err = o.fetchHistoricalPrice(ctx, o.config.Pricing.USDTCoinID, date)
+	}
+	if err == nil {
+		o.mu.Lock()
+		if len(o.historicalPrices) >= maxHistoricalPrices {
+			o.historicalPrices = make(map[string]float64)
+		}
+		o.historicalPrices[date] = price
+		o.mu.Unlock()
+		return price, false, nil
+	}
+
+	if !recentlyFailed && ctx.Err() == nil {
+		o.mu.Lock()
+		if len(o.historicalFailed) >= maxHistoricalPrices {
+			o.historicalFailed = make(map[string]time.Time)
+		}
+		o.historicalFailed[date] = time.Now()
+		o.mu.Unlock()
+		log.Printf("获取 %s 的USDT历史价格失败，使用最新价格: %v", date, err)
+	}
+	price, err = o.GetUSDTPrice(ctx)
+	if err != nil {
+		return 0, true, err
+	}
+	return price, true, nil
+}
+
+// fetchHistoricalPrice 获取指定币种在某日的美元价格
+func (o *PriceOracle) fetchHistoricalPrice(ctx context.Context, coinID, date string) (float64, error) {
+	url := fmt.Sprintf("%s/coins/%s/history?date=%s&localization=false", o.config.Pricing.BaseURL, coinID, date)
+
+	// 响应格式: {"market_data": {"current_price": {"usd": 0.9998}}}
+	var result struct {
+		MarketData *struct {
+			CurrentPrice map[string]float64 `json:"current_price"`
+		} `json:"market_data"`
+	}
+	if err := o.getJSON(ctx, url, &result); err != nil {
+		return 0, err
+	}
+
+	if result.MarketData == nil || result.MarketData.CurrentPrice["usd"] <= 0 {
+		return 0, fmt.Errorf("历史价格响应中缺少 %s 在 %s 的美元价格", coinID, date)
+	}
+
+	return result.MarketData.CurrentPrice["usd"], nil
+}
+
+// fetchPrice 从价格接口获取指定币种的美元价格
+func (o *PriceOracle) fetchPrice(ctx context.Context, coinID string) (float64, error) {
+	url := fmt.Sprintf("%s/simple/price?ids=%s&vs_currencies=usd", o.config.Pricing.BaseURL, coinID)
+
+	// 响应格式: {"tether": {"usd": 0.9998}}
+	var result map[string]map[string]float64
+	if err := o.getJSON(ctx, url, &result); err != nil {
+		return 0, err
+	}
+
+	price, ok := result[coinID]["usd"]
+	if !ok || price <= 0 {
+		return 0, fmt.Errorf("价格响应中缺少 %s 的美元价格", coinID)
+	}
+
+	return price, nil
+}
+
+// getJSON 请求价格接口并解析JSON响应
+func (o *PriceOracle) getJSON(ctx context.Context, url string, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("创建价格请求失败: %w", err)
+	}
+	req.Header.Set("User-Agent", "TronMonitor/1.0")
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("价格请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("读取价格响应失败: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("价格请求失败，状态码: %d, 响应: %s", resp.StatusCode, string(body))
+	}
+
+	if err := json.Unmarshal(body, result); err != nil {
+		return fmt.Errorf("解析价格响应失败: %w", err)
+	}
+
+	return nil
+}
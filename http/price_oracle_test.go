@@ -0,0 +1,117 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tron-monitor/config"
+)
+
+// newTestOracle 创建以fake价格接口为数据源的价格查询客户端
+func newTestOracle(t *testing.T, handler http.HandlerFunc) *PriceOracle {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	cfg := &config.Config{}
+	cfg.Pricing.BaseURL = server.URL
+	cfg.Pricing.USDTCoinID = "tether"
+	cfg.Pricing.Timeout = 5 * time.Second
+	cfg.Pricing.CacheTTL = time.Minute
+	return NewPriceOracle(cfg)
+}
+
+func TestPriceOracleCachesFailures(t *testing.T) {
+	var requests int64
+	oracle := newTestOracle(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+	})
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := oracle.GetUSDTPrice(ctx); err == nil {
+			t.Fatal("价格接口失败时应返回错误")
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if _, fallback, err := oracle.GetUSDTPriceAt(ctx, time.Now()); err == nil || !fallback {
+			t.Fatalf("历史价格和最新价格都失败时应返回错误，fallback %v，错误 %v", fallback, err)
+		}
+	}
+	// 最新价格1次 + 历史价格1次
+	if n := atomic.LoadInt64(&requests); n != 2 {
+		t.Errorf("失败结果应缓存，实际请求 %d 次", n)
+	}
+}
+
+func TestPriceOracleServesStalePriceDuringFetch(t *testing.T) {
+	release := make(chan struct{})
+	var requests int64
+	oracle := newTestOracle(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&requests, 1) > 1 {
+			<-release
+		}
+		fmt.Fprint(w, `{"tether":{"usd":0.999}}`)
+	})
+	ctx := context.Background()
+
+	if _, err := oracle.GetUSDTPrice(ctx); err != nil {
+		t.Fatal(err)
+	}
+	oracle.mu.Lock()
+	oracle.usdtFetchedAt = time.Now().Add(-time.Hour) // 缓存过期
+	oracle.mu.Unlock()
+
+	// 第一个调用方刷新价格时请求被挂起
+	refreshed := make(chan error, 1)
+	go func() {
+		_, err := oracle.GetUSDTPrice(ctx)
+		refreshed <- err
+	}()
+	for atomic.LoadInt64(&requests) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// 其他调用方不等待，直接返回旧价格
+	done := make(chan float64, 1)
+	go func() {
+		price, _ := oracle.GetUSDTPrice(ctx)
+		done <- price
+	}()
+	select {
+	case price := <-done:
+		if price != 0.999 {
+			t.Errorf("应返回旧价格，实际 %v", price)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("刷新价格期间其他调用方被阻塞")
+	}
+
+	close(release)
+	if err := <-refreshed; err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt64(&requests); n != 2 {
+		t.Errorf("刷新期间不应发起重复请求，实际请求 %d 次", n)
+	}
+}
+
+func TestPriceOracleReturnsDepeggedPrice(t *testing.T) {
+	oracle := newTestOracle(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"tether":{"usd":0.97}}`)
+	})
+
+	price, err := oracle.GetUSDTPrice(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if price != 0.97 {
+		t.Errorf("脱锚时应返回接口价格0.97，实际 %v", price)
+	}
+}
@@ -0,0 +1,109 @@
+package http
+
+import (
+	"log"
+	"sync"
+)
+
+// successWindow 最近N次请求结果的环形缓冲区，用于计算滑动窗口成功率并在低于阈值时告警
+//
+// 窗口填满前不判断，避免启动初期少量失败就触发告警；告警触发和恢复各回调一次。
+type successWindow struct {
+	mu        sync.Mutex
+	results   []bool
+	next      int
+	filled    bool
+	failures  int
+	threshold float64 // 成功率阈值（百分比）
+	alerting  bool
+
+	onAlert func(firing bool, rate float64)
+}
+
+// newSuccessWindow 创建大小为size的成功率窗口
+func newSuccessWindow(size int, threshold float64) *successWindow {
+	return &successWindow{
+		results:   make([]bool, size),
+		threshold: threshold,
+	}
+}
+
+// record 记录一次请求结果，成功率跨过阈值时触发或解除告警
+func (w *successWindow) record(ok bool) {
+	w.mu.Lock()
+
+	if w.filled && !w.results[w.next] {
+		w.failures-- // 被覆盖的旧结果
+	}
+	w.results[w.next] = ok
+	if !ok {
+		w.failures++
+	}
+	w.next++
+	if w.next == len(w.results) {
+		w.next = 0
+		w.filled = true
+	}
+
+	if !w.filled {
+		w.mu.Unlock()
+		return
+	}
+
+	rate := w.rateLocked()
+	var changed bool
+	if !w.alerting && rate < w.threshold {
+		w.alerting, changed = true, true
+	} else if w.alerting && rate >= w.threshold {
+		w.alerting, changed = false, true
+	}
+	firing, onAlert := w.alerting, w.onAlert
+	w.mu.Unlock()
+
+	if !changed {
+		return
+	}
+	if firing {
+		log.Printf("告警: 最近 %d 次TronGrid请求成功率 %.1f%% 低于阈值 %.1f%%", len(w.results), rate, w.threshold)
+	} else {
+		log.Printf("恢复: 最近 %d 次TronGrid请求成功率 %.1f%% 已回到阈值 %.1f%% 以上", len(w.results), rate, w.threshold)
+	}
+	if onAlert != nil {
+		onAlert(firing, rate)
+	}
+}
+
+// rateLocked 当前窗口内的成功率（百分比），调用方需持有锁
+func (w *successWindow) rateLocked() float64 {
+	size := w.next
+	if w.filled {
+		size = len(w.results)
+	}
+	if size == 0 {
+		return 0
+	}
+	return float64(size-w.failures) / float64(size) * 100
+}
+
+// snapshot 获取窗口成功率、已记录的请求数和是否处于告警状态
+func (w *successWindow) snapshot() (rate float64, samples int, alerting bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	samples = w.next
+	if w.filled {
+		samples = len(w.results)
+	}
+	return w.rateLocked(), samples, w.alerting
+}
+
+// reset 清空窗口和告警状态
+func (w *successWindow) reset() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for i := range w.results {
+		w.results[i] = false
+	}
+	w.next, w.filled, w.failures, w.alerting = 0, false, 0, false
+}
@@ -0,0 +1,47 @@
+package http
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// 窗口填满前不告警；成功率低于阈值时触发一次告警，回到阈值以上时恢复一次，持续低于阈值不重复告警
+func TestSuccessWindowAlertTripsAndClears(t *testing.T) {
+	w := newSuccessWindow(4, 75)
+	var events []string
+	w.onAlert = func(firing bool, rate float64) {
+		events = append(events, fmt.Sprintf("%v@%.0f", firing, rate))
+	}
+
+	for i, tc := range []struct {
+		ok       bool
+		alerting bool
+	}{
+		{false, false}, // 窗口未填满，不判断
+		{false, false},
+		{true, false},
+		{true, true},   // 填满: 2/4 = 50% < 75%，触发
+		{true, false},  // 覆盖失败: 3/4 = 75%，恢复
+		{false, false}, // 覆盖失败: 仍为 3/4
+		{false, true},  // 覆盖成功: 2/4，触发
+		{false, true},  // 1/4，仍在告警，不重复触发
+		{true, true},   // 1/4
+		{true, true},   // 2/4
+		{true, false},  // 3/4，恢复
+	} {
+		w.record(tc.ok)
+		if _, _, alerting := w.snapshot(); alerting != tc.alerting {
+			t.Fatalf("第 %d 次记录后 alerting=%v，期望 %v", i+1, alerting, tc.alerting)
+		}
+	}
+
+	if got := strings.Join(events, ","); got != "true@50,false@75,true@50,false@75" {
+		t.Errorf("告警回调 %s，期望 true@50,false@75,true@50,false@75", got)
+	}
+
+	w.reset()
+	if rate, samples, alerting := w.snapshot(); rate != 0 || samples != 0 || alerting {
+		t.Errorf("重置后 rate=%v samples=%d alerting=%v，期望全部清空", rate, samples, alerting)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// logEntry 一条日志
+type logEntry struct {
+	Time    time.Time              `json:"time"`
+	Level   string                 `json:"level"`
+	Message string                 `json:"message"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+
+	level logrus.Level
+}
+
+// logBuffer 保留最近的日志，供 /logs 查询和实时订阅
+//
+// 作为logrus钩子记录日志级别和结构化字段。标准库log没有级别，经stdWriter写入的日志按消息内容推断级别。
+type logBuffer struct {
+	mu          sync.Mutex
+	entries     []logEntry
+	next        int
+	filled      bool
+	subscribers map[chan logEntry]struct{}
+}
+
+// newLogBuffer 创建保留size条日志的缓冲区
+func newLogBuffer(size int) *logBuffer {
+	return &logBuffer{
+		entries:     make([]logEntry, size),
+		subscribers: make(map[chan logEntry]struct{}),
+	}
+}
+
+// Levels 实现logrus.Hook，记录所有级别
+func (b *logBuffer) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire 实现logrus.Hook
+func (b *logBuffer) Fire(e *logrus.Entry) error {
+	var fields map[string]interface{}
+	if len(e.Data) > 0 {
+		fields = make(map[string]interface{}, len(e.Data))
+		for k, v := range e.Data {
+			// error等类型序列化为JSON时丢失内容，统一转为字符串
+			if err, ok := v.(error); ok {
+				v = err.Error()
+			}
+			fields[k] = v
+		}
+	}
+	b.add(logEntry{Time: e.Time, Message: e.Message, Fields: fields, level: e.Level})
+	return nil
+}
+
+// stdWriter 返回供标准库log使用的Writer，写入out的同时记录到缓冲区
+func (b *logBuffer) stdWriter(out io.Writer) io.Writer {
+	return &stdLogWriter{buf: b, out: out}
+}
+
+// stdLogWriter 转发标准库log的输出并记录到缓冲区
+type stdLogWriter struct {
+	buf *logBuffer
+	out io.Writer
+}
+
+// Write 实现io.Writer，log包每次调用写入一条完整日志
+func (w *stdLogWriter) Write(p []byte) (int, error) {
+	n, err := w.out.Write(p)
+
+	message := strings.TrimRight(string(p), "\n")
+	// 去掉log包的默认时间前缀 "2006/01/02 15:04:05 "
+	if len(message) >= 20 && message[4] == '/' && message[10] == ' ' && message[19] == ' ' {
+		message = message[20:]
+	}
+	w.buf.add(logEntry{Time: time.Now(), Message: message, level: inferLogLevel(message)})
+
+	return n, err
+}
+
+// inferLogLevel 根据消息内容推断标准库log日志的级别：
+// 包含"警告"、"告警"为warning，包含"失败"、"错误"、"panic"为error，其余为info
+func inferLogLevel(message string) logrus.Level {
+	switch {
+	case strings.Contains(message, "警告") || strings.Contains(message, "告警"):
+		return logrus.WarnLevel
+	case strings.Contains(message, "失败") || strings.Contains(message, "错误") || strings.Contains(message, "panic"):
+		return logrus.ErrorLevel
+	default:
+		return logrus.InfoLevel
+	}
+}
+
+// add 记录一条日志并推送给订阅方
+func (b *logBuffer) add(entry logEntry) {
+	entry.Level = entry.level.String()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.entries[b.next] = entry
+	b.next++
+	if b.next == len(b.entries) {
+		b.next = 0
+		b.filled = true
+	}
+	for ch := range b.subscribers {
+		select {
+		case ch <- entry:
+		default: // 订阅方处理不过来时丢弃，不阻塞日志输出
+		}
+	}
+}
+
+// parseLogLevel 解析查询参数中的最低日志级别，为空时返回trace（不过滤）
+func parseLogLevel(level string) (logrus.Level, error) {
+	if level == "" {
+		return logrus.TraceLevel, nil
+	}
+	parsed, err := logrus.ParseLevel(level)
+	if err != nil {
+		return 0, fmt.Errorf("无效的level参数，可选 debug、info、warning、error: %w", err)
+	}
+	return parsed, nil
+}
+
+// recent 获取最近n条不低于minLevel的日志，按时间从旧到新排列
+func (b *logBuffer) recent(minLevel logrus.Level, n int) []logEntry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ordered := b.entries[:b.next]
+	if b.filled {
+		ordered = append(append([]logEntry{}, b.entries[b.next:]...), b.entries[:b.next]...)
+	}
+
+	result := make([]logEntry, 0, n)
+	for i := len(ordered) - 1; i >= 0 && len(result) < n; i-- {
+		// logrus级别数值越小越严重
+		if ordered[i].level <= minLevel {
+			result = append(result, ordered[i])
+		}
+	}
+
+	// 反转为从旧到新
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+	return result
+}
+
+// subscribe 订阅新日志，返回日志通道和取消订阅函数
+func (b *logBuffer) subscribe() (<-chan logEntry, func()) {
+	ch := make(chan logEntry, 64)
+
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		delete(b.subscribers, ch)
+		b.mu.Unlock()
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// newTestLogger 创建输出到缓冲区钩子的独立logrus实例，避免影响全局logger
+func newTestLogger(logs *logBuffer) *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	logger.SetLevel(logrus.DebugLevel)
+	logger.AddHook(logs)
+	return logger
+}
+
+func TestLogBufferCapturesLevelsAndFields(t *testing.T) {
+	logs := newLogBuffer(3)
+	logger := newTestLogger(logs)
+
+	logger.Debug("调试")
+	logger.WithField("height", 100).Info("处理区块")
+	logger.WithError(io.ErrUnexpectedEOF).Warn("重试")
+	logger.Error("保存失败")
+
+	// 缓冲区只保留最近3条
+	all := logs.recent(logrus.TraceLevel, 10)
+	if len(all) != 3 {
+		t.Fatalf("期望3条日志，实际 %d 条", len(all))
+	}
+	if all[0].Message != "处理区块" || all[0].Level != "info" || all[0].Fields["height"] != 100 {
+		t.Errorf("第一条日志不符: %+v", all[0])
+	}
+	if all[1].Fields["error"] != io.ErrUnexpectedEOF.Error() {
+		t.Errorf("error字段应转为字符串: %+v", all[1].Fields)
+	}
+
+	warnings := logs.recent(logrus.WarnLevel, 10)
+	if len(warnings) != 2 || warnings[0].Level != "warning" || warnings[1].Level != "error" {
+		t.Errorf("按级别过滤结果不符: %+v", warnings)
+	}
+
+	if latest := logs.recent(logrus.TraceLevel, 1); len(latest) != 1 || latest[0].Message != "保存失败" {
+		t.Errorf("n=1时应返回最新一条: %+v", latest)
+	}
+}
+
+func TestLogBufferStdWriter(t *testing.T) {
+	logs := newLogBuffer(10)
+	var out strings.Builder
+	logger := log.New(logs.stdWriter(&out), "", log.LstdFlags)
+
+	logger.Printf("监控启动")
+	logger.Printf("警告: 获取最新区块失败，跳过补齐范围检查")
+	logger.Printf("保存转账事件失败: 连接被拒绝")
+
+	entries := logs.recent(logrus.TraceLevel, 10)
+	if len(entries) != 3 || entries[0].Message != "监控启动" || entries[0].Level != "info" {
+		t.Fatalf("标准库日志记录不符: %+v", entries)
+	}
+	if entries[1].Level != "warning" || entries[2].Level != "error" {
+		t.Errorf("按消息内容推断级别: %s、%s，期望 warning、error", entries[1].Level, entries[2].Level)
+	}
+	if errs := logs.recent(logrus.ErrorLevel, 10); len(errs) != 1 || errs[0].Message != "保存转账事件失败: 连接被拒绝" {
+		t.Errorf("level=error应只返回错误日志: %+v", errs)
+	}
+	if !strings.Contains(out.String(), "监控启动") {
+		t.Errorf("标准库日志应转发到原输出")
+	}
+}
+
+func newLogTestServer(t *testing.T, logs *logBuffer, token string) *httptest.Server {
+	t.Helper()
+	streams := &streamLimiter{}
+	router := mux.NewRouter()
+	router.Use(timeoutMiddleware(time.Second, streams))
+	registerLogRoutes(router, logs, streams, token)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestLogsEndpoint(t *testing.T) {
+	logs := newLogBuffer(10)
+	logger := newTestLogger(logs)
+	logger.Info("第一条")
+	logger.Error("第二条")
+
+	server := newLogTestServer(t, logs, "")
+
+	tests := []struct {
+		query  string
+		status int
+		want   []string
+	}{
+		{"", http.StatusOK, []string{"第一条", "第二条"}},
+		{"?level=error", http.StatusOK, []string{"第二条"}},
+		{"?n=1", http.StatusOK, []string{"第二条"}},
+		{"?level=verbose", http.StatusBadRequest, nil},
+		{"?n=0", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		resp, err := http.Get(server.URL + "/logs" + tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tt.status {
+			t.Errorf("%q: 状态码 %d，期望 %d", tt.query, resp.StatusCode, tt.status)
+		}
+		if tt.status == http.StatusOK {
+			var entries []logEntry
+			if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, e := range entries {
+				got = append(got, e.Message)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("%q: 返回 %v，期望 %v", tt.query, got, tt.want)
+			}
+		}
+		resp.Body.Close()
+	}
+}
+
+func TestLogsEndpointToken(t *testing.T) {
+	server := newLogTestServer(t, newLogBuffer(10), "secret")
+
+	tests := []struct {
+		name   string
+		header string
+		query  string
+		status int
+	}{
+		{"无令牌", "", "", http.StatusUnauthorized},
+		{"错误令牌", "Bearer wrong", "", http.StatusUnauthorized},
+		{"请求头", "Bearer secret", "", http.StatusOK},
+		{"查询参数", "", "?token=secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", server.URL+"/logs"+tt.query, nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: 状态码 %d，期望 %d", tt.name, resp.StatusCode, tt.status)
+		}
+	}
+}
+
+// 请求超时中间件不能包装流式端点，否则http.TimeoutHandler不支持Flush
+func TestLogsStreamWithRequestTimeout(t *testing.T) {
+	logs := newLogBuffer(10)
+	logger := newTestLogger(logs)
+	server := newLogTestServer(t, logs, "")
+
+	resp, err := http.Get(server.URL + "/logs/stream?level=warning")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("状态码 %d，期望200", resp.StatusCode)
+	}
+
+	logger.Info("被过滤")
+	logger.Warn("实时告警")
+
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entry logEntry
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(strings.TrimSpace(line), "data: ")), &entry); err != nil {
+		t.Fatalf("解析SSE数据失败: %v (%q)", err, line)
+	}
+	if entry.Message != "实时告警" || entry.Level != "warning" {
+		t.Errorf("收到的日志不符: %+v", entry)
+	}
+}
@@ -2,13 +2,21 @@ package main
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"math"
+	"mime"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -17,19 +25,15 @@ import (
 
 	"tron-monitor/config"
 	httpclient "tron-monitor/http"
-	"tron-monitor/processor"
-	"tron-monitor/redis"
+	"tron-monitor/models"
+	"tron-monitor/tronaddr"
 )
 
-// Application 应用程序结构
+// Application 应用程序结构，每个监控的网络对应一个流水线，共用HTTP服务器
 type Application struct {
-	config         *config.Config
-	redisClient    *redis.RedisClient
-	httpClient     *httpclient.HTTPClient
-	blockMonitor   *processor.BlockMonitor
-	blockProcessor *processor.BlockProcessor
-	server         *http.Server
-	startTime      time.Time
+	config    *config.Config
+	pipelines []*pipeline
+	server    *http.Server
 }
 
 // NewApplication 创建应用程序实例
@@ -41,36 +45,39 @@ func NewApplication(configPath string) (*Application, error) {
 	}
 
 	// 2. 初始化日志
-	if err := initLogger(cfg); err != nil {
+	logs, err := initLogger(cfg)
+	if err != nil {
 		return nil, fmt.Errorf("初始化日志失败: %w", err)
 	}
+	models.SetPlainAmounts(cfg.Display.PlainAmounts)
 
-	// 3. 初始化Redis客户端
-	redisClient, err := redis.NewRedisClient(cfg)
-	if err != nil {
-		return nil, fmt.Errorf("初始化Redis客户端失败: %w", err)
+	// 3. 初始化各网络的监控流水线，未配置networks时只有一个监控全局配置网络的流水线
+	var pipelines []*pipeline
+	if len(cfg.Networks) == 0 {
+		p, err := newPipeline("", cfg)
+		if err != nil {
+			return nil, err
+		}
+		pipelines = append(pipelines, p)
+	}
+	for _, network := range cfg.Networks {
+		p, err := newPipeline(network.Name, cfg.ForNetwork(network))
+		if err != nil {
+			for _, created := range pipelines {
+				created.redisClient.Close()
+			}
+			return nil, fmt.Errorf("初始化网络 %s 失败: %w", network.Name, err)
+		}
+		pipelines = append(pipelines, p)
 	}
 
-	// 4. 初始化HTTP客户端
-	httpClient := httpclient.NewHTTPClient(cfg)
-
-	// 5. 初始化区块监控器
-	blockMonitor := processor.NewBlockMonitor(cfg, redisClient, httpClient)
-
-	// 6. 初始化区块处理器
-	blockProcessor := processor.NewBlockProcessor(cfg, redisClient, httpClient)
-
-	// 7. 初始化HTTP服务器
-	server := initHTTPServer(cfg, redisClient, blockMonitor, blockProcessor)
+	// 4. 初始化HTTP服务器
+	server := initHTTPServer(cfg, pipelines, logs)
 
 	return &Application{
-		config:         cfg,
-		redisClient:    redisClient,
-		httpClient:     httpClient,
-		blockMonitor:   blockMonitor,
-		blockProcessor: blockProcessor,
-		server:         server,
-		startTime:      time.Now(),
+		config:    cfg,
+		pipelines: pipelines,
+		server:    server,
 	}, nil
 }
 
@@ -78,28 +85,23 @@ func NewApplication(configPath string) (*Application, error) {
 func (app *Application) Start() error {
 	log.Println("启动Tron区块链监控系统...")
 
-	// 1. 健康检查
-	if err := app.healthCheck(); err != nil {
-		log.Printf("警告: 健康检查失败: %v，但继续启动系统", err)
-		// 不返回错误，让系统继续启动
-	}
-
-	// 2. 初始化监控地址
-	if err := app.initWatchAddresses(); err != nil {
-		return fmt.Errorf("初始化监控地址失败: %w", err)
-	}
-
-	// 3. 启动区块处理器
-	if err := app.blockProcessor.Start(); err != nil {
-		return fmt.Errorf("启动区块处理器失败: %w", err)
-	}
-
-	// 4. 启动区块监控器
-	if err := app.blockMonitor.Start(); err != nil {
-		return fmt.Errorf("启动区块监控器失败: %w", err)
+	// 1. 依次启动各网络的流水线，某个网络启动失败时停止已启动的网络（保存完已排队的转账），并关闭其余网络的Redis连接
+	for i, p := range app.pipelines {
+		if err := p.start(app.waitHealthy); err != nil {
+			for _, started := range app.pipelines[:i] {
+				started.stop()
+			}
+			for _, pending := range app.pipelines[i:] {
+				pending.redisClient.Close()
+			}
+			if p.name != "" {
+				return fmt.Errorf("启动网络 %s 失败: %w", p.name, err)
+			}
+			return err
+		}
 	}
 
-	// 5. 启动HTTP服务器
+	// 2. 启动HTTP服务器
 	go func() {
 		log.Printf("启动HTTP服务器: %s:%s", app.config.Server.Host, app.config.Server.Port)
 		if err := app.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -124,96 +126,56 @@ func (app *Application) Stop() error {
 		}
 	}
 
-	// 2. 停止区块监控器
-	if app.blockMonitor != nil {
-		if err := app.blockMonitor.Stop(); err != nil {
-			log.Printf("停止区块监控器失败: %v", err)
-		}
-	}
-
-	// 3. 停止区块处理器
-	if app.blockProcessor != nil {
-		if err := app.blockProcessor.Stop(); err != nil {
-			log.Printf("停止区块处理器失败: %v", err)
-		}
-	}
-
-	// 4. 关闭Redis连接
-	if app.redisClient != nil {
-		if err := app.redisClient.Close(); err != nil {
-			log.Printf("关闭Redis连接失败: %v", err)
-		}
+	// 2. 停止各网络的流水线
+	for _, p := range app.pipelines {
+		p.stop()
 	}
 
 	log.Println("Tron区块链监控系统已停止")
 	return nil
 }
 
-// healthCheck 健康检查
-func (app *Application) healthCheck() error {
-	log.Println("执行健康检查...")
-
-	// 检查Redis连接
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	// 测试Redis连接
-	if _, err := app.redisClient.GetQueueSize(ctx); err != nil {
-		return fmt.Errorf("Redis连接检查失败: %w", err)
-	}
-
-	// 测试TronGrid API连接（使用更长的超时时间）
-	apiCtx, apiCancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer apiCancel()
-
-	if _, err := app.httpClient.GetLatestBlock(apiCtx); err != nil {
-		return fmt.Errorf("TronGrid API连接检查失败: %w", err)
-	}
-
-	log.Println("健康检查通过")
-	return nil
-}
-
-// initWatchAddresses 初始化监控地址
-func (app *Application) initWatchAddresses() error {
-	log.Println("初始化监控地址...")
+// statsHistoryMetrics /stats/history 支持的指标
+var statsHistoryMetrics = []string{"processed_blocks", "transfers_found", "errors", "queue_size", "last_processed_block"}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// waitHealthy 按退避重试健康检查，直到通过或超过startup.health_timeout
+func (app *Application) waitHealthy(check func() error) error {
+	deadline := time.Now().Add(app.config.Startup.HealthTimeout)
+	backoff := app.config.Startup.HealthBackoff
+	const maxBackoff = 30 * time.Second
 
-	// 获取现有监控地址
-	existingAddresses, err := app.redisClient.GetWatchAddresses(ctx)
-	if err != nil {
-		return fmt.Errorf("获取现有监控地址失败: %w", err)
-	}
+	for attempt := 1; ; attempt++ {
+		err := check()
+		if err == nil {
+			return nil
+		}
 
-	// 将现有地址转换为map以便快速查找
-	existingMap := make(map[string]bool)
-	for _, addr := range existingAddresses {
-		existingMap[addr] = true
-	}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return fmt.Errorf("%d 次尝试后仍未通过: %w", attempt, err)
+		}
+		wait := backoff
+		if wait > remaining {
+			wait = remaining
+		}
+		log.Printf("健康检查失败（第 %d 次）: %v，%v 后重试", attempt, err, wait)
+		time.Sleep(wait)
 
-	// 添加配置中的监控地址
-	for _, addr := range app.config.WatchAddresses {
-		if !existingMap[addr] {
-			if err := app.redisClient.AddWatchAddress(ctx, addr); err != nil {
-				log.Printf("添加监控地址 %s 失败: %v", addr, err)
-				continue
-			}
-			log.Printf("已添加监控地址: %s", addr)
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
 		}
 	}
-
-	log.Printf("监控地址初始化完成，共 %d 个地址", len(app.config.WatchAddresses))
-	return nil
 }
 
 // initLogger 初始化日志系统
-func initLogger(cfg *config.Config) error {
+//
+// 配置了server.log_buffer_size时返回保留最近日志的缓冲区，否则返回nil。
+func initLogger(cfg *config.Config) (*logBuffer, error) {
 	// 设置日志级别
 	level, err := logrus.ParseLevel(cfg.Log.Level)
 	if err != nil {
-		return fmt.Errorf("解析日志级别失败: %w", err)
+		return nil, fmt.Errorf("解析日志级别失败: %w", err)
 	}
 	logrus.SetLevel(level)
 
@@ -226,27 +188,247 @@ func initLogger(cfg *config.Config) error {
 	if cfg.Log.File != "" {
 		file, err := os.OpenFile(cfg.Log.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
 		if err != nil {
-			return fmt.Errorf("打开日志文件失败: %w", err)
+			return nil, fmt.Errorf("打开日志文件失败: %w", err)
 		}
 		logrus.SetOutput(file)
 	}
 
-	return nil
+	// 保留最近的日志供 /logs 查询
+	if cfg.Server.LogBufferSize > 0 {
+		logs := newLogBuffer(cfg.Server.LogBufferSize)
+		logrus.AddHook(logs)
+		log.SetOutput(logs.stdWriter(log.Writer()))
+		return logs, nil
+	}
+
+	return nil, nil
+}
+
+// streamLimiter 流式接口并发客户端限制，同时记录注册时标记的流式端点
+type streamLimiter struct {
+	max     int64
+	current int64
+
+	mu     sync.RWMutex
+	routes map[*mux.Route]bool
+}
+
+// mark 标记流式端点，使其不受请求超时限制（http.TimeoutHandler不支持Flush）
+func (l *streamLimiter) mark(route *mux.Route) *mux.Route {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.routes == nil {
+		l.routes = make(map[*mux.Route]bool)
+	}
+	l.routes[route] = true
+	return route
+}
+
+// isStreaming 判断路由是否为标记过的流式端点
+func (l *streamLimiter) isStreaming(route *mux.Route) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.routes[route]
+}
+
+// acquire 占用一个客户端名额，超过上限时返回false
+func (l *streamLimiter) acquire() bool {
+	if atomic.AddInt64(&l.current, 1) > l.max && l.max > 0 {
+		atomic.AddInt64(&l.current, -1)
+		return false
+	}
+	return true
+}
+
+// release 释放客户端名额
+func (l *streamLimiter) release() {
+	atomic.AddInt64(&l.current, -1)
+}
+
+// count 当前客户端数
+func (l *streamLimiter) count() int64 {
+	return atomic.LoadInt64(&l.current)
+}
+
+// readOnlyMiddleware 只读模式下拒绝所有修改类请求
+func readOnlyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "POST", "PUT", "PATCH", "DELETE":
+			http.Error(w, "服务处于只读模式", http.StatusMethodNotAllowed)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// jsonBodyMiddleware 限制修改类请求的请求体大小，并要求带请求体时使用application/json
+func jsonBodyMiddleware(maxBytes int64) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case "POST", "PUT", "PATCH", "DELETE":
+			default:
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if r.ContentLength != 0 {
+				mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+				if err != nil || mediaType != "application/json" {
+					http.Error(w, "Content-Type必须为application/json", http.StatusUnsupportedMediaType)
+					return
+				}
+			}
+
+			r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// timeoutMiddleware 为非流式端点设置请求超时，超时返回503；流式端点由streams.mark标记
+func timeoutMiddleware(timeout time.Duration, streams *streamLimiter) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		limited := http.TimeoutHandler(next, timeout, "请求处理超时")
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if route := mux.CurrentRoute(r); route != nil && streams.isStreaming(route) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			limited.ServeHTTP(w, r)
+		})
+	}
+}
+
+// logsAuthMiddleware 配置了日志访问令牌时校验 Authorization: Bearer <token> 或 token 参数
+//
+// 浏览器EventSource无法设置请求头，SSE客户端可使用token参数。
+func logsAuthMiddleware(token string, next http.HandlerFunc) http.HandlerFunc {
+	if token == "" {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		provided := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if provided == "" {
+			provided = r.URL.Query().Get("token")
+		}
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			http.Error(w, "未授权", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// decodeJSONBody 解析JSON请求体，失败时写入错误响应并返回false
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(dst); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, fmt.Sprintf("请求体不能超过 %d 字节", maxBytesErr.Limit), http.StatusRequestEntityTooLarge)
+			return false
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
 }
 
 // initHTTPServer 初始化HTTP服务器
-func initHTTPServer(cfg *config.Config, redisClient *redis.RedisClient, blockMonitor *processor.BlockMonitor, blockProcessor *processor.BlockProcessor) *http.Server {
-	router := mux.NewRouter()
+func initHTTPServer(cfg *config.Config, pipelines []*pipeline, logs *logBuffer) *http.Server {
+	root := mux.NewRouter()
+	if cfg.Server.ReadOnly {
+		root.Use(readOnlyMiddleware)
+	}
+	root.Use(jsonBodyMiddleware(cfg.Server.MaxBodyBytes))
+	streams := &streamLimiter{max: cfg.Server.MaxStreamClients}
+	if cfg.Server.RequestTimeout > 0 {
+		root.Use(timeoutMiddleware(cfg.Server.RequestTimeout, streams))
+	}
+
+	// 配置了base_path时所有端点挂载在该前缀下
+	router := root
+	if cfg.Server.BasePath != "" {
+		router = root.PathPrefix(cfg.Server.BasePath).Subrouter()
+	}
+
+	// 健康检查端点，有工作线程因重启次数超限退出时返回503
+	health := func(w http.ResponseWriter, r *http.Request) {
+		var deadWorkers int64
+		for _, p := range pipelines {
+			deadWorkers += p.blockProcessor.DeadWorkers()
+		}
 
-	// 健康检查端点
-	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
+		if deadWorkers > 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status":       "degraded",
+				"dead_workers": deadWorkers,
+				"time":         time.Now().Format(time.RFC3339),
+			})
+			return
+		}
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"status": "healthy",
 			"time":   time.Now().Format(time.RFC3339),
 		})
-	}).Methods("GET")
+	}
+	router.HandleFunc("/health", health).Methods("GET")
+	if cfg.Server.BasePath != "" && cfg.Server.RootHealth {
+		// 探针通常直接访问根路径，不经过反向代理
+		root.HandleFunc("/health", health).Methods("GET")
+	}
+
+	// 未加前缀的端点对应第一个网络
+	registerRoutes(router, pipelines[0], streams)
+
+	// 日志端点为进程级，不按网络区分
+	if logs != nil {
+		if cfg.Server.ReadOnly && cfg.Server.LogsToken == "" {
+			log.Println("警告: 只读模式下未设置 server.logs_token，不开放 /logs 和 /logs/stream")
+		} else {
+			registerLogRoutes(router, logs, streams, cfg.Server.LogsToken)
+		}
+	}
+
+	// 配置了多个网络时，各网络的端点挂载在 /networks/{name} 下
+	if len(cfg.Networks) > 0 {
+		names := make([]string, 0, len(pipelines))
+		for _, p := range pipelines {
+			names = append(names, p.name)
+			registerRoutes(router.PathPrefix("/networks/"+p.name).Subrouter(), p, streams)
+		}
+		router.HandleFunc("/networks", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"networks": names,
+			})
+		}).Methods("GET")
+	}
+
+	return &http.Server{
+		Addr:    fmt.Sprintf("%s:%s", cfg.Server.Host, cfg.Server.Port),
+		Handler: root,
+	}
+}
+
+// registerRoutes 注册单个网络流水线的API端点
+func registerRoutes(router *mux.Router, p *pipeline, streams *streamLimiter) {
+	cfg := p.config
+	redisClient := p.redisClient
+	httpClient := p.httpClient
+	blockMonitor := p.blockMonitor
+	blockProcessor := p.blockProcessor
+	notifier := p.notifier
+
+	// 区块范围查询：启用sql_store时使用SQL存储，不受Redis列表长度和过期时间限制
+	transfersByBlockRange := redisClient.GetTransfersByBlockRange
+	if p.transferStore != nil {
+		transfersByBlockRange = p.transferStore.GetTransfersByBlockRange
+	}
 
 	// 系统状态端点
 	router.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
@@ -258,15 +440,122 @@ func initHTTPServer(cfg *config.Config, redisClient *redis.RedisClient, blockMon
 		httpStats, _ := redisClient.GetSystemStats(r.Context())
 
 		status := map[string]interface{}{
-			"monitor":   monitorStats,
-			"processor": processorStats,
-			"http":      httpStats,
-			"uptime":    time.Since(time.Now()).String(),
+			"monitor":        monitorStats,
+			"processor":      processorStats,
+			"http":           httpStats,
+			"stream_clients": streams.count(),
+			"redis_pool":     redisClient.GetPoolStats(),
+			"uptime":         time.Since(time.Now()).String(),
+		}
+		if httpStats != nil {
+			// 统计由定时任务保存，附带时效便于判断是否过期
+			age := time.Since(httpStats.UpdatedAt)
+			if httpStats.UpdatedAt.IsZero() {
+				status["http_stale"] = true
+			} else {
+				status["http_age_seconds"] = int64(age.Seconds())
+				status["http_stale"] = cfg.Stats.MaxStatusAge > 0 && age > cfg.Stats.MaxStatusAge
+			}
+		}
+		if notifier != nil {
+			status["notify"] = notifier.GetStats()
+		}
+		if memoryStats, err := redisClient.GetMemoryStats(r.Context()); err == nil {
+			status["redis_memory"] = memoryStats
+		} else {
+			log.Printf("%v", err)
+		}
+
+		// Redis内存不足导致转账保存失败时标记为降级，重置统计后恢复
+		status["status"] = "ok"
+		if oomErrors, _ := processorStats["oom_save_errors"].(int64); oomErrors > 0 {
+			status["status"] = "degraded"
+			status["degraded_reason"] = fmt.Sprintf("Redis内存不足，%d 次转账保存失败", oomErrors)
 		}
 
 		json.NewEncoder(w).Encode(status)
 	}).Methods("GET")
 
+	// 当前实际解码的合约类型、代币、过滤条件和阈值
+	router.HandleFunc("/capabilities", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(blockProcessor.Capabilities())
+	}).Methods("GET")
+
+	// Prometheus指标端点
+	router.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		blockProcessor.WriteMetrics(r.Context(), w)
+	}).Methods("GET")
+
+	// 重置监控器、处理器和HTTP客户端的统计信息
+	router.HandleFunc("/stats/reset", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		blockMonitor.ResetStats()
+		blockProcessor.ResetStats()
+		httpClient.ResetStats()
+
+		json.NewEncoder(w).Encode(map[string]string{
+			"status": "reset",
+		})
+	}).Methods("POST")
+
+	// 统计历史端点，from/to为Unix秒，默认最近1小时
+	router.HandleFunc("/stats/history", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		query := r.URL.Query()
+		metric := query.Get("metric")
+		known := false
+		for _, m := range statsHistoryMetrics {
+			if m == metric {
+				known = true
+				break
+			}
+		}
+		if !known {
+			http.Error(w, fmt.Sprintf("无效的metric参数，可选: %v", statsHistoryMetrics), http.StatusBadRequest)
+			return
+		}
+
+		to := time.Now()
+		from := to.Add(-time.Hour)
+		if v := query.Get("from"); v != "" {
+			sec, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				http.Error(w, "无效的from参数", http.StatusBadRequest)
+				return
+			}
+			from = time.Unix(sec, 0)
+		}
+		if v := query.Get("to"); v != "" {
+			sec, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				http.Error(w, "无效的to参数", http.StatusBadRequest)
+				return
+			}
+			to = time.Unix(sec, 0)
+		}
+		if from.After(to) {
+			http.Error(w, "from不能晚于to", http.StatusBadRequest)
+			return
+		}
+
+		points, err := redisClient.GetStatsHistory(r.Context(), metric, from, to)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"metric": metric,
+			"from":   from.Unix(),
+			"to":     to.Unix(),
+			"points": points,
+		})
+	}).Methods("GET")
+
 	// 监控地址管理端点
 	router.HandleFunc("/addresses", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -283,13 +572,22 @@ func initHTTPServer(cfg *config.Config, redisClient *redis.RedisClient, blockMon
 		case "POST":
 			var req struct {
 				Address string `json:"address"`
+				Group   string `json:"group"`
+				Token   string `json:"token"` // 只监控该代币（TRX、TRC10、TRC20、USDT或合约地址），为空表示任意代币
+			}
+			if !decodeJSONBody(w, r, &req) {
+				return
 			}
-			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+
+			// base58区分大小写，大小写错误的地址永远不会匹配，添加时直接拒绝
+			address, err := tronaddr.NormalizeWatchAddress(req.Address, cfg.Monitor.NormalizeHexWatch)
+			if err != nil {
 				http.Error(w, err.Error(), http.StatusBadRequest)
 				return
 			}
 
-			if err := redisClient.AddWatchAddress(r.Context(), req.Address); err != nil {
+			entry := models.WatchAddress{Address: address, Group: req.Group, Token: req.Token}
+			if err := redisClient.AddWatchAddress(r.Context(), entry); err != nil {
 				http.Error(w, err.Error(), http.StatusBadRequest)
 				return
 			}
@@ -300,8 +598,7 @@ func initHTTPServer(cfg *config.Config, redisClient *redis.RedisClient, blockMon
 			var req struct {
 				Address string `json:"address"`
 			}
-			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-				http.Error(w, err.Error(), http.StatusBadRequest)
+			if !decodeJSONBody(w, r, &req) {
 				return
 			}
 
@@ -314,8 +611,131 @@ func initHTTPServer(cfg *config.Config, redisClient *redis.RedisClient, blockMon
 		}
 	}).Methods("GET", "POST", "DELETE")
 
-	// 转账记录端点
-	router.HandleFunc("/transfers", func(w http.ResponseWriter, r *http.Request) {
+	// 移除单个监控地址，purge=true时同时清理该地址的转账记录和统计信息
+	router.HandleFunc("/addresses/{addr}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		address := mux.Vars(r)["addr"]
+
+		if err := redisClient.RemoveWatchAddress(r.Context(), address); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		result := map[string]interface{}{
+			"address": address,
+			"removed": true,
+		}
+
+		if r.URL.Query().Get("purge") == "true" {
+			purged, err := redisClient.PurgeAddressData(r.Context(), address)
+			log.Printf("清理地址 %s 的数据: %v", address, purged)
+			if err != nil {
+				log.Printf("清理地址 %s 的数据未完全成功: %v", address, err)
+				result["purge_error"] = err.Error()
+			}
+			result["purged"] = purged
+		}
+
+		json.NewEncoder(w).Encode(result)
+	}).Methods("DELETE")
+
+	// 地址净流量端点：按代币汇总已保存转账的流入减流出。from_block/to_block按区块范围（闭区间），
+	// 否则按区块时间，from/to为Unix秒，默认最近24小时；token可按代币类型、代币标识或合约地址过滤
+	router.HandleFunc("/addresses/{addr}/netflow", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		address, err := tronaddr.NormalizeWatchAddress(mux.Vars(r)["addr"], cfg.Monitor.NormalizeHexWatch)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		query := r.URL.Query()
+		token := query.Get("token")
+
+		result := map[string]interface{}{
+			"address": address,
+		}
+		var transfers []*models.TransferEvent
+		var truncated bool
+		if query.Get("from_block") != "" || query.Get("to_block") != "" {
+			var fromBlock, toBlock int64
+			if _, err := fmt.Sscanf(query.Get("from_block"), "%d", &fromBlock); err != nil {
+				http.Error(w, "无效的from_block参数", http.StatusBadRequest)
+				return
+			}
+			if _, err := fmt.Sscanf(query.Get("to_block"), "%d", &toBlock); err != nil {
+				http.Error(w, "无效的to_block参数", http.StatusBadRequest)
+				return
+			}
+			if fromBlock < 0 || fromBlock > toBlock {
+				http.Error(w, "无效的区块范围", http.StatusBadRequest)
+				return
+			}
+			if toBlock-fromBlock+1 > cfg.Server.MaxBlockRange {
+				http.Error(w, fmt.Sprintf("区块范围跨度不能超过 %d", cfg.Server.MaxBlockRange), http.StatusBadRequest)
+				return
+			}
+
+			transfers, truncated, err = transfersByBlockRange(r.Context(), fromBlock, toBlock, 100000)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			result["from_block"] = fromBlock
+			result["to_block"] = toBlock
+		} else {
+			to := time.Now()
+			from := to.Add(-24 * time.Hour)
+			if v := query.Get("from"); v != "" {
+				sec, err := strconv.ParseInt(v, 10, 64)
+				if err != nil {
+					http.Error(w, "无效的from参数", http.StatusBadRequest)
+					return
+				}
+				from = time.Unix(sec, 0)
+			}
+			if v := query.Get("to"); v != "" {
+				sec, err := strconv.ParseInt(v, 10, 64)
+				if err != nil {
+					http.Error(w, "无效的to参数", http.StatusBadRequest)
+					return
+				}
+				to = time.Unix(sec, 0)
+			}
+			if from.After(to) {
+				http.Error(w, "from不能晚于to", http.StatusBadRequest)
+				return
+			}
+
+			transfers, truncated, err = redisClient.GetTransfersByTimeRange(r.Context(), from.UnixMilli(), to.UnixMilli())
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			result["from"] = from.Unix()
+			result["to"] = to.Unix()
+		}
+
+		// 范围超出保留的转账记录时结果不完整，由调用方决定是否缩小范围
+		result["truncated"] = truncated
+		result["tokens"] = models.ComputeNetFlow(address, transfers, token)
+		json.NewEncoder(w).Encode(result)
+	}).Methods("GET")
+
+	// 地址分组聚合统计端点
+	router.HandleFunc("/groups", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		stats, err := redisClient.GetGroupStats(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(stats)
+	}).Methods("GET")
+
+	// 地址分组转账记录端点
+	router.HandleFunc("/groups/{name}/transfers", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 
 		limit := int64(100) // 默认限制
@@ -326,7 +746,7 @@ func initHTTPServer(cfg *config.Config, redisClient *redis.RedisClient, blockMon
 			}
 		}
 
-		transfers, err := redisClient.GetRecentTransfers(r.Context(), limit)
+		transfers, err := redisClient.GetGroupTransfers(r.Context(), mux.Vars(r)["name"], limit)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -335,8 +755,8 @@ func initHTTPServer(cfg *config.Config, redisClient *redis.RedisClient, blockMon
 		json.NewEncoder(w).Encode(transfers)
 	}).Methods("GET")
 
-	// USDT转账记录端点
-	router.HandleFunc("/usdt-transfers", func(w http.ResponseWriter, r *http.Request) {
+	// 按代币类型的转账记录
+	router.HandleFunc("/tokens/{symbol}/transfers", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 
 		limit := int64(100) // 默认限制
@@ -347,7 +767,7 @@ func initHTTPServer(cfg *config.Config, redisClient *redis.RedisClient, blockMon
 			}
 		}
 
-		transfers, err := redisClient.GetRecentUSDTTransfers(r.Context(), limit)
+		transfers, err := redisClient.GetRecentTransfersByToken(r.Context(), mux.Vars(r)["symbol"], limit)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -356,32 +776,524 @@ func initHTTPServer(cfg *config.Config, redisClient *redis.RedisClient, blockMon
 		json.NewEncoder(w).Encode(transfers)
 	}).Methods("GET")
 
-	// USDT统计信息端点
-	router.HandleFunc("/usdt-stats", func(w http.ResponseWriter, r *http.Request) {
+	// 转账记录端点
+	streams.mark(router.HandleFunc("/transfers", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 
-		transfers, err := redisClient.GetRecentUSDTTransfers(r.Context(), 1000) // 获取最近1000条记录进行统计
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+		limit := int64(100) // 默认限制
+		if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+			if l, err := fmt.Sscanf(limitStr, "%d", &limit); err != nil || l != 1 {
+				http.Error(w, "无效的limit参数", http.StatusBadRequest)
+				return
+			}
 		}
 
-		// 计算USDT统计信息
-		var totalAmount float64
-		var totalCount int64
-		var minAmount float64 = 999999999
-		var maxAmount float64
-		addresses := make(map[string]int64)
-
-		for _, transfer := range transfers {
-			totalAmount += transfer.Amount
-			totalCount++
-			
-			if transfer.Amount < minAmount {
-				minAmount = transfer.Amount
+		// dedup=true时合并txhash、区块内位置、发送方、接收方、金额都相同的重复记录
+		query := r.URL.Query()
+		dedup := query.Get("dedup") == "true"
+		seen := make(map[string]bool)
+		isDuplicate := func(event *models.TransferEvent) bool {
+			if !dedup {
+				return false
 			}
-			if transfer.Amount > maxAmount {
-				maxAmount = transfer.Amount
+			key := fmt.Sprintf("%s|%d|%d|%d|%s|%s|%v", event.TxHash, event.TxIndex, event.ContractIndex, event.LogIndex, event.Source, event.Destination, event.Amount)
+			if seen[key] {
+				return true
+			}
+			seen[key] = true
+			return false
+		}
+
+		// display=true时按display.trx_precision填充TRX转账的display_amount
+		display := query.Get("display") == "true"
+		formatEvent := func(event *models.TransferEvent) {
+			if !display || event.TokenType != "TRX" {
+				return
+			}
+			sun := event.AmountSun
+			if sun == 0 {
+				sun = int64(math.Round(event.Amount * models.SunPerTRX)) // 旧记录没有amount_sun
+			}
+			event.DisplayAmount = models.FormatTRX(sun, cfg.Display.TRXPrecision)
+		}
+
+		// fields=a,b只输出指定字段，未指定时使用server.transfer_fields
+		fieldNames := cfg.Server.TransferFields
+		if fieldsStr := query.Get("fields"); fieldsStr != "" {
+			fieldNames = strings.Split(fieldsStr, ",")
+		}
+		fields, err := models.ParseTransferFields(fieldNames)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// 按区块范围查询（闭区间）
+		if query.Get("from_block") != "" || query.Get("to_block") != "" {
+			var fromBlock, toBlock int64
+			if _, err := fmt.Sscanf(query.Get("from_block"), "%d", &fromBlock); err != nil {
+				http.Error(w, "无效的from_block参数", http.StatusBadRequest)
+				return
+			}
+			if _, err := fmt.Sscanf(query.Get("to_block"), "%d", &toBlock); err != nil {
+				http.Error(w, "无效的to_block参数", http.StatusBadRequest)
+				return
+			}
+			if fromBlock < 0 || fromBlock > toBlock {
+				http.Error(w, "无效的区块范围", http.StatusBadRequest)
+				return
+			}
+			if toBlock-fromBlock+1 > cfg.Server.MaxBlockRange {
+				http.Error(w, fmt.Sprintf("区块范围跨度不能超过 %d", cfg.Server.MaxBlockRange), http.StatusBadRequest)
+				return
+			}
+
+			transfers, truncated, err := transfersByBlockRange(r.Context(), fromBlock, toBlock, limit)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if truncated {
+				w.Header().Set("X-Truncated", "true")
+			}
+
+			if dedup {
+				distinct := transfers[:0]
+				for _, event := range transfers {
+					if !isDuplicate(event) {
+						distinct = append(distinct, event)
+					}
+				}
+				transfers = distinct
+			}
+			projected := make([]interface{}, 0, len(transfers))
+			for _, event := range transfers {
+				formatEvent(event)
+				item, err := models.ProjectTransfer(event, fields)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				projected = append(projected, item)
+			}
+
+			json.NewEncoder(w).Encode(projected)
+			return
+		}
+
+		// 分块流式输出，避免大limit时一次性加载全部记录
+		encoder := json.NewEncoder(w)
+		count := 0
+		err = redisClient.StreamRecentTransfers(r.Context(), limit, func(event *models.TransferEvent) error {
+			if isDuplicate(event) {
+				return nil
+			}
+			formatEvent(event)
+			item, err := models.ProjectTransfer(event, fields)
+			if err != nil {
+				return err
+			}
+			if count == 0 {
+				w.Write([]byte("["))
+			} else {
+				w.Write([]byte(","))
+			}
+			count++
+			return encoder.Encode(item)
+		})
+		if err != nil && count == 0 {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err != nil {
+			log.Printf("流式输出转账记录中断: %v", err)
+		}
+
+		if count == 0 {
+			w.Write([]byte("null"))
+		} else {
+			w.Write([]byte("]"))
+		}
+	}).Methods("GET"))
+
+	// 实时转账事件流端点（SSE）
+	streams.mark(router.HandleFunc("/transfers/stream", func(w http.ResponseWriter, r *http.Request) {
+		if !streams.acquire() {
+			http.Error(w, "流式客户端数已达上限", http.StatusServiceUnavailable)
+			return
+		}
+		// 连接断开或处理过程中panic都会释放名额
+		defer streams.release()
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "不支持流式输出", http.StatusInternalServerError)
+			return
+		}
+
+		// since为上次收到的事件ID（交易哈希，同一交易有多笔转账时为 交易哈希:日志序号）或区块时间（毫秒），
+		// 也可通过SSE的Last-Event-ID头传递
+		since := r.URL.Query().Get("since")
+		if since == "" {
+			since = r.Header.Get("Last-Event-ID")
+		}
+		var sinceID string
+		var sinceTimestamp int64
+		if since != "" {
+			if ts, err := strconv.ParseInt(since, 10, 64); err == nil {
+				sinceTimestamp = ts
+			} else {
+				sinceID = since
+			}
+		}
+
+		// 先订阅再读取历史，避免补发与实时之间漏掉事件
+		events, unsubscribe, err := redisClient.SubscribeTransfers(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer unsubscribe()
+
+		var missed []*models.TransferEvent
+		if since != "" {
+			missed, err = redisClient.GetTransfersSince(r.Context(), sinceID, sinceTimestamp, cfg.Server.MaxStreamReplay)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+
+		// 补发断线期间的事件，记录已补发的事件以便跳过订阅中的重复
+		replayed := make(map[string]bool, len(missed))
+		for _, event := range missed {
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			replayed[string(data)] = true
+			fmt.Fprintf(w, "id: %s\ndata: %s\n\n", event.EventID(), data)
+		}
+		flusher.Flush()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				data, err := json.Marshal(event)
+				if err != nil || replayed[string(data)] {
+					continue
+				}
+				fmt.Fprintf(w, "id: %s\ndata: %s\n\n", event.EventID(), data)
+				flusher.Flush()
+			}
+		}
+	}).Methods("GET"))
+
+	// USDT转账记录端点
+	router.HandleFunc("/usdt-transfers", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		limit := int64(100) // 默认限制
+		if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+			if l, err := fmt.Sscanf(limitStr, "%d", &limit); err != nil || l != 1 {
+				http.Error(w, "无效的limit参数", http.StatusBadRequest)
+				return
+			}
+		}
+
+		transfers, err := redisClient.GetRecentUSDTTransfers(r.Context(), limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(transfers)
+	}).Methods("GET")
+
+	// 全链大额USDT转账记录端点（需配置usdt.whale_threshold_usd）
+	router.HandleFunc("/whale-transfers", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		limit := int64(100) // 默认限制
+		if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+			if l, err := fmt.Sscanf(limitStr, "%d", &limit); err != nil || l != 1 {
+				http.Error(w, "无效的limit参数", http.StatusBadRequest)
+				return
+			}
+		}
+
+		transfers, err := redisClient.GetRecentWhaleTransfers(r.Context(), limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(transfers)
+	}).Methods("GET")
+
+	// 原始交易查询端点（需启用monitor.retain_raw）
+	router.HandleFunc("/transactions/{txhash}/raw", func(w http.ResponseWriter, r *http.Request) {
+		raw, err := redisClient.GetRawTransaction(r.Context(), mux.Vars(r)["txhash"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if raw == nil {
+			http.Error(w, "原始交易不存在", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(raw)
+	}).Methods("GET")
+
+	// 按需获取并解码单个区块的转账事件（不经过队列，不保存）
+	router.HandleFunc("/blocks/{height}/transfers", func(w http.ResponseWriter, r *http.Request) {
+		var height int64
+		if n, err := fmt.Sscanf(mux.Vars(r)["height"], "%d", &height); err != nil || n != 1 || height < 0 {
+			http.Error(w, "无效的区块高度", http.StatusBadRequest)
+			return
+		}
+
+		raw := r.URL.Query().Get("raw") == "true"
+		transfers, params, err := blockProcessor.DecodeBlock(r.Context(), height, raw)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		result := map[string]interface{}{
+			"height":    height,
+			"transfers": transfers,
+		}
+		if raw {
+			result["raw_parameters"] = params
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}).Methods("GET")
+
+	// 按需获取并解码单笔交易（不保存），all=true时不按监控地址过滤
+	router.HandleFunc("/tx/{txhash}", func(w http.ResponseWriter, r *http.Request) {
+		txHash := mux.Vars(r)["txhash"]
+		if len(txHash) != 64 {
+			http.Error(w, "无效的交易哈希", http.StatusBadRequest)
+			return
+		}
+		all := r.URL.Query().Get("all") == "true"
+		raw := r.URL.Query().Get("raw") == "true"
+
+		blockData, contractTypes, transfers, params, err := blockProcessor.DecodeTransaction(r.Context(), txHash, all, raw)
+		if err != nil {
+			if errors.Is(err, httpclient.ErrTransactionNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		result := map[string]interface{}{
+			"tx_hash":        txHash,
+			"block_height":   blockData.Height,
+			"timestamp":      blockData.Timestamp,
+			"contract_types": contractTypes,
+			"transfers":      transfers,
+		}
+		if raw {
+			result["raw_parameters"] = params
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}).Methods("GET")
+
+	// 解码失败记录端点（需启用monitor.record_decode_failures）
+	router.HandleFunc("/decode-failures", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		limit := int64(100) // 默认限制
+		if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+			if l, err := fmt.Sscanf(limitStr, "%d", &limit); err != nil || l != 1 {
+				http.Error(w, "无效的limit参数", http.StatusBadRequest)
+				return
+			}
+		}
+
+		failures, err := redisClient.GetRecentDecodeFailures(r.Context(), limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(failures)
+	}).Methods("GET")
+
+	// 账户权限变更记录端点
+	router.HandleFunc("/permission-updates", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		limit := int64(100) // 默认限制
+		if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+			if l, err := fmt.Sscanf(limitStr, "%d", &limit); err != nil || l != 1 {
+				http.Error(w, "无效的limit参数", http.StatusBadRequest)
+				return
+			}
+		}
+
+		events, err := redisClient.GetRecentPermissionUpdates(r.Context(), limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(events)
+	}).Methods("GET")
+
+	// 自定义合约事件端点
+	router.HandleFunc("/contract-events", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		limit := int64(100) // 默认限制
+		if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+			if l, err := fmt.Sscanf(limitStr, "%d", &limit); err != nil || l != 1 {
+				http.Error(w, "无效的limit参数", http.StatusBadRequest)
+				return
+			}
+		}
+
+		events, err := redisClient.GetRecentContractEvents(r.Context(), limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(events)
+	}).Methods("GET")
+
+	// 死信队列端点
+	router.HandleFunc("/dlq", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		limit := int64(100) // 默认限制
+		if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+			if l, err := fmt.Sscanf(limitStr, "%d", &limit); err != nil || l != 1 {
+				http.Error(w, "无效的limit参数", http.StatusBadRequest)
+				return
+			}
+		}
+
+		entries, err := redisClient.GetDeadLetterBlocks(r.Context(), limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(entries)
+	}).Methods("GET")
+
+	// 转账死信队列端点（多次保存失败的转账事件）
+	router.HandleFunc("/dlq/transfers", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		limit := int64(100) // 默认限制
+		if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+			if l, err := fmt.Sscanf(limitStr, "%d", &limit); err != nil || l != 1 {
+				http.Error(w, "无效的limit参数", http.StatusBadRequest)
+				return
+			}
+		}
+
+		entries, err := redisClient.GetTransferDeadLetters(r.Context(), limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(entries)
+	}).Methods("GET")
+
+	// 重放死信队列中的区块
+	router.HandleFunc("/dlq/replay", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		limit := int64(100) // 默认限制
+		if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+			if l, err := fmt.Sscanf(limitStr, "%d", &limit); err != nil || l != 1 {
+				http.Error(w, "无效的limit参数", http.StatusBadRequest)
+				return
+			}
+		}
+
+		replayed, err := blockProcessor.ReplayDeadLetterBlocks(r.Context(), limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"replayed": replayed,
+		})
+	}).Methods("POST")
+
+	// 重新保存转账死信队列中的事件
+	router.HandleFunc("/dlq/transfers/replay", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		limit := int64(100) // 默认限制
+		if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+			if l, err := fmt.Sscanf(limitStr, "%d", &limit); err != nil || l != 1 {
+				http.Error(w, "无效的limit参数", http.StatusBadRequest)
+				return
+			}
+		}
+
+		replayed, err := blockProcessor.ReplayTransferDeadLetters(r.Context(), limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"replayed": replayed,
+		})
+	}).Methods("POST")
+
+	// USDT统计信息端点
+	router.HandleFunc("/usdt-stats", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		transfers, err := redisClient.GetRecentUSDTTransfers(r.Context(), 1000) // 获取最近1000条记录进行统计
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// 计算USDT统计信息
+		var totalAmount float64
+		var totalCount int64
+		var minAmount float64 = 999999999
+		var maxAmount float64
+		addresses := make(map[string]int64)
+
+		for _, transfer := range transfers {
+			totalAmount += transfer.Amount
+			totalCount++
+
+			if transfer.Amount < minAmount {
+				minAmount = transfer.Amount
+			}
+			if transfer.Amount > maxAmount {
+				maxAmount = transfer.Amount
 			}
 
 			addresses[transfer.Source]++
@@ -409,18 +1321,87 @@ func initHTTPServer(cfg *config.Config, redisClient *redis.RedisClient, blockMon
 
 		json.NewEncoder(w).Encode(stats)
 	}).Methods("GET")
+}
 
-	return &http.Server{
-		Addr:    fmt.Sprintf("%s:%s", cfg.Server.Host, cfg.Server.Port),
-		Handler: router,
-	}
+// registerLogRoutes 注册最近日志端点（启用server.log_buffer_size时），token非空时需要认证
+func registerLogRoutes(router *mux.Router, logs *logBuffer, streams *streamLimiter, token string) {
+	router.HandleFunc("/logs", logsAuthMiddleware(token, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		n := 100
+		if nStr := r.URL.Query().Get("n"); nStr != "" {
+			if parsed, err := strconv.Atoi(nStr); err != nil || parsed <= 0 {
+				http.Error(w, "无效的n参数", http.StatusBadRequest)
+				return
+			} else {
+				n = parsed
+			}
+		}
+		level, err := parseLogLevel(r.URL.Query().Get("level"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		json.NewEncoder(w).Encode(logs.recent(level, n))
+	})).Methods("GET")
+
+	// 实时日志（SSE），与转账事件流共用并发客户端限制
+	streams.mark(router.HandleFunc("/logs/stream", logsAuthMiddleware(token, func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "不支持流式输出", http.StatusInternalServerError)
+			return
+		}
+		level, err := parseLogLevel(r.URL.Query().Get("level"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if !streams.acquire() {
+			http.Error(w, "流式客户端数已达上限", http.StatusServiceUnavailable)
+			return
+		}
+		defer streams.release()
+
+		entries, unsubscribe := logs.subscribe()
+		defer unsubscribe()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case entry := <-entries:
+				if entry.level > level {
+					continue
+				}
+				data, err := json.Marshal(entry)
+				if err != nil {
+					continue
+				}
+				fmt.Fprintf(w, "data: %s\n\n", data)
+				flusher.Flush()
+			}
+		}
+	})).Methods("GET"))
 }
 
 func main() {
+	// 用法: tron-monitor [--force] [配置文件路径]
+	force := flag.Bool("force", false, "允许超过monitor.max_backfill_span的区块补齐")
+	flag.Parse()
+
 	// 设置默认配置文件路径
 	configPath := "config.yaml"
-	if len(os.Args) > 1 {
-		configPath = os.Args[1]
+	if flag.NArg() > 0 {
+		configPath = flag.Arg(0)
 	}
 
 	// 创建应用程序实例
@@ -428,6 +1409,11 @@ func main() {
 	if err != nil {
 		log.Fatalf("创建应用程序失败: %v", err)
 	}
+	if *force {
+		for _, p := range app.pipelines {
+			p.config.Monitor.ForceBackfill = true
+		}
+	}
 
 	// 启动应用程序
 	if err := app.Start(); err != nil {
@@ -0,0 +1,503 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/mux"
+
+	"tron-monitor/models"
+)
+
+// getJSON 请求path并解析JSON响应
+func getJSON(t *testing.T, handler http.Handler, path string) (int, map[string]interface{}) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("%s 响应不是JSON: %v: %s", path, err, rec.Body.String())
+	}
+	return rec.Code, body
+}
+
+// newHTTPTestHandler 按extra中的YAML配置创建流水线，返回与服务启动时相同的完整路由（含中间件）
+func newHTTPTestHandler(t *testing.T, extra string) (http.Handler, *pipeline) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	cfg := loadTestConfig(t, t.TempDir(), "watch_addresses:\n  - \"TJRabPrwbZy45sbavfcjinPJC18kjpRTv8\"\n"+extra)
+	cfg.Redis.Addr = server.Addr()
+	p, err := newPipeline("", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.redisClient.Close() })
+	return initHTTPServer(cfg, []*pipeline{p}, nil).Handler, p
+}
+
+func TestHealthReportsDeadWorkers(t *testing.T) {
+	handler, p := newHTTPTestHandler(t, "monitor:\n  mode: queue\n  worker_count: 1\n  max_worker_restarts: 0\n")
+
+	if code, body := getJSON(t, handler, "/health"); code != http.StatusOK || body["status"] != "healthy" {
+		t.Fatalf("/health = %d %v，期望 200 healthy", code, body)
+	}
+
+	if err := p.blockProcessor.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.blockProcessor.Stop()
+
+	// 空合约使工作线程panic，max_worker_restarts为0时不再重启
+	bad := &models.BlockData{
+		Height: 100,
+		Block: &models.Block{
+			BlockHeader: &models.BlockHeader{RawData: &models.BlockHeaderRaw{Number: 100}},
+			Trans:       []*models.Transaction{{TxID: "00", RawData: &models.TransactionRaw{Contract: []*models.Contract{nil}}}},
+		},
+	}
+	if err := p.redisClient.PushBlockData(context.Background(), bad); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for p.blockProcessor.DeadWorkers() == 0 || p.blockProcessor.GetStats()["alive_workers"] != int64(0) {
+		if time.Now().After(deadline) {
+			t.Fatal("等待工作线程退出超时")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	code, body := getJSON(t, handler, "/health")
+	if code != http.StatusServiceUnavailable || body["status"] != "degraded" || body["dead_workers"] != float64(1) {
+		t.Errorf("/health = %d %v，期望 503 degraded dead_workers=1", code, body)
+	}
+	stats := p.blockProcessor.GetStats()
+	if stats["alive_workers"] != int64(0) || stats["worker_panics"] != int64(1) || stats["dead_workers"] != int64(1) {
+		t.Errorf("统计 alive_workers=%v worker_panics=%v dead_workers=%v，期望 0/1/1",
+			stats["alive_workers"], stats["worker_panics"], stats["dead_workers"])
+	}
+}
+
+func TestStreamClientLimit(t *testing.T) {
+	_, p := newAPITestServer(t, "{}")
+	streams := &streamLimiter{max: 2}
+	router := mux.NewRouter()
+	registerRoutes(router, p, streams)
+	api := httptest.NewServer(router)
+	defer api.Close()
+
+	// open 建立SSE连接，返回响应和断开连接的函数
+	open := func() (*http.Response, context.CancelFunc) {
+		ctx, cancel := context.WithCancel(context.Background())
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, api.URL+"/transfers/stream", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, func() {
+			cancel()
+			resp.Body.Close()
+		}
+	}
+
+	var disconnects []context.CancelFunc
+	for i := 0; i < 2; i++ {
+		resp, disconnect := open()
+		defer disconnect()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("第 %d 个连接状态码 %d，期望 200", i+1, resp.StatusCode)
+		}
+		disconnects = append(disconnects, disconnect)
+	}
+	if n := streams.count(); n != 2 {
+		t.Errorf("stream_clients = %d，期望 2", n)
+	}
+
+	// 超过上限的连接在握手时被拒绝，且不占用名额
+	resp, disconnect := open()
+	disconnect()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("超过上限的连接状态码 %d，期望 503", resp.StatusCode)
+	}
+	if n := streams.count(); n != 2 {
+		t.Errorf("拒绝连接后 stream_clients = %d，期望 2", n)
+	}
+
+	// 客户端断开后释放名额，新连接可以建立
+	disconnects[0]()
+	deadline := time.Now().Add(5 * time.Second)
+	for streams.count() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("断开连接后 stream_clients = %d，期望 1", streams.count())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	resp, disconnect = open()
+	defer disconnect()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("释放名额后新连接状态码 %d，期望 200", resp.StatusCode)
+	}
+}
+
+func TestJSONBodyMiddleware(t *testing.T) {
+	handler, _ := newHTTPTestHandler(t, "server:\n  max_body_bytes: 64\n")
+
+	post := func(contentType, body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/addresses", strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	valid := `{"address":"TUpMhErZL2fhh4sVNULAbNKLokS4GjC1F4"}`
+	for _, tc := range []struct {
+		name        string
+		contentType string
+		body        string
+		want        int
+	}{
+		{"json", "application/json", valid, http.StatusCreated},
+		{"json with charset", "application/json; charset=utf-8", valid, http.StatusCreated},
+		{"form", "application/x-www-form-urlencoded", "address=TUpMhErZL2fhh4sVNULAbNKLokS4GjC1F4", http.StatusUnsupportedMediaType},
+		{"text", "text/plain", valid, http.StatusUnsupportedMediaType},
+		{"missing", "", valid, http.StatusUnsupportedMediaType},
+		{"oversized", "application/json", `{"address":"TUpMhErZL2fhh4sVNULAbNKLokS4GjC1F4","group":"` + strings.Repeat("x", 64) + `"}`, http.StatusRequestEntityTooLarge},
+	} {
+		if code := post(tc.contentType, tc.body); code != tc.want {
+			t.Errorf("%s: 状态码 %d，期望 %d", tc.name, code, tc.want)
+		}
+	}
+
+	// 查询类请求不检查Content-Type
+	req := httptest.NewRequest(http.MethodGet, "/addresses", nil)
+	req.Header.Set("Content-Type", "text/plain")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("GET请求状态码 %d，期望 200", rec.Code)
+	}
+}
+
+func TestStatusReportsRedisPoolStats(t *testing.T) {
+	handler, _ := newHTTPTestHandler(t, "redis:\n  pool_size: 4\n  max_concurrent_ops: 2\n")
+
+	// 先发起几次Redis操作，使连接被复用
+	for i := 0; i < 3; i++ {
+		getJSON(t, handler, "/status")
+	}
+	code, status := getJSON(t, handler, "/status")
+	if code != http.StatusOK {
+		t.Fatalf("/status 状态码 %d", code)
+	}
+	pool, ok := status["redis_pool"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("/status 缺少redis_pool: %v", status)
+	}
+	for _, key := range []string{"hits", "misses", "timeouts", "total_conns", "idle_conns", "stale_conns", "ops_in_flight", "ops_rejected"} {
+		if _, ok := pool[key]; !ok {
+			t.Errorf("redis_pool缺少 %s: %v", key, pool)
+		}
+	}
+	if pool["pool_size"] != float64(4) || pool["hits"].(float64) == 0 || pool["total_conns"].(float64) == 0 {
+		t.Errorf("连接池统计不符: %v", pool)
+	}
+	if pool["ops_in_flight"] != float64(0) || pool["ops_rejected"] != float64(0) {
+		t.Errorf("空闲时热点操作统计应为0: %v", pool)
+	}
+}
+
+// display=true时按display.trx_precision填充display_amount，amount_sun保持原始整数
+func TestTransfersDisplayPrecision(t *testing.T) {
+	handler, p := newHTTPTestHandler(t, "display:\n  trx_precision: 2\n")
+	data, err := json.Marshal(&models.TransferEvent{TxHash: "01", TokenType: "TRX", Amount: 1.234567, AmountSun: 1_234_567, AmountRaw: "1234567"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := redis.NewClient(&redis.Options{Addr: p.config.Redis.Addr})
+	defer client.Close()
+	if err := client.LPush(context.Background(), "transfers", data).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(path string) map[string]interface{} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		var transfers []map[string]interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &transfers); err != nil || len(transfers) != 1 {
+			t.Fatalf("%s 响应不符: %v: %s", path, err, rec.Body.String())
+		}
+		return transfers[0]
+	}
+
+	transfer := get("/transfers?display=true")
+	if transfer["display_amount"] != "1.23" {
+		t.Errorf("display_amount = %v，期望按2位小数显示 1.23", transfer["display_amount"])
+	}
+	if transfer["amount_sun"] != float64(1_234_567) || transfer["amount_raw"] != "1234567" {
+		t.Errorf("原始sun金额应保持不变: amount_sun=%v amount_raw=%v", transfer["amount_sun"], transfer["amount_raw"])
+	}
+	if _, ok := get("/transfers")["display_amount"]; ok {
+		t.Error("未设置display时不应输出display_amount")
+	}
+}
+
+// 非流式端点超过request_timeout返回503，标记的流式端点不受限制且可以Flush
+func TestTimeoutMiddlewareExemptsStreams(t *testing.T) {
+	streams := &streamLimiter{}
+	router := mux.NewRouter()
+	router.Use(timeoutMiddleware(50*time.Millisecond, streams))
+	router.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+		w.Write([]byte("done"))
+	})
+	streams.mark(router.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "不支持流式响应", http.StatusInternalServerError)
+			return
+		}
+		time.Sleep(150 * time.Millisecond)
+		w.Write([]byte("data: ok\n\n"))
+		flusher.Flush()
+	}))
+
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "请求处理超时") {
+		t.Errorf("慢请求应超时返回503，实际 %d: %s", rec.Code, rec.Body.String())
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("慢请求 %v 后才返回，应在约50ms时超时", elapsed)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stream", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "data: ok\n\n" || !rec.Flushed {
+		t.Errorf("流式端点不应受超时限制，实际 %d flushed=%v: %s", rec.Code, rec.Flushed, rec.Body.String())
+	}
+}
+
+// /stats/history 按from/to返回窗口内的数据点，参数无效时返回400
+func TestStatsHistoryEndpointWindow(t *testing.T) {
+	handler, p := newHTTPTestHandler(t, "")
+	start := time.Unix(1700000000, 0)
+	for i := 0; i < 3; i++ {
+		at := start.Add(time.Duration(i) * time.Minute)
+		if err := p.redisClient.SaveStatsSnapshot(context.Background(), at, map[string]int64{"queue_size": int64(i + 1)}, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	code, body := getJSON(t, handler, "/stats/history?metric=queue_size&from=1700000060&to=1700000120")
+	points, _ := body["points"].([]interface{})
+	if code != http.StatusOK || len(points) != 2 || body["from"] != float64(1700000060) || body["to"] != float64(1700000120) {
+		t.Fatalf("/stats/history = %d %v，期望窗口内2个数据点", code, body)
+	}
+	if first := points[0].(map[string]interface{}); first["timestamp"] != float64(1700000060) || first["value"] != float64(2) {
+		t.Errorf("第一个数据点 %v，期望 timestamp=1700000060 value=2", first)
+	}
+
+	for _, path := range []string{
+		"/stats/history?metric=unknown",
+		"/stats/history?metric=queue_size&from=abc",
+		"/stats/history?metric=queue_size&from=1700000120&to=1700000060",
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s = %d，期望 400", path, rec.Code)
+		}
+	}
+}
+
+// 只读模式下修改类请求返回405且不产生修改，查询类请求正常
+func TestReadOnlyMode(t *testing.T) {
+	handler, p := newHTTPTestHandler(t, "server:\n  read_only: true\n")
+	if err := p.redisClient.AddWatchAddress(context.Background(), models.WatchAddress{Address: "TJRabPrwbZy45sbavfcjinPJC18kjpRTv8"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		method, path, body string
+	}{
+		{http.MethodPost, "/addresses", `{"address":"TUpMhErZL2fhh4sVNULAbNKLokS4GjC1F4"}`},
+		{http.MethodDelete, "/addresses/TJRabPrwbZy45sbavfcjinPJC18kjpRTv8", ""},
+		{http.MethodPost, "/stats/reset", ""},
+	} {
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusMethodNotAllowed || !strings.Contains(rec.Body.String(), "只读模式") {
+			t.Errorf("%s %s = %d %s，期望 405", tc.method, tc.path, rec.Code, rec.Body.String())
+		}
+	}
+
+	addresses, err := p.redisClient.GetWatchAddresses(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addresses) != 1 || addresses[0] != "TJRabPrwbZy45sbavfcjinPJC18kjpRTv8" {
+		t.Errorf("只读模式下监控地址被修改: %v", addresses)
+	}
+
+	if code, body := getJSON(t, handler, "/health"); code != http.StatusOK || body["status"] != "healthy" {
+		t.Errorf("/health = %d %v，只读模式下查询应正常", code, body)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/addresses", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "TJRabPrwbZy45sbavfcjinPJC18kjpRTv8") {
+		t.Errorf("GET /addresses = %d %s，只读模式下查询应正常", rec.Code, rec.Body.String())
+	}
+}
+
+// 配置base_path后端点只在前缀下可用，root_health开启时根路径的/health仍然可用
+func TestBasePathRoutes(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		rootHealth bool
+	}{
+		{"prefix only", false},
+		{"root health", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			handler, _ := newHTTPTestHandler(t, fmt.Sprintf("server:\n  base_path: /tron-monitor\n  root_health: %v\n", tc.rootHealth))
+			status := func(path string) int {
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+				return rec.Code
+			}
+
+			for _, path := range []string{"/tron-monitor/health", "/tron-monitor/status", "/tron-monitor/addresses"} {
+				if code := status(path); code != http.StatusOK {
+					t.Errorf("%s = %d，期望 200", path, code)
+				}
+			}
+			for _, path := range []string{"/status", "/addresses", "/tron-monitor"} {
+				if code := status(path); code != http.StatusNotFound {
+					t.Errorf("%s = %d，期望不带前缀时 404", path, code)
+				}
+			}
+			want := http.StatusNotFound
+			if tc.rootHealth {
+				want = http.StatusOK
+			}
+			if code := status("/health"); code != want {
+				t.Errorf("/health = %d，期望 %d", code, want)
+			}
+		})
+	}
+}
+
+// /capabilities 反映配置的代币开关、USDT合约和当前解码方式实际使用的函数或事件
+func TestCapabilitiesReflectConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		extra     string
+		signature string // TRC20解码使用的函数或事件签名
+		trc721    int
+	}{
+		{"calldata", "monitor:\n  enable_trc10: false\n", "transfer(address,uint256)", 0},
+		{"logs", "monitor:\n  enable_trc10: false\n  trc20_decode_mode: logs\n  tag_standard: true\n", "Transfer(address,address,uint256)", 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			handler, _ := newHTTPTestHandler(t, tc.extra+"usdt:\n  contract_address: \"TXYZopYRdj2D9XRtbG411XZZ3kM5VkAeBf\"\n  decimals: 18\n")
+			code, body := getJSON(t, handler, "/capabilities")
+			if code != http.StatusOK {
+				t.Fatalf("/capabilities = %d", code)
+			}
+
+			tokens := map[string]map[string]interface{}{}
+			for _, token := range body["tokens"].([]interface{}) {
+				token := token.(map[string]interface{})
+				tokens[token["symbol"].(string)] = token
+			}
+			if tokens["TRX"]["enabled"] != true || tokens["TRC10"]["enabled"] != false || tokens["TRC20"]["enabled"] != true {
+				t.Errorf("代币开关不符: %v", body["tokens"])
+			}
+			if usdt := tokens["USDT"]; usdt["contract_address"] != "TXYZopYRdj2D9XRtbG411XZZ3kM5VkAeBf" || usdt["decimals"] != float64(18) {
+				t.Errorf("USDT配置不符: %v", usdt)
+			}
+
+			trc20 := body["trc20"].([]interface{})
+			if len(trc20) != 1 || trc20[0].(map[string]interface{})["signature"] != tc.signature {
+				t.Errorf("trc20 = %v，期望只包含 %s", trc20, tc.signature)
+			}
+			if trc721 := body["trc721"].([]interface{}); len(trc721) != tc.trc721 {
+				t.Errorf("trc721 = %v，期望 %d 项", trc721, tc.trc721)
+			}
+			if got := fmt.Sprint(body["contract_types"]); got != "[TransferAssetContract TransferContract TriggerSmartContract]" {
+				t.Errorf("contract_types = %s", got)
+			}
+		})
+	}
+}
+
+// Redis返回OOM导致转账保存失败时 /status 显示degraded，重置统计后恢复
+func TestStatusDegradedOnRedisOOM(t *testing.T) {
+	server := miniredis.RunT(t)
+	cfg := loadTestConfig(t, t.TempDir(), "watch_addresses:\n  - \"TJRabPrwbZy45sbavfcjinPJC18kjpRTv8\"\nmonitor:\n  mode: direct\nredis:\n  save_retry_max: 1\n  save_retry_backoff: 1ms\n")
+	cfg.Redis.Addr = server.Addr()
+	p, err := newPipeline("", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.redisClient.Close()
+	if err := p.initWatchAddresses(); err != nil {
+		t.Fatal(err)
+	}
+	handler := initHTTPServer(cfg, []*pipeline{p}, nil).Handler
+
+	block := func(height int64) *models.BlockData {
+		var blockData models.BlockData
+		data := fmt.Sprintf(`{"height":%d,"blockID":"%064x","timestamp":1700000000000,"block":{"transactions":[{"txID":"%064x","raw_data":{"contract":[{"type":"TransferContract","parameter":{"value":{"owner_address":"41%s","to_address":"41%s","amount":1000000}}}]},"ret":[{"contractRet":"SUCCESS"}]}]}}`,
+			height, height, height, "5bcd41bb4b0c3a1dc5b2e6c2d3c1a7f0f1e2d3c4", "5bcd41bb4b0c3a1dc5b2e6c2d3c1a7f0f1e2d3c5")
+		if err := json.Unmarshal([]byte(data), &blockData); err != nil {
+			t.Fatal(err)
+		}
+		return &blockData
+	}
+
+	// 先成功处理一个区块以缓存监控地址，之后所有Redis命令都返回OOM
+	if err := p.blockProcessor.ProcessBlock(block(100)); err != nil {
+		t.Fatal(err)
+	}
+	if code, body := getJSON(t, handler, "/status"); code != http.StatusOK || body["status"] != "ok" {
+		t.Fatalf("/status = %d status=%v，期望 ok", code, body["status"])
+	}
+
+	server.SetError("OOM command not allowed when used memory > 'maxmemory'.")
+	p.blockProcessor.ProcessBlock(block(101))
+	server.SetError("")
+
+	code, body := getJSON(t, handler, "/status")
+	if code != http.StatusOK || body["status"] != "degraded" || !strings.Contains(fmt.Sprint(body["degraded_reason"]), "Redis内存不足") {
+		t.Fatalf("/status = %d status=%v reason=%v，期望 degraded", code, body["status"], body["degraded_reason"])
+	}
+	if processor := body["processor"].(map[string]interface{}); processor["oom_save_errors"] == float64(0) {
+		t.Errorf("oom_save_errors 应大于0: %v", processor["oom_save_errors"])
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/stats/reset", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if _, body := getJSON(t, handler, "/status"); body["status"] != "ok" {
+		t.Errorf("重置统计后 status=%v，期望 ok", body["status"])
+	}
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SunPerTRX 1 TRX = 1,000,000 sun
+const SunPerTRX = 1000000
+
+// TRXDecimals TRX的小数位数
+const TRXDecimals = 6
+
+// tronMainnetLaunchMillis TRON主网上线时间（2018-06-25，毫秒），更早的区块时间不合理
+const tronMainnetLaunchMillis = 1529884800000
+
+// NormalizeTimestampMillis 按数量级判断时间戳单位并统一为毫秒
+//
+// 小于1e11视为秒（1e11毫秒约为1973年），不小于1e14视为微秒（1e14毫秒约为5138年）。
+// ok为false表示换算后的时间仍不合理（为0、早于主网上线或超前当前时间1小时以上），调用方应记录警告。
+func NormalizeTimestampMillis(ts int64) (millis int64, ok bool) {
+	switch {
+	case ts > 0 && ts < 1e11:
+		ts *= 1000
+	case ts >= 1e14:
+		ts /= 1000
+	}
+	return ts, ts >= tronMainnetLaunchMillis && ts <= time.Now().Add(time.Hour).UnixMilli()
+}
+
+// FormatTRX 将sun金额格式化为指定小数位数的TRX字符串（四舍五入），precision取值0-6
+func FormatTRX(sun int64, precision int) string {
+	if precision < 0 {
+		precision = 0
+	}
+	if precision > TRXDecimals {
+		precision = TRXDecimals
+	}
+
+	sign := ""
+	if sun < 0 {
+		sign = "-"
+		sun = -sun
+	}
+
+	// 按目标精度四舍五入，scaled的单位为 10^-precision TRX
+	unit := int64(1)
+	for i := precision; i < TRXDecimals; i++ {
+		unit *= 10
+	}
+	scaled := (sun + unit/2) / unit
+
+	if precision == 0 {
+		return fmt.Sprintf("%s%d", sign, scaled)
+	}
+
+	divisor := int64(SunPerTRX / unit)
+	frac := fmt.Sprintf("%d", scaled%divisor)
+	return fmt.Sprintf("%s%d.%s%s", sign, scaled/divisor, strings.Repeat("0", precision-len(frac)), frac)
+}
@@ -0,0 +1,50 @@
+package models
+
+import "testing"
+
+func TestNormalizeTimestampMillis(t *testing.T) {
+	tests := []struct {
+		name   string
+		ts     int64
+		millis int64
+		ok     bool
+	}{
+		{"毫秒", 1700000000000, 1700000000000, true},
+		{"秒", 1700000000, 1700000000000, true},
+		{"微秒", 1700000000000000, 1700000000000, true},
+		{"零", 0, 0, false},
+		{"早于主网上线", 1500000000000, 1500000000000, false},
+		{"超前当前时间", 4102444800000, 4102444800000, false},
+	}
+	for _, tt := range tests {
+		millis, ok := NormalizeTimestampMillis(tt.ts)
+		if millis != tt.millis || ok != tt.ok {
+			t.Errorf("%s: NormalizeTimestampMillis(%d) = %d, %v，期望 %d, %v", tt.name, tt.ts, millis, ok, tt.millis, tt.ok)
+		}
+	}
+}
+
+func TestFormatTRX(t *testing.T) {
+	tests := []struct {
+		sun       int64
+		precision int
+		want      string
+	}{
+		{1_234_567, 6, "1.234567"},
+		{1_234_567, 3, "1.235"},
+		{1_234_567, 2, "1.23"},
+		{1_234_567, 0, "1"},
+		{1_500_000, 0, "2"},
+		{999_999, 2, "1.00"},
+		{1, 6, "0.000001"},
+		{1, 2, "0.00"},
+		{-1_234_567, 2, "-1.23"},
+		{1_234_567, 9, "1.234567"}, // 超过6位按6位
+		{1_234_567, -1, "1"},       // 小于0按0位
+	}
+	for _, tt := range tests {
+		if got := FormatTRX(tt.sun, tt.precision); got != tt.want {
+			t.Errorf("FormatTRX(%d, %d) = %q，期望 %q", tt.sun, tt.precision, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// plainAmounts 为true时转账金额按十进制小数输出，见 SetPlainAmounts
+var plainAmounts bool
+
+// SetPlainAmounts 设置转账事件序列化时金额是否始终输出为十进制小数
+//
+// encoding/json 对绝对值小于1e-6或不小于1e21的float64使用科学计数法（如18位精度代币的小额转账），
+// 部分下游解析器不支持。启动时根据配置设置一次，运行期间不应修改。
+func SetPlainAmounts(enabled bool) {
+	plainAmounts = enabled
+}
+
+// MarshalJSON 启用纯小数金额时amount、fee、usd_value不使用科学计数法，其余字段与默认序列化一致
+func (e TransferEvent) MarshalJSON() ([]byte, error) {
+	type event TransferEvent // 去掉MarshalJSON方法，避免递归
+	if !plainAmounts {
+		return json.Marshal(event(e))
+	}
+
+	var usdValue json.Number
+	if e.USDValue != 0 {
+		usdValue = decimalNumber(e.USDValue)
+	}
+
+	// 外层字段与内嵌结构体的同名字段冲突时外层优先
+	return json.Marshal(struct {
+		event
+		Amount   json.Number `json:"amount"`
+		Fee      json.Number `json:"fee"`
+		USDValue json.Number `json:"usd_value,omitempty"`
+	}{
+		event:    event(e),
+		Amount:   decimalNumber(e.Amount),
+		Fee:      decimalNumber(e.Fee),
+		USDValue: usdValue,
+	})
+}
+
+// decimalNumber 将float64格式化为不带指数的最短十进制表示
+func decimalNumber(v float64) json.Number {
+	return json.Number(strconv.FormatFloat(v, 'f', -1, 64))
+}
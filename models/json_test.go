@@ -0,0 +1,58 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// 启用plain_amounts时大额和极小金额都不使用科学计数法，反序列化后数值不变；关闭时保持默认序列化
+func TestTransferEventPlainAmounts(t *testing.T) {
+	defer SetPlainAmounts(plainAmounts)
+
+	event := &TransferEvent{TxHash: "a", Amount: 1.2345e22, Fee: 1e-18, USDValue: 2.5e21}
+
+	SetPlainAmounts(true)
+	data, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`"amount":12345000000000000000000`,
+		`"fee":0.000000000000000001`,
+		`"usd_value":2500000000000000000000`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("序列化结果缺少 %s: %s", want, data)
+		}
+	}
+	if strings.Contains(string(data), "e+") || strings.Contains(string(data), "e-") {
+		t.Errorf("金额不应使用科学计数法: %s", data)
+	}
+
+	var decoded TransferEvent
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Amount != event.Amount || decoded.Fee != event.Fee || decoded.USDValue != event.USDValue || decoded.TxHash != "a" {
+		t.Errorf("反序列化结果 %+v 与原值不一致", decoded)
+	}
+
+	// usd_value为0时仍然省略
+	data, err = json.Marshal(&TransferEvent{TxHash: "b", Amount: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "usd_value") {
+		t.Errorf("usd_value为0时应省略: %s", data)
+	}
+
+	SetPlainAmounts(false)
+	data, err = json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"amount":1.2345e+22`) {
+		t.Errorf("关闭时应保持默认序列化: %s", data)
+	}
+}
@@ -0,0 +1,64 @@
+package models
+
+import "fmt"
+
+// TokenNetFlow 单个代币的净流量
+type TokenNetFlow struct {
+	Token    string  `json:"token"`
+	In       float64 `json:"in"`  // 流入合计
+	Out      float64 `json:"out"` // 流出合计
+	Net      float64 `json:"net"` // 流入减流出
+	Count    int     `json:"count"`
+	Contract string  `json:"contract_address,omitempty"`
+}
+
+// NetFlowToken 净流量统计使用的代币标识：TRX、USDT直接使用代币类型，
+// 其他TRC20/TRC721代币为 类型:合约地址，TRC10代币为 TRC10:资产名
+func NetFlowToken(event *TransferEvent) string {
+	switch {
+	case event.AssetName != "" && event.TokenType == "TRC10":
+		return "TRC10:" + event.AssetName
+	case event.ContractAddress != "" && event.TokenType != "USDT":
+		return event.TokenType + ":" + event.ContractAddress
+	default:
+		return event.TokenType
+	}
+}
+
+// ComputeNetFlow 按代币汇总地址在给定转账中的流入和流出
+//
+// token非空时只统计代币类型、代币标识或合约地址与之相同的转账。同一笔转账
+// （交易哈希和区块内位置都相同）只计一次；地址给自己转账时流入流出相抵，净额为0。
+func ComputeNetFlow(address string, events []*TransferEvent, token string) map[string]*TokenNetFlow {
+	flows := make(map[string]*TokenNetFlow)
+	seen := make(map[string]bool)
+	for _, event := range events {
+		if event.Source != address && event.Destination != address {
+			continue
+		}
+		key := NetFlowToken(event)
+		if token != "" && token != event.TokenType && token != key && token != event.ContractAddress {
+			continue
+		}
+		id := fmt.Sprintf("%s|%d|%d|%d", event.TxHash, event.TxIndex, event.ContractIndex, event.LogIndex)
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		flow, ok := flows[key]
+		if !ok {
+			flow = &TokenNetFlow{Token: key, Contract: event.ContractAddress}
+			flows[key] = flow
+		}
+		flow.Count++
+		if event.Destination == address {
+			flow.In += event.Amount
+		}
+		if event.Source == address {
+			flow.Out += event.Amount
+		}
+		flow.Net = flow.In - flow.Out
+	}
+	return flows
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// transferFields TransferEvent的全部JSON字段名
+var transferFields = jsonFieldNames(reflect.TypeOf(TransferEvent{}))
+
+// jsonFieldNames 按json标签获取结构体的字段名
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// ParseTransferFields 校验转账事件字段名并返回字段集合，names为空时返回nil（输出全部字段）
+func ParseTransferFields(names []string) (map[string]bool, error) {
+	var fields map[string]bool
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !transferFields[name] {
+			return nil, fmt.Errorf("未知的转账字段: %s", name)
+		}
+		if fields == nil {
+			fields = make(map[string]bool)
+		}
+		fields[name] = true
+	}
+	return fields, nil
+}
+
+// ProjectTransfer 只保留fields中的字段，fields为nil时原样返回
+//
+// 先按完整事件序列化，金额格式、omitempty等规则与不投影时一致。
+func ProjectTransfer(e *TransferEvent, fields map[string]bool) (interface{}, error) {
+	if fields == nil {
+		return e, nil
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil, fmt.Errorf("序列化转账事件失败: %w", err)
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, fmt.Errorf("反序列化转账事件失败: %w", err)
+	}
+
+	projected := make(map[string]json.RawMessage, len(fields))
+	for name := range fields {
+		if value, ok := all[name]; ok {
+			projected[name] = value
+		}
+	}
+	return projected, nil
+}
@@ -1,6 +1,9 @@
 package models
 
 import (
+	"encoding/json"
+	"fmt"
+	"strings"
 	"time"
 )
 
@@ -11,6 +14,22 @@ type BlockData struct {
 	Timestamp int64     `json:"timestamp"`
 	Block     *Block    `json:"block"`
 	CreatedAt time.Time `json:"created_at"`
+	Attempts  int       `json:"attempts,omitempty"` // 已处理失败的次数
+}
+
+// DeadLetterTransfer 多次保存失败后进入死信队列的转账事件
+type DeadLetterTransfer struct {
+	Event    *TransferEvent `json:"event"`
+	Error    string         `json:"error"`
+	FailedAt time.Time      `json:"failed_at"`
+}
+
+// DeadLetterBlock 多次处理失败后进入死信队列的区块
+type DeadLetterBlock struct {
+	Block    *BlockData `json:"block"`
+	Error    string     `json:"error"`
+	Attempts int        `json:"attempts"`
+	FailedAt time.Time  `json:"failed_at"`
 }
 
 // Block Tron区块结构
@@ -59,6 +78,26 @@ type TransactionRaw struct {
 type Contract struct {
 	Type      string      `json:"type"`
 	Parameter interface{} `json:"parameter"`
+
+	// 接口返回的原始参数JSON（地址规范化之前），只在按需解码接口请求raw时保留
+	RawParameter json.RawMessage `json:"-"`
+}
+
+// TypeName 获取合约类型名称
+//
+// 部分接口只在parameter.type_url中给出protobuf类型（如 type.googleapis.com/protocol.TransferContract），
+// type为空时从type_url中取出类型名，统一为 TransferContract 这样的形式。
+func (c *Contract) TypeName() string {
+	if c.Type != "" {
+		return c.Type
+	}
+
+	param, _ := c.Parameter.(map[string]interface{})
+	typeURL, _ := param["type_url"].(string)
+	if i := strings.LastIndex(typeURL, "/"); i >= 0 {
+		typeURL = typeURL[i+1:]
+	}
+	return strings.TrimPrefix(typeURL, "protocol.")
 }
 
 // TransferContract 转账合约
@@ -89,21 +128,149 @@ type TransactionResult struct {
 	ContractRet string `json:"contractRet"`
 }
 
+// ContractResultSuccess 合约执行成功
+const ContractResultSuccess = "SUCCESS"
+
+// ContractResult 获取第index个合约的执行结果，Ret为空、长度不足或元素为nil时返回空字符串（结果未知）
+func (tx *Transaction) ContractResult(index int) string {
+	if index < 0 || index >= len(tx.Ret) || tx.Ret[index] == nil {
+		return ""
+	}
+	return tx.Ret[index].ContractRet
+}
+
 // TransferEvent 转账事件
 type TransferEvent struct {
-	Source          string  `json:"source"`
-	Destination     string  `json:"destination"`
-	Amount          float64 `json:"amount"`
-	Fee             float64 `json:"fee"`
-	TxHash          string  `json:"tx_hash"`
-	BlockHeight     int64   `json:"block_height"`
-	Timestamp       int64   `json:"timestamp"`
-	Confirmations   int     `json:"confirmations"`
-	TokenType       string  `json:"token_type"` // TRX, TRC10, TRC20, USDT
-	ContractAddress string  `json:"contract_address,omitempty"`
-	AssetName       string  `json:"asset_name,omitempty"`
-	IsUSDT          bool    `json:"is_usdt,omitempty"` // 是否为USDT转账
-	USDValue        float64 `json:"usd_value,omitempty"` // USD价值（如果是USDT）
+	Source           string   `json:"source"`
+	Destination      string   `json:"destination"`
+	Amount           float64  `json:"amount"`
+	AmountSun        int64    `json:"amount_sun,omitempty"`         // TRX转账的原始sun金额（整数，无精度损失）
+	AmountRaw        string   `json:"amount_raw,omitempty"`         // 原始整数金额（sun或代币最小单位，十进制字符串），Amount为按精度换算后的值
+	AmountDecimal    string   `json:"amount_decimal,omitempty"`     // 按精度换算后的精确十进制金额（USDT），不受浮点精度影响
+	AmountParseError bool     `json:"amount_parse_error,omitempty"` // 金额无法解析（金额字段为0），原始金额见AmountHex
+	AmountHex        string   `json:"amount_hex,omitempty"`         // 无法解析的原始十六进制金额
+	Standard         string   `json:"standard,omitempty"`           // 合约转账的合约标准（TRC20、TRC721），启用monitor.tag_standard时记录
+	TokenID          string   `json:"token_id,omitempty"`           // TRC721转账的tokenId（十进制字符串）
+	DisplayAmount    string   `json:"display_amount,omitempty"`     // 按display配置格式化的金额（仅API展示时填充）
+	Fee              float64  `json:"fee"`
+	TxHash           string   `json:"tx_hash"`
+	LogIndex         int      `json:"log_index,omitempty"` // 日志模式下Transfer事件在交易日志中的序号，同一交易的多笔转账互不相同
+	TxIndex          int      `json:"tx_index"`            // 交易在区块中的序号（从0开始，启用monitor.record_tx_index时记录，否则为0）
+	ContractIndex    int      `json:"contract_index"`      // 合约在交易中的序号（从0开始，启用monitor.record_tx_index时记录，否则为0）
+	BlockHeight      int64    `json:"block_height"`
+	BlockHash        string   `json:"block_hash,omitempty"`   // 所在区块的哈希（启用monitor.record_block_hash时记录），用于对照区块浏览器和识别重组
+	Timestamp        int64    `json:"timestamp"`              // 区块时间（毫秒）
+	TxTimestamp      int64    `json:"tx_timestamp,omitempty"` // 交易创建时间（毫秒），原始数据未提供时为0
+	Confirmations    int      `json:"confirmations"`          // 发送通知时所在区块的确认数（notify.min_confirmations大于0时），保存的记录为0
+	TokenType        string   `json:"token_type"`             // TRX, TRC10, TRC20, USDT
+	ContractAddress  string   `json:"contract_address,omitempty"`
+	AssetName        string   `json:"asset_name,omitempty"`
+	IsUSDT           bool     `json:"is_usdt,omitempty"`           // 是否为USDT转账
+	USDValue         float64  `json:"usd_value,omitempty"`         // USD价值（如果是USDT）
+	Whale            bool     `json:"whale,omitempty"`             // USD价值超过usdt.whale_threshold_usd的大额转账
+	WhaleOnly        bool     `json:"whale_only,omitempty"`        // 不涉及监控地址的大额转账，只保存到whale_transfers
+	Sampled          bool     `json:"sampled,omitempty"`           // 监控地址为空时按抽样保存的转账（monitor.empty_watch_mode为sample）
+	PriceFallback    bool     `json:"price_fallback,omitempty"`    // 历史价格不可用，USD价值按最新价格计算
+	SourceLabel      string   `json:"source_label,omitempty"`      // 发送方地址标签
+	DestinationLabel string   `json:"destination_label,omitempty"` // 接收方地址标签
+	RawTxKey         string   `json:"raw_tx_key,omitempty"`        // 原始交易JSON的Redis键（启用retain_raw时）
+	Groups           []string `json:"groups,omitempty"`            // 涉及的监控地址所属分组
+
+	// 监控地址转账后的余额，原始整数金额（启用monitor.balance_snapshot时）
+	SourceBalanceAfter string `json:"source_balance_after,omitempty"`
+	DestBalanceAfter   string `json:"dest_balance_after,omitempty"`
+}
+
+// EventID 转账的唯一标识，用作流式输出的事件ID和since游标：交易哈希，日志序号大于0时为 交易哈希:日志序号
+func (e *TransferEvent) EventID() string {
+	if e.LogIndex > 0 {
+		return fmt.Sprintf("%s:%d", e.TxHash, e.LogIndex)
+	}
+	return e.TxHash
+}
+
+// TransferReverted 已保存的转账所在区块被重组后发布的撤销事件
+type TransferReverted struct {
+	Type         string  `json:"type"` // 固定为 transfer_reverted
+	TxHash       string  `json:"tx_hash"`
+	LogIndex     int     `json:"log_index,omitempty"`
+	BlockHeight  int64   `json:"block_height"`
+	BlockHash    string  `json:"block_hash"`     // 被重组的原区块哈希
+	NewBlockHash string  `json:"new_block_hash"` // 同一高度当前的区块哈希
+	Source       string  `json:"source"`
+	Destination  string  `json:"destination"`
+	TokenType    string  `json:"token_type"`
+	Amount       float64 `json:"amount"`
+	Timestamp    int64   `json:"timestamp"` // 撤销时间（毫秒）
+}
+
+// GroupStats 地址分组的聚合统计
+type GroupStats struct {
+	Name          string             `json:"name"`
+	TransferCount int64              `json:"transfer_count"`
+	Volume        map[string]float64 `json:"volume"` // 代币标识（同NetFlowToken） -> 转账金额合计
+}
+
+// PermissionUpdateEvent 账户权限变更事件（AccountPermissionUpdateContract）
+type PermissionUpdateEvent struct {
+	Owner             string        `json:"owner"`
+	OwnerPermission   *Permission   `json:"owner_permission,omitempty"`
+	WitnessPermission *Permission   `json:"witness_permission,omitempty"`
+	ActivePermissions []*Permission `json:"active_permissions"`
+	TxHash            string        `json:"tx_hash"`
+	BlockHeight       int64         `json:"block_height"`
+	Timestamp         int64         `json:"timestamp"`
+}
+
+// Permission 账户权限
+type Permission struct {
+	Type       string           `json:"type,omitempty"`
+	ID         int64            `json:"id"`
+	Name       string           `json:"permission_name"`
+	Threshold  int64            `json:"threshold"`
+	Operations string           `json:"operations,omitempty"`
+	Keys       []*PermissionKey `json:"keys"`
+}
+
+// PermissionKey 权限密钥及权重
+type PermissionKey struct {
+	Address string `json:"address"`
+	Weight  int64  `json:"weight"`
+}
+
+// ContractEvent 通过交易日志解码的自定义合约事件
+type ContractEvent struct {
+	Contract       string            `json:"contract"`
+	EventSignature string            `json:"event_signature"`
+	Topic          string            `json:"topic"`
+	Fields         map[string]string `json:"fields"`
+	TxHash         string            `json:"tx_hash"`
+	LogIndex       int               `json:"log_index"`
+	BlockHeight    int64             `json:"block_height"`
+	Timestamp      int64             `json:"timestamp"`
+}
+
+// DecodeFailure 无法解码的合约调用记录
+type DecodeFailure struct {
+	Contract    string `json:"contract"`
+	Selector    string `json:"selector"`
+	Data        string `json:"data"`
+	Truncated   bool   `json:"truncated,omitempty"`
+	Reason      string `json:"reason"`
+	TxHash      string `json:"tx_hash"`
+	BlockHeight int64  `json:"block_height"`
+	Timestamp   int64  `json:"timestamp"`
+}
+
+// RawContractParameter 合约的原始参数（TronGrid返回的JSON），用于对照排查解码问题
+type RawContractParameter struct {
+	TxHash        string          `json:"tx_hash"`
+	ContractIndex int             `json:"contract_index"`
+	Type          string          `json:"type"`
+	Parameter     json.RawMessage `json:"parameter,omitempty"`
+	Preview       string          `json:"preview,omitempty"` // 超过大小上限时只保留开头部分（不是完整JSON）
+	Size          int             `json:"size"`              // 原始参数JSON的字节数
+	Truncated     bool            `json:"truncated,omitempty"`
 }
 
 // SystemStats 系统统计信息
@@ -115,11 +282,20 @@ type SystemStats struct {
 	Uptime               time.Duration `json:"uptime"`
 	ErrorCount           int64         `json:"error_count"`
 	SuccessCount         int64         `json:"success_count"`
+	UpdatedAt            time.Time     `json:"updated_at"` // 保存时间，用于判断统计是否过期
+}
+
+// StatsPoint 统计历史中的一个数据点
+type StatsPoint struct {
+	Timestamp int64 `json:"timestamp"` // 快照时间（Unix秒）
+	Value     int64 `json:"value"`
 }
 
 // WatchAddress 监控地址信息
 type WatchAddress struct {
 	Address       string    `json:"address"`
+	Group         string    `json:"group,omitempty"` // 所属分组（如客户、交易台），用于聚合统计
+	Token         string    `json:"token,omitempty"` // 代币范围（TRX、TRC10、TRC20、USDT或合约地址），为空表示匹配任意代币
 	AddedAt       time.Time `json:"added_at"`
 	LastSeen      time.Time `json:"last_seen,omitempty"`
 	TransferCount int64     `json:"transfer_count"`
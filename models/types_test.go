@@ -0,0 +1,71 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// 区块中第一笔交易、交易中第一个合约的序号为0，序列化时不能省略
+func TestTransferEventKeepsZeroIndexes(t *testing.T) {
+	data, err := json.Marshal(&TransferEvent{TxHash: "a", TxIndex: 0, ContractIndex: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"tx_index":0`, `"contract_index":0`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("序列化结果缺少 %s: %s", want, data)
+		}
+	}
+}
+
+func TestTransferEventID(t *testing.T) {
+	if id := (&TransferEvent{TxHash: "a"}).EventID(); id != "a" {
+		t.Errorf("EventID = %s，期望 a", id)
+	}
+	if id := (&TransferEvent{TxHash: "a", LogIndex: 2}).EventID(); id != "a:2" {
+		t.Errorf("EventID = %s，期望 a:2", id)
+	}
+}
+
+// type为空时从parameter.type_url中取出合约类型名
+func TestContractTypeName(t *testing.T) {
+	for _, tc := range []struct {
+		contract Contract
+		want     string
+	}{
+		{Contract{Type: "TransferContract"}, "TransferContract"},
+		{Contract{Type: "TransferContract", Parameter: map[string]interface{}{"type_url": "type.googleapis.com/protocol.TriggerSmartContract"}}, "TransferContract"},
+		{Contract{Parameter: map[string]interface{}{"type_url": "type.googleapis.com/protocol.TransferContract"}}, "TransferContract"},
+		{Contract{Parameter: map[string]interface{}{"type_url": "protocol.TransferAssetContract"}}, "TransferAssetContract"},
+		{Contract{Parameter: map[string]interface{}{"value": map[string]interface{}{}}}, ""},
+		{Contract{}, ""},
+	} {
+		if got := tc.contract.TypeName(); got != tc.want {
+			t.Errorf("%+v: TypeName() = %q，期望 %q", tc.contract, got, tc.want)
+		}
+	}
+}
+
+// Ret为空、长度不足或元素为nil时结果未知，不panic
+func TestTransactionContractResult(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		ret   []*TransactionResult
+		index int
+		want  string
+	}{
+		{"nil ret", nil, 0, ""},
+		{"empty ret", []*TransactionResult{}, 0, ""},
+		{"nil element", []*TransactionResult{nil}, 0, ""},
+		{"short ret", []*TransactionResult{{ContractRet: "SUCCESS"}}, 1, ""},
+		{"negative index", []*TransactionResult{{ContractRet: "SUCCESS"}}, -1, ""},
+		{"success", []*TransactionResult{{ContractRet: "SUCCESS"}}, 0, "SUCCESS"},
+		{"revert", []*TransactionResult{{ContractRet: "SUCCESS"}, {ContractRet: "REVERT"}}, 1, "REVERT"},
+	} {
+		tx := &Transaction{Ret: tc.ret}
+		if got := tx.ContractResult(tc.index); got != tc.want {
+			t.Errorf("%s: ContractResult(%d) = %q，期望 %q", tc.name, tc.index, got, tc.want)
+		}
+	}
+}
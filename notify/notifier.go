@@ -0,0 +1,397 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"tron-monitor/config"
+	"tron-monitor/models"
+)
+
+// 通知队列溢出策略，入队从不阻塞调用方，丢弃数按渠道统计
+const (
+	OverflowDropOldest = "drop_oldest" // 丢弃队列中最旧的通知
+	OverflowDropNewest = "drop_newest" // 丢弃新通知
+)
+
+// 通知级别
+const (
+	LevelInfo     = "info"
+	LevelWarning  = "warning"
+	LevelCritical = "critical"
+)
+
+// Notification 通知消息
+type Notification struct {
+	Network string                `json:"network,omitempty"` // 所属网络，未配置networks时为空
+	Level   string                `json:"level"`
+	Address string                `json:"address,omitempty"`
+	Message string                `json:"message"`
+	Event   *models.TransferEvent `json:"event,omitempty"`
+	Time    time.Time             `json:"time"`
+}
+
+// Channel 通知渠道
+type Channel interface {
+	Name() string
+	Send(ctx context.Context, n *Notification) error
+}
+
+// addressWindow 单个地址一分钟内的通知窗口
+type addressWindow struct {
+	start     time.Time
+	count     int
+	coalesced int
+	totals    map[string]float64 // 代币类型 -> 被合并的转账金额合计
+}
+
+// channelSender 单个通知渠道的发送队列，每个渠道独立发送，慢渠道不会阻塞其他渠道
+type channelSender struct {
+	channel Channel
+	queue   chan *Notification
+
+	// 统计信息
+	sentCount    int64
+	failedCount  int64
+	droppedCount int64
+}
+
+// Notifier 通知器，负责去重、按地址限流合并，并将通知异步分发到所有渠道
+type Notifier struct {
+	config  *config.Config
+	senders []*channelSender
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+
+	// 已通知的交易（txhash:address -> 通知时间），用于去重
+	notified map[string]time.Time
+	// 每个地址的限流窗口
+	windows map[string]*addressWindow
+	// 静默时段计划（未配置时为nil）和时段内暂存的通知
+	quiet  *quietSchedule
+	digest *quietDigest
+
+	// 统计信息
+	coalescedCount int64
+	quietCount     int64
+}
+
+// 去重记录保留时间
+const dedupRetention = 10 * time.Minute
+
+// NewNotifier 创建通知器，每条通知会分发到所有渠道
+func NewNotifier(cfg *config.Config, channels ...Channel) *Notifier {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	senders := make([]*channelSender, 0, len(channels))
+	for _, channel := range channels {
+		senders = append(senders, &channelSender{
+			channel: channel,
+			queue:   make(chan *Notification, cfg.Notify.BufferSize),
+		})
+	}
+
+	return &Notifier{
+		config:   cfg,
+		senders:  senders,
+		ctx:      ctx,
+		cancel:   cancel,
+		notified: make(map[string]time.Time),
+		windows:  make(map[string]*addressWindow),
+		quiet:    newQuietSchedule(cfg.Notify.QuietHours, cfg.Notify.QuietTimezone),
+	}
+}
+
+// Start 启动各渠道的发送循环和汇总循环
+func (n *Notifier) Start() {
+	names := make([]string, 0, len(n.senders))
+	for _, sender := range n.senders {
+		names = append(names, sender.channel.Name())
+
+		n.wg.Add(1)
+		go func(sender *channelSender) {
+			defer n.wg.Done()
+			n.sendLoop(sender)
+		}(sender)
+	}
+
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		n.flushLoop()
+	}()
+
+	log.Printf("通知器已启动，通知渠道: %s", strings.Join(names, ", "))
+}
+
+// Stop 停止通知器
+func (n *Notifier) Stop() {
+	n.cancel()
+	n.wg.Wait()
+	log.Println("通知器已停止")
+}
+
+// NotifyTransfer 通知监控地址的转账事件，同一地址超过限流速率的事件会被合并为汇总通知
+func (n *Notifier) NotifyTransfer(address string, event *models.TransferEvent) {
+	now := time.Now()
+
+	n.mu.Lock()
+	dedupKey := fmt.Sprintf("%s:%s", event.TxHash, address)
+	if _, ok := n.notified[dedupKey]; ok {
+		n.mu.Unlock()
+		return
+	}
+	n.notified[dedupKey] = now
+
+	var summary *Notification
+	window := n.windows[address]
+	if window == nil || now.Sub(window.start) >= time.Minute {
+		if window != nil {
+			summary = n.summarize(address, window)
+		}
+		window = &addressWindow{start: now, totals: make(map[string]float64)}
+		n.windows[address] = window
+	}
+	window.count++
+
+	rate := n.config.Notify.PerAddressRate
+	coalesce := rate > 0 && window.count > rate
+	if coalesce {
+		window.coalesced++
+		window.totals[event.TokenType] += event.Amount
+		atomic.AddInt64(&n.coalescedCount, 1)
+	}
+	n.mu.Unlock()
+
+	if summary != nil {
+		n.enqueue(summary)
+	}
+	if coalesce {
+		return
+	}
+
+	n.enqueue(&Notification{
+		Level:   LevelInfo,
+		Address: address,
+		Message: fmt.Sprintf("监控地址 %s 发生%s转账: %s -> %s, 金额: %.6f, 交易: %s",
+			address, event.TokenType, event.Source, event.Destination, event.Amount, event.TxHash),
+		Event: event,
+	})
+}
+
+// Notify 发送一条普通通知
+func (n *Notifier) Notify(level, message string) {
+	n.enqueue(&Notification{
+		Level:   level,
+		Message: message,
+	})
+}
+
+// GetStats 获取通知统计信息，sent/failed/dropped为所有渠道合计，各渠道明细见channels
+func (n *Notifier) GetStats() map[string]interface{} {
+	var sent, failed, dropped int64
+	channels := make([]map[string]interface{}, 0, len(n.senders))
+	for _, sender := range n.senders {
+		channelStats := map[string]interface{}{
+			"channel":  sender.channel.Name(),
+			"sent":     atomic.LoadInt64(&sender.sentCount),
+			"failed":   atomic.LoadInt64(&sender.failedCount),
+			"dropped":  atomic.LoadInt64(&sender.droppedCount),
+			"queued":   len(sender.queue),
+			"capacity": cap(sender.queue),
+		}
+		sent += channelStats["sent"].(int64)
+		failed += channelStats["failed"].(int64)
+		dropped += channelStats["dropped"].(int64)
+		channels = append(channels, channelStats)
+	}
+
+	return map[string]interface{}{
+		"channels":  channels,
+		"sent":      sent,
+		"failed":    failed,
+		"coalesced": atomic.LoadInt64(&n.coalescedCount),
+		"dropped":   dropped,
+		"policy":    n.config.Notify.OverflowPolicy,
+		"quiet":     atomic.LoadInt64(&n.quietCount),
+	}
+}
+
+// enqueue 将通知放入每个渠道的发送队列
+//
+// 静默时段内非critical级别的通知按notify.quiet_mode丢弃或暂存为摘要。
+func (n *Notifier) enqueue(notification *Notification) {
+	notification.Time = time.Now()
+
+	if notification.Level != LevelCritical && n.quiet.active(notification.Time) {
+		atomic.AddInt64(&n.quietCount, 1)
+		if n.config.Notify.QuietMode == QuietDigest {
+			n.mu.Lock()
+			if n.digest == nil {
+				n.digest = &quietDigest{}
+			}
+			n.digest.add(notification)
+			n.mu.Unlock()
+		}
+		return
+	}
+
+	n.dispatch(notification)
+}
+
+// dispatch 将通知放入每个渠道的发送队列，多网络时消息以网络名称开头
+func (n *Notifier) dispatch(notification *Notification) {
+	if network := n.config.Network; network != "" && notification.Network == "" {
+		notification.Network = network
+		notification.Message = "[" + network + "] " + notification.Message
+	}
+	for _, sender := range n.senders {
+		n.enqueueTo(sender, notification)
+	}
+}
+
+// enqueueTo 将通知放入单个渠道的发送队列，队列已满时按配置的溢出策略丢弃，不阻塞调用方
+//
+// 通知可能在区块处理和HTTP请求成功率回调等热路径上发出，慢渠道只会让自己的队列溢出。
+func (n *Notifier) enqueueTo(sender *channelSender, notification *Notification) {
+	switch n.config.Notify.OverflowPolicy {
+	case OverflowDropNewest:
+		select {
+		case sender.queue <- notification:
+		default:
+			n.drop(sender)
+		}
+
+	default:
+		for {
+			select {
+			case sender.queue <- notification:
+				return
+			default:
+			}
+
+			// 队列已满，丢弃最旧的一条后重试
+			select {
+			case <-sender.queue:
+				n.drop(sender)
+			default:
+			}
+		}
+	}
+}
+
+// drop 记录一条被丢弃的通知
+func (n *Notifier) drop(sender *channelSender) {
+	if dropped := atomic.AddInt64(&sender.droppedCount, 1); dropped%100 == 1 {
+		log.Printf("通知队列已满 (%s)，已累计丢弃 %d 条通知", sender.channel.Name(), dropped)
+	}
+}
+
+// summarize 生成窗口内被合并事件的汇总通知，没有被合并的事件时返回nil（调用方需持有锁）
+func (n *Notifier) summarize(address string, window *addressWindow) *Notification {
+	if window.coalesced == 0 {
+		return nil
+	}
+
+	tokens := make([]string, 0, len(window.totals))
+	for token := range window.totals {
+		tokens = append(tokens, token)
+	}
+	sort.Strings(tokens)
+
+	totals := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		totals = append(totals, fmt.Sprintf("%.6f %s", window.totals[token], token))
+	}
+
+	return &Notification{
+		Level:   LevelInfo,
+		Address: address,
+		Message: fmt.Sprintf("监控地址 %s 最近1分钟内另有 %d 笔转账，合计: %s",
+			address, window.coalesced, strings.Join(totals, ", ")),
+	}
+}
+
+// flushDigest 静默时段结束后发送暂存通知的摘要
+func (n *Notifier) flushDigest(now time.Time) {
+	if n.quiet.active(now) {
+		return
+	}
+
+	n.mu.Lock()
+	digest := n.digest
+	n.digest = nil
+	n.mu.Unlock()
+
+	if digest != nil {
+		summary := digest.notification()
+		summary.Time = now
+		n.dispatch(summary)
+	}
+}
+
+// flushLoop 定期发送到期窗口的汇总通知和静默时段摘要，并清理去重记录
+func (n *Notifier) flushLoop() {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.ctx.Done():
+			return
+		case <-ticker.C:
+			now := time.Now()
+
+			var summaries []*Notification
+			n.mu.Lock()
+			for address, window := range n.windows {
+				if now.Sub(window.start) >= time.Minute {
+					if summary := n.summarize(address, window); summary != nil {
+						summaries = append(summaries, summary)
+					}
+					delete(n.windows, address)
+				}
+			}
+			for key, t := range n.notified {
+				if now.Sub(t) >= dedupRetention {
+					delete(n.notified, key)
+				}
+			}
+			n.mu.Unlock()
+
+			for _, summary := range summaries {
+				n.enqueue(summary)
+			}
+			n.flushDigest(now)
+		}
+	}
+}
+
+// sendLoop 从渠道队列中取出通知并发送
+func (n *Notifier) sendLoop(sender *channelSender) {
+	for {
+		select {
+		case <-n.ctx.Done():
+			return
+		case notification := <-sender.queue:
+			ctx, cancel := context.WithTimeout(n.ctx, n.config.Notify.Timeout)
+			err := sender.channel.Send(ctx, notification)
+			cancel()
+
+			if err != nil {
+				atomic.AddInt64(&sender.failedCount, 1)
+				log.Printf("发送通知失败 (%s): %v", sender.channel.Name(), err)
+				continue
+			}
+			atomic.AddInt64(&sender.sentCount, 1)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"tron-monitor/config"
+	"tron-monitor/models"
+)
+
+// recordingChannel 记录收到的通知，可以阻塞发送模拟慢渠道
+type recordingChannel struct {
+	name  string
+	block chan struct{} // 非nil时发送阻塞直到关闭或超时
+
+	mu       sync.Mutex
+	received []*Notification
+}
+
+func (c *recordingChannel) Name() string { return c.name }
+
+func (c *recordingChannel) Send(ctx context.Context, n *Notification) error {
+	if c.block != nil {
+		select {
+		case <-c.block:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.received = append(c.received, n)
+	return nil
+}
+
+func (c *recordingChannel) messages() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	messages := make([]string, len(c.received))
+	for i, n := range c.received {
+		messages[i] = n.Message
+	}
+	return messages
+}
+
+// newTestConfig 通知器测试使用的最小配置
+func newTestConfig() *config.Config {
+	cfg := &config.Config{}
+	cfg.Notify.Timeout = time.Second
+	cfg.Notify.BufferSize = 10
+	cfg.Notify.OverflowPolicy = OverflowDropNewest
+	return cfg
+}
+
+// waitMessages 等待渠道收到n条通知
+func waitMessages(t *testing.T, channel *recordingChannel, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		messages := channel.messages()
+		if len(messages) >= n {
+			return messages
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s 只收到 %d 条通知，期望 %d 条: %v", channel.name, len(messages), n, messages)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestNotifierNetworkPrefix(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Network = "nile"
+	channel := &recordingChannel{name: "test"}
+	notifier := NewNotifier(cfg, channel)
+	notifier.Start()
+	defer notifier.Stop()
+
+	notifier.Notify(LevelWarning, "TronGrid请求失败")
+
+	messages := waitMessages(t, channel, 1)
+	if messages[0] != "[nile] TronGrid请求失败" {
+		t.Errorf("多网络时通知应以网络名称开头: %q", messages[0])
+	}
+	if network := channel.received[0].Network; network != "nile" {
+		t.Errorf("network字段 %q，期望 nile", network)
+	}
+}
+
+func TestNotifierWithoutNetwork(t *testing.T) {
+	channel := &recordingChannel{name: "test"}
+	notifier := NewNotifier(newTestConfig(), channel)
+	notifier.Start()
+	defer notifier.Stop()
+
+	notifier.Notify(LevelInfo, "恢复")
+	if messages := waitMessages(t, channel, 1); strings.HasPrefix(messages[0], "[") {
+		t.Errorf("未配置networks时不应加前缀: %q", messages[0])
+	}
+}
+
+// 一个渠道卡住时，通知调用方和其他渠道都不受影响，溢出的通知计入该渠道的丢弃数
+func TestNotifierSlowChannelDoesNotBlock(t *testing.T) {
+	for _, policy := range []string{OverflowDropOldest, OverflowDropNewest} {
+		t.Run(policy, func(t *testing.T) {
+			cfg := newTestConfig()
+			cfg.Notify.BufferSize = 2
+			cfg.Notify.OverflowPolicy = policy
+			slow := &recordingChannel{name: "slow", block: make(chan struct{})}
+			fast := &recordingChannel{name: "fast"}
+			notifier := NewNotifier(cfg, slow, fast)
+			notifier.Start()
+			defer notifier.Stop()
+			defer close(slow.block)
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for i := 0; i < 20; i++ {
+					notifier.Notify(LevelInfo, "告警")
+					time.Sleep(time.Millisecond)
+				}
+			}()
+			select {
+			case <-done:
+			case <-time.After(2 * time.Second):
+				t.Fatal("慢渠道阻塞了通知调用方")
+			}
+
+			waitMessages(t, fast, 20)
+			stats := notifier.GetStats()["channels"].([]map[string]interface{})
+			if stats[0]["dropped"].(int64) == 0 {
+				t.Errorf("慢渠道溢出的通知应计入丢弃数: %v", stats[0])
+			}
+			if stats[1]["dropped"].(int64) != 0 {
+				t.Errorf("快渠道不应丢弃通知: %v", stats[1])
+			}
+		})
+	}
+}
+
+func TestQuietScheduleActive(t *testing.T) {
+	schedule := newQuietSchedule([]string{"23:00-07:00"}, "Asia/Shanghai")
+	location, _ := time.LoadLocation("Asia/Shanghai")
+	for _, tc := range []struct {
+		hour, minute int
+		want         bool
+	}{{23, 0, true}, {2, 30, true}, {6, 59, true}, {7, 0, false}, {12, 0, false}, {22, 59, false}} {
+		at := time.Date(2024, 1, 1, tc.hour, tc.minute, 0, 0, location)
+		if got := schedule.active(at); got != tc.want {
+			t.Errorf("%02d:%02d active = %v，期望 %v", tc.hour, tc.minute, got, tc.want)
+		}
+	}
+}
+
+// 静默时段内非critical通知被丢弃或暂存，critical通知照常发送；时段结束后发送摘要
+func TestNotifierQuietHours(t *testing.T) {
+	for _, mode := range []string{QuietSuppress, QuietDigest} {
+		t.Run(mode, func(t *testing.T) {
+			cfg := newTestConfig()
+			// 当前时间前后各1小时的静默时段
+			now := time.Now().UTC()
+			cfg.Notify.QuietHours = []string{now.Add(-time.Hour).Format("15:04") + "-" + now.Add(time.Hour).Format("15:04")}
+			cfg.Notify.QuietTimezone = "UTC"
+			cfg.Notify.QuietMode = mode
+			channel := &recordingChannel{name: "test"}
+			notifier := NewNotifier(cfg, channel)
+			notifier.Start()
+			defer notifier.Stop()
+
+			notifier.Notify(LevelWarning, "转账通知")
+			notifier.Notify(LevelCritical, "成功率告警")
+			messages := waitMessages(t, channel, 1)
+			if len(messages) != 1 || messages[0] != "成功率告警" {
+				t.Fatalf("静默时段内只应发送critical通知: %v", messages)
+			}
+			if quiet := notifier.GetStats()["quiet"].(int64); quiet != 1 {
+				t.Errorf("quiet = %d，期望 1", quiet)
+			}
+
+			// 静默时段结束后
+			notifier.flushDigest(now.Add(3 * time.Hour))
+			notifier.Notify(LevelCritical, "结束")
+			if mode == QuietSuppress {
+				messages = waitMessages(t, channel, 2)
+				if messages[1] != "结束" {
+					t.Errorf("suppress模式不应补发被丢弃的通知: %v", messages)
+				}
+				return
+			}
+			messages = waitMessages(t, channel, 3)
+			if !strings.Contains(messages[1], "共有 1 条通知") || !strings.Contains(messages[1], "转账通知") {
+				t.Errorf("摘要应包含被暂存的通知: %q", messages[1])
+			}
+		})
+	}
+}
+
+// 同一地址在窗口内超过限流速率的事件合并为一条汇总通知，窗口结束后发送
+func TestNotifierCoalescesBurstIntoSummary(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Notify.PerAddressRate = 2
+	channel := &recordingChannel{name: "test"}
+	notifier := NewNotifier(cfg, channel)
+	notifier.Start()
+	defer notifier.Stop()
+
+	const address = "TWatchAddress"
+	for i := 0; i < 10; i++ {
+		notifier.NotifyTransfer(address, &models.TransferEvent{
+			TxHash:    fmt.Sprintf("tx-%d", i),
+			TokenType: "USDT",
+			Amount:    1.5,
+		})
+	}
+	waitMessages(t, channel, 2)
+	time.Sleep(20 * time.Millisecond)
+	if messages := channel.messages(); len(messages) != 2 {
+		t.Fatalf("窗口内只应单独发送限流速率内的2条通知，实际 %d 条: %v", len(messages), messages)
+	}
+	if coalesced := notifier.GetStats()["coalesced"].(int64); coalesced != 8 {
+		t.Errorf("coalesced = %d，期望8", coalesced)
+	}
+
+	// 窗口到期后下一个事件触发汇总
+	notifier.mu.Lock()
+	notifier.windows[address].start = time.Now().Add(-time.Minute)
+	notifier.mu.Unlock()
+	notifier.NotifyTransfer(address, &models.TransferEvent{TxHash: "tx-next", TokenType: "USDT", Amount: 1})
+
+	messages := waitMessages(t, channel, 4)
+	var summaries []string
+	for _, message := range messages {
+		if strings.Contains(message, "另有") {
+			summaries = append(summaries, message)
+		}
+	}
+	if len(summaries) != 1 {
+		t.Fatalf("应合并为1条汇总通知，实际 %d 条: %v", len(summaries), messages)
+	}
+	if !strings.Contains(summaries[0], "另有 8 笔转账") || !strings.Contains(summaries[0], "12.000000 USDT") {
+		t.Errorf("汇总通知内容不符: %s", summaries[0])
+	}
+}
+
+// 队列填满后按溢出策略丢弃，丢弃数计入渠道和合计统计
+func TestNotifierOverflowPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		policy string
+		want   []string
+	}{
+		{OverflowDropOldest, []string{"m3", "m4", "m5"}},
+		{OverflowDropNewest, []string{"m1", "m2", "m3"}},
+	} {
+		t.Run(tc.policy, func(t *testing.T) {
+			cfg := newTestConfig()
+			cfg.Notify.BufferSize = 3
+			cfg.Notify.OverflowPolicy = tc.policy
+			channel := &recordingChannel{name: "test"}
+			notifier := NewNotifier(cfg, channel)
+
+			// 发送循环启动前入队，队列中的通知不会被取走
+			for i := 1; i <= 5; i++ {
+				notifier.Notify(LevelInfo, fmt.Sprintf("m%d", i))
+			}
+			stats := notifier.GetStats()
+			if stats["dropped"].(int64) != 2 || stats["policy"] != tc.policy {
+				t.Errorf("dropped=%v policy=%v，期望 2 %s", stats["dropped"], stats["policy"], tc.policy)
+			}
+			if channelStats := stats["channels"].([]map[string]interface{}); channelStats[0]["dropped"].(int64) != 2 {
+				t.Errorf("渠道丢弃数 %v，期望 2", channelStats[0]["dropped"])
+			}
+
+			notifier.Start()
+			defer notifier.Stop()
+			if messages := waitMessages(t, channel, 3); strings.Join(messages, ",") != strings.Join(tc.want, ",") {
+				t.Errorf("收到 %v，期望 %v", messages, tc.want)
+			}
+		})
+	}
+}
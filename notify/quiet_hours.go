@@ -0,0 +1,98 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"tron-monitor/config"
+)
+
+// 静默时段内非紧急通知的处理方式
+const (
+	QuietSuppress = "suppress" // 直接丢弃
+	QuietDigest   = "digest"   // 合并为一条摘要，静默时段结束后发送
+)
+
+// 摘要中最多列出的通知条数，超出部分只计数
+const maxDigestMessages = 50
+
+// quietWindow 一个静默时段，以当天的分钟数表示，end小于start时表示跨越午夜
+type quietWindow struct {
+	start, end int
+}
+
+// quietSchedule 静默时段计划
+type quietSchedule struct {
+	windows  []quietWindow
+	location *time.Location
+}
+
+// newQuietSchedule 创建静默时段计划，没有配置时段时返回nil（配置已在加载时校验）
+func newQuietSchedule(specs []string, timezone string) *quietSchedule {
+	if len(specs) == 0 {
+		return nil
+	}
+
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		location = time.UTC
+	}
+
+	schedule := &quietSchedule{location: location}
+	for _, spec := range specs {
+		start, end, err := config.ParseQuietWindow(spec)
+		if err != nil {
+			continue
+		}
+		schedule.windows = append(schedule.windows, quietWindow{start: start, end: end})
+	}
+	return schedule
+}
+
+// active 判断t是否处于静默时段
+func (s *quietSchedule) active(t time.Time) bool {
+	if s == nil {
+		return false
+	}
+
+	local := t.In(s.location)
+	minute := local.Hour()*60 + local.Minute()
+	for _, w := range s.windows {
+		if w.start < w.end {
+			if minute >= w.start && minute < w.end {
+				return true
+			}
+		} else if minute >= w.start || minute < w.end {
+			return true
+		}
+	}
+	return false
+}
+
+// quietDigest 静默时段内被暂存的通知
+type quietDigest struct {
+	count    int
+	messages []string
+}
+
+// add 暂存一条通知
+func (d *quietDigest) add(notification *Notification) {
+	d.count++
+	if len(d.messages) < maxDigestMessages {
+		d.messages = append(d.messages, fmt.Sprintf("[%s] %s %s",
+			notification.Level, notification.Time.Format("15:04:05"), notification.Message))
+	}
+}
+
+// notification 生成摘要通知
+func (d *quietDigest) notification() *Notification {
+	message := fmt.Sprintf("静默时段内共有 %d 条通知:\n%s", d.count, strings.Join(d.messages, "\n"))
+	if omitted := d.count - len(d.messages); omitted > 0 {
+		message += fmt.Sprintf("\n... 另有 %d 条未列出", omitted)
+	}
+	return &Notification{
+		Level:   LevelInfo,
+		Message: message,
+	}
+}
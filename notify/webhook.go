@@ -0,0 +1,98 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Webhook签名请求头
+const (
+	HeaderTimestamp = "X-Timestamp" // 发送时间（Unix秒）
+	HeaderSignature = "X-Signature" // sha256=<hex(HMAC-SHA256(secret, timestamp + "." + body))>
+)
+
+// WebhookChannel Webhook通知渠道
+type WebhookChannel struct {
+	name   string
+	url    string
+	secret string // 签名密钥，为空时不签名
+	client *http.Client
+}
+
+// NewWebhookChannel 创建Webhook通知渠道
+func NewWebhookChannel(url string) *WebhookChannel {
+	return NewNamedWebhookChannel("webhook", url)
+}
+
+// NewNamedWebhookChannel 创建指定名称的Webhook通知渠道，用于同时配置多个Webhook时区分统计
+func NewNamedWebhookChannel(name, url string) *WebhookChannel {
+	return &WebhookChannel{
+		name:   name,
+		url:    url,
+		client: &http.Client{},
+	}
+}
+
+// SetSecret 设置签名密钥，设置后每次发送都携带时间戳和HMAC签名
+func (c *WebhookChannel) SetSecret(secret string) {
+	c.secret = secret
+}
+
+// Name 渠道名称
+func (c *WebhookChannel) Name() string {
+	return c.name
+}
+
+// Send 以JSON格式POST通知
+func (c *WebhookChannel) Send(ctx context.Context, n *Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("序列化通知失败: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("创建Webhook请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "TronMonitor/1.0")
+	if c.secret != "" {
+		// 每次发送重新生成时间戳，重发的请求不会复用旧时间戳
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(HeaderTimestamp, timestamp)
+		req.Header.Set(HeaderSignature, "sha256="+signPayload(c.secret, timestamp, body))
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Webhook请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("Webhook请求失败，状态码: %d, 响应: %s", resp.StatusCode, string(respBody))
+	}
+
+	return nil
+}
+
+// signPayload 计算签名：HMAC-SHA256(secret, timestamp + "." + body)，十六进制编码
+//
+// 时间戳参与签名，接收方校验签名后还应拒绝与当前时间相差过大的请求以防重放。
+func signPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
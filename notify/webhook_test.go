@@ -0,0 +1,88 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookRequest 接收方收到的请求
+type webhookRequest struct {
+	timestamp string
+	signature string
+	body      []byte
+}
+
+// 签名覆盖时间戳和请求体，每次发送重新生成时间戳，重发的请求签名不同；未设置密钥时不签名
+func TestWebhookSignatureCoversTimestamp(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received []webhookRequest
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received = append(received, webhookRequest{r.Header.Get(HeaderTimestamp), r.Header.Get(HeaderSignature), body})
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	// verify 按接收方的方式校验签名
+	verify := func(secret, timestamp string, body []byte, signature string) bool {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(timestamp + "." + string(body)))
+		return hmac.Equal([]byte(signature), []byte("sha256="+hex.EncodeToString(mac.Sum(nil))))
+	}
+
+	channel := NewWebhookChannel(server.URL)
+	channel.SetSecret("s3cret")
+	n := &Notification{Level: LevelWarning, Message: "转账通知"}
+	if err := channel.Send(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	// 时间戳精度为秒，等到下一秒再重发
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+	if err := channel.Send(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+
+	unsigned := NewWebhookChannel(server.URL)
+	if err := unsigned.Send(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 3 {
+		t.Fatalf("收到 %d 个请求，期望 3", len(received))
+	}
+	first, retry := received[0], received[1]
+	for i, req := range []webhookRequest{first, retry} {
+		if _, err := strconv.ParseInt(req.timestamp, 10, 64); err != nil {
+			t.Errorf("第 %d 次发送的时间戳无效: %q", i+1, req.timestamp)
+		}
+		if !verify("s3cret", req.timestamp, req.body, req.signature) {
+			t.Errorf("第 %d 次发送的签名校验失败: %s", i+1, req.signature)
+		}
+	}
+
+	// 替换时间戳后签名失效，防止重放时篡改时间戳
+	if verify("s3cret", retry.timestamp, first.body, first.signature) {
+		t.Error("签名应覆盖时间戳，换用其他时间戳后不应校验通过")
+	}
+	if first.timestamp == retry.timestamp || first.signature == retry.signature {
+		t.Errorf("重发时应使用新的时间戳和签名: %s/%s，%s/%s", first.timestamp, first.signature, retry.timestamp, retry.signature)
+	}
+
+	if received[2].timestamp != "" || received[2].signature != "" {
+		t.Errorf("未设置密钥时不应签名: %+v", received[2])
+	}
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"tron-monitor/config"
+	httpclient "tron-monitor/http"
+	"tron-monitor/models"
+	"tron-monitor/notify"
+	"tron-monitor/processor"
+	"tron-monitor/redis"
+	"tron-monitor/store"
+)
+
+// pipeline 单个网络的监控流水线：独立的配置、Redis客户端、TronGrid客户端、区块监控器和处理器
+type pipeline struct {
+	name           string // 网络名称，未配置networks时为空
+	config         *config.Config
+	redisClient    *redis.RedisClient
+	httpClient     *httpclient.HTTPClient
+	blockMonitor   *processor.BlockMonitor
+	blockProcessor *processor.BlockProcessor
+	notifier       *notify.Notifier
+	transferStore  store.TransferStore // 启用sql_store时与Redis双写的转账存储，未启用时为nil
+	startTime      time.Time
+	stopStats      context.CancelFunc // 停止系统统计更新和统计快照
+}
+
+// newPipeline 按配置创建监控流水线
+func newPipeline(name string, cfg *config.Config) (*pipeline, error) {
+	// 1. 初始化Redis客户端
+	redisClient, err := redis.NewRedisClient(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("初始化Redis客户端失败: %w", err)
+	}
+
+	// 2. 初始化HTTP客户端
+	httpClient := httpclient.NewHTTPClient(cfg)
+
+	// 3. 初始化区块监控器
+	blockMonitor := processor.NewBlockMonitor(cfg, redisClient, httpClient)
+
+	// 4. 初始化通知器（可选）
+	var notifier *notify.Notifier
+	if cfg.Notify.Enabled {
+		var channels []notify.Channel
+		if cfg.Notify.WebhookURL != "" {
+			channel := notify.NewWebhookChannel(cfg.Notify.WebhookURL)
+			channel.SetSecret(cfg.Notify.WebhookSecret)
+			channels = append(channels, channel)
+		}
+		for i, url := range cfg.Notify.WebhookURLs {
+			channel := notify.NewNamedWebhookChannel(fmt.Sprintf("webhook-%d", i+1), url)
+			channel.SetSecret(cfg.Notify.WebhookSecret)
+			channels = append(channels, channel)
+		}
+		notifier = notify.NewNotifier(cfg, channels...)
+
+		// TronGrid成功率告警和恢复同时发送通知
+		httpClient.OnSuccessRateAlert(func(firing bool, rate float64) {
+			if firing {
+				notifier.Notify(notify.LevelCritical, fmt.Sprintf("TronGrid最近 %d 次请求成功率 %.1f%%，低于阈值 %.1f%%",
+					cfg.TronGrid.SuccessRateWindow, rate, cfg.TronGrid.SuccessRateThreshold))
+				return
+			}
+			notifier.Notify(notify.LevelInfo, fmt.Sprintf("TronGrid请求成功率已恢复到 %.1f%%", rate))
+		})
+	}
+
+	// 5. 初始化区块处理器
+	blockProcessor := processor.NewBlockProcessor(cfg, redisClient, httpClient, notifier)
+	blockMonitor.SetCursorSeed(blockProcessor.SeedCursor)
+	if cfg.Monitor.Mode == processor.MonitorModeDirect {
+		blockMonitor.SetDirectHandler(blockProcessor.ProcessBlock)
+	}
+
+	// 6. 初始化SQL转账存储（可选）
+	var transferStore store.TransferStore
+	if cfg.SQLStore.Enabled {
+		sqlStore, err := store.NewSQLStore(cfg.SQLStore.Path)
+		if err != nil {
+			redisClient.Close()
+			return nil, fmt.Errorf("初始化SQL转账存储失败: %w", err)
+		}
+		transferStore = sqlStore
+		blockProcessor.SetTransferStore(transferStore)
+	}
+
+	return &pipeline{
+		name:           name,
+		config:         cfg,
+		redisClient:    redisClient,
+		httpClient:     httpClient,
+		blockMonitor:   blockMonitor,
+		blockProcessor: blockProcessor,
+		notifier:       notifier,
+		transferStore:  transferStore,
+		startTime:      time.Now(),
+	}, nil
+}
+
+// start 启动流水线，启用startup.require_healthy时用waitHealthy重试健康检查
+func (p *pipeline) start(waitHealthy func(check func() error) error) error {
+	if p.name != "" {
+		log.Printf("启动网络 %s 的监控流水线...", p.name)
+	}
+
+	// 1. 健康检查，启用startup.require_healthy时重试直到通过或超时
+	if p.config.Startup.RequireHealthy {
+		if err := waitHealthy(p.healthCheck); err != nil {
+			return fmt.Errorf("健康检查失败: %w", err)
+		}
+	} else if err := p.healthCheck(); err != nil {
+		log.Printf("警告: 健康检查失败: %v，但继续启动系统", err)
+		// 不返回错误，让系统继续启动
+	}
+
+	// 2. 检查启动后需要补齐的区块范围，跨度过大时拒绝启动
+	if err := p.blockMonitor.CheckResumeSpan(); err != nil {
+		return fmt.Errorf("补齐范围检查失败: %w", err)
+	}
+
+	// 3. 初始化监控地址
+	if err := p.initWatchAddresses(); err != nil {
+		return fmt.Errorf("初始化监控地址失败: %w", err)
+	}
+
+	// 4. 启动通知器
+	if p.notifier != nil {
+		p.notifier.Start()
+	}
+
+	// 5. 启动区块处理器，失败时停止已启动的通知器
+	if err := p.blockProcessor.Start(); err != nil {
+		if p.notifier != nil {
+			p.notifier.Stop()
+		}
+		return fmt.Errorf("启动区块处理器失败: %w", err)
+	}
+
+	// 6. 启动区块监控器，失败时停止已启动的处理器和通知器
+	if err := p.blockMonitor.Start(); err != nil {
+		if stopErr := p.blockProcessor.Stop(); stopErr != nil {
+			log.Printf("停止区块处理器失败: %v", stopErr)
+		}
+		if p.notifier != nil {
+			p.notifier.Stop()
+		}
+		return fmt.Errorf("启动区块监控器失败: %w", err)
+	}
+
+	// 7. 启动系统统计更新和统计快照
+	ctx, cancel := context.WithCancel(context.Background())
+	p.stopStats = cancel
+	go p.updateSystemStats(ctx)
+	if p.config.Stats.SnapshotInterval > 0 {
+		go p.snapshotStats(ctx)
+	}
+
+	return nil
+}
+
+// stop 停止流水线并关闭Redis连接
+func (p *pipeline) stop() {
+	// 1. 停止统计快照
+	if p.stopStats != nil {
+		p.stopStats()
+	}
+
+	// 2. 停止区块监控器
+	if p.blockMonitor != nil {
+		if err := p.blockMonitor.Stop(); err != nil {
+			log.Printf("停止区块监控器失败: %v", err)
+		}
+	}
+
+	// 3. 停止区块处理器
+	if p.blockProcessor != nil {
+		if err := p.blockProcessor.Stop(); err != nil {
+			log.Printf("停止区块处理器失败: %v", err)
+		}
+	}
+
+	// 4. 停止通知器
+	if p.notifier != nil {
+		p.notifier.Stop()
+	}
+
+	// 5. 关闭SQL转账存储，区块处理器停止后不再写入
+	if p.transferStore != nil {
+		if err := p.transferStore.Close(); err != nil {
+			log.Printf("关闭SQL转账存储失败: %v", err)
+		}
+	}
+
+	// 6. 关闭Redis连接
+	if p.redisClient != nil {
+		if err := p.redisClient.Close(); err != nil {
+			log.Printf("关闭Redis连接失败: %v", err)
+		}
+	}
+}
+
+// updateSystemStats 按stats.save_interval定期保存系统统计，供 /status 读取，启动时先保存一次
+func (p *pipeline) updateSystemStats(ctx context.Context) {
+	ticker := time.NewTicker(p.config.Stats.SaveInterval)
+	defer ticker.Stop()
+
+	p.saveSystemStats(ctx, time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			p.saveSystemStats(ctx, now)
+		}
+	}
+}
+
+// saveSystemStats 保存当前的处理计数
+func (p *pipeline) saveSystemStats(ctx context.Context, now time.Time) {
+	monitorStats := p.blockMonitor.GetStats()
+	processorStats := p.blockProcessor.GetStats()
+
+	lastBlock, _ := monitorStats["last_processed_block"].(int64)
+	processed, _ := processorStats["processed_blocks"].(int64)
+	errorCount, _ := processorStats["errors"].(int64)
+	transfers, _ := processorStats["transfers_found"].(int64)
+
+	stats := &models.SystemStats{
+		TotalBlocksProcessed: processed,
+		TotalTransfersFound:  transfers,
+		LastProcessedBlock:   lastBlock,
+		LastProcessedTime:    now,
+		Uptime:               time.Since(p.startTime),
+		ErrorCount:           errorCount,
+		SuccessCount:         processed,
+		UpdatedAt:            now,
+	}
+	if err := p.redisClient.SaveSystemStats(ctx, stats); err != nil {
+		log.Printf("保存系统统计信息失败: %v", err)
+	}
+}
+
+// snapshotStats 定期按指标记录统计历史
+func (p *pipeline) snapshotStats(ctx context.Context) {
+	ticker := time.NewTicker(p.config.Stats.SnapshotInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			monitorStats := p.blockMonitor.GetStats()
+			processorStats := p.blockProcessor.GetStats()
+
+			lastBlock, _ := monitorStats["last_processed_block"].(int64)
+			queueSize, _ := monitorStats["queue_size"].(int64)
+			processed, _ := processorStats["processed_blocks"].(int64)
+			transfers, _ := processorStats["transfers_found"].(int64)
+			errorCount, _ := processorStats["errors"].(int64)
+
+			metrics := map[string]int64{
+				"processed_blocks":     processed,
+				"transfers_found":      transfers,
+				"errors":               errorCount,
+				"queue_size":           queueSize,
+				"last_processed_block": lastBlock,
+			}
+			if err := p.redisClient.SaveStatsSnapshot(ctx, now, metrics, p.config.Stats.HistoryRetention); err != nil {
+				log.Printf("记录统计历史失败: %v", err)
+			}
+		}
+	}
+}
+
+// healthCheck 健康检查
+func (p *pipeline) healthCheck() error {
+	log.Println("执行健康检查...")
+
+	// 检查Redis连接
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// 测试Redis连接
+	if _, err := p.redisClient.GetQueueSize(ctx); err != nil {
+		return fmt.Errorf("Redis连接检查失败: %w", err)
+	}
+
+	// 测试TronGrid API连接（使用更长的超时时间）
+	apiCtx, apiCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer apiCancel()
+
+	if _, err := p.httpClient.GetLatestBlock(apiCtx); err != nil {
+		return fmt.Errorf("TronGrid API连接检查失败: %w", err)
+	}
+
+	log.Println("健康检查通过")
+	return nil
+}
+
+// initWatchAddresses 初始化监控地址
+func (p *pipeline) initWatchAddresses() error {
+	log.Println("初始化监控地址...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// 获取现有监控地址
+	existingAddresses, err := p.redisClient.GetWatchAddresses(ctx)
+	if err != nil {
+		return fmt.Errorf("获取现有监控地址失败: %w", err)
+	}
+
+	// 将现有地址转换为map以便快速查找
+	existingMap := make(map[string]bool)
+	for _, addr := range existingAddresses {
+		existingMap[addr] = true
+	}
+
+	// 添加配置中的监控地址
+	configMap := make(map[string]bool)
+	var added, removed []string
+	for _, addr := range p.config.WatchAddresses {
+		configMap[addr] = true
+		if !existingMap[addr] {
+			if err := p.redisClient.AddWatchAddress(ctx, models.WatchAddress{Address: addr}); err != nil {
+				log.Printf("添加监控地址 %s 失败: %v", addr, err)
+				continue
+			}
+			log.Printf("已添加监控地址: %s", addr)
+			added = append(added, addr)
+		}
+	}
+
+	// 同步模式下移除配置中已不存在的地址（包括通过API添加的地址）
+	if p.config.Monitor.SyncWatchAddresses {
+		for _, addr := range existingAddresses {
+			if configMap[addr] {
+				continue
+			}
+			if err := p.redisClient.RemoveWatchAddress(ctx, addr); err != nil {
+				log.Printf("移除监控地址 %s 失败: %v", addr, err)
+				continue
+			}
+			log.Printf("已移除配置中不存在的监控地址: %s", addr)
+			removed = append(removed, addr)
+		}
+		log.Printf("监控地址已与配置同步: 新增 %d 个 %v，移除 %d 个 %v", len(added), added, len(removed), removed)
+	}
+
+	total := len(existingAddresses) + len(added) - len(removed)
+	if total == 0 {
+		if p.config.Monitor.EmptyWatchMode == processor.EmptyWatchModeSample {
+			log.Printf("警告: 监控地址为空，已启用抽样模式，约每 %d 笔交易保存一笔TRC10/TRC20转账", p.config.Monitor.SampleRate)
+		} else {
+			log.Println("警告: 监控地址为空，TRC10/TRC20转账不会被保存；请通过 watch_addresses 或 POST /addresses 添加地址，或设置 monitor.empty_watch_mode: sample 抽样查看全链转账")
+		}
+	}
+
+	log.Printf("监控地址初始化完成，共 %d 个地址", total)
+	return nil
+}
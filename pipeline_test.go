@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"tron-monitor/config"
+	"tron-monitor/models"
+)
+
+// loadTestConfig 将YAML写入dir并加载配置
+func loadTestConfig(t *testing.T, dir, yaml string) *config.Config {
+	t.Helper()
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// newTestApplication 创建包含mainnet和nile两个网络的应用，TronGrid请求全部失败，不启动HTTP服务器
+func newTestApplication(t *testing.T, dir string) *Application {
+	t.Helper()
+	tronGrid := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(tronGrid.Close)
+	server := miniredis.RunT(t)
+
+	yaml := fmt.Sprintf(`trongrid:
+  base_url: %q
+  retry_max: 0
+redis:
+  addr: %q
+watch_addresses:
+  - "TJRabPrwbZy45sbavfcjinPJC18kjpRTv8"
+file_sink:
+  enabled: true
+  path: %q
+networks:
+  - name: "mainnet"
+    redis_db: 0
+  - name: "nile"
+    redis_db: 1
+`, tronGrid.URL, server.Addr(), filepath.Join(dir, "transfers.jsonl"))
+	cfg := loadTestConfig(t, dir, yaml)
+
+	app := &Application{config: cfg}
+	for _, network := range cfg.Networks {
+		p, err := newPipeline(network.Name, cfg.ForNetwork(network))
+		if err != nil {
+			t.Fatal(err)
+		}
+		app.pipelines = append(app.pipelines, p)
+	}
+	return app
+}
+
+func TestNetworkFileSinkPaths(t *testing.T) {
+	dir := t.TempDir()
+	app := newTestApplication(t, dir)
+	defer func() {
+		for _, p := range app.pipelines {
+			p.redisClient.Close()
+		}
+	}()
+
+	paths := map[string]bool{}
+	for _, p := range app.pipelines {
+		want := filepath.Join(dir, "transfers."+p.name+".jsonl")
+		if p.config.FileSink.Path != want || p.config.Network != p.name {
+			t.Errorf("网络 %s: 输出文件 %s，网络名 %q", p.name, p.config.FileSink.Path, p.config.Network)
+		}
+		paths[p.config.FileSink.Path] = true
+	}
+	if len(paths) != 2 {
+		t.Errorf("两个网络的输出文件应不同: %v", paths)
+	}
+}
+
+// 第二个网络启动失败时，已启动的第一个网络必须停止，不能在进程退出前继续运行
+func TestStartStopsStartedPipelinesOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	app := newTestApplication(t, dir)
+
+	// nile的输出文件路径被目录占用，启动区块处理器时打开文件失败
+	if err := os.Mkdir(filepath.Join(dir, "transfers.nile.jsonl"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	err := app.Start()
+	if err == nil || !strings.Contains(err.Error(), "nile") {
+		t.Fatalf("nile启动失败时应返回错误，实际: %v", err)
+	}
+
+	mainnet := app.pipelines[0]
+	if mainnet.blockMonitor.IsRunning() || mainnet.blockProcessor.IsRunning() {
+		t.Error("启动失败后mainnet流水线应已停止")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "transfers.mainnet.jsonl")); err != nil {
+		t.Errorf("mainnet应已打开自己的输出文件: %v", err)
+	}
+}
+
+// sync_watch_addresses开启时启动后Redis中的监控地址与配置一致，移除的地址同时清理分组和代币范围；关闭时只新增
+func TestSyncWatchAddressesPurgesRemoved(t *testing.T) {
+	const (
+		configured = "TJRabPrwbZy45sbavfcjinPJC18kjpRTv8"
+		removed    = "TUpMhErZL2fhh4sVNULAbNKLokS4GjC1F4"
+	)
+	for _, sync := range []bool{false, true} {
+		t.Run(fmt.Sprintf("sync=%v", sync), func(t *testing.T) {
+			_, p := newHTTPTestHandler(t, fmt.Sprintf("monitor:\n  sync_watch_addresses: %v\n", sync))
+			ctx := context.Background()
+			if err := p.redisClient.AddWatchAddress(ctx, models.WatchAddress{Address: removed, Group: "desk", Token: "USDT"}); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := p.initWatchAddresses(); err != nil {
+				t.Fatal(err)
+			}
+
+			addresses, err := p.redisClient.GetWatchAddresses(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(addresses)
+			want := []string{configured, removed}
+			if sync {
+				want = []string{configured}
+			}
+			if strings.Join(addresses, ",") != strings.Join(want, ",") {
+				t.Fatalf("监控地址 %v，期望 %v", addresses, want)
+			}
+
+			groups, err := p.redisClient.GetAddressGroups(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			scopes, err := p.redisClient.GetWatchScopes(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, hasGroup := groups[removed]
+			_, hasScope := scopes[removed]
+			if hasGroup == sync || hasScope == sync {
+				t.Errorf("地址 %s 的分组=%v 代币范围=%v，同步模式下应随地址清理", removed, hasGroup, hasScope)
+			}
+		})
+	}
+}
+
+// 监控地址为空时启动时给出警告，sample模式下提示抽样比例
+func TestEmptyWatchAddressesWarning(t *testing.T) {
+	for _, tc := range []struct {
+		yaml string
+		want string
+	}{
+		{"", "TRC10/TRC20转账不会被保存"},
+		{"monitor:\n  empty_watch_mode: sample\n  sample_rate: 50\n", "已启用抽样模式，约每 50 笔交易"},
+	} {
+		cfg := loadTestConfig(t, t.TempDir(), tc.yaml)
+		cfg.Redis.Addr = miniredis.RunT(t).Addr()
+		p, err := newPipeline("", cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer p.redisClient.Close()
+
+		var buf bytes.Buffer
+		log.SetOutput(&buf)
+		err = p.initWatchAddresses()
+		log.SetOutput(os.Stderr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(buf.String(), "警告: 监控地址为空") || !strings.Contains(buf.String(), tc.want) {
+			t.Errorf("监控地址为空时应输出包含 %q 的警告，实际日志:\n%s", tc.want, buf.String())
+		}
+	}
+}
+
+// 系统统计保存到Redis后 /status 返回其时效，超过stats.max_status_age时标记为过期
+func TestSystemStatsPersistedWithAge(t *testing.T) {
+	handler, p := newHTTPTestHandler(t, "monitor:\n  mode: direct\nstats:\n  max_status_age: 1m\n")
+	ctx := context.Background()
+	if _, body := getJSON(t, handler, "/status"); body["http_stale"] != true {
+		t.Fatalf("尚未保存系统统计时 http_stale=%v，期望 true", body["http_stale"])
+	}
+
+	p.saveSystemStats(ctx, time.Now())
+	code, body := getJSON(t, handler, "/status")
+	httpStats, _ := body["http"].(map[string]interface{})
+	if code != http.StatusOK || httpStats == nil || httpStats["updated_at"] == nil {
+		t.Fatalf("/status = %d http=%v，期望保存的系统统计", code, body["http"])
+	}
+	if body["http_stale"] != false || body["http_age_seconds"] != float64(0) {
+		t.Errorf("刚保存的统计 http_stale=%v http_age_seconds=%v，期望 false/0", body["http_stale"], body["http_age_seconds"])
+	}
+
+	// 模拟监控实例停止后统计不再更新
+	p.saveSystemStats(ctx, time.Now().Add(-2*time.Minute))
+	_, body = getJSON(t, handler, "/status")
+	if age, _ := body["http_age_seconds"].(float64); body["http_stale"] != true || age < 120 {
+		t.Errorf("2分钟前保存的统计 http_stale=%v http_age_seconds=%v，期望 true/≥120", body["http_stale"], body["http_age_seconds"])
+	}
+}
+
+// 健康检查在重试期间恢复时启动继续；超过startup.health_timeout仍失败时返回最后一次的错误
+func TestWaitHealthyRetryBudget(t *testing.T) {
+	app := &Application{config: &config.Config{}}
+	app.config.Startup.HealthTimeout = 200 * time.Millisecond
+	app.config.Startup.HealthBackoff = 10 * time.Millisecond
+
+	calls := 0
+	err := app.waitHealthy(func() error {
+		calls++
+		if calls < 3 {
+			return fmt.Errorf("TronGrid不可用")
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Fatalf("第3次检查通过后应启动: calls=%d err=%v", calls, err)
+	}
+
+	calls = 0
+	started := time.Now()
+	err = app.waitHealthy(func() error {
+		calls++
+		return fmt.Errorf("Redis连接失败")
+	})
+	elapsed := time.Since(started)
+	if err == nil || !strings.Contains(err.Error(), "Redis连接失败") {
+		t.Fatalf("超时后应返回最后一次的错误: %v", err)
+	}
+	if calls < 2 {
+		t.Errorf("超时前应重试，实际只检查了 %d 次", calls)
+	}
+	if elapsed < app.config.Startup.HealthTimeout || elapsed > 2*app.config.Startup.HealthTimeout {
+		t.Errorf("重试耗时 %v，期望约为 %v", elapsed, app.config.Startup.HealthTimeout)
+	}
+}
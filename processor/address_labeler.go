@@ -0,0 +1,126 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"tron-monitor/config"
+	"tron-monitor/models"
+	"tron-monitor/redis"
+)
+
+// AddressLabeler 地址标签查询器
+type AddressLabeler struct {
+	config      *config.Config
+	redisClient *redis.RedisClient
+	mu          sync.RWMutex
+
+	// 精确匹配的标签
+	exact map[string]string
+	// 以*结尾的前缀通配标签（key为去掉*后的前缀）
+	prefixes map[string]string
+}
+
+// NewAddressLabeler 创建地址标签查询器
+func NewAddressLabeler(cfg *config.Config, redisClient *redis.RedisClient) *AddressLabeler {
+	return &AddressLabeler{
+		config:      cfg,
+		redisClient: redisClient,
+		exact:       make(map[string]string),
+		prefixes:    make(map[string]string),
+	}
+}
+
+// Reload 重新加载标签（标签文件 + Redis哈希，Redis中的标签优先）
+func (l *AddressLabeler) Reload(ctx context.Context) error {
+	labels := make(map[string]string)
+
+	if l.config.Labels.File != "" {
+		data, err := os.ReadFile(l.config.Labels.File)
+		if err != nil {
+			return fmt.Errorf("读取标签文件失败: %w", err)
+		}
+		if err := json.Unmarshal(data, &labels); err != nil {
+			return fmt.Errorf("解析标签文件失败: %w", err)
+		}
+	}
+
+	redisLabels, err := l.redisClient.GetAddressLabels(ctx)
+	if err != nil {
+		return err
+	}
+	for addr, label := range redisLabels {
+		labels[addr] = label
+	}
+
+	exact := make(map[string]string)
+	prefixes := make(map[string]string)
+	for addr, label := range labels {
+		addr = strings.TrimSpace(addr)
+		if strings.HasSuffix(addr, "*") {
+			prefixes[strings.TrimSuffix(addr, "*")] = label
+			continue
+		}
+		exact[addr] = label
+	}
+
+	l.mu.Lock()
+	l.exact = exact
+	l.prefixes = prefixes
+	l.mu.Unlock()
+
+	return nil
+}
+
+// Lookup 查询地址标签，优先精确匹配，其次最长前缀匹配
+func (l *AddressLabeler) Lookup(address string) string {
+	if address == "" {
+		return ""
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if label, ok := l.exact[address]; ok {
+		return label
+	}
+
+	var label string
+	var matched int
+	for prefix, prefixLabel := range l.prefixes {
+		if len(prefix) > matched && strings.HasPrefix(address, prefix) {
+			label = prefixLabel
+			matched = len(prefix)
+		}
+	}
+	return label
+}
+
+// Apply 为转账事件附加发送方/接收方标签
+func (l *AddressLabeler) Apply(transfer *models.TransferEvent) {
+	transfer.SourceLabel = l.Lookup(transfer.Source)
+	transfer.DestinationLabel = l.Lookup(transfer.Destination)
+}
+
+// run 定期热加载标签
+func (l *AddressLabeler) run(ctx context.Context) {
+	ticker := time.NewTicker(l.config.Labels.ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := l.Reload(ctx); err != nil {
+				log.Printf("热加载地址标签失败: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"tron-monitor/redis"
+)
+
+// addressMetrics 按监控地址输出转账数和最后活跃时长，数据在每次抓取时从地址统计信息读取
+//
+// 只输出监控地址，且数量受上限约束，避免标签基数随地址数无限增长。
+type addressMetrics struct {
+	redisClient *redis.RedisClient
+
+	mu          sync.Mutex
+	capReported bool // 已记录过超出上限的日志，回到上限内后重置
+}
+
+// newAddressMetrics 创建按地址的指标输出器
+func newAddressMetrics(redisClient *redis.RedisClient) *addressMetrics {
+	return &addressMetrics{redisClient: redisClient}
+}
+
+// writePrometheus 以Prometheus文本格式输出按地址的指标，地址按字典序取前limit个
+func (m *addressMetrics) writePrometheus(ctx context.Context, w io.Writer, limit int) {
+	addresses, err := m.redisClient.GetWatchAddresses(ctx)
+	if err != nil {
+		log.Printf("输出按地址指标失败: %v", err)
+		return
+	}
+
+	sort.Strings(addresses)
+	m.reportCap(len(addresses), limit)
+	if len(addresses) > limit {
+		addresses = addresses[:limit]
+	}
+
+	infos, err := m.redisClient.GetAddressInfos(ctx, addresses)
+	if err != nil {
+		log.Printf("输出按地址指标失败: %v", err)
+		return
+	}
+
+	const transfersName = "tron_monitor_address_transfers_total"
+	fmt.Fprintf(w, "# HELP %s 监控地址累计转账数\n", transfersName)
+	fmt.Fprintf(w, "# TYPE %s counter\n", transfersName)
+	for _, info := range infos {
+		fmt.Fprintf(w, "%s{address=%q} %d\n", transfersName, info.Address, info.TransferCount)
+	}
+
+	// 从未出现过转账的地址不输出最后活跃时长
+	const ageName = "tron_monitor_address_last_seen_age_seconds"
+	now := time.Now()
+	fmt.Fprintf(w, "# HELP %s 监控地址距最近一次转账的秒数\n", ageName)
+	fmt.Fprintf(w, "# TYPE %s gauge\n", ageName)
+	for _, info := range infos {
+		if info.LastSeen.IsZero() {
+			continue
+		}
+		fmt.Fprintf(w, "%s{address=%q} %.0f\n", ageName, info.Address, now.Sub(info.LastSeen).Seconds())
+	}
+}
+
+// reportCap 监控地址数超过上限时记录一次日志，回到上限内后再次超出会重新记录
+func (m *addressMetrics) reportCap(total, limit int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if total <= limit {
+		m.capReported = false
+		return
+	}
+	if !m.capReported {
+		log.Printf("监控地址数 %d 超过按地址指标上限 %d，只输出前 %d 个地址（stats.max_metric_addresses）", total, limit, limit)
+		m.capReported = true
+	}
+}
@@ -0,0 +1,65 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"tron-monitor/models"
+)
+
+// 监控地址按地址输出转账数和最后活跃时长，超过stats.max_metric_addresses的地址按字典序截断，0表示不输出
+func TestAddressMetricsSeries(t *testing.T) {
+	const extraAddr = "TXYZopYRdj2D9XRtbG411XZZ3kM5VkAeBf"
+
+	for _, tc := range []struct {
+		name  string
+		limit int
+		want  []string // 应输出的地址
+	}{
+		{"all", 10, []string{testWatchAddr, testOtherAddr, extraAddr}},
+		{"capped", 2, []string{testWatchAddr, testOtherAddr}},
+		{"disabled", 0, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := loadTestConfig(t, "monitor:\n  mode: direct\n")
+			cfg.Stats.MaxMetricAddresses = tc.limit
+			client := newTestRedis(t, cfg)
+			for _, address := range []string{testOtherAddr, extraAddr} {
+				if err := client.AddWatchAddress(context.Background(), models.WatchAddress{Address: address}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			processor := NewBlockProcessor(cfg, client, nil, nil)
+			if err := processor.ProcessBlock(testBlock(t, 100, trxTransferTx(t, txID(1), testWatchAddr, testUSDTAddr, 1_000_000))); err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			processor.WriteMetrics(context.Background(), &buf)
+			out := buf.String()
+
+			if got := strings.Count(out, "tron_monitor_address_transfers_total{"); got != len(tc.want) {
+				t.Errorf("输出 %d 个地址的转账数，期望 %d:\n%s", got, len(tc.want), out)
+			}
+			for _, address := range tc.want {
+				if !strings.Contains(out, `tron_monitor_address_transfers_total{address="`+address+`"}`) {
+					t.Errorf("缺少地址 %s 的转账数:\n%s", address, out)
+				}
+			}
+			if tc.limit == 0 {
+				return
+			}
+
+			if !strings.Contains(out, `tron_monitor_address_transfers_total{address="`+testWatchAddr+`"} 1`+"\n") {
+				t.Errorf("地址 %s 的转账数应为1:\n%s", testWatchAddr, out)
+			}
+			// 只有出现过转账的地址输出最后活跃时长
+			if !strings.Contains(out, `tron_monitor_address_last_seen_age_seconds{address="`+testWatchAddr+`"}`) ||
+				strings.Contains(out, `tron_monitor_address_last_seen_age_seconds{address="`+testOtherAddr+`"}`) {
+				t.Errorf("最后活跃时长只应输出有转账的地址:\n%s", out)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package processor
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// amountHistogram 按代币类型统计转账金额分布
+type amountHistogram struct {
+	buckets []float64 // 升序的桶上界
+
+	mu     sync.Mutex
+	series map[string]*amountSeries
+}
+
+// amountSeries 单个代币类型的分布，counts比buckets多一个+Inf桶
+type amountSeries struct {
+	counts []int64
+	sum    float64
+	count  int64
+}
+
+// newAmountHistogram 创建金额分布统计
+func newAmountHistogram(buckets []float64) *amountHistogram {
+	return &amountHistogram{
+		buckets: buckets,
+		series:  make(map[string]*amountSeries),
+	}
+}
+
+// observe 记录一笔转账金额
+func (h *amountHistogram) observe(tokenType string, amount float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	series, ok := h.series[tokenType]
+	if !ok {
+		series = &amountSeries{counts: make([]int64, len(h.buckets)+1)}
+		h.series[tokenType] = series
+	}
+
+	// 第一个上界不小于amount的桶，超过所有上界时落入+Inf桶
+	i := sort.SearchFloat64s(h.buckets, amount)
+	series.counts[i]++
+	series.sum += amount
+	series.count++
+}
+
+// reset 清空统计
+func (h *amountHistogram) reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.series = make(map[string]*amountSeries)
+}
+
+// writePrometheus 以Prometheus文本格式输出，桶计数为累计值
+func (h *amountHistogram) writePrometheus(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	const name = "tron_monitor_transfer_amount"
+	fmt.Fprintf(w, "# HELP %s 转账金额分布（按代币类型，USDT为换算精度后的金额）\n", name)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+
+	tokens := make([]string, 0, len(h.series))
+	for token := range h.series {
+		tokens = append(tokens, token)
+	}
+	sort.Strings(tokens)
+
+	for _, token := range tokens {
+		series := h.series[token]
+		var cumulative int64
+		for i, bound := range h.buckets {
+			cumulative += series.counts[i]
+			fmt.Fprintf(w, "%s_bucket{token_type=%q,le=%q} %d\n", name, token, strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+		}
+		cumulative += series.counts[len(h.buckets)]
+		fmt.Fprintf(w, "%s_bucket{token_type=%q,le=\"+Inf\"} %d\n", name, token, cumulative)
+		fmt.Fprintf(w, "%s_sum{token_type=%q} %s\n", name, token, strconv.FormatFloat(series.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "%s_count{token_type=%q} %d\n", name, token, series.count)
+	}
+}
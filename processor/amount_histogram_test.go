@@ -0,0 +1,43 @@
+package processor
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// 桶按上界包含（le），超过所有上界的金额落入+Inf桶，输出的桶计数为累计值
+func TestAmountHistogramBuckets(t *testing.T) {
+	h := newAmountHistogram([]float64{1, 10, 100})
+	for _, amount := range []float64{0.5, 1, 5, 10, 50, 1000} {
+		h.observe("TRX", amount)
+	}
+	h.observe("USDT", 20)
+
+	var buf bytes.Buffer
+	h.writePrometheus(&buf)
+	out := buf.String()
+
+	for _, line := range []string{
+		`tron_monitor_transfer_amount_bucket{token_type="TRX",le="1"} 2`,
+		`tron_monitor_transfer_amount_bucket{token_type="TRX",le="10"} 4`,
+		`tron_monitor_transfer_amount_bucket{token_type="TRX",le="100"} 5`,
+		`tron_monitor_transfer_amount_bucket{token_type="TRX",le="+Inf"} 6`,
+		`tron_monitor_transfer_amount_sum{token_type="TRX"} 1066.5`,
+		`tron_monitor_transfer_amount_count{token_type="TRX"} 6`,
+		`tron_monitor_transfer_amount_bucket{token_type="USDT",le="10"} 0`,
+		`tron_monitor_transfer_amount_bucket{token_type="USDT",le="100"} 1`,
+		`tron_monitor_transfer_amount_count{token_type="USDT"} 1`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("缺少指标行 %s\n%s", line, out)
+		}
+	}
+
+	h.reset()
+	buf.Reset()
+	h.writePrometheus(&buf)
+	if strings.Contains(buf.String(), "_bucket") {
+		t.Errorf("重置后不应输出分布数据:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,164 @@
+package processor
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"tron-monitor/http"
+	"tron-monitor/models"
+)
+
+// accountBalances 一次账户查询得到的余额（原始整数金额，十进制字符串）
+type accountBalances struct {
+	trx       string
+	trc20     map[string]string // 合约地址 -> 余额
+	trc10     map[string]string // 资产ID -> 余额
+	fetchedAt time.Time
+}
+
+// balanceSnapshotter 查询监控地址转账后的余额
+//
+// 每个地址的查询结果缓存ttl时间，繁忙地址在缓存期内不会重复请求接口，
+// 因此余额为近似的转账后余额，用于对账参考。
+type balanceSnapshotter struct {
+	httpClient *http.HTTPClient
+	ttl        time.Duration
+
+	mu        sync.Mutex
+	cache     map[string]*accountBalances
+	lastSweep time.Time
+}
+
+// newBalanceSnapshotter 创建余额快照查询器
+func newBalanceSnapshotter(httpClient *http.HTTPClient, ttl time.Duration) *balanceSnapshotter {
+	return &balanceSnapshotter{
+		httpClient: httpClient,
+		ttl:        ttl,
+		cache:      make(map[string]*accountBalances),
+	}
+}
+
+// balanceAfter 获取地址在转账代币上的余额，地址不存在或没有该代币时返回"0"
+func (s *balanceSnapshotter) balanceAfter(ctx context.Context, address string, transfer *models.TransferEvent) (string, error) {
+	balances, err := s.balances(ctx, address)
+	if err != nil {
+		return "", err
+	}
+
+	var balance string
+	switch transfer.TokenType {
+	case "TRX":
+		balance = balances.trx
+	case "TRC10":
+		balance = balances.trc10[trc10AssetID(transfer.AssetName)]
+	default:
+		balance = balances.trc20[transfer.ContractAddress]
+	}
+	if balance == "" {
+		balance = "0"
+	}
+	return balance, nil
+}
+
+// balances 获取地址的余额，缓存未过期时直接返回
+func (s *balanceSnapshotter) balances(ctx context.Context, address string) (*accountBalances, error) {
+	s.mu.Lock()
+	cached, ok := s.cache[address]
+	s.mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < s.ttl {
+		return cached, nil
+	}
+
+	info, err := s.httpClient.GetAccountInfo(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	balances, err := parseAccountBalances(info)
+	if err != nil {
+		return nil, fmt.Errorf("解析账户 %s 余额失败: %w", address, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// 每个ttl周期最多清理一次过期缓存，避免地址很多时无限增长，也不必每次未命中都遍历
+	if now := time.Now(); now.Sub(s.lastSweep) >= s.ttl {
+		for addr, entry := range s.cache {
+			if now.Sub(entry.fetchedAt) >= s.ttl {
+				delete(s.cache, addr)
+			}
+		}
+		s.lastSweep = now
+	}
+	s.cache[address] = balances
+	return balances, nil
+}
+
+// trc10AssetID 将区块中十六进制编码的asset_name（如"31303032303030"）解码为资产ID（"1002000"），
+// 与账户assetV2中的键一致；无法解码为数字ID时原样返回
+func trc10AssetID(assetName string) string {
+	decoded, err := hex.DecodeString(assetName)
+	if err != nil || len(decoded) == 0 {
+		return assetName
+	}
+	for _, c := range decoded {
+		if c < '0' || c > '9' {
+			return assetName
+		}
+	}
+	return string(decoded)
+}
+
+// parseAccountBalances 解析 /v1/accounts/{address} 响应中的余额
+//
+// 响应格式: {"data": [{"balance": 123, "trc20": [{"合约地址": "余额"}], "assetV2": [{"key": "资产ID", "value": 100}]}]}，
+// 未激活的账户data为空数组。
+func parseAccountBalances(info map[string]interface{}) (*accountBalances, error) {
+	balances := &accountBalances{
+		trx:       "0",
+		trc20:     make(map[string]string),
+		trc10:     make(map[string]string),
+		fetchedAt: time.Now(),
+	}
+
+	data, ok := info["data"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("响应缺少data字段")
+	}
+	if len(data) == 0 {
+		return balances, nil
+	}
+	account, ok := data[0].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("无效的账户数据")
+	}
+
+	if balance, ok := account["balance"].(float64); ok {
+		balances.trx = strconv.FormatInt(int64(balance), 10)
+	}
+
+	trc20, _ := account["trc20"].([]interface{})
+	for _, item := range trc20 {
+		entry, _ := item.(map[string]interface{})
+		for contract, value := range entry {
+			if amount, ok := value.(string); ok {
+				balances.trc20[contract] = amount
+			}
+		}
+	}
+
+	assets, _ := account["assetV2"].([]interface{})
+	for _, item := range assets {
+		entry, _ := item.(map[string]interface{})
+		key, _ := entry["key"].(string)
+		value, ok := entry["value"].(float64)
+		if key != "" && ok {
+			balances.trc10[key] = strconv.FormatInt(int64(value), 10)
+		}
+	}
+
+	return balances, nil
+}
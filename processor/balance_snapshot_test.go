@@ -0,0 +1,47 @@
+package processor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"tron-monitor/models"
+)
+
+func TestTRC10AssetID(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"31303032303030", "1002000"},
+		{"1002000", "1002000"},
+		{"424954544f5252454e54", "424954544f5252454e54"}, // 旧版按名称标识的资产不是数字ID，保持原样
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := trc10AssetID(tt.in); got != tt.want {
+			t.Errorf("trc10AssetID(%q) = %q，期望 %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestBalanceAfterTRC10(t *testing.T) {
+	balances, err := parseAccountBalances(map[string]interface{}{
+		"data": []interface{}{map[string]interface{}{
+			"balance": float64(5000000),
+			"assetV2": []interface{}{map[string]interface{}{"key": "1002000", "value": float64(42)}},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newBalanceSnapshotter(nil, time.Minute)
+	s.cache[testWatchAddr] = balances
+
+	// 区块中的asset_name是十六进制编码的资产ID
+	transfer := &models.TransferEvent{TokenType: "TRC10", AssetName: "31303032303030"}
+	balance, err := s.balanceAfter(context.Background(), testWatchAddr, transfer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance != "42" {
+		t.Errorf("TRC10余额 %s，期望 42", balance)
+	}
+}
@@ -0,0 +1,93 @@
+package processor
+
+import (
+	"log"
+	"sort"
+	"sync"
+)
+
+// blockCursor 区块处理游标
+//
+// 工作线程并发处理区块，完成顺序可能与区块高度不一致。游标只在区块高度连续时前进，
+// 提前完成的区块在窗口内等待缺口补齐；等待的区块超过窗口大小时跳过缺口，避免游标永久停滞。
+// 游标起点由监控器分发的首个区块确定（seed），未设置时以首个完成的区块为起点。
+type blockCursor struct {
+	mu      sync.Mutex
+	height  int64
+	pending map[int64]struct{}
+	window  int
+	marked  bool // 是否已有区块完成
+}
+
+// newBlockCursor 创建区块处理游标
+func newBlockCursor(window int) *blockCursor {
+	return &blockCursor{
+		pending: make(map[int64]struct{}),
+		window:  window,
+	}
+}
+
+// seed 以首个分发的区块高度设置游标起点，已有区块完成后调用无效
+func (c *blockCursor) seed(height int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.marked || height <= 0 {
+		return
+	}
+	c.height = height - 1
+}
+
+// markProcessed 标记区块已处理，返回游标是否前进以及前进后的高度
+func (c *blockCursor) markProcessed(height int64) (int64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.marked = true
+
+	// 首个区块初始化游标
+	if c.height == 0 {
+		c.height = height - 1
+	}
+
+	// 游标之前的区块（重复或迟到）不影响游标
+	if height <= c.height {
+		return c.height, false
+	}
+
+	c.pending[height] = struct{}{}
+	start := c.height
+	c.advance()
+
+	// 等待窗口已满，跳过最小缺口
+	if len(c.pending) > c.window {
+		heights := make([]int64, 0, len(c.pending))
+		for h := range c.pending {
+			heights = append(heights, h)
+		}
+		sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+
+		log.Printf("区块处理游标等待窗口已满，跳过缺口 %d - %d", c.height+1, heights[0]-1)
+		c.height = heights[0] - 1
+		c.advance()
+	}
+
+	return c.height, c.height != start
+}
+
+// advance 在区块连续时推进游标（调用方需持有锁）
+func (c *blockCursor) advance() {
+	for {
+		if _, ok := c.pending[c.height+1]; !ok {
+			return
+		}
+		delete(c.pending, c.height+1)
+		c.height++
+	}
+}
+
+// snapshot 获取当前游标高度和等待中的区块数
+func (c *blockCursor) snapshot() (int64, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.height, len(c.pending)
+}
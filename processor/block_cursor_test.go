@@ -0,0 +1,42 @@
+package processor
+
+import (
+	"testing"
+)
+
+func TestBlockCursorSeededFromDispatchStart(t *testing.T) {
+	c := newBlockCursor(10)
+	c.seed(100)
+
+	// 后分发的区块先完成，游标不从它开始
+	if cursor, advanced := c.markProcessed(102); advanced || cursor != 99 {
+		t.Fatalf("区块100、101未完成时游标不应前进: %d %v", cursor, advanced)
+	}
+	c.markProcessed(100)
+	if cursor, _ := c.markProcessed(101); cursor != 102 {
+		t.Errorf("缺口补齐后游标应前进到102，实际 %d", cursor)
+	}
+
+	// 已有区块完成后再设置起点无效
+	c.seed(500)
+	if cursor, _ := c.snapshot(); cursor != 102 {
+		t.Errorf("已有区块完成后不应重新设置起点，游标 %d", cursor)
+	}
+}
+
+func TestBlockCursorWaitsForFailedBlock(t *testing.T) {
+	c := newBlockCursor(2)
+	c.seed(100)
+	c.markProcessed(100)
+
+	// 区块101失败（不标记），后续区块在窗口内等待
+	c.markProcessed(102)
+	if cursor, _ := c.markProcessed(103); cursor != 100 {
+		t.Fatalf("窗口未满时游标应停在失败区块之前，实际 %d", cursor)
+	}
+
+	// 窗口满后跳过失败区块
+	if cursor, _ := c.markProcessed(104); cursor != 104 {
+		t.Errorf("窗口满后应跳过缺口，实际 %d", cursor)
+	}
+}
@@ -2,13 +2,16 @@ package processor
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"tron-monitor/config"
 	"tron-monitor/http"
+	"tron-monitor/models"
 	"tron-monitor/redis"
 )
 
@@ -17,16 +20,29 @@ type BlockMonitor struct {
 	config      *config.Config
 	redisClient *redis.RedisClient
 	httpClient  *http.HTTPClient
+	source      BlockSource
 	ctx         context.Context
 	cancel      context.CancelFunc
 	wg          sync.WaitGroup
 	running     bool
 	mu          sync.RWMutex
 
-	// 统计信息
-	lastProcessedBlock int64
+	// direct模式下同步处理区块的函数，为nil时推送到Redis队列
+	directHandler func(*models.BlockData) error
+
+	// 分发首个区块前以其高度设置处理游标起点，只调用一次
+	cursorSeed func(int64)
+	seedOnce   sync.Once
+
+	// 统计信息（processedBlocks、errors统一使用atomic读写）
+	lastProcessedBlock atomic.Int64 // 监控循环写入，GetStats和API并发读取
 	processedBlocks    int64
 	errors             int64
+	skippedTicks       int64
+	catchingUp         atomic.Bool // 监控循环写入，GetStats并发读取
+
+	// 最近一次历史区块同步的进度
+	historical *historicalSync
 }
 
 // NewBlockMonitor 创建区块监控器
@@ -37,6 +53,7 @@ func NewBlockMonitor(cfg *config.Config, redisClient *redis.RedisClient, httpCli
 		config:      cfg,
 		redisClient: redisClient,
 		httpClient:  httpClient,
+		source:      NewBlockSource(cfg, httpClient),
 		ctx:         ctx,
 		cancel:      cancel,
 	}
@@ -52,6 +69,17 @@ func (bm *BlockMonitor) Start() error {
 	}
 
 	bm.running = true
+	bm.resume()
+
+	// 事件流来源需要后台保持连接
+	if stream, ok := bm.source.(*streamSource); ok {
+		bm.wg.Add(1)
+		go func() {
+			defer bm.wg.Done()
+			stream.run(bm.ctx)
+		}()
+	}
+
 	bm.wg.Add(1)
 
 	go func() {
@@ -63,6 +91,62 @@ func (bm *BlockMonitor) Start() error {
 	return nil
 }
 
+// resume 设置启动时的游标，首轮查询即补齐游标之后的区块
+//
+// 获取最新区块失败时只能从持久化的处理游标继续，没有游标则保持为0，与未启用预热时一样从最新区块开始。
+func (bm *BlockMonitor) resume() {
+	if bm.lastProcessedBlock.Load() > 0 {
+		return
+	}
+
+	var latestHeight int64
+	if latestBlock, err := bm.source.LatestBlock(bm.ctx); err != nil {
+		log.Printf("警告: 启动时获取最新区块失败，不做预热: %v", err)
+	} else {
+		latestHeight = latestBlock.Height
+	}
+
+	cursor, source := bm.resumeCursor(latestHeight)
+	if cursor <= 0 {
+		return
+	}
+
+	bm.lastProcessedBlock.Store(cursor)
+	bm.seedCursor(cursor + 1)
+	log.Printf("%s: 最新区块 %d，从区块 %d 开始处理", source, latestHeight, cursor+1)
+}
+
+// resumeCursor 计算启动时的游标：优先从持久化的处理游标继续，首次启动（没有处理游标）时取最新区块之前
+// monitor.warmup_lookback个区块；都没有时返回0，从最新区块开始监控，不补齐。
+//
+// 游标不早于起始区块高度之前一个区块。latestHeight为0表示最新区块未知，此时不预热。
+func (bm *BlockMonitor) resumeCursor(latestHeight int64) (int64, string) {
+	cursor, source := int64(0), ""
+	if bm.redisClient != nil {
+		persisted, err := bm.redisClient.GetProcessorCursor(bm.ctx)
+		if err != nil {
+			log.Printf("警告: %v，按首次启动处理", err)
+		}
+		cursor, source = persisted, "恢复处理游标"
+	}
+
+	if cursor <= 0 {
+		lookback := bm.config.Monitor.WarmupLookback
+		if lookback <= 0 || latestHeight <= 0 {
+			return 0, ""
+		}
+		cursor, source = latestHeight-lookback, "预热"
+	}
+
+	if start := bm.config.Monitor.StartBlockHeight; start > 0 && cursor < start-1 {
+		cursor = start - 1
+	}
+	if cursor < 0 {
+		cursor = 0
+	}
+	return cursor, source
+}
+
 // Stop 停止区块监控
 func (bm *BlockMonitor) Stop() error {
 	bm.mu.Lock()
@@ -80,6 +164,50 @@ func (bm *BlockMonitor) Stop() error {
 	return nil
 }
 
+// SetDirectHandler 设置direct模式下同步处理区块的函数，需在Start之前调用
+func (bm *BlockMonitor) SetDirectHandler(handler func(*models.BlockData) error) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	bm.directHandler = handler
+}
+
+// SetCursorSeed 设置分发首个区块前调用的函数（传入该区块高度），用于确定处理游标的起点，需在Start之前调用
+func (bm *BlockMonitor) SetCursorSeed(seed func(int64)) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	bm.cursorSeed = seed
+}
+
+// seedCursor 以height设置处理游标起点，只有第一次调用生效
+func (bm *BlockMonitor) seedCursor(height int64) {
+	if bm.cursorSeed == nil {
+		return
+	}
+	bm.seedOnce.Do(func() { bm.cursorSeed(height) })
+}
+
+// dispatch 分发区块：queue模式推送到Redis队列，direct模式直接同步处理
+//
+// 队列已满时等待工作线程消化后重试，不丢弃区块。
+func (bm *BlockMonitor) dispatch(blockData *models.BlockData) error {
+	bm.seedCursor(blockData.Height)
+	if bm.directHandler != nil {
+		return bm.directHandler(blockData)
+	}
+
+	for {
+		err := bm.redisClient.PushBlockData(bm.ctx, blockData)
+		if !errors.Is(err, redis.ErrQueueFull) {
+			return err
+		}
+
+		log.Printf("区块队列已满，等待消化后推送区块 %d", blockData.Height)
+		if err := bm.waitForQueueBelow(int64(bm.config.Monitor.QueueSize)); err != nil {
+			return err
+		}
+	}
+}
+
 // IsRunning 检查是否正在运行
 func (bm *BlockMonitor) IsRunning() bool {
 	bm.mu.RLock()
@@ -101,26 +229,62 @@ func (bm *BlockMonitor) monitorBlocks() {
 			return
 		case <-ticker.C:
 			log.Printf("开始处理最新区块...")
+			started := time.Now()
 			if err := bm.processLatestBlock(); err != nil {
 				log.Printf("处理最新区块失败: %v", err)
-				bm.errors++
+				atomic.AddInt64(&bm.errors, 1)
+			}
+
+			// 追赶模式下不等待ticker，连续处理直到追上最新区块
+			for bm.catchingUp.Load() {
+				select {
+				case <-bm.ctx.Done():
+					return
+				default:
+				}
+
+				if err := bm.processLatestBlock(); err != nil {
+					log.Printf("追赶模式处理区块失败: %v", err)
+					atomic.AddInt64(&bm.errors, 1)
+					break
+				}
+			}
+
+			if bm.config.Monitor.SkipOverrunTicks {
+				bm.skipOverrunTick(ticker, time.Since(started))
 			}
 		}
 	}
 }
 
+// skipOverrunTick 本轮处理超过查询间隔时丢弃期间积压的tick
+//
+// ticker通道缓冲一个tick，处理耗时超过间隔后会立即再触发一轮，与刚结束的一轮重复获取区块。
+func (bm *BlockMonitor) skipOverrunTick(ticker *time.Ticker, elapsed time.Duration) {
+	if elapsed < bm.config.Monitor.BlockInterval {
+		return
+	}
+
+	select {
+	case <-ticker.C:
+		atomic.AddInt64(&bm.skippedTicks, 1)
+		log.Printf("本轮处理耗时 %v，超过查询间隔 %v，跳过积压的一次查询", elapsed, bm.config.Monitor.BlockInterval)
+	default:
+	}
+}
+
 // processLatestBlock 处理最新区块
 func (bm *BlockMonitor) processLatestBlock() error {
 	// 获取最新区块
-	blockData, err := bm.httpClient.GetLatestBlock(bm.ctx)
+	blockData, err := bm.source.LatestBlock(bm.ctx)
 	if err != nil {
 		return fmt.Errorf("获取最新区块失败: %w", err)
 	}
 
-	log.Printf("获取到区块高度: %d, 上次处理区块: %d", blockData.Height, bm.lastProcessedBlock)
+	log.Printf("获取到区块高度: %d, 上次处理区块: %d", blockData.Height, bm.lastProcessedBlock.Load())
 
 	// 检查是否为新区块
-	if blockData.Height <= bm.lastProcessedBlock {
+	if blockData.Height <= bm.lastProcessedBlock.Load() {
 		log.Printf("区块 %d 不是新区块，跳过", blockData.Height)
 		return nil // 不是新区块，跳过
 	}
@@ -137,10 +301,21 @@ func (bm *BlockMonitor) processLatestBlock() error {
 		return nil
 	}
 
+	// 落后超过阈值时进入追赶模式，按顺序补齐区块
+	catchUpThreshold := bm.config.Monitor.CatchUpThreshold
+	if last := bm.lastProcessedBlock.Load(); catchUpThreshold > 0 && last > 0 && blockData.Height-last > catchUpThreshold {
+		return bm.catchUp(blockData.Height)
+	}
+	bm.catchingUp.Store(false)
+
 	// 处理缺失的区块（限制最多处理10个区块，避免性能问题）
-	startBlock := bm.lastProcessedBlock + 1
+	startBlock := bm.lastProcessedBlock.Load() + 1
 	endBlock := blockData.Height
 	maxGap := int64(10) // 最多处理10个缺失区块
+	if catchUpThreshold > maxGap {
+		// 启用追赶模式时，阈值以内的缺口全部补齐，保证连续
+		maxGap = catchUpThreshold
+	}
 
 	if startBlock < endBlock {
 		gap := endBlock - startBlock + 1
@@ -148,42 +323,128 @@ func (bm *BlockMonitor) processLatestBlock() error {
 			log.Printf("缺失区块过多 (%d 个)，只处理最近的 %d 个区块", gap, maxGap)
 			startBlock = endBlock - maxGap + 1
 		}
-		
+
 		log.Printf("发现缺失区块，处理区块范围: %d - %d", startBlock, endBlock)
-		
+
 		for blockNum := startBlock; blockNum <= endBlock; blockNum++ {
 			// 获取特定区块
-			specificBlockData, err := bm.httpClient.GetBlockByNumber(bm.ctx, blockNum)
+			specificBlockData, err := bm.source.BlockByNumber(bm.ctx, blockNum)
 			if err != nil {
 				log.Printf("获取区块 %d 失败: %v", blockNum, err)
 				continue
 			}
 
 			// 推送区块数据到Redis队列
-			if err := bm.redisClient.PushBlockData(bm.ctx, specificBlockData); err != nil {
+			if err := bm.dispatch(specificBlockData); err != nil {
 				log.Printf("推送区块 %d 数据到队列失败: %v", blockNum, err)
 				continue
 			}
 
 			log.Printf("已处理缺失区块 %d", blockNum)
-			bm.processedBlocks++
+			atomic.AddInt64(&bm.processedBlocks, 1)
 		}
 	} else {
 		// 推送最新区块数据到Redis队列
-		if err := bm.redisClient.PushBlockData(bm.ctx, blockData); err != nil {
+		if err := bm.dispatch(blockData); err != nil {
 			return fmt.Errorf("推送区块数据到队列失败: %w", err)
 		}
 	}
 
 	// 更新统计信息
-	bm.lastProcessedBlock = blockData.Height
-	bm.processedBlocks++
+	bm.lastProcessedBlock.Store(blockData.Height)
+	atomic.AddInt64(&bm.processedBlocks, 1)
 
 	log.Printf("已处理区块 %d，队列大小: %d", blockData.Height, bm.getQueueSize())
 
 	return nil
 }
 
+// catchUp 追赶模式：从上次处理的区块开始按顺序连续处理一批区块
+//
+// 与常规模式不同，追赶模式不跳过任何区块；获取失败时停止本轮并退出追赶模式，游标停留在最后成功的区块。
+func (bm *BlockMonitor) catchUp(tipHeight int64) error {
+	if !bm.catchingUp.Load() {
+		log.Printf("落后最新区块 %d 个，进入追赶模式", tipHeight-bm.lastProcessedBlock.Load())
+	}
+	bm.catchingUp.Store(true)
+
+	endBlock := bm.lastProcessedBlock.Load() + bm.config.Monitor.CatchUpBatch
+	if endBlock > tipHeight {
+		endBlock = tipHeight
+	}
+
+	if bm.config.Monitor.HistoricalWorkers > 1 {
+		if err := bm.catchUpConcurrently(endBlock); err != nil {
+			bm.catchingUp.Store(false)
+			return err
+		}
+	} else if err := bm.catchUpSerially(endBlock); err != nil {
+		bm.catchingUp.Store(false)
+		return err
+	}
+
+	remaining := tipHeight - bm.lastProcessedBlock.Load()
+	log.Printf("追赶模式已处理至区块 %d，距离最新区块 %d 个", bm.lastProcessedBlock.Load(), remaining)
+
+	if remaining <= bm.config.Monitor.CatchUpThreshold {
+		log.Println("已追上最新区块，退出追赶模式")
+		bm.catchingUp.Store(false)
+	}
+
+	return nil
+}
+
+// catchUpSerially 按顺序处理到endBlock，失败时游标停留在最后成功的区块
+func (bm *BlockMonitor) catchUpSerially(endBlock int64) error {
+	for blockNum := bm.lastProcessedBlock.Load() + 1; blockNum <= endBlock; blockNum++ {
+		select {
+		case <-bm.ctx.Done():
+			return nil
+		default:
+		}
+
+		blockData, err := bm.source.BlockByNumber(bm.ctx, blockNum)
+		if err != nil {
+			return fmt.Errorf("获取区块 %d 失败: %w", blockNum, err)
+		}
+
+		if err := bm.dispatch(blockData); err != nil {
+			return fmt.Errorf("推送区块 %d 数据到队列失败: %w", blockNum, err)
+		}
+
+		bm.lastProcessedBlock.Store(blockNum)
+		atomic.AddInt64(&bm.processedBlocks, 1)
+	}
+	return nil
+}
+
+// catchUpConcurrently 按分块由monitor.historical_workers个协程并发处理到endBlock，游标推进到连续完成的水位
+//
+// 分块大小不超过本轮区块数÷协程数，使每轮追赶都能分给所有协程。
+func (bm *BlockMonitor) catchUpConcurrently(endBlock int64) error {
+	startBlock := bm.lastProcessedBlock.Load() + 1
+	if startBlock > endBlock {
+		return nil
+	}
+	workers := int64(bm.config.Monitor.HistoricalWorkers)
+	chunkSize := (endBlock - startBlock + workers) / workers
+	if chunkSize > bm.config.Monitor.HistoricalChunkSize {
+		chunkSize = bm.config.Monitor.HistoricalChunkSize
+	}
+
+	s := newHistoricalSync(startBlock, endBlock, chunkSize)
+	bm.mu.Lock()
+	bm.historical = s
+	bm.mu.Unlock()
+
+	watermark, err := bm.runHistoricalSync(s)
+	if last := bm.lastProcessedBlock.Load(); watermark > last {
+		atomic.AddInt64(&bm.processedBlocks, watermark-last)
+		bm.lastProcessedBlock.Store(watermark)
+	}
+	return err
+}
+
 // getQueueSize 获取队列大小
 func (bm *BlockMonitor) getQueueSize() int64 {
 	size, err := bm.redisClient.GetQueueSize(bm.ctx)
@@ -197,61 +458,127 @@ func (bm *BlockMonitor) getQueueSize() int64 {
 // GetStats 获取监控器统计信息
 func (bm *BlockMonitor) GetStats() map[string]interface{} {
 	bm.mu.RLock()
-	defer bm.mu.RUnlock()
+	running, historical := bm.running, bm.historical
+	bm.mu.RUnlock()
 
+	// 查询队列长度需要访问Redis，不在持有锁时进行，避免Redis变慢时阻塞Start、Stop
 	queueSize, _ := bm.redisClient.GetQueueSize(bm.ctx)
 
-	return map[string]interface{}{
-		"running":              bm.running,
-		"last_processed_block": bm.lastProcessedBlock,
-		"processed_blocks":     bm.processedBlocks,
-		"errors":               bm.errors,
+	stats := map[string]interface{}{
+		"running":              running,
+		"last_processed_block": bm.lastProcessedBlock.Load(),
+		"processed_blocks":     atomic.LoadInt64(&bm.processedBlocks),
+		"errors":               atomic.LoadInt64(&bm.errors),
 		"queue_size":           queueSize,
 		"block_interval":       bm.config.Monitor.BlockInterval,
+		"catching_up":          bm.catchingUp.Load(),
+		"skipped_ticks":        atomic.LoadInt64(&bm.skippedTicks),
+		"follow_solidified":    bm.config.Monitor.FollowSolidified,
+		"block_source":         bm.config.Monitor.BlockSource,
+	}
+	if stream, ok := bm.source.(*streamSource); ok {
+		stats["stream_connected"] = stream.isConnected()
 	}
+	if bm.httpClient != nil {
+		stats["trongrid"] = bm.httpClient.GetStats()
+	}
+	if historical != nil {
+		stats["historical_sync"] = historical.stats()
+	}
+
+	return stats
 }
 
 // ProcessHistoricalBlocks 处理历史区块
-func (bm *BlockMonitor) ProcessHistoricalBlocks(startBlock, endBlock int64) error {
+//
+// 范围按monitor.historical_chunk_size分块，由monitor.historical_workers个协程并发处理，块内按顺序推送；
+// 开始新分块前等待队列消化，避免大量区块涌入Redis。返回从startBlock开始连续处理完成的最高区块。
+func (bm *BlockMonitor) ProcessHistoricalBlocks(startBlock, endBlock int64) (int64, error) {
+	if startBlock < 0 || endBlock < 0 {
+		return 0, fmt.Errorf("区块高度不能为负数: %d - %d", startBlock, endBlock)
+	}
+	if startBlock > endBlock {
+		return 0, fmt.Errorf("起始区块 %d 大于结束区块 %d", startBlock, endBlock)
+	}
+	if err := bm.checkBackfillSpan(startBlock, endBlock); err != nil {
+		return 0, err
+	}
+
 	log.Printf("开始处理历史区块: %d - %d", startBlock, endBlock)
 
-	for blockNum := startBlock; blockNum <= endBlock; blockNum++ {
+	s := newHistoricalSync(startBlock, endBlock, bm.config.Monitor.HistoricalChunkSize)
+	bm.mu.Lock()
+	bm.historical = s
+	bm.mu.Unlock()
+
+	watermark, err := bm.runHistoricalSync(s)
+	if err != nil {
+		return watermark, err
+	}
+
+	log.Printf("历史区块处理完成")
+	return watermark, nil
+}
+
+// waitForQueueBelow 等待区块队列长度降到limit以下
+func (bm *BlockMonitor) waitForQueueBelow(limit int64) error {
+	for {
+		size, err := bm.redisClient.GetQueueSize(bm.ctx)
+		if err != nil {
+			return fmt.Errorf("获取队列大小失败: %w", err)
+		}
+		if size < limit {
+			return nil
+		}
+
 		select {
 		case <-bm.ctx.Done():
 			return fmt.Errorf("处理被中断")
-		default:
+		case <-time.After(bm.config.Monitor.BlockInterval):
 		}
+	}
+}
 
-		// 获取区块数据
-		blockData, err := bm.httpClient.GetBlockByNumber(bm.ctx, blockNum)
-		if err != nil {
-			log.Printf("获取区块 %d 失败: %v", blockNum, err)
-			continue
-		}
+// checkBackfillSpan 补齐范围超过monitor.max_backfill_span时拒绝执行，除非显式允许（force_backfill或--force）
+func (bm *BlockMonitor) checkBackfillSpan(startBlock, endBlock int64) error {
+	span := endBlock - startBlock + 1
+	limit := bm.config.Monitor.MaxBackfillSpan
+	if limit > 0 && span > limit && !bm.config.Monitor.ForceBackfill {
+		return fmt.Errorf("补齐范围 %d - %d 共 %d 个区块，超过安全上限 %d；确认需要时设置 monitor.force_backfill 或使用 --force 启动",
+			startBlock, endBlock, span, limit)
+	}
+	return nil
+}
 
-		// 推送区块数据到Redis队列
-		if err := bm.redisClient.PushBlockData(bm.ctx, blockData); err != nil {
-			log.Printf("推送区块 %d 到队列失败: %v", blockNum, err)
-			continue
-		}
+// CheckResumeSpan 检查启动后需要补齐的范围（持久化的处理游标或预热游标到最新区块）是否超过安全上限，启动前调用
+//
+// start_block_height只过滤低于它的区块，不会触发补齐；没有游标也未启用预热时从最新区块开始，无需检查。
+func (bm *BlockMonitor) CheckResumeSpan() error {
+	latestBlock, err := bm.source.LatestBlock(bm.ctx)
+	if err != nil {
+		// 与健康检查一致，接口暂时不可用时不阻止启动
+		log.Printf("警告: 获取最新区块失败，跳过补齐范围检查: %v", err)
+		return nil
+	}
 
-		log.Printf("已处理历史区块 %d", blockNum)
+	cursor, _ := bm.resumeCursor(latestBlock.Height)
+	if cursor <= 0 || cursor >= latestBlock.Height {
+		return nil
 	}
 
-	log.Printf("历史区块处理完成")
-	return nil
+	return bm.checkBackfillSpan(cursor+1, latestBlock.Height)
 }
 
 // SyncToLatestBlock 同步到最新区块
 func (bm *BlockMonitor) SyncToLatestBlock() error {
 	// 获取最新区块
-	latestBlock, err := bm.httpClient.GetLatestBlock(bm.ctx)
+	latestBlock, err := bm.source.LatestBlock(bm.ctx)
 	if err != nil {
 		return fmt.Errorf("获取最新区块失败: %w", err)
 	}
 
 	latestHeight := latestBlock.Height
-	currentHeight := bm.lastProcessedBlock
+	currentHeight := bm.lastProcessedBlock.Load()
 
 	if currentHeight >= latestHeight {
 		log.Printf("已是最新区块，当前: %d, 最新: %d", currentHeight, latestHeight)
@@ -260,29 +587,29 @@ func (bm *BlockMonitor) SyncToLatestBlock() error {
 
 	log.Printf("开始同步区块: %d -> %d", currentHeight+1, latestHeight)
 
-	return bm.ProcessHistoricalBlocks(currentHeight+1, latestHeight)
+	// 并发同步时只有连续完成的部分可以推进游标，中断后从第一个未完成的区块重新开始
+	watermark, err := bm.ProcessHistoricalBlocks(currentHeight+1, latestHeight)
+	if watermark > currentHeight {
+		bm.SetLastProcessedBlock(watermark)
+	}
+	return err
 }
 
 // ResetStats 重置统计信息
+//
+// 只重置计数器；lastProcessedBlock是监控进度，重置会导致跳过区块，因此保留。
 func (bm *BlockMonitor) ResetStats() {
-	bm.mu.Lock()
-	defer bm.mu.Unlock()
-
-	bm.processedBlocks = 0
-	bm.errors = 0
-	bm.lastProcessedBlock = 0
+	atomic.StoreInt64(&bm.processedBlocks, 0)
+	atomic.StoreInt64(&bm.errors, 0)
+	atomic.StoreInt64(&bm.skippedTicks, 0)
 }
 
 // GetLastProcessedBlock 获取最后处理的区块高度
 func (bm *BlockMonitor) GetLastProcessedBlock() int64 {
-	bm.mu.RLock()
-	defer bm.mu.RUnlock()
-	return bm.lastProcessedBlock
+	return bm.lastProcessedBlock.Load()
 }
 
 // SetLastProcessedBlock 设置最后处理的区块高度
 func (bm *BlockMonitor) SetLastProcessedBlock(height int64) {
-	bm.mu.Lock()
-	defer bm.mu.Unlock()
-	bm.lastProcessedBlock = height
+	bm.lastProcessedBlock.Store(height)
 }
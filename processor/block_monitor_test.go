@@ -0,0 +1,460 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	httpclient "tron-monitor/http"
+	"tron-monitor/models"
+)
+
+func TestCheckResumeSpan(t *testing.T) {
+	const tip = 500000
+
+	tests := []struct {
+		name      string
+		start     int64
+		lookback  int64
+		persisted int64
+		force     bool
+		wantErr   bool
+	}{
+		{"起始高度只过滤不补齐", 1, 0, 0, false, false},
+		{"预热范围在上限内", 1, 100, 0, false, false},
+		{"处理游标落后过多", 0, 0, tip - 200000, false, true},
+		{"处理游标在上限内", 0, 0, tip - 50000, false, false},
+		{"处理游标优先于预热", 0, 100, tip - 200000, false, true},
+		{"起始高度截断旧游标", tip - 1000, 0, 1, false, false},
+		{"强制补齐", 0, 0, 1, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := loadTestConfig(t, "")
+			cfg.Monitor.StartBlockHeight = tt.start
+			cfg.Monitor.WarmupLookback = tt.lookback
+			cfg.Monitor.ForceBackfill = tt.force
+			cfg.Monitor.MaxBackfillSpan = 100000
+
+			client := newTestRedis(t, cfg)
+			if tt.persisted > 0 {
+				if err := client.SaveProcessorCursor(context.Background(), tt.persisted); err != nil {
+					t.Fatal(err)
+				}
+			}
+			bm := &BlockMonitor{config: cfg, redisClient: client, source: &fakeBlockSource{tip: tip}, ctx: context.Background()}
+
+			err := bm.CheckResumeSpan()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("错误 %v，期望出错: %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "超过安全上限") {
+				t.Errorf("错误信息不符: %v", err)
+			}
+		})
+	}
+}
+
+func TestResumeFromPersistedCursor(t *testing.T) {
+	cfg := loadTestConfig(t, "monitor:\n  warmup_lookback: 100\n")
+	client := newTestRedis(t, cfg)
+	bm := &BlockMonitor{config: cfg, redisClient: client, source: &fakeBlockSource{tip: 5000}, ctx: context.Background()}
+
+	// 首次启动按预热
+	bm.resume()
+	if bm.lastProcessedBlock.Load() != 4900 {
+		t.Errorf("首次启动游标 %d，期望预热到 4900", bm.lastProcessedBlock.Load())
+	}
+
+	// 重启时从持久化的处理游标继续
+	if err := client.SaveProcessorCursor(context.Background(), 4200); err != nil {
+		t.Fatal(err)
+	}
+	bm.lastProcessedBlock.Store(0)
+	bm.resume()
+	if bm.lastProcessedBlock.Load() != 4200 {
+		t.Errorf("重启后游标 %d，期望 4200", bm.lastProcessedBlock.Load())
+	}
+}
+
+// 首次启动时游标取最新区块之前warmup_lookback个区块，不早于起始区块高度之前一个区块；
+// 未启用预热或预热超过链高度时从最新区块（或链起点）开始
+func TestWarmupSeedsCursor(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		lookback int64
+		start    int64
+		want     int64
+	}{
+		{"disabled", 0, 0, 0},
+		{"lookback", 50, 0, 950},
+		{"clamped to start height", 50, 980, 979},
+		{"start height before warmup", 50, 900, 950},
+		{"beyond chain start", 5000, 0, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			bm, _ := newTestMonitor(&fakeBlockSource{tip: 1000}, 1, 1000)
+			defer bm.cancel()
+			bm.config.Monitor.WarmupLookback = tc.lookback
+			bm.config.Monitor.StartBlockHeight = tc.start
+
+			var seeded int64
+			bm.SetCursorSeed(func(height int64) { seeded = height })
+			bm.resume()
+
+			if got := bm.lastProcessedBlock.Load(); got != tc.want {
+				t.Errorf("游标 %d，期望 %d", got, tc.want)
+			}
+			if tc.want > 0 && seeded != tc.want+1 {
+				t.Errorf("处理游标起点 %d，期望 %d", seeded, tc.want+1)
+			}
+			if tc.want == 0 && seeded != 0 {
+				t.Errorf("不预热时不应设置处理游标起点，实际 %d", seeded)
+			}
+		})
+	}
+
+	// 已有游标（如启动前已处理过区块）时不覆盖
+	bm, _ := newTestMonitor(&fakeBlockSource{tip: 1000}, 1, 1000)
+	defer bm.cancel()
+	bm.config.Monitor.WarmupLookback = 50
+	bm.lastProcessedBlock.Store(990)
+	bm.resume()
+	if got := bm.lastProcessedBlock.Load(); got != 990 {
+		t.Errorf("已有游标被覆盖为 %d，期望 990", got)
+	}
+}
+
+// advancingBlockSource 每次查询最新区块时高度加一
+type advancingBlockSource struct {
+	fakeBlockSource
+	height atomic.Int64
+}
+
+func (s *advancingBlockSource) LatestBlock(ctx context.Context) (*models.BlockData, error) {
+	return &models.BlockData{Height: s.height.Add(1)}, nil
+}
+
+func TestStatsAndResetWhileMonitoring(t *testing.T) {
+	source := &advancingBlockSource{}
+	source.height.Store(1000)
+	bm, _ := newTestMonitor(source, 1, 100)
+	defer bm.cancel()
+	bm.redisClient = newTestRedis(t, loadTestConfig(t, ""))
+	bm.lastProcessedBlock.Store(1000)
+
+	// 监控循环推进游标的同时并发读取统计和重置计数器，go test -race 下不应报告数据竞争
+	const rounds = 200
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < rounds; i++ {
+			if err := bm.processLatestBlock(); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+			bm.GetStats()
+			bm.GetLastProcessedBlock()
+			bm.ResetStats()
+		}
+	}
+
+	// 重置只清零计数器，保留处理进度
+	bm.ResetStats()
+	stats := bm.GetStats()
+	if stats["last_processed_block"].(int64) != 1000+rounds {
+		t.Errorf("last_processed_block = %v，期望 %d", stats["last_processed_block"], 1000+rounds)
+	}
+	if bm.GetLastProcessedBlock() != 1000+rounds {
+		t.Errorf("GetLastProcessedBlock() = %d，期望 %d", bm.GetLastProcessedBlock(), 1000+rounds)
+	}
+	if stats["processed_blocks"].(int64) != 0 || stats["errors"].(int64) != 0 {
+		t.Errorf("重置后计数器应为0: %v", stats)
+	}
+}
+
+// 落后超过catch_up_threshold时不等待ticker，连续按批补齐区块，追上后恢复按间隔查询
+func TestCatchUpIgnoresTicker(t *testing.T) {
+	bm, recorder := newTestMonitor(&fakeBlockSource{tip: 5100}, 1, 1000)
+	bm.config.Monitor.BlockInterval = 200 * time.Millisecond
+	bm.config.Monitor.CatchUpBatch = 500
+	bm.lastProcessedBlock.Store(100)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		bm.monitorBlocks()
+	}()
+	defer func() {
+		bm.cancel()
+		<-done
+	}()
+
+	// 按ticker节奏处理10批至少需要2秒，追赶模式应在第一个tick之后很快完成
+	start := time.Now()
+	waitFor(t, "追上最新区块", func() bool { return bm.lastProcessedBlock.Load() == 5100 })
+	if elapsed := time.Since(start); elapsed > 3*bm.config.Monitor.BlockInterval {
+		t.Errorf("补齐5000个区块耗时 %v，应在约一个查询间隔内完成", elapsed)
+	}
+	if bm.catchingUp.Load() {
+		t.Error("追上最新区块后应退出追赶模式")
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	for height := int64(101); height <= 5100; height++ {
+		if recorder.counts[height] != 1 {
+			t.Fatalf("区块 %d 被分发 %d 次，追赶模式不应跳过或重复区块", height, recorder.counts[height])
+		}
+	}
+}
+
+// 启用follow_solidified时以固化区块为链头，未固化的最新区块不会被处理
+func TestFollowSolidifiedUsesSolidifiedTip(t *testing.T) {
+	for _, tc := range []struct {
+		follow bool
+		want   int64
+	}{
+		{true, 180},
+		{false, 200},
+	} {
+		t.Run(fmt.Sprintf("follow_solidified=%v", tc.follow), func(t *testing.T) {
+			var mu sync.Mutex
+			var paths []string
+			block := func(w http.ResponseWriter, height int64) {
+				fmt.Fprintf(w, `{"blockID":"%064x","block_header":{"raw_data":{"number":%d,"timestamp":1700000000000}},"transactions":[]}`, height, height)
+			}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				paths = append(paths, r.URL.Path)
+				mu.Unlock()
+				switch r.URL.Path {
+				case "/wallet/getnowblock":
+					block(w, 200)
+				case "/walletsolidity/getnowblock":
+					block(w, 180)
+				case "/wallet/getblockbynum":
+					var req struct {
+						Num int64 `json:"num"`
+					}
+					json.NewDecoder(r.Body).Decode(&req)
+					block(w, req.Num)
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer server.Close()
+
+			cfg := loadTestConfig(t, fmt.Sprintf("trongrid:\n  base_url: %q\n  retry_max: 0\nmonitor:\n  mode: direct\n  follow_solidified: %v\n", server.URL, tc.follow))
+			bm := NewBlockMonitor(cfg, newTestRedis(t, cfg), httpclient.NewHTTPClient(cfg))
+			defer bm.cancel()
+			recorder := &dispatchRecorder{counts: make(map[int64]int)}
+			bm.SetDirectHandler(recorder.handle)
+			bm.lastProcessedBlock.Store(tc.want - 1)
+
+			if err := bm.processLatestBlock(); err != nil {
+				t.Fatal(err)
+			}
+			if last := bm.lastProcessedBlock.Load(); last != tc.want {
+				t.Errorf("处理游标 %d，期望 %d", last, tc.want)
+			}
+			if len(recorder.counts) != 1 || recorder.counts[tc.want] != 1 {
+				t.Errorf("分发的区块 %v，期望只有 %d", recorder.counts, tc.want)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			wantPath, otherPath := "/wallet/getnowblock", "/walletsolidity/getnowblock"
+			if tc.follow {
+				wantPath, otherPath = otherPath, wantPath
+			}
+			joined := strings.Join(paths, ",")
+			if !strings.Contains(joined, wantPath) || strings.Contains(joined, otherPath) {
+				t.Errorf("请求的接口 %v，期望使用 %s 而不是 %s", paths, wantPath, otherPath)
+			}
+		})
+	}
+}
+
+// 事件流推送的区块直接作为链头，不轮询getnowblock；事件流断开后回退到轮询
+func TestStreamSourceDeliversBlocks(t *testing.T) {
+	blockJSON := func(height int64) string {
+		return fmt.Sprintf(`{"blockID":"%064x","block_header":{"raw_data":{"number":%d,"timestamp":1700000000000}},"transactions":[]}`, height, height)
+	}
+	pushed := make(chan int64)
+	var polls int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/stream":
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			for height := range pushed {
+				fmt.Fprintf(w, "event: block\ndata: %s\n\n", blockJSON(height))
+				w.(http.Flusher).Flush()
+			}
+		case "/wallet/getnowblock":
+			atomic.AddInt64(&polls, 1)
+			fmt.Fprint(w, blockJSON(999))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	cfg := loadTestConfig(t, fmt.Sprintf(`trongrid:
+  base_url: %q
+  retry_max: 0
+monitor:
+  mode: direct
+  block_source: stream
+  stream_url: %q
+  stream_reconnect_delay: 1m
+`, server.URL, server.URL+"/stream"))
+	bm := NewBlockMonitor(cfg, newTestRedis(t, cfg), httpclient.NewHTTPClient(cfg))
+	recorder := &dispatchRecorder{counts: make(map[int64]int)}
+	bm.SetDirectHandler(recorder.handle)
+	stream := bm.source.(*streamSource)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		stream.run(bm.ctx)
+	}()
+	defer func() {
+		bm.cancel()
+		<-done
+	}()
+
+	bm.lastProcessedBlock.Store(299)
+	for _, height := range []int64{300, 301} {
+		pushed <- height
+		// 直接检查事件流收到的区块，LatestBlock在连接建立前会回退到轮询
+		waitFor(t, fmt.Sprintf("收到区块 %d", height), func() bool {
+			stream.mu.RLock()
+			defer stream.mu.RUnlock()
+			return stream.latest != nil && stream.latest.Height == height
+		})
+		if err := bm.processLatestBlock(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recorder.mu.Lock()
+	if recorder.counts[300] != 1 || recorder.counts[301] != 1 || len(recorder.counts) != 2 {
+		t.Errorf("分发的区块 %v，期望事件流推送的 300 和 301", recorder.counts)
+	}
+	recorder.mu.Unlock()
+	if n := atomic.LoadInt64(&polls); n != 0 {
+		t.Errorf("事件流可用时不应轮询getnowblock，实际 %d 次", n)
+	}
+
+	// 事件流关闭后回退到轮询
+	close(pushed)
+	waitFor(t, "事件流断开", func() bool { return !stream.isConnected() })
+	latest, err := stream.LatestBlock(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.Height != 999 || atomic.LoadInt64(&polls) != 1 {
+		t.Errorf("断开后链头 %d（轮询 %d 次），期望回退到轮询得到 999", latest.Height, atomic.LoadInt64(&polls))
+	}
+}
+
+// slowBlockSource 每次获取链头耗时delay，链头每次前进一个区块，记录调用的并发数和起止时间
+type slowBlockSource struct {
+	delay time.Duration
+
+	mu          sync.Mutex
+	tip         int64
+	inFlight    int
+	maxInFlight int
+	starts      []time.Time
+	ends        []time.Time
+}
+
+func (s *slowBlockSource) LatestBlock(ctx context.Context) (*models.BlockData, error) {
+	s.mu.Lock()
+	s.inFlight++
+	if s.inFlight > s.maxInFlight {
+		s.maxInFlight = s.inFlight
+	}
+	s.starts = append(s.starts, time.Now())
+	s.tip++
+	height := s.tip
+	s.mu.Unlock()
+
+	time.Sleep(s.delay)
+
+	s.mu.Lock()
+	s.inFlight--
+	s.ends = append(s.ends, time.Now())
+	s.mu.Unlock()
+	return &models.BlockData{Height: height}, nil
+}
+
+func (s *slowBlockSource) BlockByNumber(ctx context.Context, height int64) (*models.BlockData, error) {
+	return &models.BlockData{Height: height}, nil
+}
+
+// 单轮处理超过block_interval时不会并发处理；启用skip_overrun_ticks时丢弃积压的tick，下一轮按间隔触发
+func TestSlowPollSkipsOverrunTicks(t *testing.T) {
+	for _, skip := range []bool{true, false} {
+		t.Run(fmt.Sprintf("skip_overrun_ticks=%v", skip), func(t *testing.T) {
+			source := &slowBlockSource{delay: 120 * time.Millisecond, tip: 100}
+			bm, _ := newTestMonitor(source, 1, 1000)
+			bm.redisClient = newTestRedis(t, loadTestConfig(t, ""))
+			bm.config.Monitor.BlockInterval = 50 * time.Millisecond
+			bm.config.Monitor.SkipOverrunTicks = skip
+			bm.lastProcessedBlock.Store(100)
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				bm.monitorBlocks()
+			}()
+			waitFor(t, "完成4轮查询", func() bool {
+				source.mu.Lock()
+				defer source.mu.Unlock()
+				return len(source.ends) >= 4
+			})
+			bm.cancel()
+			<-done
+
+			source.mu.Lock()
+			defer source.mu.Unlock()
+			if source.maxInFlight != 1 {
+				t.Errorf("最大并发查询数 %d，processLatestBlock不应并发执行", source.maxInFlight)
+			}
+
+			skipped := bm.GetStats()["skipped_ticks"].(int64)
+			if !skip {
+				if skipped != 0 {
+					t.Errorf("未启用时skipped_ticks应为0，实际 %d", skipped)
+				}
+				return
+			}
+			if skipped == 0 {
+				t.Error("处理耗时超过查询间隔时应计入skipped_ticks")
+			}
+			// 积压的tick被丢弃，下一轮等到下一个间隔才开始，而不是紧接着上一轮
+			for i := 1; i < len(source.starts) && i < len(source.ends); i++ {
+				if gap := source.starts[i].Sub(source.ends[i-1]); gap < 10*time.Millisecond {
+					t.Errorf("第 %d 轮在上一轮结束 %v 后立即开始，积压的tick未被丢弃", i+1, gap)
+				}
+			}
+		})
+	}
+}
@@ -2,40 +2,75 @@ package processor
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"io"
 	"log"
-	"math"
+	"math/big"
+	"runtime/debug"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"tron-monitor/config"
 	"tron-monitor/http"
 	"tron-monitor/models"
+	"tron-monitor/notify"
 	"tron-monitor/redis"
-
-	"github.com/btcsuite/btcutil/base58"
+	"tron-monitor/store"
+	"tron-monitor/tronaddr"
 )
 
 // BlockProcessor 区块处理器
 type BlockProcessor struct {
-	config      *config.Config
-	redisClient *redis.RedisClient
-	httpClient  *http.HTTPClient
-	workers     []*BlockWorker
-	wg          sync.WaitGroup
-	ctx         context.Context
-	cancel      context.CancelFunc
-	running     bool
-	mu          sync.RWMutex
-
-	// 统计信息
+	config        *config.Config
+	redisClient   *redis.RedisClient
+	httpClient    *http.HTTPClient
+	labeler       *AddressLabeler
+	priceOracle   *http.PriceOracle
+	notifier      *notify.Notifier
+	confirmations *confirmationTracker // 启用notify.min_confirmations时持有通知直到确认
+	balances      *balanceSnapshotter  // 启用monitor.balance_snapshot时查询监控地址转账后的余额
+	amounts       *amountHistogram     // 转账金额分布，供 /metrics 输出
+	perAddress    *addressMetrics      // 按监控地址的转账指标，供 /metrics 输出
+	throughput    *throughputMonitor   // 启用monitor.throughput_window时跟踪每个区块的转账数
+	sink          *fileSink            // 启用file_sink时将保存的转账追加到本地JSONL文件
+	store         store.TransferStore  // 启用sql_store时与Redis双写的持久存储
+	verifier      *storeVerifier       // 配置sql_store.verify_sample_rate时抽样校验双写结果
+	cursor        *blockCursor
+	ownerGroups   map[string]string // 地址 -> 所有者分组名
+	workers       []*BlockWorker
+	direct        chan *BlockWorker // direct模式下由监控器同步调用的工作线程池，并发历史同步时每个协程各取一个
+	saves         *savePipeline     // 启用monitor.save_workers时的独立保存阶段
+	wg            sync.WaitGroup
+	ctx           context.Context
+	cancel        context.CancelFunc
+	running       bool
+	mu            sync.RWMutex
+
+	// 最近一次成功获取的监控地址集合，获取失败时沿用
+	watchMu      sync.Mutex
+	lastWatchSet map[string]bool
+
+	// 统计信息（工作线程并发写入，统一使用atomic读写）
 	processedBlocks int64
 	transfersFound  int64
 	errors          int64
+	enrichErrors    int64 // 价格、原始交易保留等附加信息失败次数，不影响转账保存
+	aliveWorkers    int64
+	workerPanics    int64
+	deadWorkers     int64 // 一分钟内重启次数达到monitor.max_worker_restarts而退出的工作线程数
+	truncatedBlocks int64 // 转账数超过monitor.max_transfers_per_block被截断的区块数
+	oomSaveErrors   int64 // 因Redis内存不足保存转账失败的次数（含重试）
+	skippedTxs      int64 // 预检未引用监控地址而跳过解码的交易数
+	zeroAmount      int64 // 因金额为0被丢弃的转账数（monitor.skip_zero_amount）
+	duplicateTxs    int64 // 同一转账已按其他区块保存的冲突次数（monitor.resolve_duplicate_txs）
+	watchFallbacks  int64 // 获取监控地址失败、沿用上次监控地址的次数
+	storeErrors     int64 // 写入SQL存储失败的次数，不影响Redis中的记录
 }
 
 // BlockWorker 区块工作线程
@@ -47,20 +82,89 @@ type BlockWorker struct {
 	wg        sync.WaitGroup
 	running   bool
 	mu        sync.RWMutex
+
+	// 当前交易是否被抽样（监控地址为空且启用sample模式时），抽中的交易保留所有转账
+	sampleTx bool
+
+	// 当前区块的交易信息（交易哈希 -> 信息），第一次需要日志时整块获取
+	txInfos       map[string]*models.TransactionInfo
+	txInfosLoaded bool
+	txInfosErr    error
 }
 
 // NewBlockProcessor 创建区块处理器
-func NewBlockProcessor(cfg *config.Config, redisClient *redis.RedisClient, httpClient *http.HTTPClient) *BlockProcessor {
+func NewBlockProcessor(cfg *config.Config, redisClient *redis.RedisClient, httpClient *http.HTTPClient, notifier *notify.Notifier) *BlockProcessor {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	processor := &BlockProcessor{
 		config:      cfg,
 		redisClient: redisClient,
 		httpClient:  httpClient,
+		notifier:    notifier,
+		cursor:      newBlockCursor(cfg.Monitor.ReorderWindow),
+		amounts:     newAmountHistogram(cfg.Stats.AmountBuckets),
+		perAddress:  newAddressMetrics(redisClient),
 		ctx:         ctx,
 		cancel:      cancel,
 	}
 
+	// 建立地址到所有者分组的索引
+	processor.ownerGroups = make(map[string]string)
+	for group, addresses := range cfg.Monitor.OwnerGroups {
+		for _, addr := range addresses {
+			processor.ownerGroups[addr] = group
+		}
+	}
+
+	// 通知需要等待确认时创建确认数跟踪器
+	if notifier != nil && cfg.Notify.MinConfirmations > 0 {
+		processor.confirmations = newConfirmationTracker(httpClient, redisClient, notifier, cfg.Notify.MinConfirmations, cfg.Monitor.BlockInterval)
+		if cfg.Notify.ConfirmationsSource == ConfirmationsSourceSolidified {
+			processor.confirmations.useSolidified(cfg.Monitor.BlockInterval)
+		}
+		if cfg.Notify.RevertReorged {
+			processor.confirmations.revertReorged()
+		}
+	}
+
+	// 创建每区块转账量监控
+	if cfg.Monitor.ThroughputWindow > 0 {
+		processor.throughput = newThroughputMonitor(cfg.Monitor.ThroughputWindow, cfg.Monitor.ThroughputK, cfg.Monitor.ThroughputCap, notifier)
+	}
+
+	// 创建本地JSONL文件输出
+	if cfg.FileSink.Enabled {
+		processor.sink = newFileSink(cfg)
+	}
+
+	// 创建余额快照查询器
+	if cfg.Monitor.BalanceSnapshot {
+		processor.balances = newBalanceSnapshotter(httpClient, cfg.Monitor.BalanceCacheTTL)
+	}
+
+	// 创建地址标签查询器
+	if cfg.Labels.Enabled {
+		processor.labeler = NewAddressLabeler(cfg, redisClient)
+	}
+
+	// 创建价格查询客户端
+	if cfg.USDT.UseLivePrice {
+		processor.priceOracle = http.NewPriceOracle(cfg)
+	}
+
+	// direct模式不使用队列和工作线程池；工作线程有逐交易状态，不能被并发调用，按历史同步协程数创建
+	if cfg.Monitor.Mode == MonitorModeDirect {
+		size := cfg.Monitor.HistoricalWorkers
+		if size < 1 {
+			size = 1
+		}
+		processor.direct = make(chan *BlockWorker, size)
+		for i := 0; i < size; i++ {
+			processor.direct <- &BlockWorker{id: -1 - i, processor: processor, ctx: ctx}
+		}
+		return processor
+	}
+
 	// 创建工作线程
 	processor.workers = make([]*BlockWorker, cfg.Monitor.WorkerCount)
 	for i := 0; i < cfg.Monitor.WorkerCount; i++ {
@@ -73,6 +177,11 @@ func NewBlockProcessor(cfg *config.Config, redisClient *redis.RedisClient, httpC
 		}
 	}
 
+	// 创建独立的保存阶段
+	if cfg.Monitor.SaveWorkers > 0 {
+		processor.saves = newSavePipeline(processor, cfg.Monitor.SaveWorkers, cfg.Monitor.SaveQueueSize)
+	}
+
 	return processor
 }
 
@@ -87,6 +196,45 @@ func (bp *BlockProcessor) Start() error {
 
 	bp.running = true
 
+	// 加载地址标签并启动热加载
+	if bp.labeler != nil {
+		if err := bp.labeler.Reload(bp.ctx); err != nil {
+			log.Printf("加载地址标签失败: %v", err)
+		}
+		bp.wg.Add(1)
+		go func() {
+			defer bp.wg.Done()
+			bp.labeler.run(bp.ctx)
+		}()
+	}
+
+	if bp.sink != nil {
+		if err := bp.sink.start(); err != nil {
+			bp.running = false
+			return err
+		}
+	}
+	if bp.verifier != nil {
+		bp.verifier.start()
+	}
+
+	// 恢复上次运行时等待确认的通知并启动确认检查
+	if bp.confirmations != nil {
+		if err := bp.confirmations.load(bp.ctx); err != nil {
+			log.Printf("恢复待确认区块失败: %v", err)
+		}
+		bp.wg.Add(1)
+		go func() {
+			defer bp.wg.Done()
+			bp.confirmations.run(bp.ctx)
+		}()
+	}
+
+	// 先启动保存线程，解码线程提交的转账才有人处理
+	if bp.saves != nil {
+		bp.saves.start()
+	}
+
 	// 启动所有工作线程
 	for _, worker := range bp.workers {
 		bp.wg.Add(1)
@@ -96,10 +244,102 @@ func (bp *BlockProcessor) Start() error {
 		}(worker)
 	}
 
+	if bp.direct != nil {
+		log.Println("区块处理器已启动（direct模式，由监控器同步处理区块）")
+		return nil
+	}
 	log.Printf("区块处理器已启动，工作线程数: %d", len(bp.workers))
 	return nil
 }
 
+// ProcessBlock 同步处理单个区块（direct模式），失败时重试至monitor.max_block_attempts次，仍失败则放入死信队列
+//
+// 区块放入死信队列后返回nil，监控器游标照常前进；只有放入死信队列也失败时才返回错误，由监控器重新获取。
+// 失败的区块不标记为已处理，处理游标停在它之前，等待窗口满后才跳过（区块留在死信队列中待重放）。
+func (bp *BlockProcessor) ProcessBlock(blockData *models.BlockData) error {
+	if bp.direct == nil {
+		return fmt.Errorf("区块处理器未运行在direct模式")
+	}
+	w := <-bp.direct
+	defer func() { bp.direct <- w }()
+
+	var err error
+	for attempt := 1; attempt <= bp.config.Monitor.MaxBlockAttempts; attempt++ {
+		if err = w.processBlockSafe(blockData); err == nil {
+			atomic.AddInt64(&bp.processedBlocks, 1)
+			w.advanceCursor(blockData.Height)
+			return nil
+		}
+
+		log.Printf("处理区块 %d 失败（第 %d 次）: %v", blockData.Height, attempt, err)
+		atomic.AddInt64(&bp.errors, 1)
+		blockData.Attempts = attempt
+	}
+
+	entry := &models.DeadLetterBlock{
+		Block:    blockData,
+		Error:    err.Error(),
+		Attempts: blockData.Attempts,
+		FailedAt: time.Now(),
+	}
+	if dlqErr := bp.redisClient.PushDeadLetterBlock(bp.ctx, entry); dlqErr != nil {
+		log.Printf("区块 %d 放入死信队列失败: %v", blockData.Height, dlqErr)
+		return fmt.Errorf("处理区块 %d 失败且未能放入死信队列: %w", blockData.Height, err)
+	}
+	log.Printf("区块 %d 处理 %d 次仍失败，已放入死信队列", blockData.Height, blockData.Attempts)
+
+	return nil
+}
+
+// ReplayDeadLetterBlocks 重放死信队列中最旧的limit个区块，返回重放数量
+//
+// queue模式放回处理队列；direct模式没有消费队列的工作线程，直接同步处理，再次失败的区块重新进入死信队列。
+func (bp *BlockProcessor) ReplayDeadLetterBlocks(ctx context.Context, limit int64) (int64, error) {
+	if bp.direct == nil {
+		return bp.redisClient.ReplayDeadLetterBlocks(ctx, limit)
+	}
+	return bp.redisClient.ReplayDeadLetterBlocksWith(ctx, limit, bp.ProcessBlock)
+}
+
+// ReplayTransferDeadLetters 重新保存转账死信队列中最旧的limit个事件，返回重放数量
+//
+// 启用地址标签时按当前标签重新标注，启用SQL存储时同时写入，与工作线程保存的转账一致。
+// SQL存储按事件覆盖写入，Redis保存失败、事件放回死信队列后再次重放不会产生重复记录。
+func (bp *BlockProcessor) ReplayTransferDeadLetters(ctx context.Context, limit int64) (int64, error) {
+	if bp.labeler == nil && bp.store == nil {
+		return bp.redisClient.ReplayTransferDeadLetters(ctx, limit)
+	}
+	return bp.redisClient.ReplayTransferDeadLettersWith(ctx, limit, func(event *models.TransferEvent) {
+		if bp.labeler != nil {
+			bp.labeler.Apply(event)
+		}
+		if bp.store != nil && !event.WhaleOnly {
+			bp.saveToStore(ctx, event)
+		}
+	})
+}
+
+// SetTransferStore 设置与Redis双写的转账存储，需在Start之前调用
+func (bp *BlockProcessor) SetTransferStore(s store.TransferStore) {
+	bp.store = s
+	if rate := bp.config.SQLStore.VerifySampleRate; s != nil && rate > 0 {
+		bp.verifier = newStoreVerifier(bp.redisClient, s, rate, bp.config.SQLStore.VerifyQueueSize)
+	}
+	if bp.confirmations != nil {
+		bp.confirmations.store = s
+	}
+}
+
+// saveToStore 将转账写入SQL存储，失败只记录日志并计数，Redis中的记录仍然有效
+func (bp *BlockProcessor) saveToStore(ctx context.Context, transfer *models.TransferEvent) bool {
+	if err := bp.store.SaveTransfer(ctx, transfer); err != nil {
+		log.Printf("转账 %s: %v", transfer.EventID(), err)
+		atomic.AddInt64(&bp.storeErrors, 1)
+		return false
+	}
+	return true
+}
+
 // Stop 停止区块处理器
 func (bp *BlockProcessor) Stop() error {
 	bp.mu.Lock()
@@ -116,200 +356,1068 @@ func (bp *BlockProcessor) Stop() error {
 	for _, worker := range bp.workers {
 		worker.stop()
 	}
-
-	bp.wg.Wait()
-	log.Println("区块处理器已停止")
-	return nil
+
+	// 解码线程退出后不会再提交转账，保存线程用自己未取消的上下文保存完队列中的转账再停止
+	if bp.saves != nil {
+		bp.saves.stop()
+	}
+
+	bp.wg.Wait()
+
+	// 所有转账保存完成后写完文件输出的剩余队列，校验完已提交的抽样转账
+	if bp.sink != nil {
+		bp.sink.stop()
+	}
+	if bp.verifier != nil {
+		bp.verifier.stop()
+	}
+	log.Println("区块处理器已停止")
+	return nil
+}
+
+// IsRunning 检查是否正在运行
+func (bp *BlockProcessor) IsRunning() bool {
+	bp.mu.RLock()
+	defer bp.mu.RUnlock()
+	return bp.running
+}
+
+// DeadWorkers 返回因一分钟内重启次数超过monitor.max_worker_restarts而退出的工作线程数，这些线程不会再处理区块
+func (bp *BlockProcessor) DeadWorkers() int64 {
+	return atomic.LoadInt64(&bp.deadWorkers)
+}
+
+// GetStats 获取处理器统计信息
+func (bp *BlockProcessor) GetStats() map[string]interface{} {
+	bp.mu.RLock()
+	defer bp.mu.RUnlock()
+
+	cursor, pending := bp.cursor.snapshot()
+
+	stats := map[string]interface{}{
+		"running":          bp.running,
+		"processed_blocks": atomic.LoadInt64(&bp.processedBlocks),
+		"transfers_found":  atomic.LoadInt64(&bp.transfersFound),
+		"errors":           atomic.LoadInt64(&bp.errors),
+		"enrich_errors":    atomic.LoadInt64(&bp.enrichErrors),
+		"worker_count":     len(bp.workers),
+		"alive_workers":    atomic.LoadInt64(&bp.aliveWorkers),
+		"worker_panics":    atomic.LoadInt64(&bp.workerPanics),
+		"dead_workers":     bp.DeadWorkers(),
+		"truncated_blocks": atomic.LoadInt64(&bp.truncatedBlocks),
+		"oom_save_errors":  atomic.LoadInt64(&bp.oomSaveErrors),
+		"skipped_txs":      atomic.LoadInt64(&bp.skippedTxs),
+		"zero_amount":      atomic.LoadInt64(&bp.zeroAmount),
+		"duplicate_txs":    atomic.LoadInt64(&bp.duplicateTxs),
+		"watch_fallbacks":  atomic.LoadInt64(&bp.watchFallbacks),
+		"cursor":           cursor,
+		"pending_blocks":   pending,
+	}
+	if bp.saves != nil {
+		stats["save_workers"] = len(bp.saves.workers)
+		stats["save_queue"] = len(bp.saves.jobs)
+	}
+	if bp.throughput != nil {
+		stats["throughput"] = bp.throughput.stats()
+	}
+	if bp.sink != nil {
+		stats["file_sink"] = bp.sink.stats()
+	}
+	if bp.store != nil {
+		stats["sql_store_errors"] = atomic.LoadInt64(&bp.storeErrors)
+	}
+	if bp.verifier != nil {
+		stats["sql_store_verify"] = bp.verifier.stats()
+	}
+	if bp.confirmations != nil {
+		stats["pending_notifications"], stats["reorg_dropped_notifications"], stats["reorg_reverted_transfers"] = bp.confirmations.stats()
+	}
+
+	return stats
+}
+
+// ResetStats 重置统计信息
+//
+// 只重置计数器，处理游标属于处理进度而非统计信息，不受影响。
+func (bp *BlockProcessor) ResetStats() {
+	atomic.StoreInt64(&bp.processedBlocks, 0)
+	atomic.StoreInt64(&bp.transfersFound, 0)
+	atomic.StoreInt64(&bp.errors, 0)
+	atomic.StoreInt64(&bp.enrichErrors, 0)
+	atomic.StoreInt64(&bp.workerPanics, 0)
+	atomic.StoreInt64(&bp.truncatedBlocks, 0)
+	atomic.StoreInt64(&bp.oomSaveErrors, 0)
+	atomic.StoreInt64(&bp.skippedTxs, 0)
+	atomic.StoreInt64(&bp.zeroAmount, 0)
+	atomic.StoreInt64(&bp.duplicateTxs, 0)
+	atomic.StoreInt64(&bp.watchFallbacks, 0)
+	atomic.StoreInt64(&bp.storeErrors, 0)
+	if bp.verifier != nil {
+		bp.verifier.reset()
+	}
+	bp.amounts.reset()
+}
+
+// watchAddressSet 获取监控地址集合（只读，调用方不能修改）
+//
+// 获取失败时使用最近一次成功获取的集合并计入watch_fallbacks，区块照常处理，不会因Redis短暂抖动进入死信队列；
+// 从未成功获取过时返回错误。
+func (bp *BlockProcessor) watchAddressSet(ctx context.Context) (map[string]bool, error) {
+	watchAddresses, err := bp.redisClient.GetWatchAddresses(ctx)
+	if err != nil {
+		bp.watchMu.Lock()
+		last := bp.lastWatchSet
+		bp.watchMu.Unlock()
+		if last == nil {
+			return nil, fmt.Errorf("获取监控地址失败: %w", err)
+		}
+		atomic.AddInt64(&bp.watchFallbacks, 1)
+		log.Printf("警告: 获取监控地址失败，使用最近一次的监控地址（%d 个）: %v", len(last), err)
+		return last, nil
+	}
+
+	watchAddressSet := make(map[string]bool, len(watchAddresses))
+	for _, addr := range watchAddresses {
+		watchAddressSet[addr] = true
+	}
+	bp.watchMu.Lock()
+	bp.lastWatchSet = watchAddressSet
+	bp.watchMu.Unlock()
+	return watchAddressSet, nil
+}
+
+// WriteMetrics 以Prometheus文本格式输出处理器指标
+func (bp *BlockProcessor) WriteMetrics(ctx context.Context, w io.Writer) {
+	bp.amounts.writePrometheus(w)
+	if limit := bp.config.Stats.MaxMetricAddresses; limit > 0 {
+		bp.perAddress.writePrometheus(ctx, w, limit)
+	}
+}
+
+// DecodeBlock 获取并解码指定区块的转账事件，不经过队列，也不保存任何数据
+//
+// raw为true时同时返回区块中各合约的原始参数。
+func (bp *BlockProcessor) DecodeBlock(ctx context.Context, height int64, raw bool) ([]*models.TransferEvent, []*models.RawContractParameter, error) {
+	getBlock := bp.httpClient.GetBlockByNumber
+	if raw {
+		getBlock = bp.httpClient.GetBlockByNumberRaw
+	}
+	blockData, err := getBlock(ctx, height)
+	if err != nil {
+		return nil, nil, err
+	}
+	if blockData.Block == nil || blockData.Block.Trans == nil {
+		return []*models.TransferEvent{}, nil, nil
+	}
+
+	var params []*models.RawContractParameter
+	if raw {
+		params = bp.rawParameters(blockData.Block.Trans)
+	}
+
+	watchAddressSet, err := bp.watchAddressSet(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	watchScopes, err := bp.redisClient.GetWatchScopes(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 使用临时工作线程复用解码逻辑
+	w := &BlockWorker{id: -1, processor: bp, ctx: ctx}
+
+	transfers := []*models.TransferEvent{}
+	for txIndex, tx := range blockData.Block.Trans {
+		txTransfers, _, err := w.extractTransfers(tx, txIndex, blockData, watchAddressSet)
+		if err != nil {
+			log.Printf("提取交易 %s 的转账信息失败: %v", tx.TxID, err)
+			continue
+		}
+		txTransfers = filterScoped(txTransfers, watchAddressSet, watchScopes)
+		if bp.config.Monitor.IgnoreSelfTransfers {
+			txTransfers = bp.dropSelfTransfers(txTransfers)
+		}
+		transfers = append(transfers, txTransfers...)
+	}
+
+	if bp.labeler != nil {
+		for _, transfer := range transfers {
+			bp.labeler.Apply(transfer)
+		}
+	}
+
+	return transfers, params, nil
+}
+
+// DecodeTransaction 按需从链上获取并解码单笔交易，返回交易所在区块、合约类型和解码出的转账，不保存任何数据
+//
+// all为true时返回交易中的全部转账，不按监控地址和代币范围过滤，用于排查未被记录的转账；
+// raw为true时同时返回各合约的原始参数。
+func (bp *BlockProcessor) DecodeTransaction(ctx context.Context, txID string, all, raw bool) (*models.BlockData, []string, []*models.TransferEvent, []*models.RawContractParameter, error) {
+	getTransaction := bp.httpClient.GetTransactionByID
+	if raw {
+		getTransaction = bp.httpClient.GetTransactionByIDRaw
+	}
+	tx, err := getTransaction(ctx, txID)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	// 区块高度和时间只能从交易信息中获取，未确认的交易两者为0
+	txInfo, err := bp.httpClient.GetTransactionInfo(ctx, txID)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	blockData := &models.BlockData{
+		Height:    txInfo.BlockNumber,
+		CreatedAt: time.Now(),
+	}
+	if txInfo.BlockTimeStamp != 0 {
+		blockData.Timestamp, _ = models.NormalizeTimestampMillis(txInfo.BlockTimeStamp)
+	}
+
+	contractTypes := []string{}
+	if tx.RawData != nil {
+		for _, contract := range tx.RawData.Contract {
+			if contract != nil {
+				contractTypes = append(contractTypes, contract.TypeName())
+			}
+		}
+	}
+
+	watchAddressSet, err := bp.watchAddressSet(ctx)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	// 使用临时工作线程复用解码逻辑；返回全部转账时借用抽样标记跳过监控地址过滤
+	w := &BlockWorker{id: -1, processor: bp, ctx: ctx, sampleTx: all}
+
+	// 交易在区块中的序号未知，按0处理
+	transfers, _, err := w.extractTransfers(tx, 0, blockData, watchAddressSet)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("提取交易 %s 的转账信息失败: %w", txID, err)
+	}
+	if transfers == nil {
+		transfers = []*models.TransferEvent{}
+	}
+	for _, transfer := range transfers {
+		if all {
+			transfer.Sampled = false
+		}
+	}
+
+	if !all {
+		watchScopes, err := bp.redisClient.GetWatchScopes(ctx)
+		if err != nil {
+			return nil, nil, nil, nil, err
+		}
+		transfers = filterScoped(transfers, watchAddressSet, watchScopes)
+		if bp.config.Monitor.IgnoreSelfTransfers {
+			transfers = bp.dropSelfTransfers(transfers)
+		}
+	}
+
+	if bp.labeler != nil {
+		for _, transfer := range transfers {
+			bp.labeler.Apply(transfer)
+		}
+	}
+
+	var params []*models.RawContractParameter
+	if raw {
+		params = bp.rawParameters([]*models.Transaction{tx})
+	}
+
+	return blockData, contractTypes, transfers, params, nil
+}
+
+// rawParameters 收集交易中各合约的原始参数（接口返回的JSON，地址未规范化），单个参数超过server.raw_param_max_bytes时只保留开头部分，
+// 总条数不超过server.raw_param_max_entries
+func (bp *BlockProcessor) rawParameters(txs []*models.Transaction) []*models.RawContractParameter {
+	maxBytes := bp.config.Server.RawParamMaxBytes
+	maxEntries := bp.config.Server.RawParamMaxEntries
+
+	params := []*models.RawContractParameter{}
+	for _, tx := range txs {
+		if tx == nil || tx.RawData == nil {
+			continue
+		}
+		for i, contract := range tx.RawData.Contract {
+			if contract == nil {
+				continue
+			}
+			if len(params) >= maxEntries {
+				return params
+			}
+			data := []byte(contract.RawParameter)
+			if data == nil {
+				var err error
+				if data, err = json.Marshal(contract.Parameter); err != nil {
+					continue
+				}
+			}
+			param := &models.RawContractParameter{
+				TxHash:        tx.TxID,
+				ContractIndex: i,
+				Type:          contract.TypeName(),
+				Size:          len(data),
+			}
+			if len(data) > maxBytes {
+				param.Preview = string(data[:maxBytes])
+				param.Truncated = true
+			} else {
+				param.Parameter = data
+			}
+			params = append(params, param)
+		}
+	}
+	return params
+}
+
+// start 启动工作线程
+func (w *BlockWorker) start() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.running {
+		return
+	}
+
+	w.running = true
+	w.wg.Add(1)
+
+	go func() {
+		defer w.wg.Done()
+		w.run()
+	}()
+
+	log.Printf("工作线程 %d 已启动", w.id)
+}
+
+// stop 停止工作线程
+func (w *BlockWorker) stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.running {
+		return
+	}
+
+	w.running = false
+	w.cancel()
+	w.wg.Wait()
+
+	log.Printf("工作线程 %d 已停止", w.id)
+}
+
+// run 运行工作线程，processBlocks发生panic时按限制的频率重启
+func (w *BlockWorker) run() {
+	atomic.AddInt64(&w.processor.aliveWorkers, 1)
+	defer atomic.AddInt64(&w.processor.aliveWorkers, -1)
+
+	var restarts []time.Time
+	for {
+		if !w.processBlocksSafe() {
+			return // 正常退出
+		}
+
+		select {
+		case <-w.ctx.Done():
+			return
+		default:
+		}
+
+		// 只保留最近一分钟内的重启记录
+		now := time.Now()
+		recent := restarts[:0]
+		for _, t := range restarts {
+			if now.Sub(t) < time.Minute {
+				recent = append(recent, t)
+			}
+		}
+		restarts = recent
+
+		if len(restarts) >= w.processor.config.Monitor.MaxWorkerRestarts {
+			log.Printf("工作线程 %d: 一分钟内重启次数已达上限 %d，停止重启", w.id, w.processor.config.Monitor.MaxWorkerRestarts)
+			atomic.AddInt64(&w.processor.deadWorkers, 1)
+			return
+		}
+		restarts = append(restarts, now)
+
+		log.Printf("工作线程 %d: 将在 %v 后重启", w.id, w.processor.config.Monitor.ErrorBackoff)
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-time.After(w.processor.config.Monitor.ErrorBackoff):
+		}
+	}
+}
+
+// processBlockSafe 处理单个区块并捕获panic，panic作为处理失败返回（direct模式在监控器协程中调用）
+func (w *BlockWorker) processBlockSafe(blockData *models.BlockData) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("工作线程 %d: 处理区块 %d 时发生panic: %v\n%s", w.id, blockData.Height, r, debug.Stack())
+			atomic.AddInt64(&w.processor.workerPanics, 1)
+			err = fmt.Errorf("处理区块时发生panic: %v", r)
+		}
+	}()
+
+	return w.processBlock(blockData)
+}
+
+// processBlocksSafe 执行处理循环并捕获panic，发生panic时返回true
+func (w *BlockWorker) processBlocksSafe() (panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("工作线程 %d: 发生panic: %v\n%s", w.id, r, debug.Stack())
+			atomic.AddInt64(&w.processor.workerPanics, 1)
+			atomic.AddInt64(&w.processor.errors, 1)
+			panicked = true
+		}
+	}()
+
+	w.processBlocks()
+	return false
+}
+
+// processBlocks 处理区块循环
+func (w *BlockWorker) processBlocks() {
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		default:
+		}
+
+		// 从Redis队列获取区块数据（队列为空时BRPOP会阻塞idle_poll_interval）
+		blockData, err := w.processor.redisClient.PopBlockData(w.ctx)
+		if err != nil {
+			// 停止时BRPOP被取消，直接退出，不做错误退避
+			if w.ctx.Err() != nil {
+				return
+			}
+			log.Printf("工作线程 %d: 获取区块数据失败: %v", w.id, err)
+			select {
+			case <-w.ctx.Done():
+				return
+			case <-time.After(w.processor.config.Monitor.ErrorBackoff):
+			}
+			continue
+		}
+
+		if blockData == nil {
+			// 队列为空，BRPOP已经阻塞等待过，直接重新拉取
+			continue
+		}
+
+		// 处理区块
+		if err := w.processBlock(blockData); err != nil {
+			if w.ctx.Err() != nil {
+				// 停止时区块可能只保存了一部分，放回队列下次启动重新处理，游标不前进
+				w.requeueOnStop(blockData, err)
+				return
+			}
+			log.Printf("工作线程 %d: 处理区块 %d 失败: %v", w.id, blockData.Height, err)
+			atomic.AddInt64(&w.processor.errors, 1)
+
+			// 重新入队或放入死信队列，都不标记为已处理，游标不越过失败的区块
+			w.retryOrDeadLetter(blockData, err)
+			continue
+		}
+		atomic.AddInt64(&w.processor.processedBlocks, 1)
+
+		// 区块可能乱序完成，游标只在连续时前进
+		w.advanceCursor(blockData.Height)
+	}
+}
+
+// requeueOnStop 停止时把未处理完的区块放回队列（不计入重试次数），放回失败则放入死信队列
+//
+// 工作线程的上下文已取消，这里使用独立的短超时上下文。
+func (w *BlockWorker) requeueOnStop(blockData *models.BlockData, processErr error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := w.processor.redisClient.RequeueBlockData(ctx, blockData)
+	if err == nil {
+		log.Printf("工作线程 %d: 停止时区块 %d 未处理完成，已放回队列", w.id, blockData.Height)
+		return
+	}
+	log.Printf("工作线程 %d: 停止时区块 %d 放回队列失败: %v", w.id, blockData.Height, err)
+
+	entry := &models.DeadLetterBlock{
+		Block:    blockData,
+		Error:    processErr.Error(),
+		Attempts: blockData.Attempts,
+		FailedAt: time.Now(),
+	}
+	if err := w.processor.redisClient.PushDeadLetterBlock(ctx, entry); err != nil {
+		log.Printf("工作线程 %d: 区块 %d 放入死信队列失败，区块丢失: %v", w.id, blockData.Height, err)
+	}
+}
+
+// retryOrDeadLetter 处理失败的区块未达到最大次数时重新入队（返回true），否则放入死信队列
+//
+// 重新入队按monitor.queue_full_policy处理队列已满的情况，只有Redis写入失败才放入死信队列。
+func (w *BlockWorker) retryOrDeadLetter(blockData *models.BlockData, processErr error) bool {
+	blockData.Attempts++
+	if blockData.Attempts < w.processor.config.Monitor.MaxBlockAttempts {
+		if err := w.processor.redisClient.RequeueBlockData(w.ctx, blockData); err != nil {
+			log.Printf("工作线程 %d: 区块 %d 重新入队失败: %v", w.id, blockData.Height, err)
+		} else {
+			return true
+		}
+	}
+
+	entry := &models.DeadLetterBlock{
+		Block:    blockData,
+		Error:    processErr.Error(),
+		Attempts: blockData.Attempts,
+		FailedAt: time.Now(),
+	}
+	if err := w.processor.redisClient.PushDeadLetterBlock(w.ctx, entry); err != nil {
+		log.Printf("工作线程 %d: 区块 %d 放入死信队列失败: %v", w.id, blockData.Height, err)
+		return false
+	}
+
+	log.Printf("工作线程 %d: 区块 %d 处理 %d 次仍失败，已放入死信队列", w.id, blockData.Height, blockData.Attempts)
+	return false
+}
+
+// SeedCursor 设置处理游标的起点为监控器分发的首个区块高度，需在该区块完成前调用
+func (bp *BlockProcessor) SeedCursor(height int64) {
+	bp.cursor.seed(height)
+}
+
+// advanceCursor 标记区块已处理并在游标前进时持久化
+func (w *BlockWorker) advanceCursor(height int64) {
+	cursor, advanced := w.processor.cursor.markProcessed(height)
+	if !advanced {
+		return
+	}
+
+	// 等待确认的通知先于游标持久化，重启后不会越过未保存的通知
+	if w.processor.confirmations != nil {
+		w.processor.confirmations.persist(w.ctx, cursor)
+	}
+
+	if err := w.processor.redisClient.SaveProcessorCursor(w.ctx, cursor); err != nil {
+		log.Printf("工作线程 %d: %v", w.id, err)
+	}
+
+	if w.processor.confirmations != nil {
+		w.processor.confirmations.advance(cursor)
+	}
+}
+
+// processBlock 处理单个区块
+func (w *BlockWorker) processBlock(blockData *models.BlockData) error {
+	log.Printf("工作线程 %d: 处理区块 %d，Block: %v, Trans: %v",
+		w.id, blockData.Height, blockData.Block != nil,
+		func() interface{} {
+			if blockData.Block != nil {
+				return len(blockData.Block.Trans)
+			}
+			return "nil"
+		}())
+
+	if blockData.Block == nil || blockData.Block.Trans == nil {
+		return fmt.Errorf("区块数据无效")
+	}
+	w.txInfos, w.txInfosLoaded, w.txInfosErr = nil, false, nil
+	if tracker := w.processor.confirmations; tracker != nil {
+		tracker.reset(w.ctx, blockData)
+	}
+
+	var transfers []*models.TransferEvent
+
+	// 获取监控地址集合
+	watchAddressSet, err := w.processor.watchAddressSet(w.ctx)
+	if err != nil {
+		return err
+	}
+
+	// 获取监控地址的代币范围，失败时按不限代币处理
+	watchScopes, err := w.processor.redisClient.GetWatchScopes(w.ctx)
+	if err != nil {
+		log.Printf("工作线程 %d: %v", w.id, err)
+		atomic.AddInt64(&w.processor.enrichErrors, 1)
+	}
+
+	// 监控地址为空时按配置抽样保存全链转账
+	sampling := len(watchAddressSet) == 0 && w.processor.config.Monitor.EmptyWatchMode == EmptyWatchModeSample
+
+	// 只处理涉及监控地址的交易时，先做廉价的字符串预检
+	var prefilter *watchPrefilter
+	if w.processor.config.Monitor.WatchOnlyPrefilter {
+		prefilter = newWatchPrefilter(watchAddressSet)
+	}
+
+	// 解码出的转账数（代币范围、零额和自转账过滤之前），用于转账量监控
+	decoded := 0
+
+	// 处理区块中的每个交易
+	for txIndex, tx := range blockData.Block.Trans {
+		w.sampleTx = sampling && sampleTransaction(tx.TxID, w.processor.config.Monitor.SampleRate)
+		if prefilter != nil && !w.sampleTx && !prefilter.references(tx) {
+			// 自定义合约事件与监控地址无关，仍然解码
+			atomic.AddInt64(&w.processor.skippedTxs, 1)
+			if len(w.processor.config.ContractEvents) > 0 {
+				w.extractContractEvents(tx, blockData)
+			}
+			continue
+		}
+		txTransfers, failures, err := w.extractTransfers(tx, txIndex, blockData, watchAddressSet)
+		if err != nil {
+			log.Printf("工作线程 %d: 提取交易 %s 的转账信息失败: %v", w.id, tx.TxID, err)
+			continue
+		}
+		decoded += len(txTransfers)
+		txTransfers = filterScoped(txTransfers, watchAddressSet, watchScopes)
+		if w.processor.config.Monitor.SkipZeroAmount {
+			txTransfers = w.processor.dropZeroAmount(txTransfers)
+		}
+
+		if w.processor.config.Monitor.RecordDecodeFailures {
+			w.recordDecodeFailures(failures)
+		}
+
+		// 更新地址统计信息
+		for _, transfer := range txTransfers {
+			if watchAddressSet[transfer.Source] {
+				w.updateAddressStats(transfer.Source, blockData)
+			}
+			if watchAddressSet[transfer.Destination] {
+				w.updateAddressStats(transfer.Destination, blockData)
+			}
+		}
+
+		if w.processor.config.Monitor.TrackPermissionUpdates {
+			w.recordPermissionUpdates(tx, blockData, watchAddressSet)
+		}
+
+		if w.processor.config.Monitor.IgnoreSelfTransfers {
+			txTransfers = w.processor.dropSelfTransfers(txTransfers)
+		}
+
+		if len(w.processor.config.ContractEvents) > 0 {
+			w.extractContractEvents(tx, blockData)
+		}
+
+		if len(txTransfers) > 0 && w.processor.config.Monitor.RetainRaw {
+			w.retainRawTransaction(tx, txTransfers)
+		}
+
+		transfers = append(transfers, txTransfers...)
+
+		// 异常区块保护：超过上限后丢弃剩余交易
+		if maxTransfers := w.processor.config.Monitor.MaxTransfersPerBlock; maxTransfers > 0 && len(transfers) > maxTransfers {
+			log.Printf("工作线程 %d: 区块 %d 的转账数超过上限 %d（共 %d 笔交易），截断剩余部分",
+				w.id, blockData.Height, maxTransfers, len(blockData.Block.Trans))
+			transfers = transfers[:maxTransfers]
+			atomic.AddInt64(&w.processor.truncatedBlocks, 1)
+			break
+		}
+	}
+
+	if w.processor.throughput != nil {
+		w.processor.throughput.record(blockData.Height, decoded)
+	}
+
+	// 获取地址分组，失败时不打分组标签，不影响转账保存
+	addressGroups, err := w.processor.redisClient.GetAddressGroups(w.ctx)
+	if err != nil {
+		log.Printf("工作线程 %d: %v", w.id, err)
+		atomic.AddInt64(&w.processor.enrichErrors, 1)
+	}
+
+	// 保存转账事件，启用保存线程时交给保存阶段并行处理
+	if pipeline := w.processor.saves; pipeline != nil {
+		return w.submit(pipeline, transfers, blockData, watchAddressSet, addressGroups)
+	}
+	for _, transfer := range transfers {
+		w.persistTransfer(transfer, blockData, watchAddressSet, addressGroups)
+	}
+
+	return nil
+}
+
+// persistTransfer 补充标签、分组和余额后保存转账事件并发送通知，保存失败只记录日志
+func (w *BlockWorker) persistTransfer(transfer *models.TransferEvent, blockData *models.BlockData, watchAddressSet map[string]bool, addressGroups map[string]string) {
+	w.enrichTransfer(transfer, watchAddressSet, addressGroups)
+	w.commitTransfer(transfer, blockData, watchAddressSet)
+}
+
+// enrichTransfer 补充标签、分组和余额，不写Redis，可以并行执行
+func (w *BlockWorker) enrichTransfer(transfer *models.TransferEvent, watchAddressSet map[string]bool, addressGroups map[string]string) {
+	if w.processor.labeler != nil {
+		w.processor.labeler.Apply(transfer)
+	}
+	tagGroups(transfer, addressGroups, watchAddressSet)
+	if w.processor.balances != nil {
+		w.attachBalances(transfer, watchAddressSet)
+	}
+}
+
+// commitTransfer 保存转账事件并发送通知，同一区块的转账需按顺序调用
+func (w *BlockWorker) commitTransfer(transfer *models.TransferEvent, blockData *models.BlockData, watchAddressSet map[string]bool) {
+	if w.processor.config.Monitor.ResolveDuplicateTxs && !w.resolveDuplicate(transfer) {
+		return
+	}
+	if err := w.saveTransfer(transfer); err != nil {
+		log.Printf("工作线程 %d: 保存转账事件失败: %v", w.id, err)
+		return
+	}
+
+	atomic.AddInt64(&w.processor.transfersFound, 1)
+	w.processor.amounts.observe(transfer.TokenType, transfer.Amount)
+	if w.processor.sink != nil {
+		w.processor.sink.append(transfer)
+	}
+	// 与 /transfers 列表一致，不涉及监控地址的大额转账只保存在whale_transfers
+	if w.processor.store != nil && !transfer.WhaleOnly {
+		if w.processor.saveToStore(w.ctx, transfer) && w.processor.verifier != nil {
+			w.processor.verifier.submit(transfer)
+		}
+	}
+	if tracker := w.processor.confirmations; tracker != nil {
+		tracker.track(blockData, transfer)
+	}
+	w.notifyTransfer(transfer, blockData, watchAddressSet)
+}
+
+// saveTransfer 保存转账事件，Redis暂时不可用时按退避重试，最终失败则放入转账死信队列
+func (w *BlockWorker) saveTransfer(transfer *models.TransferEvent) error {
+	redisCfg := w.processor.config.Redis
+	backoff := redisCfg.SaveRetryBackoff
+
+	var err error
+	for attempt := 0; attempt <= redisCfg.SaveRetryMax; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-w.ctx.Done():
+				return w.ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+
+		if err = w.processor.redisClient.SaveTransferEvent(w.ctx, transfer); err == nil {
+			return nil
+		}
+		if errors.Is(err, redis.ErrOutOfMemory) {
+			// 内存不足通常需要等待过期键释放或人工扩容，按退避重试，最终进入死信队列
+			atomic.AddInt64(&w.processor.oomSaveErrors, 1)
+		}
+		log.Printf("工作线程 %d: 保存转账事件 %s 失败（第 %d 次）: %v", w.id, transfer.TxHash, attempt+1, err)
+	}
+
+	if dlqErr := w.processor.redisClient.PushTransferDeadLetter(w.ctx, transfer, err.Error()); dlqErr != nil {
+		log.Printf("工作线程 %d: 转账事件 %s 放入死信队列失败，事件丢失: %v", w.id, transfer.TxHash, dlqErr)
+	}
+	return err
+}
+
+// filterScoped 按监控地址的代币范围过滤转账
+//
+// 涉及的监控地址都限定了代币范围且都不匹配时丢弃；未限定范围的监控地址匹配任意代币。
+// 不涉及监控地址的转账（如TRX全量转账）保持原样。
+func filterScoped(transfers []*models.TransferEvent, watchAddressSet map[string]bool, watchScopes map[string]string) []*models.TransferEvent {
+	if len(watchScopes) == 0 {
+		return transfers
+	}
+
+	kept := transfers[:0]
+	for _, transfer := range transfers {
+		watched, matched := false, false
+		for _, address := range []string{transfer.Source, transfer.Destination} {
+			if !watchAddressSet[address] {
+				continue
+			}
+			watched = true
+			if scope, ok := watchScopes[address]; !ok || scopeMatches(scope, transfer) {
+				matched = true
+			}
+		}
+		if watched && !matched {
+			continue
+		}
+		kept = append(kept, transfer)
+	}
+	return kept
+}
+
+// scopeMatches 判断转账是否属于代币范围（代币类型不区分大小写，或合约地址、TRC10资产名完全匹配）
+func scopeMatches(scope string, transfer *models.TransferEvent) bool {
+	if strings.EqualFold(scope, transfer.TokenType) {
+		return true
+	}
+	// USDT转账同时属于TRC20
+	if transfer.IsUSDT && strings.EqualFold(scope, "TRC20") {
+		return true
+	}
+	return scope == transfer.ContractAddress || (transfer.AssetName != "" && scope == transfer.AssetName)
+}
+
+// tagGroups 为转账事件标记涉及的监控地址所属的分组
+func tagGroups(transfer *models.TransferEvent, addressGroups map[string]string, watchAddressSet map[string]bool) {
+	for _, address := range []string{transfer.Source, transfer.Destination} {
+		group := addressGroups[address]
+		if group == "" || !watchAddressSet[address] {
+			continue
+		}
+		if len(transfer.Groups) == 1 && transfer.Groups[0] == group {
+			continue // 双方属于同一分组
+		}
+		transfer.Groups = append(transfer.Groups, group)
+	}
 }
 
-// IsRunning 检查是否正在运行
-func (bp *BlockProcessor) IsRunning() bool {
-	bp.mu.RLock()
-	defer bp.mu.RUnlock()
-	return bp.running
+// dropSelfTransfers 过滤自转账：发送方与接收方相同，或同属一个所有者分组
+func (bp *BlockProcessor) dropSelfTransfers(transfers []*models.TransferEvent) []*models.TransferEvent {
+	kept := transfers[:0]
+	for _, transfer := range transfers {
+		if bp.isSelfTransfer(transfer.Source, transfer.Destination) {
+			continue
+		}
+		kept = append(kept, transfer)
+	}
+	return kept
 }
 
-// GetStats 获取处理器统计信息
-func (bp *BlockProcessor) GetStats() map[string]interface{} {
-	bp.mu.RLock()
-	defer bp.mu.RUnlock()
+// dropZeroAmount 过滤金额为0的转账（如垃圾空投和零额转账），并累计丢弃数
+func (bp *BlockProcessor) dropZeroAmount(transfers []*models.TransferEvent) []*models.TransferEvent {
+	kept := transfers[:0]
+	for _, transfer := range transfers {
+		if isZeroAmount(transfer) {
+			atomic.AddInt64(&bp.zeroAmount, 1)
+			continue
+		}
+		kept = append(kept, transfer)
+	}
+	return kept
+}
 
-	return map[string]interface{}{
-		"running":          bp.running,
-		"processed_blocks": bp.processedBlocks,
-		"transfers_found":  bp.transfersFound,
-		"errors":           bp.errors,
-		"worker_count":     len(bp.workers),
+// isZeroAmount 判断转账金额是否为0，优先按原始整数金额判断
+func isZeroAmount(transfer *models.TransferEvent) bool {
+	if transfer.AmountParseError {
+		return false // 金额未知，不能按0处理
 	}
+	if transfer.AmountRaw != "" {
+		return strings.TrimLeft(transfer.AmountRaw, "0") == ""
+	}
+	return transfer.Amount == 0 && transfer.AmountSun == 0
 }
 
-// ResetStats 重置统计信息
-func (bp *BlockProcessor) ResetStats() {
-	bp.mu.Lock()
-	defer bp.mu.Unlock()
+// isSelfTransfer 判断两个地址之间的转账是否为自转账
+func (bp *BlockProcessor) isSelfTransfer(source, destination string) bool {
+	if source == destination {
+		return true
+	}
 
-	bp.processedBlocks = 0
-	bp.transfersFound = 0
-	bp.errors = 0
+	sourceGroup, ok := bp.ownerGroups[source]
+	return ok && sourceGroup == bp.ownerGroups[destination]
 }
 
-// start 启动工作线程
-func (w *BlockWorker) start() {
-	w.mu.Lock()
-	defer w.mu.Unlock()
-
-	if w.running {
+// retainRawTransaction 保存原始交易JSON并在转账事件上记录引用
+func (w *BlockWorker) retainRawTransaction(tx *models.Transaction, transfers []*models.TransferEvent) {
+	raw, err := json.Marshal(tx)
+	if err != nil {
+		log.Printf("序列化原始交易 %s 失败: %v", tx.TxID, err)
+		atomic.AddInt64(&w.processor.enrichErrors, 1)
 		return
 	}
 
-	w.running = true
-	w.wg.Add(1)
-
-	go func() {
-		defer w.wg.Done()
-		w.processBlocks()
-	}()
+	monitorCfg := w.processor.config.Monitor
+	key, err := w.processor.redisClient.SaveRawTransaction(w.ctx, tx.TxID, raw, monitorCfg.RawTTL, monitorCfg.RawMaxBytes)
+	if err != nil {
+		log.Printf("保存原始交易 %s 失败: %v", tx.TxID, err)
+		atomic.AddInt64(&w.processor.enrichErrors, 1)
+		return
+	}
+	if key == "" {
+		log.Printf("原始交易 %s 压缩后超过 %d 字节，不保留", tx.TxID, monitorCfg.RawMaxBytes)
+		return
+	}
 
-	log.Printf("工作线程 %d 已启动", w.id)
+	for _, transfer := range transfers {
+		transfer.RawTxKey = key
+	}
 }
 
-// stop 停止工作线程
-func (w *BlockWorker) stop() {
-	w.mu.Lock()
-	defer w.mu.Unlock()
-
-	if !w.running {
+// notifyTransfer 为涉及监控地址的转账发送通知，需要等待确认时交给确认数跟踪器
+func (w *BlockWorker) notifyTransfer(transfer *models.TransferEvent, blockData *models.BlockData, watchAddressSet map[string]bool) {
+	if w.processor.notifier == nil {
 		return
 	}
 
-	w.running = false
-	w.cancel()
-	w.wg.Wait()
+	notify := w.processor.notifier.NotifyTransfer
+	if tracker := w.processor.confirmations; tracker != nil {
+		notify = func(address string, event *models.TransferEvent) {
+			tracker.add(blockData, address, event)
+		}
+	}
 
-	log.Printf("工作线程 %d 已停止", w.id)
-}
+	if watchAddressSet[transfer.Source] {
+		notify(transfer.Source, transfer)
+	}
+	if watchAddressSet[transfer.Destination] && transfer.Destination != transfer.Source {
+		notify(transfer.Destination, transfer)
+	}
 
-// processBlocks 处理区块循环
-func (w *BlockWorker) processBlocks() {
-	for {
-		select {
-		case <-w.ctx.Done():
-			return
-		default:
-		}
+	// 不涉及监控地址的大额转账按接收方通知
+	if transfer.Whale && !watchAddressSet[transfer.Source] && !watchAddressSet[transfer.Destination] {
+		notify(transfer.Destination, transfer)
+	}
+}
 
-		// 从Redis队列获取区块数据
-		blockData, err := w.processor.redisClient.PopBlockData(w.ctx)
+// attachBalances 为转账中的监控地址附加转账后余额，查询失败时不影响转账保存
+func (w *BlockWorker) attachBalances(transfer *models.TransferEvent, watchAddressSet map[string]bool) {
+	if watchAddressSet[transfer.Source] {
+		balance, err := w.processor.balances.balanceAfter(w.ctx, transfer.Source, transfer)
 		if err != nil {
-			log.Printf("工作线程 %d: 获取区块数据失败: %v", w.id, err)
-			time.Sleep(time.Second)
-			continue
-		}
-
-		if blockData == nil {
-			// 队列为空，等待一段时间
-			time.Sleep(100 * time.Millisecond)
-			continue
+			log.Printf("工作线程 %d: 查询地址 %s 余额失败: %v", w.id, transfer.Source, err)
+			atomic.AddInt64(&w.processor.enrichErrors, 1)
+		} else {
+			transfer.SourceBalanceAfter = balance
 		}
-
-		// 处理区块
-		if err := w.processBlock(blockData); err != nil {
-			log.Printf("工作线程 %d: 处理区块 %d 失败: %v", w.id, blockData.Height, err)
-			w.processor.errors++
+	}
+	if watchAddressSet[transfer.Destination] {
+		balance, err := w.processor.balances.balanceAfter(w.ctx, transfer.Destination, transfer)
+		if err != nil {
+			log.Printf("工作线程 %d: 查询地址 %s 余额失败: %v", w.id, transfer.Destination, err)
+			atomic.AddInt64(&w.processor.enrichErrors, 1)
 		} else {
-			w.processor.processedBlocks++
+			transfer.DestBalanceAfter = balance
 		}
 	}
 }
 
-// processBlock 处理单个区块
-func (w *BlockWorker) processBlock(blockData *models.BlockData) error {
-	log.Printf("工作线程 %d: 处理区块 %d，Block: %v, Trans: %v",
-		w.id, blockData.Height, blockData.Block != nil,
-		func() interface{} {
-			if blockData.Block != nil {
-				return len(blockData.Block.Trans)
-			}
-			return "nil"
-		}())
-
-	if blockData.Block == nil || blockData.Block.Trans == nil {
-		return fmt.Errorf("区块数据无效")
+// sampleTransaction 按交易哈希确定性抽样，约每rate笔交易抽中一笔，同一交易重复处理时结果一致
+func sampleTransaction(txID string, rate int) bool {
+	if rate <= 1 {
+		return true
 	}
+	h := fnv.New32a()
+	h.Write([]byte(txID))
+	return h.Sum32()%uint32(rate) == 0
+}
 
-	var transfers []*models.TransferEvent
-
-	// 处理区块中的每个交易
-	for _, tx := range blockData.Block.Trans {
-		txTransfers, err := w.extractTransfers(tx, blockData)
-		if err != nil {
-			log.Printf("工作线程 %d: 提取交易 %s 的转账信息失败: %v", w.id, tx.TxID, err)
-			continue
-		}
-
-		transfers = append(transfers, txTransfers...)
+// isWhale 判断是否为全链大额USDT转账，价格不可用（USD价值为0）时按USDT数量判断
+func (w *BlockWorker) isWhale(transfer *models.TransferEvent) bool {
+	threshold := w.processor.config.USDT.WhaleThresholdUSD
+	if threshold <= 0 || !transfer.IsUSDT {
+		return false
 	}
 
-	// 保存转账事件
-	for _, transfer := range transfers {
-		if err := w.processor.redisClient.SaveTransferEvent(w.ctx, transfer); err != nil {
-			log.Printf("工作线程 %d: 保存转账事件失败: %v", w.id, err)
-			continue
-		}
-
-		w.processor.transfersFound++
+	value := transfer.USDValue
+	if value == 0 {
+		value = transfer.Amount
 	}
-
-	return nil
+	return value >= threshold
 }
 
-// extractTransfers 提取转账事件
-func (w *BlockWorker) extractTransfers(tx *models.Transaction, blockData *models.BlockData) ([]*models.TransferEvent, error) {
+// extractTransfers 提取转账事件，同时返回无法解码的合约调用
+//
+// 只做解码，不写入Redis；地址统计和权限变更等副作用由processBlock处理。
+//
+// txIndex为交易在区块中的序号，启用monitor.record_tx_index时与合约序号一起记录到转账事件。
+func (w *BlockWorker) extractTransfers(tx *models.Transaction, txIndex int, blockData *models.BlockData, watchAddressSet map[string]bool) ([]*models.TransferEvent, []*models.DecodeFailure, error) {
 	var transfers []*models.TransferEvent
+	var failures []*models.DecodeFailure
 
 	if tx.RawData == nil || len(tx.RawData.Contract) == 0 {
-		return transfers, nil
+		return transfers, failures, nil
 	}
 
-	// 获取监控地址集合
-	watchAddresses, err := w.processor.redisClient.GetWatchAddresses(w.ctx)
-	if err != nil {
-		return nil, fmt.Errorf("获取监控地址失败: %w", err)
-	}
+	// 处理每个合约
+	logsDecoded := false
+	recordIndex := w.processor.config.Monitor.RecordTxIndex
+	recordBlockHash := w.processor.config.Monitor.RecordBlockHash
+	for contractIndex, contract := range tx.RawData.Contract {
+		if !w.acceptContractResult(tx, contractIndex) || !w.contractEnabled(contract.TypeName()) {
+			continue
+		}
 
-	watchAddressSet := make(map[string]bool)
-	for _, addr := range watchAddresses {
-		watchAddressSet[addr] = true
-	}
+		// 日志模式下TRC20转账从交易日志中提取，日志覆盖整笔交易，只需获取一次
+		if contract.TypeName() == "TriggerSmartContract" && w.processor.config.Monitor.TRC20DecodeMode == TRC20DecodeLogs {
+			if logsDecoded {
+				continue
+			}
+			logsDecoded = true
+
+			logTransfers, err := w.extractTRC20TransfersFromLogs(tx, blockData, watchAddressSet)
+			if err != nil {
+				log.Printf("提取合约转账信息失败: %v", err)
+				continue
+			}
+			for _, transfer := range logTransfers {
+				transfer.TxTimestamp = tx.RawData.Timestamp
+				if recordBlockHash {
+					transfer.BlockHash = blockData.BlockHash
+				}
+				if recordIndex {
+					transfer.TxIndex, transfer.ContractIndex = txIndex, contractIndex
+				}
+			}
+			transfers = append(transfers, logTransfers...)
+			continue
+		}
 
-	// 处理每个合约
-	for _, contract := range tx.RawData.Contract {
 		transfer, err := w.extractTransferFromContract(contract, tx, blockData, watchAddressSet)
 		if err != nil {
 			log.Printf("提取合约转账信息失败: %v", err)
+			var decodeErr *decodeError
+			if errors.As(err, &decodeErr) {
+				failures = append(failures, decodeErr.failure(contract, tx, blockData))
+			}
 			continue
 		}
 
 		if transfer != nil {
+			// 交易原始数据中的创建时间（可能为0，表示未提供）
+			transfer.TxTimestamp = tx.RawData.Timestamp
+			if recordBlockHash {
+				transfer.BlockHash = blockData.BlockHash
+			}
+			if recordIndex {
+				transfer.TxIndex, transfer.ContractIndex = txIndex, contractIndex
+			}
 			transfers = append(transfers, transfer)
 		}
 	}
 
-	return transfers, nil
+	return transfers, failures, nil
+}
+
+// acceptContractResult 按monitor.skip_failed_transactions判断是否处理合约
+//
+// 执行失败（如REVERT、OUT_OF_ENERGY）的合约不产生实际转账；部分节点返回的交易没有ret，
+// 结果未知时按monitor.include_unknown_result决定是否处理。
+func (w *BlockWorker) acceptContractResult(tx *models.Transaction, contractIndex int) bool {
+	monitorCfg := w.processor.config.Monitor
+	if !monitorCfg.SkipFailedTransactions {
+		return true
+	}
+
+	result := tx.ContractResult(contractIndex)
+	if result == "" {
+		return monitorCfg.IncludeUnknownResult
+	}
+	return result == models.ContractResultSuccess
 }
 
 // extractTransferFromContract 从合约中提取转账信息
 func (w *BlockWorker) extractTransferFromContract(contract *models.Contract, tx *models.Transaction, blockData *models.BlockData, watchAddressSet map[string]bool) (*models.TransferEvent, error) {
-	switch contract.Type {
-	case "TransferContract":
-		return w.extractTRXTransfer(contract, tx, blockData, watchAddressSet)
-	case "TransferAssetContract":
-		return w.extractTRC10Transfer(contract, tx, blockData, watchAddressSet)
-	case "TriggerSmartContract":
-		return w.extractTRC20Transfer(contract, tx, blockData, watchAddressSet)
-	default:
+	extract, ok := contractExtractors[contract.TypeName()]
+	if !ok {
 		return nil, nil // 不支持的合约类型
 	}
+	return extract(w, contract, tx, blockData, watchAddressSet)
 }
 
 // extractTRXTransfer 提取TRX转账
@@ -331,8 +1439,8 @@ func (w *BlockWorker) extractTRXTransfer(contract *models.Contract, tx *models.T
 	amount, _ := valueData["amount"].(float64)
 
 	// 转换地址格式
-	fromAddr := w.convertHexToBase58(ownerAddress)
-	toAddr := w.convertHexToBase58(toAddress)
+	fromAddr := tronaddr.ToBase58(ownerAddress)
+	toAddr := tronaddr.ToBase58(toAddress)
 
 	// 检查是否涉及监控地址（暂时注释掉，显示所有转账事件）
 	// if !watchAddressSet[fromAddr] && !watchAddressSet[toAddr] {
@@ -340,23 +1448,18 @@ func (w *BlockWorker) extractTRXTransfer(contract *models.Contract, tx *models.T
 	// }
 
 	// 显示转账详情
+	amountSun := int64(amount)
 	transferTime := time.Unix(blockData.Timestamp/1000, 0).Format("2006-01-02 15:04:05")
-	log.Printf("TRX转账事件 - From: %s, To: %s, Amount: %.6f TRX, Time: %s, TxHash: %s",
-		fromAddr, toAddr, amount/1e6, transferTime, tx.TxID)
-
-	// 更新地址统计信息
-	if watchAddressSet[fromAddr] {
-		w.updateAddressStats(fromAddr, blockData)
-	}
-	if watchAddressSet[toAddr] {
-		w.updateAddressStats(toAddr, blockData)
-	}
+	log.Printf("TRX转账事件 - From: %s, To: %s, Amount: %s TRX, Time: %s, TxHash: %s",
+		fromAddr, toAddr, models.FormatTRX(amountSun, w.processor.config.Display.TRXPrecision), transferTime, tx.TxID)
 
 	return &models.TransferEvent{
 		Source:      fromAddr,
 		Destination: toAddr,
 		Amount:      amount / 1e6, // TRX精度为6位小数
-		Fee:         0,            // 需要从交易收据获取
+		AmountSun:   amountSun,
+		AmountRaw:   strconv.FormatInt(amountSun, 10),
+		Fee:         0, // 需要从交易收据获取
 		TxHash:      tx.TxID,
 		BlockHeight: blockData.Height,
 		Timestamp:   blockData.Timestamp,
@@ -384,12 +1487,16 @@ func (w *BlockWorker) extractTRC10Transfer(contract *models.Contract, tx *models
 	assetName, _ := valueData["asset_name"].(string)
 
 	// 将十六进制地址转换为base58格式的TRX地址
-	ownerAddress := w.convertHexToBase58(ownerAddressHex)
-	toAddress := w.convertHexToBase58(toAddressHex)
+	ownerAddress := tronaddr.ToBase58(ownerAddressHex)
+	toAddress := tronaddr.ToBase58(toAddressHex)
 
-	// 检查是否涉及监控地址
+	// 检查是否涉及监控地址，不涉及时只保留抽样交易
+	sampled := false
 	if !watchAddressSet[ownerAddress] && !watchAddressSet[toAddress] {
-		return nil, nil
+		if !w.sampleTx {
+			return nil, nil
+		}
+		sampled = true
 	}
 
 	// 显示转账详情
@@ -397,24 +1504,18 @@ func (w *BlockWorker) extractTRC10Transfer(contract *models.Contract, tx *models
 	log.Printf("TRC10转账事件 - From: %s, To: %s, Amount: %.0f %s, Time: %s, TxHash: %s",
 		ownerAddress, toAddress, amount, assetName, transferTime, tx.TxID)
 
-	// 更新地址统计信息
-	if watchAddressSet[ownerAddress] {
-		w.updateAddressStats(ownerAddress, blockData)
-	}
-	if watchAddressSet[toAddress] {
-		w.updateAddressStats(toAddress, blockData)
-	}
-
 	return &models.TransferEvent{
 		Source:      ownerAddress,
 		Destination: toAddress,
-		Amount:      amount,
+		Amount:      amount, // TRC10金额不做精度换算，与原始金额相同
+		AmountRaw:   strconv.FormatInt(int64(amount), 10),
 		Fee:         0,
 		TxHash:      tx.TxID,
 		BlockHeight: blockData.Height,
 		Timestamp:   blockData.Timestamp,
 		TokenType:   "TRC10",
 		AssetName:   assetName,
+		Sampled:     sampled,
 	}, nil
 }
 
@@ -437,8 +1538,8 @@ func (w *BlockWorker) extractTRC20Transfer(contract *models.Contract, tx *models
 	data, _ := valueData["data"].(string)
 
 	// 将十六进制地址转换为base58格式的TRX地址
-	ownerAddress := w.convertHexToBase58(ownerAddressHex)
-	contractAddress := w.convertHexToBase58(contractAddressHex)
+	ownerAddress := tronaddr.ToBase58(ownerAddressHex)
+	contractAddress := tronaddr.ToBase58(contractAddressHex)
 	// 检查是否为USDT转账
 	isUSDT := w.isUSDTContract(contractAddress)
 
@@ -447,14 +1548,39 @@ func (w *BlockWorker) extractTRC20Transfer(contract *models.Contract, tx *models
 		log.Printf("USDT监控已禁用，跳过处理")
 		return nil, nil
 	}
+	// USDT以外的合约代币（含TRC721）由monitor.enable_trc20控制
+	if !isUSDT && !w.processor.config.Monitor.EnableTRC20 {
+		return nil, nil
+	}
+
+	// 启用合约标准标记时同时解码TRC721转账
+	tagStandard := w.processor.config.Monitor.TagStandard
+	if tagStandard && classifyCalldata(strings.TrimPrefix(data, "0x")) == StandardTRC721 {
+		transfer, err := parseTRC721TransferData(strings.TrimPrefix(data, "0x"), contractAddress, tx, blockData)
+		if err != nil {
+			log.Printf("解析TRC721转账数据失败: %v", err)
+			return nil, err
+		}
+		if !watchAddressSet[transfer.Source] && !watchAddressSet[transfer.Destination] {
+			if !w.sampleTx {
+				return nil, nil
+			}
+			transfer.Sampled = true
+		}
+		return transfer, nil
+	}
 
 	// 解析TRC20转账数据
-	transfer, err := w.parseTRC20TransferData(data, ownerAddress, contractAddress, tx, blockData, isUSDT)
+	transfer, err := w.parseTRC20TransferData(data, ownerAddress, contractAddress, tx, blockData, isUSDT, watchAddressSet)
 	if err != nil {
 		log.Printf("解析TRC20转账数据失败: %v", err)
 		return nil, err
 	}
 	if transfer != nil {
+		if tagStandard {
+			transfer.Standard = StandardTRC20
+		}
+
 		// 显示转账详情（非USDT的TRC20转账）
 		if !transfer.IsUSDT {
 			transferTime := time.Unix(blockData.Timestamp/1000, 0).Format("2006-01-02 15:04:05")
@@ -462,21 +1588,124 @@ func (w *BlockWorker) extractTRC20Transfer(contract *models.Contract, tx *models
 				transfer.Source, transfer.Destination, transfer.Amount, contractAddress, transferTime, tx.TxID)
 		}
 
-		// 检查是否涉及监控地址（发送方或接收方）
+		// 检查是否涉及监控地址（发送方或接收方），不涉及时只保留全链大额转账和抽样交易
+		transfer.Whale = w.isWhale(transfer)
 		if !watchAddressSet[transfer.Source] && !watchAddressSet[transfer.Destination] {
-			return nil, nil
+			if !transfer.Whale && !w.sampleTx {
+				return nil, nil
+			}
+			transfer.WhaleOnly = transfer.Whale
+			transfer.Sampled = !transfer.Whale
 		}
+	}
 
-		// 更新地址统计信息
-		if watchAddressSet[transfer.Source] {
-			w.updateAddressStats(transfer.Source, blockData)
+	return transfer, nil
+}
+
+// recordDecodeFailures 保存无法解码的合约调用，供后续分析
+func (w *BlockWorker) recordDecodeFailures(failures []*models.DecodeFailure) {
+	maxData := w.processor.config.Monitor.DecodeFailureMaxData
+	for _, failure := range failures {
+		if len(failure.Data) > maxData {
+			failure.Data = failure.Data[:maxData]
+			failure.Truncated = true
 		}
-		if watchAddressSet[transfer.Destination] {
-			w.updateAddressStats(transfer.Destination, blockData)
+		if err := w.processor.redisClient.SaveDecodeFailure(w.ctx, failure); err != nil {
+			log.Printf("工作线程 %d: %v", w.id, err)
 		}
 	}
+}
 
-	return transfer, nil
+// recordPermissionUpdates 记录交易中监控地址的账户权限变更
+func (w *BlockWorker) recordPermissionUpdates(tx *models.Transaction, blockData *models.BlockData, watchAddressSet map[string]bool) {
+	if tx.RawData == nil {
+		return
+	}
+
+	for _, contract := range tx.RawData.Contract {
+		if contract != nil && contract.TypeName() == "AccountPermissionUpdateContract" {
+			w.recordPermissionUpdate(contract, tx, blockData, watchAddressSet)
+		}
+	}
+}
+
+// recordPermissionUpdate 记录监控地址的账户权限变更
+func (w *BlockWorker) recordPermissionUpdate(contract *models.Contract, tx *models.Transaction, blockData *models.BlockData, watchAddressSet map[string]bool) {
+	paramData, ok := contract.Parameter.(map[string]interface{})
+	if !ok {
+		log.Printf("无效的权限变更合约参数")
+		return
+	}
+
+	valueData, ok := paramData["value"].(map[string]interface{})
+	if !ok {
+		log.Printf("无效的权限变更value数据")
+		return
+	}
+
+	ownerAddressHex, _ := valueData["owner_address"].(string)
+	owner := tronaddr.ToBase58(ownerAddressHex)
+	if !watchAddressSet[owner] {
+		return
+	}
+
+	event := &models.PermissionUpdateEvent{
+		Owner:             owner,
+		OwnerPermission:   w.parsePermission(valueData["owner"]),
+		WitnessPermission: w.parsePermission(valueData["witness"]),
+		TxHash:            tx.TxID,
+		BlockHeight:       blockData.Height,
+		Timestamp:         blockData.Timestamp,
+	}
+	if actives, ok := valueData["actives"].([]interface{}); ok {
+		for _, active := range actives {
+			if permission := w.parsePermission(active); permission != nil {
+				event.ActivePermissions = append(event.ActivePermissions, permission)
+			}
+		}
+	}
+
+	log.Printf("账户权限变更事件 - Owner: %s, Active权限数: %d, TxHash: %s",
+		owner, len(event.ActivePermissions), tx.TxID)
+
+	if err := w.processor.redisClient.SavePermissionUpdate(w.ctx, event); err != nil {
+		log.Printf("保存权限变更事件失败: %v", err)
+	}
+}
+
+// parsePermission 解析权限结构，数据缺失时返回nil
+func (w *BlockWorker) parsePermission(raw interface{}) *models.Permission {
+	data, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	permission := &models.Permission{}
+	if permType, ok := data["type"]; ok {
+		permission.Type = fmt.Sprint(permType)
+	}
+	id, _ := data["id"].(float64)
+	threshold, _ := data["threshold"].(float64)
+	permission.ID = int64(id)
+	permission.Threshold = int64(threshold)
+	permission.Name, _ = data["permission_name"].(string)
+	permission.Operations, _ = data["operations"].(string)
+
+	keys, _ := data["keys"].([]interface{})
+	for _, rawKey := range keys {
+		keyData, ok := rawKey.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		address, _ := keyData["address"].(string)
+		weight, _ := keyData["weight"].(float64)
+		permission.Keys = append(permission.Keys, &models.PermissionKey{
+			Address: tronaddr.ToBase58(address),
+			Weight:  int64(weight),
+		})
+	}
+
+	return permission
 }
 
 // isUSDTContract 检查是否为USDT合约
@@ -484,30 +1713,67 @@ func (w *BlockWorker) isUSDTContract(contractAddress string) bool {
 	return contractAddress == w.processor.config.USDT.ContractAddress
 }
 
+// decodeError 合约调用数据无法解码
+type decodeError struct {
+	selector string
+	data     string
+	reason   string
+}
+
+func (e *decodeError) Error() string {
+	return fmt.Sprintf("解码失败（选择器 %s）: %s", e.selector, e.reason)
+}
+
+// failure 转换为解码失败记录
+func (e *decodeError) failure(contract *models.Contract, tx *models.Transaction, blockData *models.BlockData) *models.DecodeFailure {
+	var contractAddress string
+	if paramData, ok := contract.Parameter.(map[string]interface{}); ok {
+		if valueData, ok := paramData["value"].(map[string]interface{}); ok {
+			contractAddressHex, _ := valueData["contract_address"].(string)
+			contractAddress = tronaddr.ToBase58(contractAddressHex)
+		}
+	}
+
+	return &models.DecodeFailure{
+		Contract:    contractAddress,
+		Selector:    e.selector,
+		Data:        e.data,
+		Reason:      e.reason,
+		TxHash:      tx.TxID,
+		BlockHeight: blockData.Height,
+		Timestamp:   blockData.Timestamp,
+	}
+}
+
 // parseTRC20TransferData 解析TRC20转账数据
-func (w *BlockWorker) parseTRC20TransferData(data, ownerAddress, contractAddress string, tx *models.Transaction, blockData *models.BlockData, isUSDT bool) (*models.TransferEvent, error) {
+//
+// 金额无法解析时默认丢弃转账；启用monitor.keep_unparsed_amount且接收方为监控地址时，
+// 保存金额为0并标记amount_parse_error的转账，避免漏掉入账。
+func (w *BlockWorker) parseTRC20TransferData(data, ownerAddress, contractAddress string, tx *models.Transaction, blockData *models.BlockData, isUSDT bool, watchAddressSet map[string]bool) (*models.TransferEvent, error) {
 	// TRC20 transfer函数的数据格式为: a9059cbb + 32字节的to地址 + 32字节的amount
+	// 部分节点配置返回的数据带0x前缀，统一去掉后再解析
+	if len(data) >= 2 && data[0] == '0' && (data[1] == 'x' || data[1] == 'X') {
+		data = data[2:]
+	}
+
 	// 安全获取数据前缀
 	dataPrefix := data
 	if len(data) > 10 {
 		dataPrefix = data[:10]
 	}
-	if len(data) < 74 || !strings.HasPrefix(data, "a9059cbb") {
+	if !strings.HasPrefix(data, trc20TransferSelector) {
 		log.Printf("数据不符合TRC20 transfer格式 - 长度: %d, 前缀: %s", len(data), dataPrefix)
 		return nil, nil // 不是transfer调用
 	}
+	rawData := data
 
-	// 数据没有0x前缀，直接移除函数选择器 (a9059cbb)
-	if len(data) < 8 {
-		log.Printf("数据长度不足，无法移除函数选择器: %d", len(data))
-		return nil, fmt.Errorf("数据长度不足")
-	}
-	data = data[8:]
+	// 移除函数选择器 (a9059cbb)
+	data = data[len(trc20TransferSelector):]
 
 	// 解析接收地址 (32字节，64个十六进制字符)
 	if len(data) < 64 {
 		log.Printf("地址数据长度不足: %d", len(data))
-		return nil, fmt.Errorf("地址数据长度不足")
+		return nil, &decodeError{selector: trc20TransferSelector, data: rawData, reason: "地址数据长度不足"}
 	}
 	toAddressHex := data[:64]
 
@@ -517,7 +1783,7 @@ func (w *BlockWorker) parseTRC20TransferData(data, ownerAddress, contractAddress
 	// 解析金额 (32字节，64个十六进制字符)
 	if len(data) < 64 {
 		log.Printf("金额数据长度不足: %d", len(data))
-		return nil, fmt.Errorf("金额数据长度不足")
+		return nil, &decodeError{selector: trc20TransferSelector, data: rawData, reason: "金额数据长度不足"}
 	}
 	amountHex := data[:64]
 
@@ -533,18 +1799,23 @@ func (w *BlockWorker) parseTRC20TransferData(data, ownerAddress, contractAddress
 	fullAddressHex := "41" + toAddressHex
 
 	// 转换为Base58格式
-	toAddress := w.convertHexToBase58(fullAddressHex)
+	toAddress := tronaddr.ToBase58(fullAddressHex)
 
 	// 解析金额
-	amount, err := w.parseHexAmount(amountHex)
+	amount, amountRaw, err := w.parseHexAmount(amountHex)
+	amountParseError := false
 	if err != nil {
 		log.Printf("解析金额失败: %v", err)
-		return nil, fmt.Errorf("解析金额失败: %w", err)
+		if !w.processor.config.Monitor.KeepUnparsedAmount || !watchAddressSet[toAddress] {
+			return nil, &decodeError{selector: trc20TransferSelector, data: rawData, reason: fmt.Sprintf("解析金额失败: %v", err)}
+		}
+		amountParseError = true
 	}
 
 	// 如果是USDT，需要根据精度调整金额
+	var amountDecimal string
 	if isUSDT {
-		amount = amount / math.Pow(10, float64(w.processor.config.USDT.Decimals))
+		amount, amountDecimal = scaleAmount(amountRaw, w.processor.config.USDT.Decimals)
 	}
 
 	tokenType := "TRC20"
@@ -553,7 +1824,7 @@ func (w *BlockWorker) parseTRC20TransferData(data, ownerAddress, contractAddress
 	}
 
 	// 转换发送方地址格式
-	fromAddress := w.convertHexToBase58(ownerAddress)
+	fromAddress := tronaddr.ToBase58(ownerAddress)
 
 	// 如果是USDT转账，立即打印出来
 	if isUSDT {
@@ -562,10 +1833,12 @@ func (w *BlockWorker) parseTRC20TransferData(data, ownerAddress, contractAddress
 			fromAddress, toAddress, amount, transferTime, tx.TxID)
 	}
 
-	return &models.TransferEvent{
+	transfer := &models.TransferEvent{
 		Source:          fromAddress,
 		Destination:     toAddress,
 		Amount:          amount,
+		AmountRaw:       amountRaw,
+		AmountDecimal:   amountDecimal,
 		Fee:             0,
 		TxHash:          tx.TxID,
 		BlockHeight:     blockData.Height,
@@ -573,73 +1846,81 @@ func (w *BlockWorker) parseTRC20TransferData(data, ownerAddress, contractAddress
 		TokenType:       tokenType,
 		ContractAddress: contractAddress,
 		IsUSDT:          isUSDT,
-		USDValue:        amount, // USDT的USD价值等于其数量
-	}, nil
-}
-
-// parseHexAmount 解析十六进制金额
-func (w *BlockWorker) parseHexAmount(hexStr string) (float64, error) {
-	// 移除前导零
-	hexStr = strings.TrimLeft(hexStr, "0")
-	if hexStr == "" {
-		return 0, nil
+	}
+	if amountParseError {
+		transfer.AmountParseError = true
+		transfer.AmountHex = amountHex
 	}
 
-	// 转换为十进制
-	amount, err := strconv.ParseUint(hexStr, 16, 64)
-	if err != nil {
-		return 0, fmt.Errorf("解析十六进制金额失败: %w", err)
+	if isUSDT && !amountParseError {
+		transfer.USDValue, transfer.PriceFallback = w.usdtValue(amount, blockData.Timestamp)
 	}
 
-	return float64(amount), nil
+	return transfer, nil
 }
 
-// convertHexToBase58 将hex地址转换为base58格式
-func (w *BlockWorker) convertHexToBase58(hexAddr string) string {
-	// 移除0x前缀
-	hexAddr = strings.TrimPrefix(hexAddr, "0x")
-
-	// 如果地址为空或格式不正确，返回原地址
-	if len(hexAddr) == 0 {
-		return hexAddr
+// usdtValue 计算USDT的USD价值，未启用实时价格时按1:1计算
+//
+// 启用历史价格时使用区块时间的价格，历史价格不可用时回退到最新价格并返回fallback=true。
+// 价格服务不可用时返回0（USD价值留空），只记录错误，不影响转账保存。
+func (w *BlockWorker) usdtValue(amount float64, blockTimestamp int64) (value float64, fallback bool) {
+	if w.processor.priceOracle == nil {
+		return amount, false
 	}
 
-	// 如果地址已经是base58格式（以T开头），直接返回
-	if strings.HasPrefix(hexAddr, "T") {
-		return hexAddr
+	var price float64
+	var err error
+	if w.processor.config.USDT.UseHistoricalPrice {
+		price, fallback, err = w.processor.priceOracle.GetUSDTPriceAt(w.ctx, time.UnixMilli(blockTimestamp))
+	} else {
+		price, err = w.processor.priceOracle.GetUSDTPrice(w.ctx)
 	}
-
-	// 使用正确的Tron地址转换方法
-	tronAddress, err := w.hexToTronAddress(hexAddr)
 	if err != nil {
-		log.Printf("地址转换失败: %v", err)
-		return hexAddr
+		log.Printf("获取USDT价格失败，USD价值留空: %v", err)
+		atomic.AddInt64(&w.processor.enrichErrors, 1)
+		return 0, fallback
 	}
 
-	return tronAddress
+	return amount * price, fallback
 }
 
-// hexToTronAddress 将TRON的十六进制地址转换为Base58Check格式的地址
-func (w *BlockWorker) hexToTronAddress(hexAddress string) (string, error) {
-	// 1. 解码十六进制字符串为字节数组
-	// TRON地址的十六进制表示通常以 "41" 开头
-	addressBytes, err := hex.DecodeString(hexAddress)
-	if err != nil {
-		return "", fmt.Errorf("解码十六进制地址失败: %v", err)
+// parseHexAmount 解析十六进制金额（uint256），返回浮点金额和十进制整数字符串形式的原始金额
+//
+// 原始金额按大整数解析，超过uint64范围时不会溢出；浮点金额可能损失精度。
+func (w *BlockWorker) parseHexAmount(hexStr string) (float64, string, error) {
+	// 移除前导零
+	hexStr = strings.TrimLeft(hexStr, "0")
+	if hexStr == "" {
+		return 0, "0", nil
 	}
 
-	// 2. 计算校验和：对地址字节进行两次SHA256哈希，取结果的前4个字节
-	hash1 := sha256.Sum256(addressBytes)
-	hash2 := sha256.Sum256(hash1[:])
-	checksum := hash2[:4]
+	// 转换为十进制
+	raw, ok := new(big.Int).SetString(hexStr, 16)
+	if !ok {
+		return 0, "", fmt.Errorf("解析十六进制金额失败: %s", hexStr)
+	}
 
-	// 3. 将校验和追加到地址字节数组的末尾
-	payload := append(addressBytes, checksum...)
+	amount, _ := new(big.Float).SetInt(raw).Float64()
+	return amount, raw.String(), nil
+}
 
-	// 4. 使用Base58对拼接后的数据进行编码
-	tronAddress := base58.Encode(payload)
+// scaleAmount 按精度将原始整数金额换算为实际金额，返回最接近的浮点值和精确的十进制字符串
+//
+// 使用有理数计算，1个最小单位（如0.000001 USDT）也能精确表示，避免先转浮点再相除带来的误差。
+func scaleAmount(amountRaw string, decimals int) (float64, string) {
+	scaled, ok := new(big.Rat).SetString(amountRaw)
+	if !ok {
+		return 0, ""
+	}
+	unit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	scaled.Quo(scaled, new(big.Rat).SetInt(unit))
 
-	return tronAddress, nil
+	amount, _ := scaled.Float64()
+	decimal := scaled.FloatString(decimals)
+	if decimals > 0 {
+		decimal = strings.TrimRight(strings.TrimRight(decimal, "0"), ".")
+	}
+	return amount, decimal
 }
 
 // updateAddressStats 更新地址统计信息
@@ -0,0 +1,1421 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	httpclient "tron-monitor/http"
+	"tron-monitor/models"
+	"tron-monitor/redis"
+	"tron-monitor/store"
+)
+
+// sampleBlock 包含监控地址的TRX和USDT转账，以及一笔不涉及监控地址的TRX转账（TRX转账不按监控地址过滤）
+func sampleBlock(t *testing.T, height int64) *models.BlockData {
+	return testBlock(t, height,
+		trxTransferTx(t, txID(1), testOtherAddr, testWatchAddr, 5_000_000),
+		trc20TransferTx(t, txID(2), testUSDTAddr, testWatchAddr, testOtherAddr, 12_340_000),
+		trxTransferTx(t, txID(3), testOtherAddr, testUSDTAddr, 1),
+	)
+}
+
+// savedTransfers 按交易哈希排序返回已保存的转账（JSON），便于比较
+func savedTransfers(t *testing.T, client *redis.RedisClient) []string {
+	t.Helper()
+	events, err := client.GetRecentTransfers(context.Background(), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result []string
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result = append(result, string(data))
+	}
+	sort.Strings(result)
+	return result
+}
+
+// waitFor 轮询直到cond成立
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("等待%s超时", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDirectModeMatchesQueueMode(t *testing.T) {
+	block := sampleBlock(t, 100)
+
+	// queue模式：推送到Redis队列，由工作线程处理
+	queueCfg := loadTestConfig(t, "monitor:\n  mode: queue\n  worker_count: 2\n  idle_poll_interval: 1s\n")
+	queueRedis := newTestRedis(t, queueCfg)
+	queueProcessor := NewBlockProcessor(queueCfg, queueRedis, nil, nil)
+	if err := queueProcessor.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := queueRedis.PushBlockData(context.Background(), block); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "queue模式处理区块", func() bool {
+		return queueProcessor.GetStats()["processed_blocks"].(int64) == 1
+	})
+	queueProcessor.Stop()
+	queued := savedTransfers(t, queueRedis)
+
+	// direct模式：同步处理同一个区块
+	directCfg := loadTestConfig(t, "monitor:\n  mode: direct\n")
+	directRedis := newTestRedis(t, directCfg)
+	directProcessor := NewBlockProcessor(directCfg, directRedis, nil, nil)
+	if err := directProcessor.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer directProcessor.Stop()
+	if err := directProcessor.ProcessBlock(sampleBlock(t, 100)); err != nil {
+		t.Fatal(err)
+	}
+	direct := savedTransfers(t, directRedis)
+
+	if len(queued) != 3 {
+		t.Fatalf("queue模式应保存3笔转账，实际 %d 笔: %v", len(queued), queued)
+	}
+	if len(direct) != len(queued) {
+		t.Fatalf("direct模式保存 %d 笔，queue模式 %d 笔", len(direct), len(queued))
+	}
+	for i := range queued {
+		if direct[i] != queued[i] {
+			t.Errorf("转账不一致:\ndirect: %s\nqueue:  %s", direct[i], queued[i])
+		}
+	}
+}
+
+func TestDirectModeDeadLettersPanickingBlock(t *testing.T) {
+	cfg := loadTestConfig(t, "monitor:\n  mode: direct\n  max_block_attempts: 2\n")
+	client := newTestRedis(t, cfg)
+	bp := NewBlockProcessor(cfg, client, nil, nil)
+	if err := bp.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer bp.Stop()
+
+	// nil合约使解码panic
+	bad := testBlock(t, 200, trxTransferTx(t, txID(1), testOtherAddr, testWatchAddr, 1))
+	bad.Block.Trans[0].RawData.Contract = []*models.Contract{nil}
+
+	// 放入死信队列后返回nil，监控器游标可以前进
+	if err := bp.ProcessBlock(bad); err != nil {
+		t.Fatalf("放入死信队列后应返回nil: %v", err)
+	}
+	stats := bp.GetStats()
+	if stats["worker_panics"].(int64) != 2 {
+		t.Errorf("panic次数 %v，期望2", stats["worker_panics"])
+	}
+	entries, err := client.GetDeadLetterBlocks(context.Background(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Block.Height != 200 {
+		t.Fatalf("死信队列内容不符: %+v", entries)
+	}
+	// 失败的区块不标记为已处理，处理游标停在它之前
+	if cursor, _ := bp.cursor.snapshot(); cursor != 0 {
+		t.Errorf("处理游标 %d，失败的区块不应推进游标", cursor)
+	}
+}
+
+func TestDirectModeReplaysDeadLetters(t *testing.T) {
+	cfg := loadTestConfig(t, "monitor:\n  mode: direct\n")
+	client := newTestRedis(t, cfg)
+	bp := NewBlockProcessor(cfg, client, nil, nil)
+	if err := bp.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer bp.Stop()
+
+	ctx := context.Background()
+	entry := &models.DeadLetterBlock{Block: sampleBlock(t, 300), Error: "测试", Attempts: 3, FailedAt: time.Now()}
+	if err := client.PushDeadLetterBlock(ctx, entry); err != nil {
+		t.Fatal(err)
+	}
+
+	replayed, err := bp.ReplayDeadLetterBlocks(ctx, 10)
+	if err != nil || replayed != 1 {
+		t.Fatalf("重放 %d 个区块，错误 %v", replayed, err)
+	}
+	// direct模式没有消费队列的工作线程，重放的区块应直接处理而不是进入区块队列
+	if size, _ := client.GetQueueSize(ctx); size != 0 {
+		t.Errorf("区块队列长度 %d，期望0", size)
+	}
+	if got := savedTransfers(t, client); len(got) != 3 {
+		t.Errorf("重放后应保存3笔转账，实际 %d 笔", len(got))
+	}
+}
+
+func TestWatchAddressSetFallsBackToLastKnown(t *testing.T) {
+	cfg := loadTestConfig(t, "monitor:\n  mode: direct\n")
+	client := newTestRedis(t, cfg)
+	processor := NewBlockProcessor(cfg, client, nil, nil)
+	ctx := context.Background()
+
+	set, err := processor.watchAddressSet(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !set[testWatchAddr] {
+		t.Fatalf("监控地址集合缺少 %s: %v", testWatchAddr, set)
+	}
+
+	// Redis不可用时沿用上次的集合，区块不应因此失败
+	client.Close()
+	set, err = processor.watchAddressSet(ctx)
+	if err != nil {
+		t.Fatalf("应沿用上次的监控地址，实际返回错误: %v", err)
+	}
+	if !set[testWatchAddr] {
+		t.Fatalf("沿用的监控地址集合缺少 %s: %v", testWatchAddr, set)
+	}
+	if got := processor.GetStats()["watch_fallbacks"].(int64); got != 1 {
+		t.Errorf("watch_fallbacks = %d，期望 1", got)
+	}
+
+	// 从未成功获取过时仍返回错误
+	fresh := NewBlockProcessor(cfg, client, nil, nil)
+	if _, err := fresh.watchAddressSet(ctx); err == nil {
+		t.Error("没有可沿用的监控地址时应返回错误")
+	}
+}
+
+// 队列已满时，处理失败的区块仍重新入队（block策略不丢弃区块），不进入死信队列
+func TestRetryRequeuesWhenQueueFull(t *testing.T) {
+	cfg := loadTestConfig(t, "monitor:\n  mode: queue\n  queue_size: 1\n  max_block_attempts: 3\n")
+	client := newTestRedis(t, cfg)
+	processor := NewBlockProcessor(cfg, client, nil, nil)
+	ctx := context.Background()
+
+	if err := client.PushBlockData(ctx, sampleBlock(t, 100)); err != nil {
+		t.Fatal(err)
+	}
+	worker := &BlockWorker{id: 0, processor: processor, ctx: ctx}
+	if !worker.retryOrDeadLetter(sampleBlock(t, 101), errors.New("处理失败")) {
+		t.Fatal("队列已满时区块应重新入队")
+	}
+
+	if size, _ := client.GetQueueSize(ctx); size != 2 {
+		t.Errorf("队列长度 %d，期望 2", size)
+	}
+	if entries, _ := client.GetDeadLetterBlocks(ctx, 10); len(entries) != 0 {
+		t.Errorf("不应放入死信队列: %d 条", len(entries))
+	}
+}
+
+// 重放转账死信队列时与工作线程保存一样附加地址标签
+func TestReplayTransferDeadLettersAppliesLabels(t *testing.T) {
+	labels := filepath.Join(t.TempDir(), "labels.json")
+	if err := os.WriteFile(labels, []byte(`{"`+testWatchAddr+`":"热钱包"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := loadTestConfig(t, "labels:\n  enabled: true\n  file: \""+labels+"\"\n")
+	client := newTestRedis(t, cfg)
+	processor := NewBlockProcessor(cfg, client, nil, nil)
+	ctx := context.Background()
+	if err := processor.labeler.Reload(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	event := &models.TransferEvent{TxHash: txID(1), BlockHeight: 100, Source: testOtherAddr, Destination: testWatchAddr, Amount: 1, TokenType: "TRX"}
+	if err := client.PushTransferDeadLetter(ctx, event, "保存失败"); err != nil {
+		t.Fatal(err)
+	}
+	if replayed, err := processor.ReplayTransferDeadLetters(ctx, 10); err != nil || replayed != 1 {
+		t.Fatalf("重放 %d 条，错误 %v", replayed, err)
+	}
+
+	events, err := client.GetRecentTransfers(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].DestinationLabel != "热钱包" {
+		t.Errorf("重放的转账应带有地址标签: %+v", events)
+	}
+}
+
+// 全链大额模式只保留超过阈值的无关转账，且只保存到whale_transfers
+func TestWhaleTransfersKeptOnlyAboveThreshold(t *testing.T) {
+	cfg := loadTestConfig(t, "monitor:\n  mode: direct\nusdt:\n  whale_threshold_usd: 1000\n")
+	client := newTestRedis(t, cfg)
+	bp := NewBlockProcessor(cfg, client, nil, nil)
+	if err := bp.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer bp.Stop()
+
+	block := testBlock(t, 100,
+		trc20TransferTx(t, txID(1), testUSDTAddr, testOtherAddr, testUSDTAddr, 5_000_000_000),
+		trc20TransferTx(t, txID(2), testUSDTAddr, testOtherAddr, testUSDTAddr, 10_000_000),
+		trxTransferTx(t, txID(3), testOtherAddr, testWatchAddr, 1_000_000),
+	)
+	if err := bp.ProcessBlock(block); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	whales, err := client.GetRecentWhaleTransfers(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(whales) != 1 || whales[0].TxHash != txID(1) || !whales[0].Whale || !whales[0].WhaleOnly {
+		t.Fatalf("只应保留超过阈值的大额转账: %+v", whales)
+	}
+
+	recent, err := client.GetRecentTransfers(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recent) != 1 || recent[0].TxHash != txID(3) {
+		t.Errorf("转账列表只应包含涉及监控地址的转账: %+v", recent)
+	}
+	usdt, err := client.GetRecentUSDTTransfers(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(usdt) != 0 {
+		t.Errorf("不涉及监控地址的大额转账不应进入USDT转账列表: %+v", usdt)
+	}
+}
+
+// 工作线程阻塞在BRPOP时停止应立即退出，不做错误退避
+func TestStopWhileWorkersBlockedInPop(t *testing.T) {
+	cfg := loadTestConfig(t, "monitor:\n  mode: queue\n  worker_count: 2\n  idle_poll_interval: 30s\n  error_backoff: 30s\n")
+	client := newTestRedis(t, cfg)
+	bp := NewBlockProcessor(cfg, client, nil, nil)
+	if err := bp.Start(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond) // 等工作线程进入BRPOP
+
+	start := time.Now()
+	bp.Stop()
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("停止耗时 %v，工作线程未及时退出", elapsed)
+	}
+}
+
+// usdt.contract_address以十六进制或base58配置时都能识别USDT转账
+func TestUSDTDetectedWithHexOrBase58Contract(t *testing.T) {
+	usdtHex := hexAddress(t, testUSDTAddr)
+	for _, contract := range []string{testUSDTAddr, usdtHex} {
+		cfg := loadTestConfig(t, "monitor:\n  mode: direct\nusdt:\n  contract_address: \""+contract+"\"\n")
+		client := newTestRedis(t, cfg)
+		bp := NewBlockProcessor(cfg, client, nil, nil)
+		if err := bp.Start(); err != nil {
+			t.Fatal(err)
+		}
+		err := bp.ProcessBlock(testBlock(t, 100, trc20TransferTx(t, txID(1), testUSDTAddr, testOtherAddr, testWatchAddr, 1_000_000)))
+		bp.Stop()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		events, err := client.GetRecentUSDTTransfers(context.Background(), 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 1 || !events[0].IsUSDT || events[0].TokenType != "USDT" {
+			t.Errorf("合约地址配置为 %s 时应识别USDT转账: %+v", contract, events)
+		}
+	}
+}
+
+func TestScaleAmountExact(t *testing.T) {
+	tests := []struct {
+		raw      string
+		decimals int
+		amount   float64
+		decimal  string
+	}{
+		{"1", 6, 0.000001, "0.000001"},
+		{"0", 6, 0, "0"},
+		{"10000000", 6, 10, "10"},
+		{"123456789", 6, 123.456789, "123.456789"},
+		{"100000000000000000000000001", 18, 100000000, "100000000.000000000000000001"},
+		{"42", 0, 42, "42"},
+	}
+	for _, tt := range tests {
+		amount, decimal := scaleAmount(tt.raw, tt.decimals)
+		if amount != tt.amount || decimal != tt.decimal {
+			t.Errorf("scaleAmount(%s, %d) = %v, %s，期望 %v, %s", tt.raw, tt.decimals, amount, decimal, tt.amount, tt.decimal)
+		}
+	}
+}
+
+// 1个最小单位的USDT转账保留原始整数和精确的十进制金额
+func TestOneBaseUnitUSDTTransfer(t *testing.T) {
+	cfg := loadTestConfig(t, "monitor:\n  mode: direct\n")
+	client := newTestRedis(t, cfg)
+	bp := NewBlockProcessor(cfg, client, nil, nil)
+	if err := bp.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer bp.Stop()
+	if err := bp.ProcessBlock(testBlock(t, 100, trc20TransferTx(t, txID(1), testUSDTAddr, testOtherAddr, testWatchAddr, 1))); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := client.GetRecentUSDTTransfers(context.Background(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("应保存1笔USDT转账，实际 %d 笔", len(events))
+	}
+	event := events[0]
+	if event.AmountRaw != "1" || event.AmountDecimal != "0.000001" || event.Amount != 0.000001 {
+		t.Errorf("金额应精确表示: raw=%s decimal=%s amount=%v", event.AmountRaw, event.AmountDecimal, event.Amount)
+	}
+}
+
+// unparsableTRC20Tx 构造金额参数不是合法十六进制的TRC20 transfer调用
+func unparsableTRC20Tx(t *testing.T, id, to, amountHex string) *models.Transaction {
+	data := "a9059cbb" + strings.Repeat("0", 24) + strings.TrimPrefix(hexAddress(t, to), "41") + amountHex
+	return contractTx(id, "TriggerSmartContract", map[string]interface{}{
+		"owner_address":    hexAddress(t, testOtherAddr),
+		"contract_address": hexAddress(t, testUSDTAddr),
+		"data":             data,
+	})
+}
+
+// 金额无法解析但接收方是监控地址时，启用keep_unparsed_amount后仍保存带标记的转账
+func TestKeepUnparsedAmountForWatchedRecipient(t *testing.T) {
+	amountHex := strings.Repeat("zz", 32)
+	for _, keep := range []bool{false, true} {
+		cfg := loadTestConfig(t, fmt.Sprintf("monitor:\n  mode: direct\n  keep_unparsed_amount: %v\n", keep))
+		client := newTestRedis(t, cfg)
+		bp := NewBlockProcessor(cfg, client, nil, nil)
+		if err := bp.Start(); err != nil {
+			t.Fatal(err)
+		}
+		err := bp.ProcessBlock(testBlock(t, 100,
+			unparsableTRC20Tx(t, txID(1), testWatchAddr, amountHex),
+			unparsableTRC20Tx(t, txID(2), testOtherAddr, amountHex),
+		))
+		bp.Stop()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		events, err := client.GetRecentTransfers(context.Background(), 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !keep {
+			if len(events) != 0 {
+				t.Errorf("未启用keep_unparsed_amount时不应保存: %+v", events)
+			}
+			continue
+		}
+		if len(events) != 1 {
+			t.Fatalf("只应保存接收方为监控地址的转账，实际 %d 笔", len(events))
+		}
+		event := events[0]
+		if event.TxHash != txID(1) || !event.AmountParseError || event.AmountHex != amountHex || event.Amount != 0 || event.Destination != testWatchAddr {
+			t.Errorf("应保存带amount_parse_error标记和原始金额的转账: %+v", event)
+		}
+	}
+}
+
+func TestSQLStoreDualWrite(t *testing.T) {
+	cfg := loadTestConfig(t, "monitor:\n  mode: direct\n")
+	client := newTestRedis(t, cfg)
+	sqlStore, err := store.NewSQLStore(filepath.Join(t.TempDir(), "transfers.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlStore.Close()
+
+	processor := NewBlockProcessor(cfg, client, nil, nil)
+	processor.SetTransferStore(sqlStore)
+	if err := processor.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer processor.Stop()
+	if err := processor.ProcessBlock(sampleBlock(t, 100)); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, truncated, err := sqlStore.GetTransfersByBlockRange(context.Background(), 100, 100, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if truncated {
+		t.Error("3笔转账不应被截断")
+	}
+	var got []string
+	for _, event := range stored {
+		data, err := json.Marshal(event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, string(data))
+	}
+	sort.Strings(got)
+	want := savedTransfers(t, client)
+	if len(want) != 3 || strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("SQL存储与Redis中的转账不一致:\nsql:   %v\nredis: %v", got, want)
+	}
+	if errs := processor.GetStats()["sql_store_errors"].(int64); errs != 0 {
+		t.Errorf("sql_store_errors = %d，期望0", errs)
+	}
+}
+
+func TestUSDValueUsesDepeggedPrice(t *testing.T) {
+	prices := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"tether":{"usd":0.97}}`)
+	}))
+	defer prices.Close()
+
+	cfg := loadTestConfig(t, fmt.Sprintf("monitor:\n  mode: direct\nusdt:\n  use_live_price: true\npricing:\n  base_url: %q\n", prices.URL))
+	client := newTestRedis(t, cfg)
+	processor := NewBlockProcessor(cfg, client, nil, nil)
+	if err := processor.ProcessBlock(sampleBlock(t, 100)); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := client.GetRecentTransfers(context.Background(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, event := range events {
+		if !event.IsUSDT {
+			continue
+		}
+		found = true
+		if want := 12.34 * 0.97; event.USDValue != want {
+			t.Errorf("USD价值 %v，期望按脱锚价格计算为 %v", event.USDValue, want)
+		}
+	}
+	if !found {
+		t.Fatal("未保存USDT转账")
+	}
+}
+
+func TestWorkerUsesConfiguredPollIntervals(t *testing.T) {
+	server := miniredis.RunT(t)
+	cfg := loadTestConfig(t, "monitor:\n  mode: queue\n  worker_count: 1\n  idle_poll_interval: 1s\n  error_backoff: 300ms\n")
+	cfg.Redis.Addr = server.Addr()
+	client, err := redis.NewRedisClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	ctx := context.Background()
+
+	// 队列为空时BRPOP阻塞idle_poll_interval后返回
+	start := time.Now()
+	if block, err := client.PopBlockData(ctx); err != nil || block != nil {
+		t.Fatalf("空队列应返回nil，实际 %v，错误 %v", block, err)
+	}
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond || elapsed > 1500*time.Millisecond {
+		t.Errorf("空队列等待 %v，期望约为idle_poll_interval（1s）", elapsed)
+	}
+
+	// 阻塞等待期间入队的区块立即被取走，而不是等到下一轮轮询
+	processor := NewBlockProcessor(cfg, client, nil, nil)
+	if err := processor.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer processor.Stop()
+	time.Sleep(200 * time.Millisecond)
+	start = time.Now()
+	if err := client.PushBlockData(ctx, sampleBlock(t, 100)); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "处理区块", func() bool { return processor.GetStats()["processed_blocks"].(int64) == 1 })
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("入队后 %v 才处理，应在BRPOP阻塞期间立即取走", elapsed)
+	}
+
+	// Redis出错时按error_backoff退避，第一次失败后的1秒内约重试3次
+	var logs strings.Builder
+	var mu sync.Mutex
+	failures := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return strings.Count(logs.String(), "获取区块数据失败")
+	}
+	log.SetOutput(writerFunc(func(p []byte) (int, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return logs.Write(p)
+	}))
+	defer log.SetOutput(os.Stderr)
+	server.SetError("ERR 模拟Redis故障")
+	defer server.SetError("")
+
+	// 故障前发出的BRPOP仍在阻塞，等到第一次失败再计数
+	waitFor(t, "第一次获取失败", func() bool { return failures() > 0 })
+	first := failures()
+	time.Sleep(time.Second)
+	if retries := failures() - first; retries < 2 || retries > 5 {
+		t.Errorf("1秒内重试 %d 次，期望按300ms退避约3次", retries)
+	}
+}
+
+// writerFunc 将函数适配为io.Writer
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
+
+func TestWorkerRestartsAfterPanic(t *testing.T) {
+	cfg := loadTestConfig(t, "monitor:\n  mode: queue\n  worker_count: 1\n  idle_poll_interval: 1s\n  error_backoff: 50ms\n  max_worker_restarts: 1\n")
+	client := newTestRedis(t, cfg)
+	processor := NewBlockProcessor(cfg, client, nil, nil)
+	if err := processor.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer processor.Stop()
+	ctx := context.Background()
+
+	// 空合约使processBlock发生panic
+	badBlock := func(height int64) *models.BlockData {
+		bad := sampleBlock(t, height)
+		bad.Block.Trans[0].RawData.Contract = []*models.Contract{nil}
+		return bad
+	}
+	stat := func(name string) int64 { return processor.GetStats()[name].(int64) }
+
+	// 第一次panic后工作线程重启，继续处理后续区块
+	if err := client.PushBlockData(ctx, badBlock(100)); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "第一次panic", func() bool { return stat("worker_panics") == 1 })
+	if err := client.PushBlockData(ctx, sampleBlock(t, 101)); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "重启后处理区块", func() bool { return stat("processed_blocks") == 1 })
+	if alive := stat("alive_workers"); alive != 1 {
+		t.Errorf("重启后 alive_workers = %d，期望 1", alive)
+	}
+	if dead := processor.DeadWorkers(); dead != 0 {
+		t.Errorf("重启后 DeadWorkers() = %d，期望 0", dead)
+	}
+
+	// 一分钟内再次panic超过max_worker_restarts，工作线程退出且不再重启
+	if err := client.PushBlockData(ctx, badBlock(102)); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "工作线程退出", func() bool { return stat("alive_workers") == 0 })
+	if panics := stat("worker_panics"); panics != 2 {
+		t.Errorf("worker_panics = %d，期望 2", panics)
+	}
+	if dead := stat("dead_workers"); dead != 1 {
+		t.Errorf("dead_workers = %d，期望 1", dead)
+	}
+
+	// 没有存活的工作线程，新入队的区块不再被处理
+	if err := client.PushBlockData(ctx, sampleBlock(t, 103)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if processed := stat("processed_blocks"); processed != 1 {
+		t.Errorf("工作线程退出后 processed_blocks = %d，期望仍为 1", processed)
+	}
+}
+
+// Timestamp始终为区块时间，TxTimestamp取交易原始数据中的创建时间，未提供时为0且不输出
+func TestTransferTxTimestamp(t *testing.T) {
+	cfg := loadTestConfig(t, "monitor:\n  mode: direct\n")
+	client := newTestRedis(t, cfg)
+	bp := NewBlockProcessor(cfg, client, nil, nil)
+	if err := bp.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer bp.Stop()
+
+	withTimestamp := trxTransferTx(t, txID(1), testOtherAddr, testWatchAddr, 5_000_000)
+	withTimestamp.RawData.Timestamp = 1699999990000
+	withoutTimestamp := trc20TransferTx(t, txID(2), testUSDTAddr, testWatchAddr, testOtherAddr, 12_340_000)
+	block := testBlock(t, 100, withTimestamp, withoutTimestamp)
+	if err := bp.ProcessBlock(block); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := client.GetRecentTransfers(context.Background(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byHash := make(map[string]*models.TransferEvent)
+	for _, event := range events {
+		byHash[event.TxHash] = event
+	}
+	if len(byHash) != 2 {
+		t.Fatalf("应保存2笔转账，实际 %d 笔", len(byHash))
+	}
+
+	for _, event := range byHash {
+		if event.Timestamp != block.Timestamp {
+			t.Errorf("转账 %s Timestamp = %d，应为区块时间 %d", event.TxHash, event.Timestamp, block.Timestamp)
+		}
+	}
+	if got := byHash[txID(1)].TxTimestamp; got != 1699999990000 {
+		t.Errorf("TxTimestamp = %d，应为交易创建时间 1699999990000", got)
+	}
+	zero := byHash[txID(2)]
+	if zero.TxTimestamp != 0 {
+		t.Errorf("原始数据无时间戳时 TxTimestamp = %d，应为0", zero.TxTimestamp)
+	}
+	data, err := json.Marshal(zero)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "tx_timestamp") {
+		t.Errorf("TxTimestamp为0时不应输出tx_timestamp: %s", data)
+	}
+}
+
+// permissionUpdateTx 构造AccountPermissionUpdateContract交易：owner权限单签，active权限2/3多签
+func permissionUpdateTx(t *testing.T, id, owner string) *models.Transaction {
+	key := func(address string, weight int) map[string]interface{} {
+		return map[string]interface{}{"address": hexAddress(t, address), "weight": float64(weight)}
+	}
+	return contractTx(id, "AccountPermissionUpdateContract", map[string]interface{}{
+		"owner_address": hexAddress(t, owner),
+		"owner": map[string]interface{}{
+			"type":            "Owner",
+			"permission_name": "owner",
+			"threshold":       float64(1),
+			"keys":            []interface{}{key(owner, 1)},
+		},
+		"actives": []interface{}{map[string]interface{}{
+			"type":            "Active",
+			"id":              float64(2),
+			"permission_name": "multisig",
+			"threshold":       float64(2),
+			"operations":      "7fff1fc0033e0000000000000000000000000000000000000000000000000000",
+			"keys":            []interface{}{key(owner, 1), key(testOtherAddr, 1), key(testUSDTAddr, 1)},
+		}},
+	})
+}
+
+func TestPermissionUpdateDecoded(t *testing.T) {
+	run := func(t *testing.T, track bool) []*models.PermissionUpdateEvent {
+		cfg := loadTestConfig(t, fmt.Sprintf("monitor:\n  mode: direct\n  track_permission_updates: %v\n", track))
+		client := newTestRedis(t, cfg)
+		bp := NewBlockProcessor(cfg, client, nil, nil)
+		if err := bp.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer bp.Stop()
+		// 非监控地址的权限变更不记录
+		block := testBlock(t, 100, permissionUpdateTx(t, txID(1), testWatchAddr), permissionUpdateTx(t, txID(2), testOtherAddr))
+		if err := bp.ProcessBlock(block); err != nil {
+			t.Fatal(err)
+		}
+		events, err := client.GetRecentPermissionUpdates(context.Background(), 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return events
+	}
+
+	t.Run("enabled", func(t *testing.T) {
+		events := run(t, true)
+		if len(events) != 1 {
+			t.Fatalf("应记录1条权限变更，实际 %d 条", len(events))
+		}
+		event := events[0]
+		if event.Owner != testWatchAddr || event.TxHash != txID(1) || event.BlockHeight != 100 {
+			t.Errorf("事件 owner=%s tx=%s height=%d", event.Owner, event.TxHash, event.BlockHeight)
+		}
+		if p := event.OwnerPermission; p == nil || p.Type != "Owner" || p.Threshold != 1 || len(p.Keys) != 1 || p.Keys[0].Address != testWatchAddr {
+			t.Errorf("owner权限解析错误: %+v", p)
+		}
+		if event.WitnessPermission != nil {
+			t.Errorf("未设置witness权限时应为nil: %+v", event.WitnessPermission)
+		}
+		if len(event.ActivePermissions) != 1 {
+			t.Fatalf("应有1个active权限，实际 %d 个", len(event.ActivePermissions))
+		}
+		active := event.ActivePermissions[0]
+		if active.ID != 2 || active.Name != "multisig" || active.Threshold != 2 || active.Operations == "" {
+			t.Errorf("active权限解析错误: %+v", active)
+		}
+		var keys []string
+		for _, key := range active.Keys {
+			if key.Weight != 1 {
+				t.Errorf("密钥 %s 权重 %d，期望 1", key.Address, key.Weight)
+			}
+			keys = append(keys, key.Address)
+		}
+		if want := []string{testWatchAddr, testOtherAddr, testUSDTAddr}; strings.Join(keys, ",") != strings.Join(want, ",") {
+			t.Errorf("active密钥 %v，期望base58地址 %v", keys, want)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		if events := run(t, false); len(events) != 0 {
+			t.Errorf("未启用track_permission_updates时不应记录，实际 %d 条", len(events))
+		}
+	})
+}
+
+func TestRetainRawTransaction(t *testing.T) {
+	// run 处理一笔TRX转账，返回保存的转账和Redis中的原始交易
+	run := func(t *testing.T, extra string) (*models.TransferEvent, []byte, *miniredis.Miniredis) {
+		server := miniredis.RunT(t)
+		cfg := loadTestConfig(t, "monitor:\n  mode: direct\n"+extra)
+		cfg.Redis.Addr = server.Addr()
+		client, err := redis.NewRedisClient(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+		bp := NewBlockProcessor(cfg, client, nil, nil)
+		if err := bp.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer bp.Stop()
+
+		ctx := context.Background()
+		if err := client.AddWatchAddress(ctx, models.WatchAddress{Address: testWatchAddr}); err != nil {
+			t.Fatal(err)
+		}
+		if err := bp.ProcessBlock(testBlock(t, 100, trxTransferTx(t, txID(1), testOtherAddr, testWatchAddr, 5_000_000))); err != nil {
+			t.Fatal(err)
+		}
+		events, err := client.GetRecentTransfers(ctx, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 1 {
+			t.Fatalf("应保存1笔转账，实际 %d 笔", len(events))
+		}
+		raw, err := client.GetRawTransaction(ctx, txID(1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return events[0], raw, server
+	}
+
+	t.Run("enabled", func(t *testing.T) {
+		event, raw, server := run(t, "  retain_raw: true\n  raw_ttl: 1h\n")
+		if event.RawTxKey != "raw_tx:"+txID(1) {
+			t.Errorf("RawTxKey = %q，期望 raw_tx:<txhash>", event.RawTxKey)
+		}
+		var tx models.Transaction
+		if err := json.Unmarshal(raw, &tx); err != nil {
+			t.Fatalf("原始交易不是合法JSON: %v: %s", err, raw)
+		}
+		if tx.TxID != txID(1) || tx.RawData == nil || len(tx.RawData.Contract) != 1 {
+			t.Errorf("原始交易内容不完整: %s", raw)
+		}
+		if ttl := server.TTL(event.RawTxKey); ttl != time.Hour {
+			t.Errorf("原始交易TTL = %v，期望 raw_ttl（1h）", ttl)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		event, raw, server := run(t, "")
+		if event.RawTxKey != "" || raw != nil || server.Exists("raw_tx:"+txID(1)) {
+			t.Errorf("未启用retain_raw时不应保留原始交易: key=%q raw=%s", event.RawTxKey, raw)
+		}
+	})
+
+	// 压缩后超过raw_max_bytes的交易不保留，转账照常保存
+	t.Run("bounded", func(t *testing.T) {
+		event, raw, server := run(t, "  retain_raw: true\n  raw_max_bytes: 16\n")
+		if event.RawTxKey != "" || raw != nil || server.Exists("raw_tx:"+txID(1)) {
+			t.Errorf("超过raw_max_bytes时不应保留原始交易: key=%q raw=%s", event.RawTxKey, raw)
+		}
+	})
+}
+
+// 启用use_historical_price时按区块日期的历史价格计算USD价值，历史价格不可用时回退到最新价格并标记
+func TestUSDValueUsesHistoricalPrice(t *testing.T) {
+	run := func(t *testing.T, historyAvailable bool) (*models.TransferEvent, []string) {
+		var mu sync.Mutex
+		var historyDates []string
+		prices := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/simple/price":
+				fmt.Fprint(w, `{"tether":{"usd":0.97}}`)
+			case "/coins/tether/history":
+				mu.Lock()
+				historyDates = append(historyDates, r.URL.Query().Get("date"))
+				mu.Unlock()
+				if !historyAvailable {
+					http.Error(w, "not found", http.StatusNotFound)
+					return
+				}
+				fmt.Fprint(w, `{"market_data":{"current_price":{"usd":0.995}}}`)
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+		defer prices.Close()
+
+		cfg := loadTestConfig(t, fmt.Sprintf("monitor:\n  mode: direct\nusdt:\n  use_live_price: true\n  use_historical_price: true\npricing:\n  base_url: %q\n", prices.URL))
+		client := newTestRedis(t, cfg)
+		processor := NewBlockProcessor(cfg, client, nil, nil)
+		// 两个区块在同一天，历史价格只请求一次
+		for _, height := range []int64{100, 101} {
+			block := testBlock(t, height, trc20TransferTx(t, txID(int(height)), testUSDTAddr, testWatchAddr, testOtherAddr, 12_340_000))
+			if err := processor.ProcessBlock(block); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		events, err := client.GetRecentUSDTTransfers(context.Background(), 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 2 {
+			t.Fatalf("应保存2笔USDT转账，实际 %d 笔", len(events))
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return events[0], historyDates
+	}
+
+	t.Run("historical", func(t *testing.T) {
+		event, dates := run(t, true)
+		if want := 12.34 * 0.995; event.USDValue != want || event.PriceFallback {
+			t.Errorf("USD价值 %v fallback %v，期望按历史价格计算为 %v", event.USDValue, event.PriceFallback, want)
+		}
+		// 区块时间 2023-11-14 22:18:20 UTC
+		if len(dates) != 1 || dates[0] != "14-11-2023" {
+			t.Errorf("历史价格请求日期 %v，期望只按区块日期 14-11-2023 请求一次", dates)
+		}
+	})
+
+	t.Run("fallback", func(t *testing.T) {
+		event, _ := run(t, false)
+		if want := 12.34 * 0.97; event.USDValue != want || !event.PriceFallback {
+			t.Errorf("USD价值 %v fallback %v，期望回退到最新价格 %v 并标记", event.USDValue, event.PriceFallback, want)
+		}
+	})
+}
+
+func TestIgnoreSelfTransfers(t *testing.T) {
+	block := func() *models.BlockData {
+		return testBlock(t, 100,
+			trxTransferTx(t, txID(1), testWatchAddr, testWatchAddr, 1_000_000), // 自转账
+			trxTransferTx(t, txID(2), testWatchAddr, testOtherAddr, 2_000_000), // 配置分组时为组内互转
+			trxTransferTx(t, txID(3), testWatchAddr, testUSDTAddr, 3_000_000),
+		)
+	}
+	ownerGroups := fmt.Sprintf("  owner_groups:\n    exchange:\n      - %q\n      - %q\n", testWatchAddr, testOtherAddr)
+
+	for _, tc := range []struct {
+		name  string
+		extra string
+		want  []string
+	}{
+		{"disabled", "", []string{txID(1), txID(2), txID(3)}},
+		{"self", "  ignore_self_transfers: true\n", []string{txID(2), txID(3)}},
+		{"grouped", "  ignore_self_transfers: true\n" + ownerGroups, []string{txID(3)}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := loadTestConfig(t, "monitor:\n  mode: direct\n"+tc.extra)
+			client := newTestRedis(t, cfg)
+			processor := NewBlockProcessor(cfg, client, nil, nil)
+			if err := processor.ProcessBlock(block()); err != nil {
+				t.Fatal(err)
+			}
+
+			events, err := client.GetRecentTransfers(context.Background(), 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, event := range events {
+				got = append(got, event.TxHash)
+			}
+			sort.Strings(got)
+			if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+				t.Errorf("保存的转账 %v，期望 %v", got, tc.want)
+			}
+		})
+	}
+}
+
+// 价格和余额查询接口都不可用时区块照常处理，转账保存时附加字段留空，失败计入enrich_errors
+func TestEnrichmentFailuresDoNotDropTransfers(t *testing.T) {
+	var requests int64
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+
+	cfg := loadTestConfig(t, fmt.Sprintf(`monitor:
+  mode: direct
+  balance_snapshot: true
+usdt:
+  use_live_price: true
+pricing:
+  base_url: %q
+trongrid:
+  base_url: %q
+  retry_max: 0
+`, unavailable.URL, unavailable.URL))
+	client := newTestRedis(t, cfg)
+	processor := NewBlockProcessor(cfg, client, httpclient.NewHTTPClient(cfg), nil)
+	if err := processor.ProcessBlock(sampleBlock(t, 100)); err != nil {
+		t.Fatalf("附加信息失败不应导致区块处理失败: %v", err)
+	}
+
+	events, err := client.GetRecentTransfers(context.Background(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("应保存3笔转账，实际 %d 笔", len(events))
+	}
+	for _, event := range events {
+		if event.USDValue != 0 || event.Fee != 0 || event.SourceBalanceAfter != "" || event.DestBalanceAfter != "" {
+			t.Errorf("转账 %s 附加字段应留空: usd=%v fee=%v balances=%q/%q",
+				event.TxHash, event.USDValue, event.Fee, event.SourceBalanceAfter, event.DestBalanceAfter)
+		}
+	}
+	if atomic.LoadInt64(&requests) == 0 {
+		t.Fatal("未请求价格或余额接口")
+	}
+	stats := processor.GetStats()
+	if stats["enrich_errors"].(int64) == 0 || stats["errors"].(int64) != 0 {
+		t.Errorf("enrich_errors=%v errors=%v，附加信息失败应只计入enrich_errors", stats["enrich_errors"], stats["errors"])
+	}
+}
+
+func TestMalformedCalldataRecordedAsDecodeFailure(t *testing.T) {
+	// transfer选择器后的参数被截断
+	malformed := func() *models.BlockData {
+		data := "a9059cbb" + strings.Repeat("0", 24) + strings.TrimPrefix(hexAddress(t, testWatchAddr), "41")
+		return testBlock(t, 100, contractTx(txID(1), "TriggerSmartContract", map[string]interface{}{
+			"owner_address":    hexAddress(t, testOtherAddr),
+			"contract_address": hexAddress(t, testUSDTAddr),
+			"data":             data,
+		}))
+	}
+	run := func(t *testing.T, extra string) []*models.DecodeFailure {
+		cfg := loadTestConfig(t, "monitor:\n  mode: direct\n"+extra)
+		client := newTestRedis(t, cfg)
+		if err := NewBlockProcessor(cfg, client, nil, nil).ProcessBlock(malformed()); err != nil {
+			t.Fatal(err)
+		}
+		failures, err := client.GetRecentDecodeFailures(context.Background(), 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return failures
+	}
+
+	t.Run("enabled", func(t *testing.T) {
+		failures := run(t, "  record_decode_failures: true\n  decode_failure_max_data: 16\n")
+		if len(failures) != 1 {
+			t.Fatalf("应记录1条解码失败，实际 %d 条", len(failures))
+		}
+		failure := failures[0]
+		if failure.Contract != testUSDTAddr || failure.Selector != "a9059cbb" || failure.TxHash != txID(1) || failure.BlockHeight != 100 || failure.Reason == "" {
+			t.Errorf("解码失败记录不完整: %+v", failure)
+		}
+		if len(failure.Data) != 16 || !failure.Truncated || !strings.HasPrefix(failure.Data, "a9059cbb") {
+			t.Errorf("原始数据应截断为decode_failure_max_data个字符: data=%q truncated=%v", failure.Data, failure.Truncated)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		if failures := run(t, ""); len(failures) != 0 {
+			t.Errorf("未启用record_decode_failures时不应记录，实际 %d 条", len(failures))
+		}
+	})
+}
+
+// 限定代币范围的监控地址只匹配对应代币或合约，未限定范围的监控地址匹配任意代币
+func TestWatchAddressTokenScope(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		scopes map[string]string // 监控地址 -> 代币范围，空字符串表示不限
+		want   []string
+	}{
+		{"unscoped", map[string]string{testWatchAddr: ""}, []string{txID(1), txID(2)}},
+		{"token", map[string]string{testWatchAddr: "usdt"}, []string{txID(2)}},
+		{"trc20", map[string]string{testWatchAddr: "TRC20"}, []string{txID(2)}},
+		{"contract", map[string]string{testWatchAddr: testUSDTAddr}, []string{txID(2)}},
+		{"trx", map[string]string{testWatchAddr: "TRX"}, []string{txID(1)}},
+		// 另一方为未限定范围的监控地址时保留
+		{"mixed", map[string]string{testWatchAddr: testUSDTAddr, testOtherAddr: ""}, []string{txID(1), txID(2)}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := loadTestConfig(t, "monitor:\n  mode: direct\n")
+			client := newTestRedis(t, cfg)
+			for address, token := range tc.scopes {
+				if err := client.AddWatchAddress(context.Background(), models.WatchAddress{Address: address, Token: token}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			processor := NewBlockProcessor(cfg, client, nil, nil)
+			err := processor.ProcessBlock(testBlock(t, 100,
+				trxTransferTx(t, txID(1), testWatchAddr, testOtherAddr, 1_000_000),
+				trc20TransferTx(t, txID(2), testUSDTAddr, testWatchAddr, testOtherAddr, 2_000_000),
+			))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			events, err := client.GetRecentTransfers(context.Background(), 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, event := range events {
+				got = append(got, event.TxHash)
+			}
+			sort.Strings(got)
+			if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+				t.Errorf("保存的转账 %v，期望 %v", got, tc.want)
+			}
+		})
+	}
+}
+
+// 带0x/0X前缀的TRC20调用数据与不带前缀的解析结果一致
+func TestTRC20CalldataHexPrefix(t *testing.T) {
+	cfg := loadTestConfig(t, "monitor:\n  mode: direct\n")
+	client := newTestRedis(t, cfg)
+	processor := NewBlockProcessor(cfg, client, nil, nil)
+
+	prefixed := func(n int, prefix string) *models.Transaction {
+		tx := trc20TransferTx(t, txID(n), testUSDTAddr, testWatchAddr, testOtherAddr, 12_340_000)
+		value := tx.RawData.Contract[0].Parameter.(map[string]interface{})["value"].(map[string]interface{})
+		value["data"] = prefix + value["data"].(string)
+		return tx
+	}
+	if err := processor.ProcessBlock(testBlock(t, 100, prefixed(1, ""), prefixed(2, "0x"), prefixed(3, "0X"))); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := client.GetRecentTransfers(context.Background(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("保存了 %d 笔转账，期望 3 笔", len(events))
+	}
+	for _, event := range events {
+		if event.Destination != testOtherAddr || event.AmountRaw != "12340000" || event.Amount != 12.34 || !event.IsUSDT {
+			t.Errorf("交易 %s 解析结果 to=%s amount_raw=%s amount=%v usdt=%v，应与无前缀时一致",
+				event.TxHash, event.Destination, event.AmountRaw, event.Amount, event.IsUSDT)
+		}
+	}
+}
+
+// 原始整数金额与换算后的金额一致：TRX按6位精度，USDT按usdt.decimals，超过uint64范围的金额原始值不溢出
+func TestAmountRawMatchesScaledAmount(t *testing.T) {
+	cfg := loadTestConfig(t, "monitor:\n  mode: direct\n")
+	client := newTestRedis(t, cfg)
+	processor := NewBlockProcessor(cfg, client, nil, nil)
+
+	huge := new(big.Int).Lsh(big.NewInt(1), 70) // 1180591620717411303424
+	hugeTx := trc20TransferTx(t, txID(3), testUSDTAddr, testWatchAddr, testOtherAddr, 1)
+	value := hugeTx.RawData.Contract[0].Parameter.(map[string]interface{})["value"].(map[string]interface{})
+	data := value["data"].(string)
+	value["data"] = data[:len(data)-64] + fmt.Sprintf("%064x", huge)
+
+	err := processor.ProcessBlock(testBlock(t, 100,
+		trxTransferTx(t, txID(1), testWatchAddr, testOtherAddr, 1_234_567),
+		trc20TransferTx(t, txID(2), testUSDTAddr, testWatchAddr, testOtherAddr, 12_340_001),
+		hugeTx,
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		tx            string
+		raw           string
+		amount        float64
+		amountDecimal string
+	}{
+		{txID(1), "1234567", 1.234567, ""},
+		{txID(2), "12340001", 12.340001, "12.340001"},
+		{txID(3), huge.String(), 1180591620717411.303424, "1180591620717411.303424"},
+	} {
+		event, err := client.GetTransferEvent(context.Background(), tc.tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if event.AmountRaw != tc.raw || event.Amount != tc.amount || event.AmountDecimal != tc.amountDecimal {
+			t.Errorf("交易 %s: amount_raw=%s amount=%v amount_decimal=%q，期望 %s/%v/%q",
+				tc.tx, event.AmountRaw, event.Amount, event.AmountDecimal, tc.raw, tc.amount, tc.amountDecimal)
+		}
+		if event.TokenType == "TRX" && strconv.FormatInt(event.AmountSun, 10) != event.AmountRaw {
+			t.Errorf("交易 %s: amount_sun=%d 与 amount_raw=%s 不一致", tc.tx, event.AmountSun, event.AmountRaw)
+		}
+	}
+}
+
+// 合约type为空、只有type_url时按type_url识别TRX转账
+func TestTransferContractRoutedByTypeURL(t *testing.T) {
+	cfg := loadTestConfig(t, "monitor:\n  mode: direct\n")
+	client := newTestRedis(t, cfg)
+	processor := NewBlockProcessor(cfg, client, nil, nil)
+
+	tx := trxTransferTx(t, txID(1), testWatchAddr, testOtherAddr, 1_000_000)
+	tx.RawData.Contract[0].Type = ""
+	if err := processor.ProcessBlock(testBlock(t, 100, tx)); err != nil {
+		t.Fatal(err)
+	}
+
+	event, err := client.GetTransferEvent(context.Background(), txID(1))
+	if err != nil {
+		t.Fatalf("仅有type_url的TRX转账应被解码: %v", err)
+	}
+	if event.TokenType != "TRX" || event.AmountSun != 1_000_000 || event.Destination != testOtherAddr {
+		t.Errorf("解码结果 token=%s amount_sun=%d to=%s，期望 TRX/1000000/%s", event.TokenType, event.AmountSun, event.Destination, testOtherAddr)
+	}
+}
+
+// 监控地址为空时warn模式不保存TRC20转账，sample模式按交易哈希抽样保存并标记sampled
+func TestEmptyWatchSetSampling(t *testing.T) {
+	block := func() *models.BlockData {
+		var txs []*models.Transaction
+		for i := 1; i <= 20; i++ {
+			txs = append(txs, trc20TransferTx(t, txID(i), testUSDTAddr, testWatchAddr, testOtherAddr, int64(i)*1_000_000))
+		}
+		return testBlock(t, 100, txs...)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		extra string
+		rate  int // 0表示不抽样
+	}{
+		{"warn", "", 0},
+		{"sample all", "  empty_watch_mode: sample\n  sample_rate: 1\n", 1},
+		{"sample", "  empty_watch_mode: sample\n  sample_rate: 3\n", 3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := loadTestConfig(t, "monitor:\n  mode: direct\n"+tc.extra)
+			cfg.WatchAddresses = nil
+			client := newTestRedis(t, cfg)
+			processor := NewBlockProcessor(cfg, client, nil, nil)
+			if err := processor.ProcessBlock(block()); err != nil {
+				t.Fatal(err)
+			}
+
+			var want []string
+			for i := 1; i <= 20 && tc.rate > 0; i++ {
+				if sampleTransaction(txID(i), tc.rate) {
+					want = append(want, txID(i))
+				}
+			}
+			if tc.rate == 3 && (len(want) == 0 || len(want) == 20) {
+				t.Fatalf("抽样结果 %d 笔，测试数据应只抽中部分交易", len(want))
+			}
+
+			events, err := client.GetRecentTransfers(context.Background(), 100)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, event := range events {
+				if !event.Sampled {
+					t.Errorf("交易 %s 未标记sampled", event.TxHash)
+				}
+				got = append(got, event.TxHash)
+			}
+			sort.Strings(got)
+			if strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Errorf("保存的转账 %v，期望 %v", got, want)
+			}
+		})
+	}
+}
+
+// 跳过失败交易时，没有执行结果（ret缺失或为null）的交易不会panic，按include_unknown_result处理
+func TestMissingContractResult(t *testing.T) {
+	block := func() *models.BlockData {
+		missing := trxTransferTx(t, txID(1), testWatchAddr, testOtherAddr, 1_000_000)
+		missing.Ret = nil
+		null := trxTransferTx(t, txID(2), testWatchAddr, testOtherAddr, 2_000_000)
+		null.Ret = []*models.TransactionResult{nil}
+		reverted := trxTransferTx(t, txID(3), testWatchAddr, testOtherAddr, 3_000_000)
+		reverted.Ret = []*models.TransactionResult{{ContractRet: "REVERT"}}
+		success := trxTransferTx(t, txID(4), testWatchAddr, testOtherAddr, 4_000_000)
+		return testBlock(t, 100, missing, null, reverted, success)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		extra string
+		want  []string
+	}{
+		{"disabled", "", []string{txID(1), txID(2), txID(3), txID(4)}},
+		{"include unknown", "  skip_failed_transactions: true\n", []string{txID(1), txID(2), txID(4)}},
+		{"skip unknown", "  skip_failed_transactions: true\n  include_unknown_result: false\n", []string{txID(4)}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := loadTestConfig(t, "monitor:\n  mode: direct\n"+tc.extra)
+			client := newTestRedis(t, cfg)
+			processor := NewBlockProcessor(cfg, client, nil, nil)
+			if err := processor.ProcessBlock(block()); err != nil {
+				t.Fatal(err)
+			}
+
+			events, err := client.GetRecentTransfers(context.Background(), 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, event := range events {
+				got = append(got, event.TxHash)
+			}
+			sort.Strings(got)
+			if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+				t.Errorf("保存的转账 %v，期望 %v", got, tc.want)
+			}
+		})
+	}
+}
+
+// monitor.enable_trx/enable_trc10/enable_trc20关闭后对应类型的转账不再保存，其他类型不受影响；USDT只受usdt.enable_monitoring控制
+func TestDisabledTokenTypeSkipped(t *testing.T) {
+	const otherToken = "TXYZopYRdj2D9XRtbG411XZZ3kM5VkAeBf"
+	txs := func(t *testing.T) []*models.Transaction {
+		return []*models.Transaction{
+			trxTransferTx(t, txID(1), testWatchAddr, testOtherAddr, 1_000_000),
+			contractTx(txID(2), "TransferAssetContract", map[string]interface{}{
+				"owner_address": hexAddress(t, testWatchAddr),
+				"to_address":    hexAddress(t, testOtherAddr),
+				"amount":        float64(5),
+				"asset_name":    "31303032303030",
+			}),
+			trc20TransferTx(t, txID(3), testUSDTAddr, testWatchAddr, testOtherAddr, 1_000_000),
+			trc20TransferTx(t, txID(4), otherToken, testWatchAddr, testOtherAddr, 1_000_000),
+		}
+	}
+
+	for _, tc := range []struct {
+		name  string
+		extra string
+		saved []bool // TRX、TRC10、USDT、其他TRC20是否保存
+	}{
+		{"all enabled", "", []bool{true, true, true, true}},
+		{"trx disabled", "  enable_trx: false\n", []bool{false, true, true, true}},
+		{"trc10 disabled", "  enable_trc10: false\n", []bool{true, false, true, true}},
+		{"trc20 disabled", "  enable_trc20: false\n", []bool{true, true, true, false}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := loadTestConfig(t, "monitor:\n  mode: direct\n"+tc.extra)
+			client := newTestRedis(t, cfg)
+			processor := NewBlockProcessor(cfg, client, nil, nil)
+			if err := processor.ProcessBlock(testBlock(t, 100, txs(t)...)); err != nil {
+				t.Fatal(err)
+			}
+
+			for i, want := range tc.saved {
+				event, err := client.GetTransferEvent(context.Background(), txID(i+1))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if (event != nil) != want {
+					t.Errorf("第 %d 笔转账 saved=%v，期望 %v", i+1, event != nil, want)
+				}
+			}
+		})
+	}
+}
+
+// 启用monitor.record_block_hash时转账带有所在区块的哈希，关闭时不记录
+func TestTransferBlockHash(t *testing.T) {
+	for _, record := range []bool{true, false} {
+		t.Run(fmt.Sprintf("record_block_hash=%v", record), func(t *testing.T) {
+			cfg := loadTestConfig(t, fmt.Sprintf("monitor:\n  mode: direct\n  record_block_hash: %v\n", record))
+			client := newTestRedis(t, cfg)
+			processor := NewBlockProcessor(cfg, client, nil, nil)
+			block := testBlock(t, 100,
+				trxTransferTx(t, txID(1), testWatchAddr, testOtherAddr, 1_000_000),
+				trc20TransferTx(t, txID(2), testUSDTAddr, testWatchAddr, testOtherAddr, 1_000_000),
+			)
+			if err := processor.ProcessBlock(block); err != nil {
+				t.Fatal(err)
+			}
+
+			want := ""
+			if record {
+				want = block.BlockHash
+			}
+			for _, id := range []string{txID(1), txID(2)} {
+				event, err := client.GetTransferEvent(context.Background(), id)
+				if err != nil || event == nil {
+					t.Fatalf("转账 %s 应被保存: %v", id, err)
+				}
+				if event.BlockHash != want {
+					t.Errorf("转账 %s block_hash=%q，期望 %q", id, event.BlockHash, want)
+				}
+			}
+		})
+	}
+}
+
+// 启用monitor.skip_zero_amount时丢弃金额为0的TRX和TRC20转账并计入zero_amount，关闭时保留
+func TestZeroAmountTransfers(t *testing.T) {
+	for _, skip := range []bool{true, false} {
+		t.Run(fmt.Sprintf("skip_zero_amount=%v", skip), func(t *testing.T) {
+			cfg := loadTestConfig(t, fmt.Sprintf("monitor:\n  mode: direct\n  skip_zero_amount: %v\n", skip))
+			client := newTestRedis(t, cfg)
+			processor := NewBlockProcessor(cfg, client, nil, nil)
+			err := processor.ProcessBlock(testBlock(t, 100,
+				trxTransferTx(t, txID(1), testWatchAddr, testOtherAddr, 0),
+				trc20TransferTx(t, txID(2), testUSDTAddr, testOtherAddr, testWatchAddr, 0),
+				trc20TransferTx(t, txID(3), testUSDTAddr, testWatchAddr, testOtherAddr, 1),
+			))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, id := range []string{txID(1), txID(2), txID(3)} {
+				event, err := client.GetTransferEvent(context.Background(), id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := !skip || i == 2
+				if (event != nil) != want {
+					t.Errorf("转账 %s saved=%v，期望 %v", id, event != nil, want)
+				}
+			}
+
+			wantSkipped := int64(0)
+			if skip {
+				wantSkipped = 2
+			}
+			if got := processor.GetStats()["zero_amount"]; got != wantSkipped {
+				t.Errorf("zero_amount=%v，期望 %d", got, wantSkipped)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package processor
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"tron-monitor/config"
+	"tron-monitor/http"
+	"tron-monitor/models"
+)
+
+// 监控模式
+const (
+	MonitorModeQueue  = "queue"  // 区块推送到Redis队列，由工作线程池处理
+	MonitorModeDirect = "direct" // 监控器直接同步处理区块，不使用队列
+)
+
+// 监控地址为空时的处理方式
+const (
+	EmptyWatchModeWarn   = "warn"   // 只在启动时警告
+	EmptyWatchModeSample = "sample" // 抽样保存全链TRC10/TRC20转账
+)
+
+// 区块来源类型
+const (
+	BlockSourcePolling = "polling"
+	BlockSourceStream  = "stream"
+)
+
+// BlockSource 区块来源，监控器只通过它获取链头区块和指定高度的区块
+type BlockSource interface {
+	// LatestBlock 获取链头区块
+	LatestBlock(ctx context.Context) (*models.BlockData, error)
+	// BlockByNumber 获取指定高度的区块
+	BlockByNumber(ctx context.Context, height int64) (*models.BlockData, error)
+}
+
+// NewBlockSource 根据配置创建区块来源
+func NewBlockSource(cfg *config.Config, httpClient *http.HTTPClient) BlockSource {
+	polling := &pollingSource{config: cfg, httpClient: httpClient}
+	if cfg.Monitor.BlockSource == BlockSourceStream {
+		return &streamSource{config: cfg, httpClient: httpClient, fallback: polling}
+	}
+	return polling
+}
+
+// pollingSource 轮询TronGrid接口获取区块
+type pollingSource struct {
+	config     *config.Config
+	httpClient *http.HTTPClient
+}
+
+// LatestBlock 获取链头区块，启用follow_solidified时为最新固化区块
+func (s *pollingSource) LatestBlock(ctx context.Context) (*models.BlockData, error) {
+	if s.config.Monitor.FollowSolidified {
+		return s.httpClient.GetSolidifiedBlock(ctx)
+	}
+	return s.httpClient.GetLatestBlock(ctx)
+}
+
+// BlockByNumber 获取指定高度的区块
+func (s *pollingSource) BlockByNumber(ctx context.Context, height int64) (*models.BlockData, error) {
+	return s.httpClient.GetBlockByNumber(ctx, height)
+}
+
+// streamSource 从区块事件流接收最新区块，断开或长时间未收到区块时回退到轮询
+type streamSource struct {
+	config     *config.Config
+	httpClient *http.HTTPClient
+	fallback   *pollingSource
+
+	mu         sync.RWMutex
+	latest     *models.BlockData
+	receivedAt time.Time
+	connected  bool
+}
+
+// run 保持事件流连接，断开后按配置的间隔重连，直到ctx取消
+func (s *streamSource) run(ctx context.Context) {
+	for {
+		err := s.httpClient.StreamBlocks(ctx, s.config.Monitor.StreamURL, s.onBlock)
+
+		s.mu.Lock()
+		s.connected = false
+		s.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.config.Monitor.StreamReconnectDelay):
+		}
+
+		log.Printf("区块事件流断开，回退到轮询并重新连接: %v", err)
+	}
+}
+
+// onBlock 记录事件流推送的区块
+func (s *streamSource) onBlock(blockData *models.BlockData) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.connected = true
+	if s.latest == nil || blockData.Height >= s.latest.Height {
+		s.latest = blockData
+		s.receivedAt = time.Now()
+	}
+}
+
+// LatestBlock 优先返回事件流推送的最新区块，事件流不可用或数据过期时回退到轮询
+func (s *streamSource) LatestBlock(ctx context.Context) (*models.BlockData, error) {
+	s.mu.RLock()
+	latest := s.latest
+	fresh := s.connected && latest != nil && time.Since(s.receivedAt) < s.config.Monitor.StreamStaleAfter
+	s.mu.RUnlock()
+
+	if fresh {
+		return latest, nil
+	}
+	return s.fallback.LatestBlock(ctx)
+}
+
+// BlockByNumber 获取指定高度的区块（补齐缺失区块时使用接口查询）
+func (s *streamSource) BlockByNumber(ctx context.Context, height int64) (*models.BlockData, error) {
+	return s.fallback.BlockByNumber(ctx, height)
+}
+
+// isConnected 事件流当前是否已连接
+func (s *streamSource) isConnected() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.connected
+}
@@ -0,0 +1,123 @@
+package processor
+
+import (
+	"sort"
+
+	"tron-monitor/models"
+)
+
+// contractExtractor 从单个合约中提取转账的解码函数
+type contractExtractor func(w *BlockWorker, contract *models.Contract, tx *models.Transaction, blockData *models.BlockData, watchAddressSet map[string]bool) (*models.TransferEvent, error)
+
+// contractExtractors 支持解码的合约类型，/capabilities 也从这里生成，新增合约类型只需在此注册
+var contractExtractors = map[string]contractExtractor{
+	"TransferContract":      (*BlockWorker).extractTRXTransfer,
+	"TransferAssetContract": (*BlockWorker).extractTRC10Transfer,
+	"TriggerSmartContract":  (*BlockWorker).extractTRC20Transfer,
+}
+
+// contractEnabled 合约类型对应的代币类别是否启用，禁用时整个合约不解码
+//
+// TriggerSmartContract在USDT或其他合约代币任一启用时都需要解码，再按合约地址区分。
+func (w *BlockWorker) contractEnabled(typeName string) bool {
+	cfg := w.processor.config
+	switch typeName {
+	case "TransferContract":
+		return cfg.Monitor.EnableTRX
+	case "TransferAssetContract":
+		return cfg.Monitor.EnableTRC10
+	case "TriggerSmartContract":
+		return cfg.Monitor.EnableTRC20 || cfg.USDT.EnableMonitoring
+	default:
+		return true
+	}
+}
+
+// trc20TransferSelector transfer(address,uint256)的函数选择器
+const trc20TransferSelector = "a9059cbb"
+
+// trc20Methods 调用数据模式下支持解码的TRC20函数（选择器 -> 函数签名）
+var trc20Methods = map[string]string{
+	trc20TransferSelector: "transfer(address,uint256)",
+}
+
+// trc20Events 日志模式下支持解码的TRC20事件（topics[0] -> 事件签名）
+var trc20Events = map[string]string{
+	transferEventTopic: "Transfer(address,address,uint256)",
+}
+
+// Capabilities 汇总当前实际解码的合约类型、代币、过滤条件和阈值，供集成方确认监控范围
+func (bp *BlockProcessor) Capabilities() map[string]interface{} {
+	cfg := bp.config
+
+	contractTypes := make([]string, 0, len(contractExtractors))
+	for typeName := range contractExtractors {
+		contractTypes = append(contractTypes, typeName)
+	}
+	sort.Strings(contractTypes)
+
+	// 当前解码方式实际使用的TRC20函数或事件
+	registry := trc20Methods
+	if cfg.Monitor.TRC20DecodeMode == TRC20DecodeLogs {
+		registry = trc20Events
+	}
+	trc20 := make([]map[string]string, 0, len(registry))
+	for id, signature := range registry {
+		trc20 = append(trc20, map[string]string{"id": id, "signature": signature})
+	}
+	sort.Slice(trc20, func(i, j int) bool { return trc20[i]["signature"] < trc20[j]["signature"] })
+
+	// 启用合约标准标记时解码的TRC721函数或事件
+	trc721 := make([]map[string]string, 0)
+	if cfg.Monitor.TagStandard {
+		registry = trc721Methods
+		if cfg.Monitor.TRC20DecodeMode == TRC20DecodeLogs {
+			registry = trc721Events
+		}
+		for id, signature := range registry {
+			trc721 = append(trc721, map[string]string{"id": id, "signature": signature})
+		}
+		sort.Slice(trc721, func(i, j int) bool { return trc721[i]["signature"] < trc721[j]["signature"] })
+	}
+
+	tokens := []map[string]interface{}{
+		{"symbol": "TRX", "decimals": models.TRXDecimals, "enabled": cfg.Monitor.EnableTRX},
+		{"symbol": "TRC10", "decimals": 0, "enabled": cfg.Monitor.EnableTRC10},
+		{"symbol": "USDT", "contract_address": cfg.USDT.ContractAddress, "decimals": cfg.USDT.Decimals, "enabled": cfg.USDT.EnableMonitoring},
+		{"symbol": "TRC20", "decimals": 0, "enabled": cfg.Monitor.EnableTRC20}, // 其他TRC20代币按原始整数金额保存
+	}
+
+	contractEvents := make([]map[string]string, 0, len(cfg.ContractEvents))
+	for _, event := range cfg.ContractEvents {
+		contractEvents = append(contractEvents, map[string]string{
+			"contract":        event.Contract,
+			"event_signature": event.EventSignature,
+		})
+	}
+
+	return map[string]interface{}{
+		"contract_types":    contractTypes,
+		"trc20_decode_mode": cfg.Monitor.TRC20DecodeMode,
+		"trc20":             trc20,
+		"trc721":            trc721,
+		"tokens":            tokens,
+		"contract_events":   contractEvents,
+		"filters": map[string]interface{}{
+			"ignore_self_transfers":    cfg.Monitor.IgnoreSelfTransfers,
+			"skip_zero_amount":         cfg.Monitor.SkipZeroAmount,
+			"owner_groups":             len(cfg.Monitor.OwnerGroups),
+			"empty_watch_mode":         cfg.Monitor.EmptyWatchMode,
+			"sample_rate":              cfg.Monitor.SampleRate,
+			"max_transfers_per_block":  cfg.Monitor.MaxTransfersPerBlock,
+			"follow_solidified":        cfg.Monitor.FollowSolidified,
+			"track_permission_updates": cfg.Monitor.TrackPermissionUpdates,
+			"record_decode_failures":   cfg.Monitor.RecordDecodeFailures,
+		},
+		"thresholds": map[string]interface{}{
+			"usdt_min_amount":     cfg.USDT.MinAmount,
+			"usdt_max_amount":     cfg.USDT.MaxAmount,
+			"whale_threshold_usd": cfg.USDT.WhaleThresholdUSD,
+			"min_confirmations":   cfg.Notify.MinConfirmations,
+		},
+	}
+}
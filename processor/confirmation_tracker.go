@@ -0,0 +1,393 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"tron-monitor/http"
+	"tron-monitor/models"
+	"tron-monitor/notify"
+	"tron-monitor/redis"
+	"tron-monitor/store"
+)
+
+// 确认数计算依据
+const (
+	ConfirmationsSourceCursor     = "cursor"
+	ConfirmationsSourceSolidified = "solidified"
+)
+
+// pendingNotification 等待确认的转账通知
+type pendingNotification struct {
+	Address string                `json:"address"`
+	Event   *models.TransferEvent `json:"event"`
+}
+
+// pendingBlock 同一区块中等待确认的通知，序列化后保存在Redis中，重启后继续等待确认
+type pendingBlock struct {
+	BlockHash     string                  `json:"block_hash"`
+	Notifications []*pendingNotification  `json:"notifications,omitempty"`
+	Saved         []*models.TransferEvent `json:"saved,omitempty"` // 启用撤销时该区块已保存的转账
+
+	dirty bool // 有未持久化的变更
+}
+
+// confirmationTracker 持有转账通知直到所在区块达到要求的确认数，区块被重组时丢弃
+//
+// 默认以处理游标为链头计算确认数，游标略落后于真实链头，因此结果偏保守；
+// 启用固化模式后以固化区块高度计算，确认即不可逆。
+//
+// 检查在独立协程中进行，工作线程推进游标时只记录链头并唤醒检查，不等待TronGrid请求。
+// 等待中的区块在游标持久化之前写入Redis，重启后从Redis恢复。
+type confirmationTracker struct {
+	httpClient       *http.HTTPClient
+	redisClient      *redis.RedisClient
+	notifier         *notify.Notifier
+	minConfirmations int64
+	checkEvery       time.Duration // 没有新区块时的检查间隔，用于重试失败的确认
+
+	// 固化模式：缓存固化区块高度，refreshEvery内不重复请求
+	solidified       bool
+	refreshEvery     time.Duration
+	solidifiedHeight int64
+	solidifiedAt     time.Time
+
+	// 撤销模式：区块被重组时删除已保存的转账并发布撤销事件
+	revertSaved bool
+	store       store.TransferStore // 启用sql_store时同时删除SQL存储中的记录
+
+	wake chan struct{} // 游标推进时唤醒检查协程
+
+	mu       sync.Mutex
+	tip      int64 // 最近一次推进后的处理游标
+	pending  map[int64]*pendingBlock
+	dropped  int64
+	reverted int64
+}
+
+// newConfirmationTracker 创建确认数跟踪器
+func newConfirmationTracker(httpClient *http.HTTPClient, redisClient *redis.RedisClient, notifier *notify.Notifier, minConfirmations int64, checkEvery time.Duration) *confirmationTracker {
+	return &confirmationTracker{
+		httpClient:       httpClient,
+		redisClient:      redisClient,
+		notifier:         notifier,
+		minConfirmations: minConfirmations,
+		checkEvery:       checkEvery,
+		wake:             make(chan struct{}, 1),
+		pending:          make(map[int64]*pendingBlock),
+	}
+}
+
+// useSolidified 改为以固化区块高度计算确认数，固化高度最多每refreshEvery获取一次
+func (t *confirmationTracker) useSolidified(refreshEvery time.Duration) {
+	t.solidified = true
+	t.refreshEvery = refreshEvery
+}
+
+// revertReorged 区块被重组时同时撤销该区块已保存的转账
+func (t *confirmationTracker) revertReorged() {
+	t.revertSaved = true
+}
+
+// load 从Redis恢复上次运行时等待确认的区块，内存中已有的高度不覆盖
+func (t *confirmationTracker) load(ctx context.Context) error {
+	blocks, err := t.redisClient.GetPendingConfirmations(ctx)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for height, data := range blocks {
+		var block pendingBlock
+		if err := json.Unmarshal(data, &block); err != nil {
+			continue // 跳过无效数据
+		}
+		if _, ok := t.pending[height]; !ok {
+			t.pending[height] = &block
+		}
+	}
+	if len(blocks) > 0 {
+		log.Printf("已恢复 %d 个等待确认的区块", len(blocks))
+	}
+	return nil
+}
+
+// run 在独立协程中检查等待确认的区块，直到ctx取消
+func (t *confirmationTracker) run(ctx context.Context) {
+	ticker := time.NewTicker(t.checkEvery)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.wake:
+		case <-ticker.C:
+		}
+
+		t.mu.Lock()
+		tip := t.tip
+		t.mu.Unlock()
+		if tip > 0 {
+			t.check(ctx, tip)
+		}
+	}
+}
+
+// advance 记录推进后的游标并唤醒检查协程，不等待检查完成
+func (t *confirmationTracker) advance(tipHeight int64) {
+	t.mu.Lock()
+	if tipHeight > t.tip {
+		t.tip = tipHeight
+	}
+	t.mu.Unlock()
+
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
+}
+
+// persist 将不高于maxHeight且有变更的等待区块写入Redis，没有待发送通知和待撤销转账的区块直接删除
+func (t *confirmationTracker) persist(ctx context.Context, maxHeight int64) {
+	blocks := make(map[int64][]byte)
+	var empty []int64
+
+	t.mu.Lock()
+	for height, block := range t.pending {
+		if height > maxHeight || !block.dirty {
+			continue
+		}
+		block.dirty = false
+		if len(block.Notifications) == 0 && len(block.Saved) == 0 {
+			delete(t.pending, height)
+			empty = append(empty, height)
+			continue
+		}
+		data, err := json.Marshal(block)
+		if err != nil {
+			log.Printf("序列化待确认区块 %d 失败: %v", height, err)
+			continue
+		}
+		blocks[height] = data
+	}
+	t.mu.Unlock()
+
+	if err := t.redisClient.SavePendingConfirmations(ctx, blocks); err != nil {
+		log.Printf("%v", err)
+	}
+	if err := t.redisClient.DeletePendingConfirmations(ctx, empty...); err != nil {
+		log.Printf("%v", err)
+	}
+}
+
+// reset 区块重新处理（重放、重新入队或重组后按新哈希处理）前清空该高度的等待记录，
+// 避免通知重复或按旧哈希确认；哈希不同时旧记录所在区块已被重组，丢弃其通知并撤销已保存的转账
+func (t *confirmationTracker) reset(ctx context.Context, blockData *models.BlockData) {
+	t.mu.Lock()
+	old, ok := t.pending[blockData.Height]
+	if !ok {
+		t.mu.Unlock()
+		return
+	}
+	t.pending[blockData.Height] = &pendingBlock{BlockHash: blockData.BlockHash, dirty: true}
+	reorged := old.BlockHash != "" && blockData.BlockHash != "" && old.BlockHash != blockData.BlockHash
+	if reorged {
+		t.dropped += int64(len(old.Notifications))
+	}
+	t.mu.Unlock()
+
+	if reorged {
+		log.Printf("区块 %d 按新哈希重新处理（%s -> %s），丢弃 %d 条待发送通知",
+			blockData.Height, old.BlockHash, blockData.BlockHash, len(old.Notifications))
+		t.revert(ctx, blockData.Height, old, blockData.BlockHash)
+	}
+}
+
+// confirmations 计算区块的确认数
+//
+// 游标模式为 tipHeight-height+1；固化模式为 solidifiedHeight-height，小于0时按0计。
+func (t *confirmationTracker) confirmations(height, tipHeight, solidifiedHeight int64) int64 {
+	if !t.solidified {
+		return tipHeight - height + 1
+	}
+	if solidifiedHeight < height {
+		return 0
+	}
+	return solidifiedHeight - height
+}
+
+// currentSolidifiedHeight 获取固化区块高度，缓存未过期时直接返回缓存值
+func (t *confirmationTracker) currentSolidifiedHeight(ctx context.Context) (int64, error) {
+	t.mu.Lock()
+	if !t.solidifiedAt.IsZero() && time.Since(t.solidifiedAt) < t.refreshEvery {
+		height := t.solidifiedHeight
+		t.mu.Unlock()
+		return height, nil
+	}
+	t.mu.Unlock()
+
+	block, err := t.httpClient.GetBlockHeader(ctx, -1, true)
+	if err != nil {
+		return 0, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.solidifiedHeight = block.Height
+	t.solidifiedAt = time.Now()
+	return block.Height, nil
+}
+
+// add 登记一条等待确认的通知
+func (t *confirmationTracker) add(blockData *models.BlockData, address string, event *models.TransferEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	block := t.blockLocked(blockData)
+	block.Notifications = append(block.Notifications, &pendingNotification{Address: address, Event: event})
+	block.dirty = true
+}
+
+// track 登记一条已保存的转账，区块被重组时撤销，未启用撤销时忽略
+func (t *confirmationTracker) track(blockData *models.BlockData, event *models.TransferEvent) {
+	if !t.revertSaved {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	block := t.blockLocked(blockData)
+	block.Saved = append(block.Saved, event)
+	block.dirty = true
+}
+
+// blockLocked 获取或创建区块的等待记录，调用方需持有锁
+func (t *confirmationTracker) blockLocked(blockData *models.BlockData) *pendingBlock {
+	block, ok := t.pending[blockData.Height]
+	if !ok {
+		block = &pendingBlock{BlockHash: blockData.BlockHash}
+		t.pending[blockData.Height] = block
+	}
+	return block
+}
+
+// check 发送已达到确认数的通知，区块哈希与链上不一致（已被重组）的通知直接丢弃，
+// 处理完的区块从Redis中删除
+func (t *confirmationTracker) check(ctx context.Context, tipHeight int64) {
+	var solidifiedHeight int64
+	if t.solidified {
+		height, err := t.currentSolidifiedHeight(ctx)
+		if err != nil {
+			log.Printf("获取固化区块高度失败，稍后重试: %v", err)
+			return
+		}
+		solidifiedHeight = height
+	}
+
+	confirmed := make(map[int64]*pendingBlock)
+
+	t.mu.Lock()
+	for height, block := range t.pending {
+		if t.confirmations(height, tipHeight, solidifiedHeight) >= t.minConfirmations {
+			confirmed[height] = block
+			delete(t.pending, height)
+		}
+	}
+	t.mu.Unlock()
+
+	var done []int64
+	defer func() {
+		if err := t.redisClient.DeletePendingConfirmations(ctx, done...); err != nil {
+			log.Printf("%v", err)
+		}
+	}()
+
+	for height, block := range confirmed {
+		current, err := t.httpClient.GetBlockHeader(ctx, height, false)
+		if err != nil {
+			// 无法确认时放回，等待下次检查
+			log.Printf("确认区块 %d 失败，稍后重试: %v", height, err)
+			t.mu.Lock()
+			if _, ok := t.pending[height]; !ok {
+				t.pending[height] = block
+			}
+			t.mu.Unlock()
+			continue
+		}
+		done = append(done, height)
+
+		if block.BlockHash != "" && current.BlockHash != block.BlockHash {
+			log.Printf("区块 %d 已被重组（%s -> %s），丢弃 %d 条待发送通知",
+				height, block.BlockHash, current.BlockHash, len(block.Notifications))
+			t.mu.Lock()
+			t.dropped += int64(len(block.Notifications))
+			t.mu.Unlock()
+			t.revert(ctx, height, block, current.BlockHash)
+			continue
+		}
+
+		// 通知中带上发送时的确认数，转账对象可能仍被其他地址的通知引用，复制后再修改
+		confirmations := t.confirmations(height, tipHeight, solidifiedHeight)
+		for _, pending := range block.Notifications {
+			event := *pending.Event
+			event.Confirmations = int(confirmations)
+			t.notifier.NotifyTransfer(pending.Address, &event)
+		}
+	}
+}
+
+// revert 撤销被重组区块中已保存的转账，单条失败只记录日志
+func (t *confirmationTracker) revert(ctx context.Context, height int64, block *pendingBlock, newBlockHash string) {
+	if len(block.Saved) == 0 {
+		return
+	}
+
+	var reverted int64
+	for _, event := range block.Saved {
+		err := t.redisClient.RevertTransfer(ctx, event, &models.TransferReverted{
+			Type:         "transfer_reverted",
+			TxHash:       event.TxHash,
+			LogIndex:     event.LogIndex,
+			BlockHeight:  height,
+			BlockHash:    block.BlockHash,
+			NewBlockHash: newBlockHash,
+			Source:       event.Source,
+			Destination:  event.Destination,
+			TokenType:    event.TokenType,
+			Amount:       event.Amount,
+			Timestamp:    time.Now().UnixMilli(),
+		})
+		if err != nil {
+			log.Printf("撤销区块 %d 的转账 %s 失败: %v", height, event.TxHash, err)
+			continue
+		}
+		if t.store != nil {
+			if err := t.store.DeleteTransfer(ctx, event); err != nil {
+				log.Printf("撤销区块 %d 的转账 %s: %v", height, event.TxHash, err)
+			}
+		}
+		reverted++
+	}
+
+	log.Printf("区块 %d 已被重组，撤销 %d/%d 笔已保存的转账", height, reverted, len(block.Saved))
+	t.mu.Lock()
+	t.reverted += reverted
+	t.mu.Unlock()
+}
+
+// stats 获取等待确认的通知数、因重组丢弃的通知数和撤销的转账数
+func (t *confirmationTracker) stats() (pending int, dropped, reverted int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, block := range t.pending {
+		pending += len(block.Notifications)
+	}
+	return pending, t.dropped, t.reverted
+}
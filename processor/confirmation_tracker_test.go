@@ -0,0 +1,211 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+
+	httpclient "tron-monitor/http"
+	"tron-monitor/models"
+	"tron-monitor/notify"
+)
+
+// recordingChannel 记录发送的通知
+type recordingChannel struct {
+	sent chan *notify.Notification
+}
+
+func (c *recordingChannel) Name() string { return "recording" }
+
+func (c *recordingChannel) Send(ctx context.Context, n *notify.Notification) error {
+	c.sent <- n
+	return nil
+}
+
+// newTestTracker 创建以fake TronGrid为链上数据的确认数跟踪器，handler为nil时所有请求返回404
+func newTestTracker(t *testing.T, handler http.HandlerFunc) (*confirmationTracker, *recordingChannel) {
+	t.Helper()
+	if handler == nil {
+		handler = http.NotFound
+	}
+	tronGrid := httptest.NewServer(handler)
+	t.Cleanup(tronGrid.Close)
+
+	cfg := loadTestConfig(t, "")
+	cfg.TronGrid.BaseURL = tronGrid.URL
+	channel := &recordingChannel{sent: make(chan *notify.Notification, 10)}
+	notifier := notify.NewNotifier(cfg, channel)
+	notifier.Start()
+	t.Cleanup(notifier.Stop)
+
+	tracker := newConfirmationTracker(httpclient.NewHTTPClient(cfg), newTestRedis(t, cfg), notifier, 2, time.Hour)
+	return tracker, channel
+}
+
+func TestConfirmationTrackerPersistsAndResets(t *testing.T) {
+	ctx := context.Background()
+	tracker, _ := newTestTracker(t, nil)
+	block := testBlock(t, 100)
+	block.BlockHash = "hash-a"
+	tracker.add(block, testWatchAddr, &models.TransferEvent{TxHash: txID(1), BlockHeight: 100})
+
+	// 游标未到达的区块不持久化
+	tracker.persist(ctx, 99)
+	if stored, _ := tracker.redisClient.GetPendingConfirmations(ctx); len(stored) != 0 {
+		t.Fatalf("游标之后的区块不应持久化: %v", stored)
+	}
+	tracker.persist(ctx, 100)
+
+	// 重启后恢复
+	restored := newConfirmationTracker(tracker.httpClient, tracker.redisClient, tracker.notifier, 2, time.Hour)
+	if err := restored.load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if pending, _, _ := restored.stats(); pending != 1 {
+		t.Fatalf("应恢复1条待发送通知，实际 %d", pending)
+	}
+
+	// 按新哈希重新处理时丢弃旧哈希的通知，持久化后删除空记录
+	reprocessed := testBlock(t, 100)
+	reprocessed.BlockHash = "hash-b"
+	restored.reset(ctx, reprocessed)
+	if pending, dropped, _ := restored.stats(); pending != 0 || dropped != 1 {
+		t.Errorf("重新处理后应丢弃旧通知，待发送 %d，丢弃 %d", pending, dropped)
+	}
+	restored.persist(ctx, 100)
+	if stored, _ := tracker.redisClient.GetPendingConfirmations(ctx); len(stored) != 0 {
+		t.Errorf("没有待发送通知的区块应从Redis删除: %v", stored)
+	}
+}
+
+func TestConfirmationCheckDoesNotBlockAdvance(t *testing.T) {
+	release := make(chan struct{})
+	tracker, channel := newTestTracker(t, func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		if r.URL.Path != "/wallet/getblock" {
+			http.NotFound(w, r) // 只请求区块头，不下载整个区块
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"blockID":      "hash-a",
+			"block_header": map[string]interface{}{"raw_data": map[string]interface{}{"number": 100}},
+		})
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go tracker.run(ctx)
+
+	block := testBlock(t, 100)
+	block.BlockHash = "hash-a"
+	tracker.add(block, testWatchAddr, &models.TransferEvent{TxHash: txID(1), BlockHeight: 100, Destination: testWatchAddr})
+
+	// TronGrid未响应时推进游标不等待检查
+	advanced := make(chan struct{})
+	go func() {
+		tracker.advance(102)
+		close(advanced)
+	}()
+	select {
+	case <-advanced:
+	case <-time.After(time.Second):
+		t.Fatal("推进游标被确认检查阻塞")
+	}
+
+	close(release)
+	select {
+	case n := <-channel.sent:
+		if n.Event == nil || n.Event.Confirmations != 3 {
+			t.Errorf("通知应带上确认数3: %+v", n.Event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("达到确认数后应发送通知")
+	}
+}
+
+// 启用revert_reorged时，确认期间发现区块被重组会删除已保存的转账并发布transfer_reverted事件；区块未被重组时保留
+func TestReorgRevertsSavedTransfers(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		chainHash string // 确认时链上该高度的区块哈希
+		reorged   bool
+	}{
+		{"reorged", "hash-b", true},
+		{"unchanged", "hash-a", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tronGrid := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"blockID":      tc.chainHash,
+					"block_header": map[string]interface{}{"raw_data": map[string]interface{}{"number": 100}},
+				})
+			}))
+			defer tronGrid.Close()
+
+			cfg := loadTestConfig(t, "")
+			cfg.TronGrid.BaseURL = tronGrid.URL
+			client := newTestRedis(t, cfg)
+			notifier := notify.NewNotifier(cfg, &recordingChannel{sent: make(chan *notify.Notification, 10)})
+			notifier.Start()
+			defer notifier.Stop()
+			tracker := newConfirmationTracker(httpclient.NewHTTPClient(cfg), client, notifier, 2, time.Hour)
+			tracker.revertReorged()
+
+			ctx := context.Background()
+			subscriber := goredis.NewClient(&goredis.Options{Addr: cfg.Redis.Addr})
+			defer subscriber.Close()
+			pubsub := subscriber.Subscribe(ctx, "transfers_reverted")
+			defer pubsub.Close()
+			if _, err := pubsub.Receive(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			block := testBlock(t, 100)
+			block.BlockHash = "hash-a"
+			event := &models.TransferEvent{TxHash: txID(1), BlockHeight: 100, Source: testOtherAddr, Destination: testWatchAddr, TokenType: "TRX", Amount: 1.5}
+			if err := client.SaveTransferEvent(ctx, event); err != nil {
+				t.Fatal(err)
+			}
+			tracker.track(block, event)
+			tracker.check(ctx, 102)
+
+			stored, err := client.GetTransferEvent(ctx, txID(1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			recent, err := client.GetRecentTransfers(ctx, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _, reverted := tracker.stats()
+
+			if !tc.reorged {
+				if stored == nil || len(recent) != 1 || reverted != 0 {
+					t.Errorf("区块未被重组时不应撤销转账: 已保存 %v，最近转账 %d 笔，撤销 %d", stored != nil, len(recent), reverted)
+				}
+				return
+			}
+
+			if stored != nil || len(recent) != 0 || reverted != 1 {
+				t.Errorf("区块被重组后应删除转账: 已保存 %v，最近转账 %d 笔，撤销 %d", stored != nil, len(recent), reverted)
+			}
+			select {
+			case msg := <-pubsub.Channel():
+				var revertedEvent models.TransferReverted
+				if err := json.Unmarshal([]byte(msg.Payload), &revertedEvent); err != nil {
+					t.Fatal(err)
+				}
+				if revertedEvent.Type != "transfer_reverted" || revertedEvent.TxHash != txID(1) || revertedEvent.BlockHeight != 100 ||
+					revertedEvent.BlockHash != "hash-a" || revertedEvent.NewBlockHash != "hash-b" || revertedEvent.Amount != 1.5 {
+					t.Errorf("撤销事件不符: %+v", revertedEvent)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("区块被重组后应发布transfer_reverted事件")
+			}
+		})
+	}
+}
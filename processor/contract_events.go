@@ -0,0 +1,143 @@
+package processor
+
+import (
+	"fmt"
+	"log"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"tron-monitor/models"
+	"tron-monitor/tronaddr"
+)
+
+// extractContractEvents 对合约调用交易获取日志并解码自定义事件
+//
+// 按日志的合约地址匹配配置，而不是交易直接调用的合约：经由路由、多签等合约内部调用已配置合约时，
+// 事件同样出现在该交易的日志中。日志按区块一次获取，不会为每笔合约调用单独请求。
+func (w *BlockWorker) extractContractEvents(tx *models.Transaction, blockData *models.BlockData) {
+	if !isContractCall(tx) {
+		return
+	}
+	configs := w.processor.config.ContractEvents
+
+	txInfo, err := w.transactionInfo(tx, blockData)
+	if err != nil {
+		log.Printf("获取交易 %s 的日志失败: %v", tx.TxID, err)
+		return
+	}
+
+	for i, txLog := range txInfo.Log {
+		if len(txLog.Topics) == 0 {
+			continue
+		}
+
+		contract := logContractAddress(txLog.Address)
+		for j := range configs {
+			eventCfg := &configs[j]
+			if eventCfg.Contract != contract || !strings.EqualFold(eventCfg.Topic, strings.TrimPrefix(txLog.Topics[0], "0x")) {
+				continue
+			}
+
+			fields, err := decodeLogFields(eventCfg.FieldMappings, txLog)
+			if err != nil {
+				log.Printf("解码交易 %s 的合约事件 %s 失败: %v", tx.TxID, eventCfg.EventSignature, err)
+				continue
+			}
+
+			event := &models.ContractEvent{
+				Contract:       contract,
+				EventSignature: eventCfg.EventSignature,
+				Topic:          eventCfg.Topic,
+				Fields:         fields,
+				TxHash:         tx.TxID,
+				LogIndex:       i,
+				BlockHeight:    blockData.Height,
+				Timestamp:      blockData.Timestamp,
+			}
+			if err := w.processor.redisClient.SaveContractEvent(w.ctx, event); err != nil {
+				log.Printf("保存合约事件失败: %v", err)
+			}
+		}
+	}
+}
+
+// isContractCall 判断交易是否调用了智能合约（只有合约调用会产生日志）
+func isContractCall(tx *models.Transaction) bool {
+	if tx.RawData == nil {
+		return false
+	}
+	for _, contract := range tx.RawData.Contract {
+		if contract != nil && contract.TypeName() == "TriggerSmartContract" {
+			return true
+		}
+	}
+	return false
+}
+
+// logContractAddress 将日志中的合约地址（20字节hex，不带41前缀）转换为base58
+func logContractAddress(address string) string {
+	address = strings.TrimPrefix(address, "0x")
+	if len(address) == 40 {
+		address = "41" + address
+	}
+	return tronaddr.ToBase58(address)
+}
+
+// decodeLogFields 按字段映射从日志的topics和data中解码字段值
+func decodeLogFields(mappings map[string]string, txLog *models.TransactionLog) (map[string]string, error) {
+	fields := make(map[string]string, len(mappings))
+	data := strings.TrimPrefix(txLog.Data, "0x")
+
+	for name, source := range mappings {
+		parts := strings.SplitN(source, ":", 2)
+		location, valueType := parts[0], parts[1]
+
+		var word string
+		switch {
+		case strings.HasPrefix(location, "topic"):
+			index, err := strconv.Atoi(strings.TrimPrefix(location, "topic"))
+			if err != nil || index < 0 || index >= len(txLog.Topics) {
+				return nil, fmt.Errorf("字段 %s 引用的topic不存在: %s", name, location)
+			}
+			word = txLog.Topics[index]
+		default:
+			index, err := strconv.Atoi(strings.TrimPrefix(location, "data"))
+			if err != nil || index < 0 || (index+1)*64 > len(data) {
+				return nil, fmt.Errorf("字段 %s 引用的data字不存在: %s", name, location)
+			}
+			word = data[index*64 : (index+1)*64]
+		}
+
+		value, err := decodeWord(word, valueType)
+		if err != nil {
+			return nil, fmt.Errorf("解码字段 %s 失败: %w", name, err)
+		}
+		fields[name] = value
+	}
+
+	return fields, nil
+}
+
+// decodeWord 按ABI类型解码一个32字节字
+func decodeWord(word, valueType string) (string, error) {
+	word = strings.TrimPrefix(word, "0x")
+	if len(word) != 64 {
+		return "", fmt.Errorf("数据长度不是32字节: %d", len(word)/2)
+	}
+
+	switch valueType {
+	case "address":
+		return tronaddr.ToBase58("41" + word[24:]), nil
+	case "uint256":
+		value, ok := new(big.Int).SetString(word, 16)
+		if !ok {
+			return "", fmt.Errorf("无效的uint256: %s", word)
+		}
+		return value.String(), nil
+	case "bool":
+		return strconv.FormatBool(strings.TrimLeft(word, "0") != ""), nil
+	default:
+		return word, nil
+	}
+}
@@ -0,0 +1,59 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	httpclient "tron-monitor/http"
+	"tron-monitor/models"
+)
+
+func TestContractEventsFromInternalCall(t *testing.T) {
+	// 交易调用的是路由合约，Approval事件由内部调用的USDT合约产生
+	const routerAddr = testOtherAddr
+	tx := trc20TransferTx(t, txID(1), routerAddr, testWatchAddr, testOtherAddr, 1)
+	word := func(address string) string {
+		return strings.Repeat("0", 24) + strings.TrimPrefix(hexAddress(t, address), "41")
+	}
+	infos := []*models.TransactionInfo{{ID: tx.TxID, Log: []*models.TransactionLog{{
+		Address: strings.TrimPrefix(hexAddress(t, testUSDTAddr), "41"),
+		Topics:  []string{"8c5be1e5ebec7d5bd14f71427d1e84f3dd0314c0f7b2291e5b200ac8c7c3b925", word(testWatchAddr), word(routerAddr)},
+		Data:    fmt.Sprintf("%064x", 5),
+	}}}}
+	tronGrid := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(infos)
+	}))
+	defer tronGrid.Close()
+
+	// 重复的配置只保留一条，topic由事件签名计算
+	eventYAML := "  - contract: \"" + testUSDTAddr + "\"\n" +
+		"    event_signature: \"Approval(address, address, uint256)\"\n" +
+		"    field_mappings:\n      owner: \"topic1:address\"\n      value: \"data0:uint256\"\n"
+	cfg := loadTestConfig(t, "monitor:\n  mode: direct\ncontract_events:\n"+eventYAML+eventYAML)
+	cfg.TronGrid.BaseURL = tronGrid.URL
+	if len(cfg.ContractEvents) != 1 {
+		t.Fatalf("重复的合约事件配置应去重，实际 %d 条", len(cfg.ContractEvents))
+	}
+
+	bp := NewBlockProcessor(cfg, newTestRedis(t, cfg), httpclient.NewHTTPClient(cfg), nil)
+	if err := bp.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer bp.Stop()
+	if err := bp.ProcessBlock(testBlock(t, 100, tx)); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := bp.redisClient.GetRecentContractEvents(context.Background(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Contract != testUSDTAddr || events[0].Fields["owner"] != testWatchAddr || events[0].Fields["value"] != "5" {
+		t.Fatalf("应解码内部调用产生的1个事件: %+v", events)
+	}
+}
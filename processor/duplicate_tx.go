@@ -0,0 +1,60 @@
+package processor
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+
+	"tron-monitor/models"
+)
+
+// resolveDuplicate 检查同一转账是否已按其他区块保存（重组或重放时同一交易出现在两个区块中），
+// 返回是否继续保存transfer
+//
+// 以链上交易信息中的区块高度为准：当前区块是交易所在的规范区块时撤销旧记录并保存新记录，
+// 旧记录所在区块是规范区块时跳过新记录；无法确认时保留先保存的记录。冲突均记录日志。
+// 转账记录保留24小时，只能发现该时间内的冲突。
+func (w *BlockWorker) resolveDuplicate(transfer *models.TransferEvent) bool {
+	existing, err := w.processor.redisClient.GetStoredTransfer(w.ctx, transfer)
+	if err != nil {
+		log.Printf("工作线程 %d: %v", w.id, err)
+		return true
+	}
+	if existing == nil || existing.BlockHeight == transfer.BlockHeight {
+		return true
+	}
+
+	atomic.AddInt64(&w.processor.duplicateTxs, 1)
+	canonical := int64(-1)
+	if txInfo, err := w.processor.httpClient.GetTransactionInfo(w.ctx, transfer.TxHash); err != nil {
+		log.Printf("工作线程 %d: 获取交易 %s 的所在区块失败: %v", w.id, transfer.TxHash, err)
+	} else {
+		canonical = txInfo.BlockNumber
+	}
+
+	if canonical != transfer.BlockHeight {
+		log.Printf("工作线程 %d: 交易 %s 已按区块 %d 保存，区块 %d 中的重复记录被忽略（链上所在区块: %d）",
+			w.id, transfer.TxHash, existing.BlockHeight, transfer.BlockHeight, canonical)
+		return false
+	}
+
+	log.Printf("工作线程 %d: 交易 %s 已按区块 %d 保存，链上所在区块为 %d，改为按该区块保存",
+		w.id, transfer.TxHash, existing.BlockHeight, transfer.BlockHeight)
+	err = w.processor.redisClient.RevertTransfer(w.ctx, existing, &models.TransferReverted{
+		Type:         "transfer_reverted",
+		TxHash:       existing.TxHash,
+		LogIndex:     existing.LogIndex,
+		BlockHeight:  existing.BlockHeight,
+		BlockHash:    existing.BlockHash,
+		NewBlockHash: transfer.BlockHash,
+		Source:       existing.Source,
+		Destination:  existing.Destination,
+		TokenType:    existing.TokenType,
+		Amount:       existing.Amount,
+		Timestamp:    time.Now().UnixMilli(),
+	})
+	if err != nil {
+		log.Printf("工作线程 %d: 撤销交易 %s 在区块 %d 的旧记录失败: %v", w.id, transfer.TxHash, existing.BlockHeight, err)
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	httpclient "tron-monitor/http"
+	"tron-monitor/models"
+)
+
+// 同一交易出现在两个区块中时，无论处理顺序如何都以链上所在区块为准
+func TestResolveDuplicateTxPrefersCanonicalBlock(t *testing.T) {
+	const canonical = 101
+	tronGrid := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/wallet/gettransactioninfobyid" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(&models.TransactionInfo{ID: txID(1), BlockNumber: canonical})
+	}))
+	defer tronGrid.Close()
+
+	for _, heights := range [][]int64{{100, canonical}, {canonical, 100}} {
+		cfg := loadTestConfig(t, "monitor:\n  mode: direct\n  resolve_duplicate_txs: true\n")
+		cfg.TronGrid.BaseURL = tronGrid.URL
+		client := newTestRedis(t, cfg)
+		bp := NewBlockProcessor(cfg, client, httpclient.NewHTTPClient(cfg), nil)
+		if err := bp.Start(); err != nil {
+			t.Fatal(err)
+		}
+		for _, height := range heights {
+			if err := bp.ProcessBlock(testBlock(t, height, trxTransferTx(t, txID(1), testOtherAddr, testWatchAddr, 1_000_000))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		bp.Stop()
+
+		stored, err := client.GetTransferEvent(context.Background(), txID(1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored == nil || stored.BlockHeight != canonical {
+			t.Errorf("处理顺序 %v: 应保存规范区块 %d 中的记录: %+v", heights, canonical, stored)
+		}
+		recent, err := client.GetRecentTransfers(context.Background(), 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(recent) != 1 || recent[0].BlockHeight != canonical {
+			t.Errorf("处理顺序 %v: 转账列表应只有规范区块的记录: %+v", heights, recent)
+		}
+		if n := bp.GetStats()["duplicate_txs"].(int64); n != 1 {
+			t.Errorf("处理顺序 %v: 应记录1次冲突，实际 %d", heights, n)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"tron-monitor/config"
+	"tron-monitor/models"
+)
+
+// 文件输出的fsync策略
+const (
+	FsyncAlways   = "always"   // 每写一行调用一次fsync
+	FsyncInterval = "interval" // 按file_sink.fsync_interval定期fsync
+	FsyncNever    = "never"    // 交给操作系统刷盘
+)
+
+// fileSink 将保存成功的转账以JSONL格式追加到本地文件，按大小和时间轮转
+//
+// 所有写入和轮转由同一个写入线程串行完成，轮转期间到达的转账在队列中等待，不会丢失；
+// 队列满时阻塞提交方而不是丢弃。
+type fileSink struct {
+	config *config.Config
+	lines  chan []byte
+	done   chan struct{}
+
+	file   *os.File
+	size   int64
+	opened time.Time
+
+	written   int64
+	rotations int64
+	errors    int64
+}
+
+// newFileSink 创建文件输出，start之前不打开文件
+func newFileSink(cfg *config.Config) *fileSink {
+	return &fileSink{
+		config: cfg,
+		lines:  make(chan []byte, cfg.FileSink.QueueSize),
+		done:   make(chan struct{}),
+	}
+}
+
+// start 打开输出文件并启动写入线程
+func (s *fileSink) start() error {
+	if err := s.open(); err != nil {
+		return err
+	}
+	go s.run()
+	log.Printf("转账文件输出已启动: %s", s.config.FileSink.Path)
+	return nil
+}
+
+// stop 写完队列中剩余的转账后关闭文件，调用前必须确保不再有append
+func (s *fileSink) stop() {
+	close(s.lines)
+	<-s.done
+}
+
+// append 提交一笔转账，序列化在调用方完成，之后对transfer的修改不影响输出
+func (s *fileSink) append(transfer *models.TransferEvent) {
+	data, err := json.Marshal(transfer)
+	if err != nil {
+		log.Printf("序列化转账 %s 失败，未写入文件: %v", transfer.TxHash, err)
+		atomic.AddInt64(&s.errors, 1)
+		return
+	}
+	if network := s.config.Network; network != "" && len(data) > 1 {
+		// 多网络时每行带上network字段，合并多个文件后仍可区分
+		prefix, _ := json.Marshal(network)
+		data = append([]byte(`{"network":`+string(prefix)+`,`), data[1:]...)
+	}
+	s.lines <- append(data, '\n')
+}
+
+// stats 返回写入统计
+func (s *fileSink) stats() map[string]interface{} {
+	return map[string]interface{}{
+		"written":   atomic.LoadInt64(&s.written),
+		"rotations": atomic.LoadInt64(&s.rotations),
+		"errors":    atomic.LoadInt64(&s.errors),
+		"queue":     len(s.lines),
+	}
+}
+
+// run 写入线程：逐行写入，按策略fsync，空闲时也检查按时间轮转
+func (s *fileSink) run() {
+	defer close(s.done)
+	defer s.close()
+
+	var syncTick <-chan time.Time
+	if s.config.FileSink.Fsync == FsyncInterval {
+		ticker := time.NewTicker(s.config.FileSink.FsyncInterval)
+		defer ticker.Stop()
+		syncTick = ticker.C
+	}
+	var ageTick <-chan time.Time
+	if s.config.FileSink.MaxAge > 0 {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		ageTick = ticker.C
+	}
+
+	for {
+		select {
+		case line, ok := <-s.lines:
+			if !ok {
+				return
+			}
+			s.write(line)
+		case <-syncTick:
+			s.sync()
+		case <-ageTick:
+			if s.file != nil && s.expired() {
+				s.rotate()
+			}
+		}
+	}
+}
+
+// write 写入一行，写入前超过大小或时间上限时先轮转
+func (s *fileSink) write(line []byte) {
+	maxBytes := s.config.FileSink.MaxBytes
+	if s.file != nil && ((maxBytes > 0 && s.size > 0 && s.size+int64(len(line)) > maxBytes) || s.expired()) {
+		s.rotate()
+	}
+	if s.file == nil {
+		// 轮转后重新打开失败，再尝试一次
+		if err := s.open(); err != nil {
+			log.Printf("转账文件不可用，丢弃一行: %v", err)
+			atomic.AddInt64(&s.errors, 1)
+			return
+		}
+	}
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		log.Printf("写入转账文件失败: %v", err)
+		atomic.AddInt64(&s.errors, 1)
+		return
+	}
+	atomic.AddInt64(&s.written, 1)
+	if s.config.FileSink.Fsync == FsyncAlways {
+		s.sync()
+	}
+}
+
+// expired 当前文件是否已写入超过file_sink.max_age（空文件不轮转）
+func (s *fileSink) expired() bool {
+	maxAge := s.config.FileSink.MaxAge
+	return maxAge > 0 && s.size > 0 && time.Since(s.opened) >= maxAge
+}
+
+// rotate 关闭当前文件并重命名为 路径.时间戳，然后打开新文件
+func (s *fileSink) rotate() {
+	path := s.config.FileSink.Path
+	s.close()
+
+	rotated := fmt.Sprintf("%s.%s", path, time.Now().Format("20060102T150405.000000000"))
+	if err := os.Rename(path, rotated); err != nil {
+		log.Printf("轮转转账文件失败，继续写入原文件: %v", err)
+		atomic.AddInt64(&s.errors, 1)
+	} else {
+		atomic.AddInt64(&s.rotations, 1)
+		log.Printf("转账文件已轮转: %s", rotated)
+	}
+
+	if err := s.open(); err != nil {
+		log.Printf("%v", err)
+		atomic.AddInt64(&s.errors, 1)
+	}
+}
+
+// open 以追加方式打开输出文件
+func (s *fileSink) open() error {
+	file, err := os.OpenFile(s.config.FileSink.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("打开转账文件失败: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("获取转账文件信息失败: %w", err)
+	}
+
+	s.file = file
+	s.size = info.Size()
+	s.opened = time.Now()
+	return nil
+}
+
+// sync 将已写入的内容刷到磁盘
+func (s *fileSink) sync() {
+	if s.file == nil {
+		return
+	}
+	if err := s.file.Sync(); err != nil {
+		log.Printf("同步转账文件失败: %v", err)
+		atomic.AddInt64(&s.errors, 1)
+	}
+}
+
+// close 刷盘并关闭当前文件
+func (s *fileSink) close() {
+	if s.file == nil {
+		return
+	}
+	s.sync()
+	if err := s.file.Close(); err != nil {
+		log.Printf("关闭转账文件失败: %v", err)
+	}
+	s.file = nil
+}
@@ -0,0 +1,168 @@
+package processor
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"tron-monitor/config"
+	"tron-monitor/models"
+)
+
+// newTestSink 创建写入临时目录的文件输出
+func newTestSink(t *testing.T, configure func(cfg *config.Config)) *fileSink {
+	t.Helper()
+	cfg := &config.Config{}
+	cfg.FileSink.Path = filepath.Join(t.TempDir(), "transfers.jsonl")
+	cfg.FileSink.Fsync = FsyncNever
+	cfg.FileSink.QueueSize = 100
+	if configure != nil {
+		configure(cfg)
+	}
+	return newFileSink(cfg)
+}
+
+// readLines 读取文件中的JSON行
+func readLines(t *testing.T, path string) []map[string]interface{} {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("无效的JSON行 %q: %v", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestFileSinkNetworkField(t *testing.T) {
+	for _, network := range []string{"", "nile"} {
+		sink := newTestSink(t, func(cfg *config.Config) { cfg.Network = network })
+		if err := sink.start(); err != nil {
+			t.Fatal(err)
+		}
+		sink.append(&models.TransferEvent{TxHash: "abc", TokenType: "TRX", Amount: 1})
+		sink.stop()
+
+		lines := readLines(t, sink.config.FileSink.Path)
+		if len(lines) != 1 || lines[0]["tx_hash"] != "abc" {
+			t.Fatalf("网络 %q: 写入内容不符: %v", network, lines)
+		}
+		got, ok := lines[0]["network"]
+		if network == "" && ok {
+			t.Errorf("未配置networks时不应有network字段: %v", lines[0])
+		}
+		if network != "" && got != network {
+			t.Errorf("network字段 %v，期望 %s", got, network)
+		}
+	}
+}
+
+// sinkFiles 按写入顺序返回输出文件：轮转出的文件按时间戳排序，当前文件在最后
+func sinkFiles(t *testing.T, path string) []string {
+	t.Helper()
+	rotated, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(rotated)
+	return append(rotated, path)
+}
+
+func TestFileSinkRotatesBySize(t *testing.T) {
+	const maxBytes = 400
+	sink := newTestSink(t, func(cfg *config.Config) {
+		cfg.FileSink.MaxBytes = maxBytes
+		cfg.FileSink.Fsync = FsyncAlways
+	})
+	if err := sink.start(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 20; i++ {
+		sink.append(&models.TransferEvent{TxHash: txID(i), TokenType: "TRX", Amount: float64(i)})
+	}
+	sink.stop()
+
+	files := sinkFiles(t, sink.config.FileSink.Path)
+	if len(files) < 3 {
+		t.Fatalf("写入20行应按 %d 字节轮转出多个文件，实际 %v", maxBytes, files)
+	}
+	var hashes []string
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() > maxBytes {
+			t.Errorf("%s 大小 %d 超过 %d", file, info.Size(), maxBytes)
+		}
+		for _, line := range readLines(t, file) {
+			hashes = append(hashes, line["tx_hash"].(string))
+		}
+	}
+
+	// 每笔转账一行，轮转不丢失也不重复，顺序与提交顺序一致
+	if len(hashes) != 20 {
+		t.Fatalf("应写入20行，实际 %d 行", len(hashes))
+	}
+	for i, hash := range hashes {
+		if hash != txID(i+1) {
+			t.Fatalf("第 %d 行为 %s，期望 %s", i+1, hash, txID(i+1))
+		}
+	}
+	stats := sink.stats()
+	if stats["written"].(int64) != 20 || stats["rotations"].(int64) != int64(len(files)-1) || stats["errors"].(int64) != 0 {
+		t.Errorf("写入统计不符: %v（文件 %d 个）", stats, len(files))
+	}
+}
+
+func TestFileSinkRotatesByAge(t *testing.T) {
+	sink := newTestSink(t, func(cfg *config.Config) { cfg.FileSink.MaxAge = 50 * time.Millisecond })
+	if err := sink.start(); err != nil {
+		t.Fatal(err)
+	}
+	sink.append(&models.TransferEvent{TxHash: txID(1), TokenType: "TRX"})
+	time.Sleep(100 * time.Millisecond)
+	sink.append(&models.TransferEvent{TxHash: txID(2), TokenType: "TRX"})
+	sink.stop()
+
+	files := sinkFiles(t, sink.config.FileSink.Path)
+	if len(files) != 2 {
+		t.Fatalf("超过max_age后应轮转，实际文件 %v", files)
+	}
+	for i, file := range files {
+		if lines := readLines(t, file); len(lines) != 1 || lines[0]["tx_hash"] != txID(i+1) {
+			t.Errorf("%s 内容不符: %v", file, lines)
+		}
+	}
+}
+
+// 重新启动时追加到已有文件，并按已有大小判断轮转
+func TestFileSinkAppendsToExistingFile(t *testing.T) {
+	sink := newTestSink(t, nil)
+	for i := 1; i <= 2; i++ {
+		if err := sink.start(); err != nil {
+			t.Fatal(err)
+		}
+		sink.append(&models.TransferEvent{TxHash: txID(i), TokenType: "TRX"})
+		sink.stop()
+		sink = newFileSink(sink.config)
+	}
+
+	lines := readLines(t, sink.config.FileSink.Path)
+	if len(lines) != 2 || lines[0]["tx_hash"] != txID(1) || lines[1]["tx_hash"] != txID(2) {
+		t.Errorf("重启后应追加写入: %v", lines)
+	}
+}
@@ -0,0 +1,137 @@
+package processor
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"tron-monitor/config"
+	"tron-monitor/models"
+	"tron-monitor/redis"
+	"tron-monitor/tronaddr"
+)
+
+// 测试用地址（base58校验和有效）
+const (
+	testWatchAddr = "TJRabPrwbZy45sbavfcjinPJC18kjpRTv8"
+	testOtherAddr = "TUpMhErZL2fhh4sVNULAbNKLokS4GjC1F4"
+	testUSDTAddr  = "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t"
+)
+
+// loadTestConfig 按默认值加载配置，extra为追加的YAML片段
+func loadTestConfig(t testing.TB, extra string) *config.Config {
+	t.Helper()
+	yaml := "watch_addresses:\n  - \"" + testWatchAddr + "\"\n" + extra
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.LoadConfig(path)
+	if err != nil {
+		t.Fatalf("加载测试配置失败: %v", err)
+	}
+	return cfg
+}
+
+// newTestRedis 启动内存Redis并连接，监控地址按配置写入
+func newTestRedis(t testing.TB, cfg *config.Config) *redis.RedisClient {
+	t.Helper()
+	server := miniredis.RunT(t)
+	cfg.Redis.Addr = server.Addr()
+	client, err := redis.NewRedisClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	for _, addr := range cfg.WatchAddresses {
+		if err := client.AddWatchAddress(context.Background(), models.WatchAddress{Address: addr}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return client
+}
+
+// hexAddress base58地址转为区块中使用的41前缀十六进制
+func hexAddress(t testing.TB, address string) string {
+	t.Helper()
+	hexAddr, err := tronaddr.Base58ToHex(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hexAddr
+}
+
+// trxTransferTx 构造TRX转账交易
+func trxTransferTx(t testing.TB, txID, from, to string, sun int64) *models.Transaction {
+	return contractTx(txID, "TransferContract", map[string]interface{}{
+		"owner_address": hexAddress(t, from),
+		"to_address":    hexAddress(t, to),
+		"amount":        float64(sun),
+	})
+}
+
+// trc20TransferTx 构造调用transfer(address,uint256)的TRC20转账交易
+func trc20TransferTx(t testing.TB, txID, contract, from, to string, amount int64) *models.Transaction {
+	toHex := strings.TrimPrefix(hexAddress(t, to), "41")
+	data := "a9059cbb" + strings.Repeat("0", 24) + toHex + fmt.Sprintf("%064x", big.NewInt(amount))
+	return contractTx(txID, "TriggerSmartContract", map[string]interface{}{
+		"owner_address":    hexAddress(t, from),
+		"contract_address": hexAddress(t, contract),
+		"data":             data,
+	})
+}
+
+func contractTx(txID, contractType string, value map[string]interface{}) *models.Transaction {
+	return &models.Transaction{
+		TxID: txID,
+		RawData: &models.TransactionRaw{
+			Contract: []*models.Contract{{
+				Type: contractType,
+				Parameter: map[string]interface{}{
+					"value":    value,
+					"type_url": "type.googleapis.com/protocol." + contractType,
+				},
+			}},
+		},
+		Ret: []*models.TransactionResult{{ContractRet: models.ContractResultSuccess}},
+	}
+}
+
+// testBlock 构造包含指定交易的区块，经JSON往返以与接口返回的数据结构一致
+func testBlock(t testing.TB, height int64, txs ...*models.Transaction) *models.BlockData {
+	t.Helper()
+	blockData := &models.BlockData{
+		Height:    height,
+		BlockHash: fmt.Sprintf("%064x", height),
+		Timestamp: 1700000000000 + height*3000,
+		Block: &models.Block{
+			BlockHeader: &models.BlockHeader{RawData: &models.BlockHeaderRaw{Number: height}},
+			Trans:       txs,
+		},
+	}
+	if blockData.Block.Trans == nil {
+		blockData.Block.Trans = []*models.Transaction{}
+	}
+	data, err := json.Marshal(blockData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded models.BlockData
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	return &decoded
+}
+
+// txID 生成固定格式的交易哈希
+func txID(n int) string {
+	return hex.EncodeToString([]byte(fmt.Sprintf("%032d", n)))
+}
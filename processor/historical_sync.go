@@ -0,0 +1,171 @@
+package processor
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+// syncChunk 历史同步的一个分块，块内按顺序处理
+type syncChunk struct {
+	start, end int64
+	done       int64 // 从start开始连续分发成功的区块数，atomic读写
+}
+
+// historicalSync 一次历史区块同步的进度
+//
+// 各分块独立记录进度，watermark为从起点开始连续完成的最高区块，是唯一可以安全作为游标的位置。
+type historicalSync struct {
+	chunks []*syncChunk
+	total  int64
+}
+
+// newHistoricalSync 按chunkSize把范围切分为分块
+func newHistoricalSync(startBlock, endBlock, chunkSize int64) *historicalSync {
+	s := &historicalSync{total: endBlock - startBlock + 1}
+	for chunkStart := startBlock; chunkStart <= endBlock; chunkStart += chunkSize {
+		chunkEnd := chunkStart + chunkSize - 1
+		if chunkEnd > endBlock {
+			chunkEnd = endBlock
+		}
+		s.chunks = append(s.chunks, &syncChunk{start: chunkStart, end: chunkEnd})
+	}
+	return s
+}
+
+// progress 汇总各分块进度，返回已处理区块数和连续完成的最高区块（一个都没完成时为起点-1）
+func (s *historicalSync) progress() (done, watermark int64) {
+	watermark = s.chunks[0].start - 1
+	contiguous := true
+	for _, chunk := range s.chunks {
+		chunkDone := atomic.LoadInt64(&chunk.done)
+		done += chunkDone
+		if contiguous {
+			watermark = chunk.start + chunkDone - 1
+			contiguous = chunk.start+chunkDone > chunk.end
+		}
+	}
+	return done, watermark
+}
+
+// stats 同步进度统计
+func (s *historicalSync) stats() map[string]interface{} {
+	done, watermark := s.progress()
+	return map[string]interface{}{
+		"from":      s.chunks[0].start,
+		"to":        s.chunks[len(s.chunks)-1].end,
+		"total":     s.total,
+		"done":      done,
+		"watermark": watermark,
+	}
+}
+
+// runHistoricalSync 用monitor.historical_workers个协程并发处理各分块
+//
+// queue模式下每个协程开始新分块前等待队列降到 分块大小×协程数 以下，限制同时涌入Redis的区块数。
+// 任一分块失败后不再分发新分块，失败分块之后的分块处理完当前区块后停止，之前的分块继续处理完，
+// 使水位尽量推进到失败的区块之前。返回连续完成的最高区块，
+// 调用方从其下一个区块重试；水位之后已分发的区块会被再次分发，由转账去重保证幂等。
+func (bm *BlockMonitor) runHistoricalSync(s *historicalSync) (int64, error) {
+	workers := bm.config.Monitor.HistoricalWorkers
+	if workers > len(s.chunks) {
+		workers = len(s.chunks)
+	}
+	queueLimit := bm.config.Monitor.HistoricalChunkSize * int64(workers)
+
+	chunks := make(chan *syncChunk)
+	failed := make(chan struct{})
+	var (
+		wg       sync.WaitGroup
+		errMu    sync.Mutex
+		firstErr error
+		failedAt int64 // 失败分块中最小的起点，failed关闭后只读
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chunk := range chunks {
+				if err := bm.syncChunk(chunk, queueLimit, failed, &failedAt); err != nil {
+					errMu.Lock()
+					if firstErr == nil {
+						firstErr = err
+						atomic.StoreInt64(&failedAt, chunk.start)
+						close(failed)
+					} else if chunk.start < atomic.LoadInt64(&failedAt) {
+						atomic.StoreInt64(&failedAt, chunk.start)
+					}
+					errMu.Unlock()
+					return
+				}
+			}
+		}()
+	}
+
+feed:
+	for i, chunk := range s.chunks {
+		if i > 0 {
+			log.Printf("处理历史区块分块: %d - %d", chunk.start, chunk.end)
+		}
+		select {
+		case chunks <- chunk:
+		case <-failed:
+			break feed
+		case <-bm.ctx.Done():
+			break feed
+		}
+	}
+	close(chunks)
+	wg.Wait()
+
+	_, watermark := s.progress()
+	if firstErr != nil {
+		return watermark, firstErr
+	}
+	if bm.ctx.Err() != nil {
+		return watermark, fmt.Errorf("处理被中断")
+	}
+	return watermark, nil
+}
+
+// syncChunk 按顺序处理一个分块，获取或分发失败时停止，chunk.done只计入成功分发的区块
+//
+// 起点在失败分块（failedAt）之后的分块在failed关闭后也停止，避免水位已卡住后继续分发；
+// 之前的分块继续处理，它们完成后水位才能推进到失败的区块之前。
+func (bm *BlockMonitor) syncChunk(chunk *syncChunk, queueLimit int64, failed <-chan struct{}, failedAt *int64) error {
+	// direct模式没有队列，不需要等待
+	if bm.directHandler == nil {
+		if err := bm.waitForQueueBelow(queueLimit); err != nil {
+			return err
+		}
+	}
+
+	for blockNum := chunk.start; blockNum <= chunk.end; blockNum++ {
+		select {
+		case <-bm.ctx.Done():
+			return fmt.Errorf("处理被中断")
+		case <-failed:
+			if chunk.start > atomic.LoadInt64(failedAt) {
+				return nil
+			}
+		default:
+		}
+
+		// 获取区块数据
+		blockData, err := bm.source.BlockByNumber(bm.ctx, blockNum)
+		if err != nil {
+			log.Printf("获取区块 %d 失败: %v", blockNum, err)
+			return fmt.Errorf("获取区块 %d 失败: %w", blockNum, err)
+		}
+		// 推送区块数据到Redis队列（direct模式直接处理）
+		if err := bm.dispatch(blockData); err != nil {
+			log.Printf("推送区块 %d 到队列失败: %v", blockNum, err)
+			return fmt.Errorf("推送区块 %d 到队列失败: %w", blockNum, err)
+		}
+		log.Printf("已处理历史区块 %d", blockNum)
+
+		atomic.AddInt64(&chunk.done, 1)
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"tron-monitor/config"
+	"tron-monitor/models"
+)
+
+// fakeBlockSource 按高度生成空区块，fail中的高度返回错误
+type fakeBlockSource struct {
+	tip  int64
+	fail map[int64]bool
+}
+
+func (s *fakeBlockSource) LatestBlock(ctx context.Context) (*models.BlockData, error) {
+	return &models.BlockData{Height: s.tip}, nil
+}
+
+func (s *fakeBlockSource) BlockByNumber(ctx context.Context, height int64) (*models.BlockData, error) {
+	if s.fail[height] {
+		return nil, fmt.Errorf("区块 %d 不可用", height)
+	}
+	return &models.BlockData{Height: height}, nil
+}
+
+// dispatchRecorder 记录direct模式下每个区块被分发的次数
+type dispatchRecorder struct {
+	mu     sync.Mutex
+	counts map[int64]int
+}
+
+func (r *dispatchRecorder) handle(blockData *models.BlockData) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.counts[blockData.Height]++
+	return nil
+}
+
+func newTestMonitor(source BlockSource, workers int, chunkSize int64) (*BlockMonitor, *dispatchRecorder) {
+	cfg := &config.Config{}
+	cfg.Monitor.Mode = MonitorModeDirect
+	cfg.Monitor.HistoricalWorkers = workers
+	cfg.Monitor.HistoricalChunkSize = chunkSize
+	cfg.Monitor.CatchUpThreshold = 10
+	cfg.Monitor.CatchUpBatch = 1000
+
+	ctx, cancel := context.WithCancel(context.Background())
+	recorder := &dispatchRecorder{counts: make(map[int64]int)}
+	bm := &BlockMonitor{config: cfg, source: source, ctx: ctx, cancel: cancel}
+	bm.SetDirectHandler(recorder.handle)
+	return bm, recorder
+}
+
+func TestHistoricalSyncDispatchesEachBlockOnce(t *testing.T) {
+	const start, end = 1000, 50999
+	bm, recorder := newTestMonitor(&fakeBlockSource{tip: end}, 8, 700)
+	defer bm.cancel()
+
+	watermark, err := bm.ProcessHistoricalBlocks(start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if watermark != end {
+		t.Errorf("水位 %d，期望 %d", watermark, end)
+	}
+	if len(recorder.counts) != end-start+1 {
+		t.Errorf("分发了 %d 个不同区块，期望 %d", len(recorder.counts), end-start+1)
+	}
+	for height, count := range recorder.counts {
+		if height < start || height > end || count != 1 {
+			t.Fatalf("区块 %d 被分发 %d 次", height, count)
+		}
+	}
+	if done, _ := bm.historical.progress(); done != end-start+1 {
+		t.Errorf("进度 done=%d，期望 %d", done, end-start+1)
+	}
+}
+
+func TestHistoricalSyncWatermarkStopsAtFailure(t *testing.T) {
+	source := &fakeBlockSource{tip: 1999, fail: map[int64]bool{1250: true}}
+	bm, recorder := newTestMonitor(source, 4, 100)
+	defer bm.cancel()
+
+	watermark, err := bm.ProcessHistoricalBlocks(1000, 1999)
+	if err == nil {
+		t.Fatal("区块获取失败时应返回错误")
+	}
+	if watermark != 1249 {
+		t.Errorf("水位 %d，期望停在失败区块之前 1249", watermark)
+	}
+	if recorder.counts[1250] != 0 {
+		t.Errorf("失败的区块不应被分发")
+	}
+	for height := int64(1000); height <= watermark; height++ {
+		if recorder.counts[height] != 1 {
+			t.Fatalf("水位以内的区块 %d 被分发 %d 次", height, recorder.counts[height])
+		}
+	}
+
+	// 从水位之后重试，失败的区块恢复后全部补齐
+	delete(source.fail, 1250)
+	watermark, err = bm.ProcessHistoricalBlocks(watermark+1, 1999)
+	if err != nil || watermark != 1999 {
+		t.Fatalf("重试后水位 %d，错误 %v", watermark, err)
+	}
+	for height := int64(1000); height <= 1999; height++ {
+		if recorder.counts[height] == 0 {
+			t.Fatalf("区块 %d 未被分发", height)
+		}
+	}
+}
+
+func TestCatchUpUsesHistoricalWorkers(t *testing.T) {
+	bm, recorder := newTestMonitor(&fakeBlockSource{tip: 5000}, 4, 1000)
+	defer bm.cancel()
+	bm.lastProcessedBlock.Store(2000)
+
+	if err := bm.catchUp(5000); err != nil {
+		t.Fatal(err)
+	}
+	if bm.lastProcessedBlock.Load() != 3000 {
+		t.Errorf("追赶一轮后游标 %d，期望 3000", bm.lastProcessedBlock.Load())
+	}
+	if len(bm.historical.chunks) != 4 {
+		t.Errorf("本轮应分为4个分块，实际 %d 个", len(bm.historical.chunks))
+	}
+	for height := int64(2001); height <= 3000; height++ {
+		if recorder.counts[height] != 1 {
+			t.Fatalf("区块 %d 被分发 %d 次", height, recorder.counts[height])
+		}
+	}
+}
+
+// direct模式的工作线程有逐交易状态，并发调用时每个协程必须使用独立的工作线程
+func TestDirectWorkersNotShared(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Monitor.Mode = MonitorModeDirect
+	cfg.Monitor.HistoricalWorkers = 3
+	bp := NewBlockProcessor(cfg, nil, nil, nil)
+	defer bp.cancel()
+
+	seen := make(map[*BlockWorker]bool)
+	for i := 0; i < cap(bp.direct); i++ {
+		seen[<-bp.direct] = true
+	}
+	if len(seen) != 3 {
+		t.Errorf("direct工作线程池应有3个独立工作线程，实际 %d 个", len(seen))
+	}
+}
+
+func TestProcessHistoricalBlocksValidatesRange(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		start, end int64
+		want       string
+	}{
+		{"inverted", 2000, 1000, "大于结束区块"},
+		{"negative start", -1, 1000, "不能为负数"},
+		{"negative end", 0, -5, "不能为负数"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			bm, recorder := newTestMonitor(&fakeBlockSource{tip: 5000}, 4, 100)
+			defer bm.cancel()
+
+			watermark, err := bm.ProcessHistoricalBlocks(tc.start, tc.end)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("错误 %v，期望包含 %q", err, tc.want)
+			}
+			if watermark != 0 || len(recorder.counts) != 0 {
+				t.Errorf("无效范围不应分发区块: 水位 %d，分发 %d 个", watermark, len(recorder.counts))
+			}
+		})
+	}
+}
+
+// 超过historical_chunk_size的范围按分块处理，分块连续且不重叠
+func TestProcessHistoricalBlocksChunksLargeSpan(t *testing.T) {
+	const start, end = 1000, 3499
+	bm, recorder := newTestMonitor(&fakeBlockSource{tip: end}, 4, 1000)
+	defer bm.cancel()
+
+	watermark, err := bm.ProcessHistoricalBlocks(start, end)
+	if err != nil || watermark != end {
+		t.Fatalf("水位 %d，错误 %v", watermark, err)
+	}
+	var spans []string
+	for _, chunk := range bm.historical.chunks {
+		spans = append(spans, fmt.Sprintf("%d-%d", chunk.start, chunk.end))
+	}
+	if got, want := strings.Join(spans, ","), "1000-1999,2000-2999,3000-3499"; got != want {
+		t.Errorf("分块 %s，期望 %s", got, want)
+	}
+	if len(recorder.counts) != end-start+1 {
+		t.Errorf("分发了 %d 个区块，期望 %d", len(recorder.counts), end-start+1)
+	}
+
+	// 超过max_backfill_span时拒绝，除非设置force_backfill
+	bm.config.Monitor.MaxBackfillSpan = 1000
+	if _, err := bm.ProcessHistoricalBlocks(start, end); err == nil || !strings.Contains(err.Error(), "超过安全上限") {
+		t.Errorf("超过max_backfill_span应拒绝，实际错误 %v", err)
+	}
+	bm.config.Monitor.ForceBackfill = true
+	if _, err := bm.ProcessHistoricalBlocks(start, end); err != nil {
+		t.Errorf("force_backfill时应允许，实际错误 %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package processor
+
+import (
+	"strings"
+
+	"tron-monitor/models"
+	"tron-monitor/tronaddr"
+)
+
+// watchPrefilter 交易预检，在完整解码前用字符串查找判断交易是否引用了监控地址
+//
+// 区块中的地址字段已统一为base58，直接按集合查找；调用数据（data）仍为十六进制，
+// 按32字节参数逐个取低20字节与监控地址的十六进制形式比较。解码器产生的转账双方
+// 一定来自这两处（owner_address/to_address或transfer的to参数），因此预检不会漏掉匹配。
+type watchPrefilter struct {
+	base58 map[string]bool
+	hex    map[string]bool // 20字节地址的十六进制，小写，不带41前缀
+}
+
+// newWatchPrefilter 根据监控地址集合创建预检器，无法解析的地址只按base58匹配
+func newWatchPrefilter(watchAddressSet map[string]bool) *watchPrefilter {
+	p := &watchPrefilter{
+		base58: watchAddressSet,
+		hex:    make(map[string]bool, len(watchAddressSet)),
+	}
+	for address := range watchAddressSet {
+		if addressHex, err := tronaddr.Base58ToHex(address); err == nil {
+			p.hex[addressHex[2:]] = true
+		}
+	}
+	return p
+}
+
+// references 判断交易是否可能涉及监控地址，无法判断时返回true
+func (p *watchPrefilter) references(tx *models.Transaction) bool {
+	if tx.RawData == nil {
+		return false
+	}
+	for _, contract := range tx.RawData.Contract {
+		if contract.Parameter == nil {
+			return true
+		}
+		if p.scan(contract.Parameter) {
+			return true
+		}
+	}
+	return false
+}
+
+// scan 递归检查参数中的所有字符串
+func (p *watchPrefilter) scan(value interface{}) bool {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, field := range v {
+			if p.scan(field) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if p.scan(item) {
+				return true
+			}
+		}
+	case string:
+		return p.matchString(v)
+	}
+	return false
+}
+
+// matchString 检查单个字符串：base58地址、带41前缀的十六进制地址或调用数据中的地址参数
+func (p *watchPrefilter) matchString(s string) bool {
+	if p.base58[s] {
+		return true
+	}
+
+	s = strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X"))
+	if len(s) == 42 && strings.HasPrefix(s, "41") && p.hex[s[2:]] {
+		return true
+	}
+
+	// 调用数据: 4字节选择器 + 若干32字节参数，地址参数位于低20字节
+	if len(s) < 8+64 {
+		return false
+	}
+	for i := 8; i+64 <= len(s); i += 64 {
+		if p.hex[s[i+24:i+64]] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"tron-monitor/models"
+	"tron-monitor/tronaddr"
+)
+
+// newPrefilterTestProcessor 创建queue模式的处理器，按prefilter开关watch_only_prefilter
+func newPrefilterTestProcessor(t testing.TB, prefilter bool) *BlockProcessor {
+	cfg := loadTestConfig(t, fmt.Sprintf("monitor:\n  mode: queue\n  worker_count: 1\n  watch_only_prefilter: %v\n", prefilter))
+	return NewBlockProcessor(cfg, newTestRedis(t, cfg), nil, nil)
+}
+
+// prefilterBlock 构造n笔交易的区块，每related笔中有一笔涉及监控地址，依次覆盖TRX和TRC20的发送方与接收方
+func prefilterBlock(t testing.TB, height int64, n, related int) *models.BlockData {
+	txs := make([]*models.Transaction, n)
+	for i := range txs {
+		id := txID(i + 1)
+		if i%related != 0 {
+			if i%2 == 0 {
+				txs[i] = trxTransferTx(t, id, testOtherAddr, testUSDTAddr, int64(i+1))
+			} else {
+				txs[i] = trc20TransferTx(t, id, testUSDTAddr, testOtherAddr, testUSDTAddr, int64(i+1))
+			}
+			continue
+		}
+		switch (i / related) % 4 {
+		case 0:
+			txs[i] = trxTransferTx(t, id, testOtherAddr, testWatchAddr, int64(i+1))
+		case 1:
+			txs[i] = trxTransferTx(t, id, testWatchAddr, testOtherAddr, int64(i+1))
+		case 2:
+			txs[i] = trc20TransferTx(t, id, testUSDTAddr, testOtherAddr, testWatchAddr, int64(i+1))
+		default:
+			txs[i] = trc20TransferTx(t, id, testUSDTAddr, testWatchAddr, testOtherAddr, int64(i+1))
+		}
+	}
+	return testBlock(t, height, txs...)
+}
+
+// watchedTxHashes 返回已保存的涉及监控地址的转账的交易哈希（最新在前）
+func watchedTxHashes(t testing.TB, bp *BlockProcessor) []string {
+	t.Helper()
+	events, err := bp.redisClient.GetRecentTransfers(context.Background(), 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hashes []string
+	for _, event := range events {
+		if event.Source == testWatchAddr || event.Destination == testWatchAddr {
+			hashes = append(hashes, event.TxHash)
+		}
+	}
+	return hashes
+}
+
+// 预检不能跳过任何涉及监控地址的交易：开启前后保存的监控地址转账一致
+func TestWatchPrefilterNeverSkipsMatches(t *testing.T) {
+	full := newPrefilterTestProcessor(t, false)
+	if err := full.workers[0].processBlock(prefilterBlock(t, 100, 40, 3)); err != nil {
+		t.Fatal(err)
+	}
+	want := watchedTxHashes(t, full)
+
+	filtered := newPrefilterTestProcessor(t, true)
+	if err := filtered.workers[0].processBlock(prefilterBlock(t, 100, 40, 3)); err != nil {
+		t.Fatal(err)
+	}
+	got := watchedTxHashes(t, filtered)
+
+	if len(want) != 14 || strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("预检后保存的监控地址转账不一致:\ngot:  %v\nwant: %v", got, want)
+	}
+	if skipped := filtered.GetStats()["skipped_txs"].(int64); skipped != 40-14 {
+		t.Errorf("应跳过 %d 笔无关交易，实际 %d", 40-14, skipped)
+	}
+}
+
+// 预检同时识别base58地址、带41前缀的十六进制地址和调用数据中的地址参数
+func TestWatchPrefilterMatchesAddressForms(t *testing.T) {
+	p := newWatchPrefilter(map[string]bool{testWatchAddr: true})
+	watchHex, err := tronaddr.Base58ToHex(testWatchAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := "a9059cbb" + strings.Repeat("0", 24) + watchHex[2:] + fmt.Sprintf("%064x", 1)
+
+	for _, s := range []string{testWatchAddr, watchHex, strings.ToUpper(watchHex), "0x" + watchHex, data} {
+		if !p.matchString(s) {
+			t.Errorf("应匹配 %s", s)
+		}
+	}
+	otherHex, err := tronaddr.Base58ToHex(testOtherAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{testOtherAddr, otherHex, strings.ToLower(testWatchAddr)} {
+		if p.matchString(s) {
+			t.Errorf("不应匹配 %s", s)
+		}
+	}
+}
+
+func BenchmarkWatchPrefilter(b *testing.B) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	for _, prefilter := range []bool{false, true} {
+		b.Run(fmt.Sprintf("prefilter=%v", prefilter), func(b *testing.B) {
+			bp := newPrefilterTestProcessor(b, prefilter)
+			block := prefilterBlock(b, 100, 200, 50)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := bp.workers[0].processBlock(block); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+
+	"tron-monitor/models"
+)
+
+// saveJob 交给保存线程的一条转账
+type saveJob struct {
+	transfer        *models.TransferEvent
+	blockData       *models.BlockData
+	watchAddressSet map[string]bool
+	addressGroups   map[string]string
+	done            *sync.WaitGroup
+
+	// 同一区块的转账按提交顺序写入：等待prev关闭后才保存，保存完成（或放弃）后关闭saved
+	prev  <-chan struct{}
+	saved chan struct{}
+}
+
+// savePipeline 保存阶段：解码线程只负责提取转账，标签、余额、保存和通知由独立的保存线程完成
+//
+// 解码线程等待本区块的转账全部保存后才返回，处理游标、重试和死信语义与不拆分时一致。
+// 标签、分组和余额查询由多个保存线程并行完成；写入Redis、文件输出和通知按区块内的顺序依次进行，
+// 转账列表中同一区块的顺序与不拆分时相同。
+//
+// 保存线程使用独立的上下文：停止时先取消解码线程，再用未取消的上下文保存完队列中的转账，最后才取消。
+type savePipeline struct {
+	jobs    chan *saveJob
+	workers []*BlockWorker
+	wg      sync.WaitGroup
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// newSavePipeline 创建保存阶段，保存线程编号接在解码线程之后
+func newSavePipeline(bp *BlockProcessor, workerCount, queueSize int) *savePipeline {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &savePipeline{
+		jobs:    make(chan *saveJob, queueSize),
+		workers: make([]*BlockWorker, workerCount),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	for i := range p.workers {
+		p.workers[i] = &BlockWorker{
+			id:        bp.config.Monitor.WorkerCount + i,
+			processor: bp,
+			ctx:       ctx,
+		}
+	}
+	return p
+}
+
+// start 启动所有保存线程
+func (p *savePipeline) start() {
+	for _, worker := range p.workers {
+		p.wg.Add(1)
+		go func(w *BlockWorker) {
+			defer p.wg.Done()
+			for job := range p.jobs {
+				w.saveJobSafe(job)
+			}
+		}(worker)
+	}
+	log.Printf("保存线程已启动，线程数: %d，队列大小: %d", len(p.workers), cap(p.jobs))
+}
+
+// stop 在解码线程全部退出后调用，用未取消的上下文保存完队列中剩余的转账再返回
+func (p *savePipeline) stop() {
+	close(p.jobs)
+	p.wg.Wait()
+	p.cancel()
+	log.Println("保存线程已停止")
+}
+
+// submit 将区块的转账交给保存线程并等待全部保存完成
+//
+// 停止时未能全部提交则返回错误，区块不算处理完成；已提交的部分仍会保存完再返回。
+func (w *BlockWorker) submit(pipeline *savePipeline, transfers []*models.TransferEvent, blockData *models.BlockData, watchAddressSet map[string]bool, addressGroups map[string]string) error {
+	var done sync.WaitGroup
+	prev := make(chan struct{})
+	close(prev)
+
+	for i, transfer := range transfers {
+		job := &saveJob{
+			transfer:        transfer,
+			blockData:       blockData,
+			watchAddressSet: watchAddressSet,
+			addressGroups:   addressGroups,
+			done:            &done,
+			prev:            prev,
+			saved:           make(chan struct{}),
+		}
+
+		done.Add(1)
+		select {
+		case pipeline.jobs <- job:
+			prev = job.saved
+		case <-w.ctx.Done():
+			done.Done()
+			done.Wait()
+			return fmt.Errorf("区块 %d 只提交了 %d/%d 笔转账: %w", blockData.Height, i, len(transfers), w.ctx.Err())
+		}
+	}
+	done.Wait()
+	return nil
+}
+
+// saveJobSafe 保存一条转账，捕获panic以免保存线程退出导致解码线程一直等待
+func (w *BlockWorker) saveJobSafe(job *saveJob) {
+	defer job.done.Done()
+	defer close(job.saved)
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("工作线程 %d: 保存转账 %s 时发生panic: %v\n%s", w.id, job.transfer.TxHash, r, debug.Stack())
+			atomic.AddInt64(&w.processor.workerPanics, 1)
+			atomic.AddInt64(&w.processor.errors, 1)
+		}
+	}()
+
+	w.enrichTransfer(job.transfer, job.watchAddressSet, job.addressGroups)
+	<-job.prev
+	w.commitTransfer(job.transfer, job.blockData, job.watchAddressSet)
+}
@@ -0,0 +1,163 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"tron-monitor/models"
+)
+
+// manyTransfersBlock 构造包含n笔监控地址TRX转账的区块
+func manyTransfersBlock(t testing.TB, height int64, n int) *models.BlockData {
+	txs := make([]*models.Transaction, n)
+	for i := range txs {
+		txs[i] = trxTransferTx(t, txID(i+1), testOtherAddr, testWatchAddr, int64(i+1))
+	}
+	return testBlock(t, height, txs...)
+}
+
+// recentTxHashes 按转账列表顺序（最新在前）返回交易哈希
+func recentTxHashes(t testing.TB, bp *BlockProcessor) []string {
+	t.Helper()
+	events, err := bp.redisClient.GetRecentTransfers(context.Background(), 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashes := make([]string, len(events))
+	for i, event := range events {
+		hashes[i] = event.TxHash
+	}
+	return hashes
+}
+
+// newSaveTestProcessor 创建queue模式的处理器，saveWorkers为0时在解码线程内保存
+func newSaveTestProcessor(t testing.TB, saveWorkers, saveQueueSize int) *BlockProcessor {
+	cfg := loadTestConfig(t, fmt.Sprintf("monitor:\n  mode: queue\n  worker_count: 1\n  save_workers: %d\n  save_queue_size: %d\n", saveWorkers, saveQueueSize))
+	return NewBlockProcessor(cfg, newTestRedis(t, cfg), nil, nil)
+}
+
+func TestSavePipelinePreservesBlockOrder(t *testing.T) {
+	block := manyTransfersBlock(t, 100, 50)
+
+	inline := newSaveTestProcessor(t, 0, 1000)
+	if err := inline.workers[0].processBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	want := recentTxHashes(t, inline)
+
+	pipelined := newSaveTestProcessor(t, 8, 1000)
+	pipelined.saves.start()
+	if err := pipelined.workers[0].processBlock(manyTransfersBlock(t, 100, 50)); err != nil {
+		t.Fatal(err)
+	}
+	pipelined.saves.stop()
+	got := recentTxHashes(t, pipelined)
+
+	if len(want) != 50 || strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("保存线程写入顺序与解码线程内保存不一致:\ngot:  %v\nwant: %v", got, want)
+	}
+}
+
+func TestSavePipelineStopDrainsWithLiveContext(t *testing.T) {
+	bp := newSaveTestProcessor(t, 1, 1)
+	block := manyTransfersBlock(t, 100, 2)
+	first, second := block.Block.Trans[0], block.Block.Trans[1]
+	events := make(map[string]*models.TransferEvent)
+	for _, tx := range []*models.Transaction{first, second} {
+		events[tx.TxID] = &models.TransferEvent{TxHash: tx.TxID, BlockHeight: 100, TokenType: "TRX", Source: testOtherAddr, Destination: testWatchAddr, Amount: 1}
+	}
+
+	// 第一笔已在保存队列中，队列已满
+	var done sync.WaitGroup
+	done.Add(1)
+	prev := make(chan struct{})
+	close(prev)
+	bp.saves.jobs <- &saveJob{transfer: events[first.TxID], blockData: block, done: &done, prev: prev, saved: make(chan struct{})}
+
+	// 停止时先取消解码线程：未提交的转账使区块处理失败，而不是当作已完成
+	bp.cancel()
+	err := bp.workers[0].submit(bp.saves, []*models.TransferEvent{events[second.TxID]}, block, nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "0/1") {
+		t.Fatalf("取消后提交应返回错误，实际: %v", err)
+	}
+
+	// 队列中的转账用保存线程自己的上下文保存，不受解码线程取消影响
+	bp.saves.start()
+	bp.saves.stop()
+	done.Wait()
+	if got := recentTxHashes(t, bp); len(got) != 1 || got[0] != first.TxID {
+		t.Errorf("停止时应保存完队列中的转账，实际保存: %v", got)
+	}
+}
+
+func TestRequeueOnStop(t *testing.T) {
+	bp := newSaveTestProcessor(t, 1, 1)
+	block := manyTransfersBlock(t, 100, 1)
+	bp.cancel()
+	bp.workers[0].requeueOnStop(block, context.Canceled)
+
+	if size, err := bp.redisClient.GetQueueSize(context.Background()); err != nil || size != 1 {
+		t.Fatalf("停止时未处理完的区块应放回队列，队列长度 %d，错误 %v", size, err)
+	}
+	if cursor, _ := bp.cursor.snapshot(); cursor != 0 {
+		t.Errorf("放回队列的区块不应推进游标，游标 %d", cursor)
+	}
+}
+
+// BenchmarkProcessBlockSaveWorkers 比较解码线程内保存与独立保存线程处理同一区块的耗时
+func BenchmarkProcessBlockSaveWorkers(b *testing.B) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	for _, saveWorkers := range []int{0, 4, 16} {
+		b.Run(fmt.Sprintf("save_workers=%d", saveWorkers), func(b *testing.B) {
+			bp := newSaveTestProcessor(b, saveWorkers, 1000)
+			if bp.saves != nil {
+				bp.saves.start()
+				defer bp.saves.stop()
+			}
+			block := manyTransfersBlock(b, 100, 200)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := bp.workers[0].processBlock(block); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestMaxTransfersPerBlock(t *testing.T) {
+	tests := []struct {
+		name          string
+		transfers     int
+		wantSaved     int
+		wantTruncated int64
+	}{
+		{"超过上限时截断", 8, 5, 1},
+		{"恰好等于上限时不截断", 5, 5, 0},
+		{"低于上限", 3, 3, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bp := newSaveTestProcessor(t, 0, 1000)
+			bp.config.Monitor.MaxTransfersPerBlock = 5
+			if err := bp.workers[0].processBlock(manyTransfersBlock(t, 100, tt.transfers)); err != nil {
+				t.Fatal(err)
+			}
+			if saved := recentTxHashes(t, bp); len(saved) != tt.wantSaved {
+				t.Errorf("保存 %d 笔转账，期望 %d 笔", len(saved), tt.wantSaved)
+			}
+			if truncated := bp.GetStats()["truncated_blocks"].(int64); truncated != tt.wantTruncated {
+				t.Errorf("truncated_blocks = %d，期望 %d", truncated, tt.wantTruncated)
+			}
+		})
+	}
+}
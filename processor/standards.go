@@ -0,0 +1,91 @@
+package processor
+
+import (
+	"fmt"
+	"strings"
+
+	"tron-monitor/models"
+)
+
+// 合约标准，与TokenType不同，用于区分同质化代币和NFT
+const (
+	StandardTRC20   = "TRC20"
+	StandardTRC721  = "TRC721"
+	StandardUnknown = "unknown"
+)
+
+// trc721Methods 调用数据模式下支持解码的TRC721函数（选择器 -> 函数签名）
+//
+// transferFrom(address,address,uint256) 两种标准共用同一选择器，无法仅凭调用数据区分，不在此列。
+var trc721Methods = map[string]string{
+	"42842e0e": "safeTransferFrom(address,address,uint256)",
+	"b88d4fde": "safeTransferFrom(address,address,uint256,bytes)",
+}
+
+// trc721Events 日志模式下支持解码的TRC721事件（topics[0] -> 事件签名）
+//
+// 与TRC20使用同一事件签名，TRC721的tokenId是indexed参数，因此有4个topic。
+var trc721Events = map[string]string{
+	transferEventTopic: "Transfer(address,address,uint256 indexed)",
+}
+
+// classifyCalldata 按函数选择器判断调用数据所属的合约标准
+func classifyCalldata(data string) string {
+	if len(data) < 8 {
+		return StandardUnknown
+	}
+	selector := strings.ToLower(data[:8])
+	if _, ok := trc20Methods[selector]; ok {
+		return StandardTRC20
+	}
+	if _, ok := trc721Methods[selector]; ok {
+		return StandardTRC721
+	}
+	return StandardUnknown
+}
+
+// classifyTransferLog 按topic数量判断Transfer事件所属的合约标准
+func classifyTransferLog(topics []string) string {
+	switch len(topics) {
+	case 3:
+		return StandardTRC20
+	case 4:
+		return StandardTRC721
+	default:
+		return StandardUnknown
+	}
+}
+
+// parseTRC721TransferData 解析TRC721 safeTransferFrom调用数据: 选择器 + from + to + tokenId（+ bytes，忽略）
+func parseTRC721TransferData(data, contractAddress string, tx *models.Transaction, blockData *models.BlockData) (*models.TransferEvent, error) {
+	data = data[8:]
+	if len(data) < 64*3 {
+		return nil, fmt.Errorf("TRC721转账数据长度不足: %d", len(data))
+	}
+
+	from, _ := decodeWord(data[:64], "address")
+	to, _ := decodeWord(data[64:128], "address")
+	tokenID, err := decodeWord(data[128:192], "uint256")
+	if err != nil {
+		return nil, fmt.Errorf("解析TRC721 tokenId失败: %w", err)
+	}
+
+	return newTRC721Transfer(from, to, tokenID, contractAddress, tx, blockData), nil
+}
+
+// newTRC721Transfer 创建NFT转账事件，金额固定为1，tokenId单独保存
+func newTRC721Transfer(from, to, tokenID, contractAddress string, tx *models.Transaction, blockData *models.BlockData) *models.TransferEvent {
+	return &models.TransferEvent{
+		Source:          from,
+		Destination:     to,
+		Amount:          1,
+		AmountRaw:       "1",
+		TokenID:         tokenID,
+		TxHash:          tx.TxID,
+		BlockHeight:     blockData.Height,
+		Timestamp:       blockData.Timestamp,
+		TokenType:       StandardTRC721,
+		ContractAddress: contractAddress,
+		Standard:        StandardTRC721,
+	}
+}
@@ -0,0 +1,82 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestClassifyCalldata(t *testing.T) {
+	for _, tc := range []struct {
+		data string
+		want string
+	}{
+		{"a9059cbb" + strings.Repeat("0", 128), StandardTRC20},
+		{"A9059CBB" + strings.Repeat("0", 128), StandardTRC20},
+		{"42842e0e" + strings.Repeat("0", 192), StandardTRC721},
+		{"b88d4fde" + strings.Repeat("0", 256), StandardTRC721},
+		{"23b872dd" + strings.Repeat("0", 192), StandardUnknown}, // transferFrom两种标准共用选择器
+		{"a9059c", StandardUnknown},
+		{"", StandardUnknown},
+	} {
+		if got := classifyCalldata(tc.data); got != tc.want {
+			t.Errorf("%.8s: classifyCalldata = %s，期望 %s", tc.data, got, tc.want)
+		}
+	}
+}
+
+// 启用tag_standard时TRC20转账标记为TRC20，safeTransferFrom按TRC721解码并记录tokenId；关闭时不标记也不解码NFT
+func TestTagStandardTransferVsNFT(t *testing.T) {
+	const nftContract = "TXYZopYRdj2D9XRtbG411XZZ3kM5VkAeBf"
+	pad := func(address string) string {
+		return strings.Repeat("0", 24) + strings.TrimPrefix(hexAddress(t, address), "41")
+	}
+	nftTx := contractTx(txID(2), "TriggerSmartContract", map[string]interface{}{
+		"owner_address":    hexAddress(t, testWatchAddr),
+		"contract_address": hexAddress(t, nftContract),
+		"data":             "42842e0e" + pad(testWatchAddr) + pad(testOtherAddr) + fmt.Sprintf("%064x", 42),
+	})
+
+	for _, tag := range []bool{true, false} {
+		t.Run(fmt.Sprintf("tag_standard=%v", tag), func(t *testing.T) {
+			cfg := loadTestConfig(t, fmt.Sprintf("monitor:\n  mode: direct\n  tag_standard: %v\n", tag))
+			client := newTestRedis(t, cfg)
+			processor := NewBlockProcessor(cfg, client, nil, nil)
+			err := processor.ProcessBlock(testBlock(t, 100,
+				trc20TransferTx(t, txID(1), testUSDTAddr, testWatchAddr, testOtherAddr, 1_000_000),
+				nftTx,
+			))
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := context.Background()
+
+			fungible, err := client.GetTransferEvent(ctx, txID(1))
+			if err != nil || fungible == nil {
+				t.Fatalf("TRC20转账应被保存: %v", err)
+			}
+			nft, err := client.GetTransferEvent(ctx, txID(2))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !tag {
+				if fungible.Standard != "" || nft != nil {
+					t.Errorf("关闭时不应标记合约标准或解码NFT: standard=%q nft=%v", fungible.Standard, nft)
+				}
+				return
+			}
+			if fungible.Standard != StandardTRC20 || fungible.TokenType != "USDT" {
+				t.Errorf("TRC20转账 standard=%q token_type=%s，期望 TRC20/USDT", fungible.Standard, fungible.TokenType)
+			}
+			if nft == nil {
+				t.Fatal("safeTransferFrom应按TRC721解码")
+			}
+			if nft.Standard != StandardTRC721 || nft.TokenID != "42" || nft.Amount != 1 ||
+				nft.Source != testWatchAddr || nft.Destination != testOtherAddr || nft.ContractAddress != nftContract {
+				t.Errorf("NFT转账解码结果不符: %+v", nft)
+			}
+		})
+	}
+}
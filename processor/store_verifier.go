@@ -0,0 +1,157 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"tron-monitor/models"
+	"tron-monitor/redis"
+	"tron-monitor/store"
+)
+
+// storeVerifyTimeout 单次校验读取两个存储的超时时间
+const storeVerifyTimeout = 5 * time.Second
+
+// storeVerifier 双写校验：抽样从Redis和SQL存储读回同一笔转账，比较字段并记录差异
+//
+// 校验由独立线程异步完成，队列满时跳过本次校验，不阻塞保存线程。
+type storeVerifier struct {
+	redisClient *redis.RedisClient
+	store       store.TransferStore
+	sampleRate  int
+	events      chan *models.TransferEvent
+	done        chan struct{}
+
+	checked    int64
+	missing    int64
+	mismatched int64
+	skipped    int64
+	errors     int64
+}
+
+// newStoreVerifier 创建双写校验器，start之前不处理校验
+func newStoreVerifier(redisClient *redis.RedisClient, s store.TransferStore, sampleRate, queueSize int) *storeVerifier {
+	return &storeVerifier{
+		redisClient: redisClient,
+		store:       s,
+		sampleRate:  sampleRate,
+		events:      make(chan *models.TransferEvent, queueSize),
+		done:        make(chan struct{}),
+	}
+}
+
+// start 启动校验线程
+func (v *storeVerifier) start() {
+	go v.run()
+}
+
+// stop 校验完队列中剩余的转账后停止，调用前必须确保不再有submit
+func (v *storeVerifier) stop() {
+	close(v.events)
+	<-v.done
+}
+
+// submit 按事件ID抽样提交一笔已双写的转账，只复制定位记录所需的字段
+func (v *storeVerifier) submit(transfer *models.TransferEvent) {
+	if !sampleTransaction(transfer.EventID(), v.sampleRate) {
+		return
+	}
+	key := &models.TransferEvent{TxHash: transfer.TxHash, LogIndex: transfer.LogIndex}
+	select {
+	case v.events <- key:
+	default:
+		atomic.AddInt64(&v.skipped, 1)
+	}
+}
+
+func (v *storeVerifier) run() {
+	defer close(v.done)
+	for event := range v.events {
+		ctx, cancel := context.WithTimeout(context.Background(), storeVerifyTimeout)
+		v.verify(ctx, event)
+		cancel()
+	}
+}
+
+// verify 读回并比较一笔转账，读取失败只计数，不算作差异
+func (v *storeVerifier) verify(ctx context.Context, event *models.TransferEvent) {
+	inRedis, err := v.redisClient.GetStoredTransfer(ctx, event)
+	if err != nil {
+		log.Printf("双写校验: 转账 %s: %v", event.EventID(), err)
+		atomic.AddInt64(&v.errors, 1)
+		return
+	}
+	inStore, err := v.store.GetTransfer(ctx, event.EventID())
+	if err != nil {
+		log.Printf("双写校验: 转账 %s: %v", event.EventID(), err)
+		atomic.AddInt64(&v.errors, 1)
+		return
+	}
+	atomic.AddInt64(&v.checked, 1)
+
+	switch {
+	case inRedis == nil && inStore == nil:
+		// 校验前已被撤销（区块重组），两边一致
+	case inRedis == nil || inStore == nil:
+		where := "Redis"
+		if inStore == nil {
+			where = "SQL存储"
+		}
+		log.Printf("双写校验: 转账 %s 在%s中不存在", event.EventID(), where)
+		atomic.AddInt64(&v.missing, 1)
+	default:
+		if fields := diffTransferFields(inRedis, inStore); len(fields) > 0 {
+			log.Printf("双写校验: 转账 %s 在Redis和SQL存储中不一致，字段: %v", event.EventID(), fields)
+			atomic.AddInt64(&v.mismatched, 1)
+		}
+	}
+}
+
+// diffTransferFields 按JSON字段比较两笔转账，返回取值不同的字段名（升序）
+func diffTransferFields(a, b *models.TransferEvent) []string {
+	fieldsA, fieldsB := transferFields(a), transferFields(b)
+	var diff []string
+	for name, value := range fieldsA {
+		if other, ok := fieldsB[name]; !ok || !reflect.DeepEqual(value, other) {
+			diff = append(diff, name)
+		}
+	}
+	for name := range fieldsB {
+		if _, ok := fieldsA[name]; !ok {
+			diff = append(diff, name)
+		}
+	}
+	sort.Strings(diff)
+	return diff
+}
+
+func transferFields(event *models.TransferEvent) map[string]interface{} {
+	data, _ := json.Marshal(event)
+	var fields map[string]interface{}
+	json.Unmarshal(data, &fields)
+	return fields
+}
+
+func (v *storeVerifier) stats() map[string]interface{} {
+	return map[string]interface{}{
+		"sample_rate": v.sampleRate,
+		"checked":     atomic.LoadInt64(&v.checked),
+		"missing":     atomic.LoadInt64(&v.missing),
+		"mismatched":  atomic.LoadInt64(&v.mismatched),
+		"skipped":     atomic.LoadInt64(&v.skipped),
+		"errors":      atomic.LoadInt64(&v.errors),
+	}
+}
+
+func (v *storeVerifier) reset() {
+	atomic.StoreInt64(&v.checked, 0)
+	atomic.StoreInt64(&v.missing, 0)
+	atomic.StoreInt64(&v.mismatched, 0)
+	atomic.StoreInt64(&v.skipped, 0)
+	atomic.StoreInt64(&v.errors, 0)
+}
@@ -0,0 +1,85 @@
+package processor
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"tron-monitor/models"
+	"tron-monitor/store"
+)
+
+func TestStoreVerifierDetectsDiscrepancy(t *testing.T) {
+	ctx := context.Background()
+	cfg := loadTestConfig(t, "monitor:\n  mode: direct\nsql_store:\n  verify_sample_rate: 1\n")
+	client := newTestRedis(t, cfg)
+	sqlStore, err := store.NewSQLStore(filepath.Join(t.TempDir(), "transfers.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlStore.Close()
+
+	processor := NewBlockProcessor(cfg, client, nil, nil)
+	processor.SetTransferStore(sqlStore)
+	if err := processor.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer processor.Stop()
+
+	verifyStats := func() map[string]interface{} {
+		return processor.GetStats()["sql_store_verify"].(map[string]interface{})
+	}
+
+	// 双写一致时全部校验通过
+	if err := processor.ProcessBlock(sampleBlock(t, 100)); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "校验3笔转账", func() bool { return verifyStats()["checked"].(int64) == 3 })
+	if stats := verifyStats(); stats["missing"].(int64) != 0 || stats["mismatched"].(int64) != 0 {
+		t.Fatalf("一致的双写不应报告差异: %v", stats)
+	}
+
+	// 改写一笔SQL记录的金额，删除另一笔，再次校验
+	events, err := client.GetRecentTransfers(ctx, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("应保存3笔转账，实际 %d 笔", len(events))
+	}
+	changed := *events[0]
+	changed.Amount += 1
+	if err := sqlStore.SaveTransfer(ctx, &changed); err != nil {
+		t.Fatal(err)
+	}
+	if err := sqlStore.DeleteTransfer(ctx, events[1]); err != nil {
+		t.Fatal(err)
+	}
+	for _, event := range events {
+		processor.verifier.submit(event)
+	}
+	waitFor(t, "再次校验3笔转账", func() bool { return verifyStats()["checked"].(int64) == 6 })
+
+	stats := verifyStats()
+	if stats["mismatched"].(int64) != 1 {
+		t.Errorf("mismatched = %v，期望1", stats["mismatched"])
+	}
+	if stats["missing"].(int64) != 1 {
+		t.Errorf("missing = %v，期望1", stats["missing"])
+	}
+	if stored, _ := client.GetStoredTransfer(ctx, events[0]); stored == nil {
+		t.Fatal("Redis中的转账不应被修改")
+	} else if fields := diffTransferFields(stored, &changed); len(fields) != 1 || fields[0] != "amount" {
+		t.Errorf("差异字段 = %v，期望 [amount]", fields)
+	}
+}
+
+func TestStoreVerifierSkipsWhenQueueFull(t *testing.T) {
+	verifier := newStoreVerifier(nil, nil, 1, 1)
+	for i := 1; i <= 3; i++ {
+		verifier.submit(&models.TransferEvent{TxHash: txID(i)})
+	}
+	if skipped := verifier.stats()["skipped"].(int64); skipped != 2 {
+		t.Errorf("skipped = %d，期望2（队列容量1且校验线程未启动）", skipped)
+	}
+}
@@ -0,0 +1,137 @@
+package processor
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sync"
+
+	"tron-monitor/notify"
+)
+
+// blockThroughput 每个区块解码出的转账数，用于发现转账量突增
+type blockThroughput struct {
+	Height int64 `json:"height"`
+	Count  int   `json:"count"`
+}
+
+// throughputMonitor 最近N个区块转账数的环形序列
+//
+// 区块转账数超过 均值 + k·标准差（按加入该区块之前的窗口计算，窗口填满后才判断）或绝对上限时告警。
+type throughputMonitor struct {
+	mu       sync.Mutex
+	series   []blockThroughput
+	next     int
+	filled   bool
+	k        float64
+	cap      int
+	notifier *notify.Notifier
+	alerts   int64
+}
+
+// newThroughputMonitor 创建窗口大小为size的转账量监控，notifier为nil时只记录日志
+func newThroughputMonitor(size int, k float64, limit int, notifier *notify.Notifier) *throughputMonitor {
+	return &throughputMonitor{
+		series:   make([]blockThroughput, size),
+		k:        k,
+		cap:      limit,
+		notifier: notifier,
+	}
+}
+
+// record 记录一个区块的转账数，超过阈值时告警并返回true
+//
+// 重试或重放的区块已在窗口内时不重复记录，避免同一区块计入两次拉低/抬高均值。
+func (t *throughputMonitor) record(height int64, count int) bool {
+	t.mu.Lock()
+	if t.recordedLocked(height) {
+		t.mu.Unlock()
+		return false
+	}
+	var reason string
+	if t.filled {
+		mean, stddev := t.statsLocked()
+		// 标准差为0（转账数长期不变）时至少高出1笔才告警
+		if threshold := mean + t.k*math.Max(stddev, 1); float64(count) > threshold {
+			reason = fmt.Sprintf("超过动态阈值 %.1f（均值 %.1f，标准差 %.1f）", threshold, mean, stddev)
+		}
+	}
+	if t.cap > 0 && count > t.cap {
+		reason = fmt.Sprintf("超过上限 %d", t.cap)
+	}
+
+	t.series[t.next] = blockThroughput{Height: height, Count: count}
+	t.next++
+	if t.next == len(t.series) {
+		t.next = 0
+		t.filled = true
+	}
+	if reason != "" {
+		t.alerts++
+	}
+	t.mu.Unlock()
+
+	if reason == "" {
+		return false
+	}
+	message := fmt.Sprintf("区块 %d 转账数 %d，%s", height, count, reason)
+	log.Printf("告警: %s", message)
+	if t.notifier != nil {
+		t.notifier.Notify(notify.LevelWarning, message)
+	}
+	return true
+}
+
+// recordedLocked 窗口内是否已有该高度的记录，调用方需持有锁
+func (t *throughputMonitor) recordedLocked(height int64) bool {
+	size := t.next
+	if t.filled {
+		size = len(t.series)
+	}
+	for _, point := range t.series[:size] {
+		if point.Height == height {
+			return true
+		}
+	}
+	return false
+}
+
+// statsLocked 当前窗口内转账数的均值和标准差，调用方需持有锁
+func (t *throughputMonitor) statsLocked() (mean, stddev float64) {
+	size := t.next
+	if t.filled {
+		size = len(t.series)
+	}
+	if size == 0 {
+		return 0, 0
+	}
+
+	for _, point := range t.series[:size] {
+		mean += float64(point.Count)
+	}
+	mean /= float64(size)
+	for _, point := range t.series[:size] {
+		diff := float64(point.Count) - mean
+		stddev += diff * diff
+	}
+	return mean, math.Sqrt(stddev / float64(size))
+}
+
+// stats 转账量序列（按记录顺序从旧到新）、均值、标准差和告警次数
+func (t *throughputMonitor) stats() map[string]interface{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	series := append([]blockThroughput{}, t.series[:t.next]...)
+	if t.filled {
+		series = append(append([]blockThroughput{}, t.series[t.next:]...), series...)
+	}
+	mean, stddev := t.statsLocked()
+
+	return map[string]interface{}{
+		"series": series,
+		"mean":   mean,
+		"stddev": stddev,
+		"alerts": t.alerts,
+	}
+}
@@ -0,0 +1,57 @@
+package processor
+
+import "testing"
+
+func TestThroughputAlertsOnSpike(t *testing.T) {
+	monitor := newThroughputMonitor(5, 3, 0, nil)
+	for height := int64(1); height <= 5; height++ {
+		if monitor.record(height, 10) {
+			t.Fatalf("基线区块 %d 不应告警", height)
+		}
+	}
+	if !monitor.record(6, 50) {
+		t.Fatal("转账数突增的区块应告警")
+	}
+	if alerts := monitor.stats()["alerts"].(int64); alerts != 1 {
+		t.Errorf("alerts = %d，期望 1", alerts)
+	}
+}
+
+func TestThroughputRecordsEachHeightOnce(t *testing.T) {
+	monitor := newThroughputMonitor(5, 3, 0, nil)
+	monitor.record(1, 10)
+	monitor.record(1, 10) // 重试的区块
+	monitor.record(2, 10)
+
+	series := monitor.stats()["series"].([]blockThroughput)
+	if len(series) != 2 || series[0].Height != 1 || series[1].Height != 2 {
+		t.Errorf("同一高度只应记录一次: %+v", series)
+	}
+}
+
+func TestThroughputCountsDecodedTransfers(t *testing.T) {
+	cfg := loadTestConfig(t, "monitor:\n  mode: direct\n  throughput_window: 5\n  skip_zero_amount: true\n")
+	client := newTestRedis(t, cfg)
+	processor := NewBlockProcessor(cfg, client, nil, nil)
+	if err := processor.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer processor.Stop()
+
+	// 零额转账保存前被丢弃，但仍计入区块解码出的转账数
+	block := testBlock(t, 100,
+		trxTransferTx(t, txID(1), testOtherAddr, testWatchAddr, 5_000_000),
+		trxTransferTx(t, txID(2), testOtherAddr, testWatchAddr, 0),
+	)
+	if err := processor.ProcessBlock(block); err != nil {
+		t.Fatal(err)
+	}
+
+	series := processor.GetStats()["throughput"].(map[string]interface{})["series"].([]blockThroughput)
+	if len(series) != 1 || series[0].Count != 2 {
+		t.Errorf("应按过滤前的转账数记录: %+v", series)
+	}
+	if saved := savedTransfers(t, client); len(saved) != 1 {
+		t.Errorf("零额转账不应保存，实际保存 %d 笔", len(saved))
+	}
+}
@@ -0,0 +1,167 @@
+package processor
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"tron-monitor/models"
+)
+
+// TRC20转账解码方式
+const (
+	TRC20DecodeCalldata = "calldata"
+	TRC20DecodeLogs     = "logs"
+)
+
+// transferEventTopic Transfer(address,address,uint256)事件签名的keccak256哈希
+const transferEventTopic = "ddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+
+// transactionInfo 获取交易信息（含日志）
+//
+// 区块内第一次需要时用gettransactioninfobyblocknum一次取回整块并按交易哈希索引，其余交易直接查表；
+// 整块获取失败时本区块不再重复请求。结果中没有的交易（节点数据不完整）单独查询。
+func (w *BlockWorker) transactionInfo(tx *models.Transaction, blockData *models.BlockData) (*models.TransactionInfo, error) {
+	if !w.txInfosLoaded {
+		w.txInfosLoaded = true
+		infos, err := w.processor.httpClient.GetTransactionInfoByBlockNum(w.ctx, blockData.Height)
+		if err != nil {
+			w.txInfosErr = err
+		} else {
+			w.txInfos = make(map[string]*models.TransactionInfo, len(infos))
+			for _, info := range infos {
+				w.txInfos[info.ID] = info
+			}
+		}
+	}
+	if w.txInfosErr != nil {
+		return nil, w.txInfosErr
+	}
+
+	if info, ok := w.txInfos[tx.TxID]; ok {
+		return info, nil
+	}
+	return w.processor.httpClient.GetTransactionInfo(w.ctx, tx.TxID)
+}
+
+// extractTRC20TransfersFromLogs 从交易日志中提取所有TRC20 Transfer事件
+//
+// 与解析调用数据不同，同一交易中的批量转账、合约内部转账都会产生各自的事件，每个事件带有日志序号。
+func (w *BlockWorker) extractTRC20TransfersFromLogs(tx *models.Transaction, blockData *models.BlockData, watchAddressSet map[string]bool) ([]*models.TransferEvent, error) {
+	txInfo, err := w.transactionInfo(tx, blockData)
+	if err != nil {
+		return nil, fmt.Errorf("获取交易 %s 的日志失败: %w", tx.TxID, err)
+	}
+
+	tagStandard := w.processor.config.Monitor.TagStandard
+
+	var transfers []*models.TransferEvent
+	for i, txLog := range txInfo.Log {
+		// Transfer事件: topics = [签名, from, to]，data = amount；TRC721为 [签名, from, to, tokenId]
+		if len(txLog.Topics) == 0 || !strings.EqualFold(strings.TrimPrefix(txLog.Topics[0], "0x"), transferEventTopic) {
+			continue
+		}
+		standard := classifyTransferLog(txLog.Topics)
+		if standard != StandardTRC20 && !(tagStandard && standard == StandardTRC721) {
+			continue
+		}
+
+		contractAddress := logContractAddress(txLog.Address)
+		isUSDT := w.isUSDTContract(contractAddress)
+		if isUSDT && !w.processor.config.USDT.EnableMonitoring {
+			continue
+		}
+		if !isUSDT && !w.processor.config.Monitor.EnableTRC20 {
+			continue
+		}
+
+		from, err := decodeWord(txLog.Topics[1], "address")
+		if err != nil {
+			log.Printf("解码交易 %s 第 %d 条日志的发送方失败: %v", tx.TxID, i, err)
+			continue
+		}
+		to, err := decodeWord(txLog.Topics[2], "address")
+		if err != nil {
+			log.Printf("解码交易 %s 第 %d 条日志的接收方失败: %v", tx.TxID, i, err)
+			continue
+		}
+		if standard == StandardTRC721 {
+			tokenID, err := decodeWord(txLog.Topics[3], "uint256")
+			if err != nil {
+				log.Printf("解码交易 %s 第 %d 条日志的tokenId失败: %v", tx.TxID, i, err)
+				continue
+			}
+			transfer := newTRC721Transfer(from, to, tokenID, contractAddress, tx, blockData)
+			transfer.LogIndex = i
+			if !watchAddressSet[from] && !watchAddressSet[to] {
+				if !w.sampleTx {
+					continue
+				}
+				transfer.Sampled = true
+			}
+			transfers = append(transfers, transfer)
+			continue
+		}
+
+		data := strings.TrimPrefix(txLog.Data, "0x")
+		if len(data) < 64 {
+			log.Printf("交易 %s 第 %d 条日志的金额数据长度不足: %d", tx.TxID, i, len(data))
+			continue
+		}
+		amount, amountRaw, err := w.parseHexAmount(data[:64])
+		amountParseError := false
+		if err != nil {
+			log.Printf("解析交易 %s 第 %d 条日志的金额失败: %v", tx.TxID, i, err)
+			// 接收方为监控地址时仍保存并标记，避免漏掉入账
+			if !w.processor.config.Monitor.KeepUnparsedAmount || !watchAddressSet[to] {
+				continue
+			}
+			amountParseError = true
+		}
+
+		tokenType := "TRC20"
+		var amountDecimal string
+		if isUSDT {
+			amount, amountDecimal = scaleAmount(amountRaw, w.processor.config.USDT.Decimals)
+			tokenType = "USDT"
+		}
+
+		transfer := &models.TransferEvent{
+			Source:          from,
+			Destination:     to,
+			Amount:          amount,
+			AmountRaw:       amountRaw,
+			AmountDecimal:   amountDecimal,
+			TxHash:          tx.TxID,
+			LogIndex:        i,
+			BlockHeight:     blockData.Height,
+			Timestamp:       blockData.Timestamp,
+			TokenType:       tokenType,
+			ContractAddress: contractAddress,
+			IsUSDT:          isUSDT,
+		}
+		if tagStandard {
+			transfer.Standard = StandardTRC20
+		}
+		if amountParseError {
+			transfer.AmountParseError = true
+			transfer.AmountHex = data[:64]
+		}
+		if isUSDT && !amountParseError {
+			transfer.USDValue, transfer.PriceFallback = w.usdtValue(amount, blockData.Timestamp)
+		}
+
+		// 不涉及监控地址时只保留全链大额转账和抽样交易
+		transfer.Whale = w.isWhale(transfer)
+		if !watchAddressSet[from] && !watchAddressSet[to] {
+			if !transfer.Whale && !w.sampleTx {
+				continue
+			}
+			transfer.WhaleOnly = transfer.Whale
+			transfer.Sampled = !transfer.Whale
+		}
+		transfers = append(transfers, transfer)
+	}
+
+	return transfers, nil
+}
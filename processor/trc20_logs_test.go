@@ -0,0 +1,85 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	httpclient "tron-monitor/http"
+	"tron-monitor/models"
+)
+
+// transferLog 构造TRC20 Transfer事件日志（地址为不带41前缀的十六进制）
+func transferLog(t testing.TB, contract, from, to string, amount int64) *models.TransactionLog {
+	word := func(address string) string {
+		return strings.Repeat("0", 24) + strings.TrimPrefix(hexAddress(t, address), "41")
+	}
+	return &models.TransactionLog{
+		Address: strings.TrimPrefix(hexAddress(t, contract), "41"),
+		Topics:  []string{transferEventTopic, word(from), word(to)},
+		Data:    fmt.Sprintf("%064x", amount),
+	}
+}
+
+func TestLogsModeFetchesTransactionInfoOncePerBlock(t *testing.T) {
+	block := testBlock(t, 100,
+		trc20TransferTx(t, txID(1), testUSDTAddr, testWatchAddr, testOtherAddr, 1_000_000),
+		trc20TransferTx(t, txID(2), testUSDTAddr, testOtherAddr, testWatchAddr, 2_000_000),
+		trc20TransferTx(t, txID(3), testUSDTAddr, testWatchAddr, testOtherAddr, 3_000_000),
+	)
+	var infos []*models.TransactionInfo
+	for i, tx := range block.Block.Trans {
+		from, to := testWatchAddr, testOtherAddr
+		if i == 1 {
+			from, to = to, from
+		}
+		infos = append(infos, &models.TransactionInfo{ID: tx.TxID, Log: []*models.TransactionLog{
+			transferLog(t, testUSDTAddr, from, to, int64(i+1)*1_000_000),
+		}})
+	}
+
+	var byBlock, byID int64
+	tronGrid := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/wallet/gettransactioninfobyblocknum":
+			atomic.AddInt64(&byBlock, 1)
+			json.NewEncoder(w).Encode(infos)
+		case "/wallet/gettransactioninfobyid":
+			atomic.AddInt64(&byID, 1)
+			json.NewEncoder(w).Encode(&models.TransactionInfo{})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer tronGrid.Close()
+
+	cfg := loadTestConfig(t, "monitor:\n  mode: direct\n  trc20_decode_mode: logs\n")
+	cfg.TronGrid.BaseURL = tronGrid.URL
+	bp := NewBlockProcessor(cfg, newTestRedis(t, cfg), httpclient.NewHTTPClient(cfg), nil)
+	if err := bp.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer bp.Stop()
+
+	if err := bp.ProcessBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	if got := savedTransfers(t, bp.redisClient); len(got) != 3 {
+		t.Errorf("应从日志中提取3笔转账，实际 %d 笔", len(got))
+	}
+	if blocks, ids := atomic.LoadInt64(&byBlock), atomic.LoadInt64(&byID); blocks != 1 || ids != 0 {
+		t.Errorf("整块请求 %d 次、逐笔请求 %d 次，期望 1 和 0", blocks, ids)
+	}
+
+	// 下一个区块重新获取
+	if err := bp.ProcessBlock(testBlock(t, 101, block.Block.Trans[0])); err != nil {
+		t.Fatal(err)
+	}
+	if blocks := atomic.LoadInt64(&byBlock); blocks != 2 {
+		t.Errorf("每个区块应获取一次，实际 %d 次", blocks)
+	}
+}
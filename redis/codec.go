@@ -0,0 +1,55 @@
+package redis
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+
+	"tron-monitor/models"
+)
+
+// 区块队列编码格式
+const (
+	QueueCodecJSON = "json"
+	QueueCodecGob  = "gob"
+)
+
+// gobTag gob编码的队列数据前缀；JSON数据以'{'开头，无前缀的数据按JSON解码，兼容升级前入队的区块
+var gobTag = []byte("gob:")
+
+func init() {
+	// 合约参数(Parameter)反序列化自JSON，接口字段中保存的是以下具体类型，gob需要预先注册
+	gob.Register(map[string]interface{}{})
+	gob.Register([]interface{}{})
+}
+
+// encodeBlockData 按codec编码区块数据
+func encodeBlockData(codec string, blockData *models.BlockData) ([]byte, error) {
+	if codec != QueueCodecGob {
+		return json.Marshal(blockData)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(gobTag)
+	if err := gob.NewEncoder(&buf).Encode(blockData); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeBlockData 根据数据前缀识别编码格式并解码，与当前配置的codec无关
+func decodeBlockData(data []byte) (*models.BlockData, error) {
+	var blockData models.BlockData
+	if bytes.HasPrefix(data, gobTag) {
+		if err := gob.NewDecoder(bytes.NewReader(data[len(gobTag):])).Decode(&blockData); err != nil {
+			return nil, fmt.Errorf("gob解码失败: %w", err)
+		}
+		return &blockData, nil
+	}
+
+	if err := json.Unmarshal(data, &blockData); err != nil {
+		return nil, err
+	}
+	return &blockData, nil
+}
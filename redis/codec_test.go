@@ -0,0 +1,117 @@
+package redis
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"tron-monitor/models"
+)
+
+// codecTestBlock 含n笔TRC20转账的区块，合约参数经JSON反序列化，与从TronGrid获取的区块一致
+func codecTestBlock(t testing.TB, n int) *models.BlockData {
+	t.Helper()
+	txs := make([]string, n)
+	for i := range txs {
+		txs[i] = fmt.Sprintf(`{"txID":"%064x","signature":["%0130x"],"ret":[{"contractRet":"SUCCESS"}],
+			"raw_data":{"ref_block_bytes":"a1b2","ref_block_hash":"0011223344556677","expiration":1700000060000,"timestamp":1700000000000,"fee_limit":100000000,
+			"contract":[{"type":"TriggerSmartContract","parameter":{"type_url":"type.googleapis.com/protocol.TriggerSmartContract",
+			"value":{"owner_address":"41%040x","contract_address":"41a614f803b6fd780986a42c78ec9c7f77e6ded13c","call_value":0,
+			"data":"a9059cbb000000000000000000000000%040x%064x"}}}]}}`, i, i, i, i+1, i*1000)
+	}
+	data := fmt.Sprintf(`{"height":100,"blockID":"%064x","timestamp":1700000000000,"created_at":"2024-01-01T00:00:00Z",
+		"block":{"block_header":{"raw_data":{"number":100,"timestamp":1700000000000,"parentHash":"%064x"}},"transactions":[%s]}}`,
+		100, 99, strings.Join(txs, ","))
+
+	var blockData models.BlockData
+	if err := json.Unmarshal([]byte(data), &blockData); err != nil {
+		t.Fatal(err)
+	}
+	return &blockData
+}
+
+func TestBlockCodecRoundTrip(t *testing.T) {
+	original := codecTestBlock(t, 50)
+	original.Attempts = 2
+	want, err := json.Marshal(original)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, codec := range []string{QueueCodecJSON, QueueCodecGob} {
+		t.Run(codec, func(t *testing.T) {
+			data, err := encodeBlockData(codec, original)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := decodeBlockData(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := json.Marshal(decoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("%s编码往返后区块不一致:\ngot:  %.300s\nwant: %.300s", codec, got, want)
+			}
+			if !decoded.CreatedAt.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) {
+				t.Errorf("created_at = %v", decoded.CreatedAt)
+			}
+		})
+	}
+
+	// 切换到gob后，升级前入队的无前缀JSON区块仍能解码
+	legacy, err := json.Marshal(original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded, err := decodeBlockData(legacy); err != nil || decoded.Height != 100 {
+		t.Errorf("无前缀的JSON区块解码失败: %v", err)
+	}
+}
+
+func TestBlockCodecSize(t *testing.T) {
+	block := codecTestBlock(t, 200)
+	jsonData, err := encodeBlockData(QueueCodecJSON, block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gobData, err := encodeBlockData(QueueCodecGob, block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("200笔交易的区块: json %d 字节，gob %d 字节（%.0f%%）",
+		len(jsonData), len(gobData), float64(len(gobData))*100/float64(len(jsonData)))
+	if len(gobData) >= len(jsonData) {
+		t.Errorf("gob编码 %d 字节，应小于JSON的 %d 字节", len(gobData), len(jsonData))
+	}
+}
+
+// BenchmarkBlockCodec 比较两种编码的区块入队（编码）和出队（解码）耗时，bytes/block为编码后大小
+func BenchmarkBlockCodec(b *testing.B) {
+	block := codecTestBlock(b, 200)
+	for _, codec := range []string{QueueCodecJSON, QueueCodecGob} {
+		data, err := encodeBlockData(codec, block)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(codec+"/encode", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := encodeBlockData(codec, block); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(len(data)), "bytes/block")
+		})
+		b.Run(codec+"/decode", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := decodeBlockData(data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ErrOutOfMemory Redis达到maxmemory且无法淘汰键，写命令被拒绝
+var ErrOutOfMemory = errors.New("Redis内存不足")
+
+// isOOMError 判断是否为Redis返回的OOM错误（-OOM command not allowed when used memory > 'maxmemory'）
+func isOOMError(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "OOM ")
+}
+
+// wrapOOM OOM错误包装为ErrOutOfMemory，便于调用方用errors.Is区分，其他错误原样返回
+func wrapOOM(err error) error {
+	if isOOMError(err) {
+		return fmt.Errorf("%w: %v", ErrOutOfMemory, err)
+	}
+	return err
+}
+
+// oomHook 统计所有命令中被Redis以OOM拒绝的次数，包括调用方忽略了错误的写命令
+type oomHook struct {
+	count *int64
+}
+
+func (h oomHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h oomHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	if isOOMError(cmd.Err()) {
+		atomic.AddInt64(h.count, 1)
+	}
+	return nil
+}
+
+func (h oomHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h oomHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	for _, cmd := range cmds {
+		if isOOMError(cmd.Err()) {
+			atomic.AddInt64(h.count, 1)
+		}
+	}
+	return nil
+}
+
+// parseInfo 解析INFO命令的输出（key:value，每行一项）
+func parseInfo(info string) map[string]string {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(info, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if key, value, ok := strings.Cut(line, ":"); ok {
+			fields[key] = value
+		}
+	}
+	return fields
+}
+
+// GetMemoryStats 获取Redis内存使用、淘汰策略和已淘汰键数，以及本进程遇到的OOM错误次数
+func (r *RedisClient) GetMemoryStats(ctx context.Context) (map[string]interface{}, error) {
+	memory, err := r.client.Info(ctx, "memory").Result()
+	if err != nil {
+		return nil, fmt.Errorf("获取Redis内存信息失败: %w", err)
+	}
+	stats, err := r.client.Info(ctx, "stats").Result()
+	if err != nil {
+		return nil, fmt.Errorf("获取Redis统计信息失败: %w", err)
+	}
+
+	fields := parseInfo(memory)
+	for key, value := range parseInfo(stats) {
+		fields[key] = value
+	}
+
+	result := map[string]interface{}{
+		"maxmemory_policy": fields["maxmemory_policy"],
+		"oom_errors":       atomic.LoadInt64(&r.oomErrors),
+	}
+	for _, key := range []string{"used_memory", "used_memory_peak", "maxmemory", "evicted_keys"} {
+		if n, err := strconv.ParseInt(fields[key], 10, 64); err == nil {
+			result[key] = n
+		}
+	}
+	if maxmemory, _ := result["maxmemory"].(int64); maxmemory > 0 {
+		used, _ := result["used_memory"].(int64)
+		result["used_ratio"] = float64(used) / float64(maxmemory)
+	}
+
+	return result, nil
+}
+
+// checkEvictionPolicy 启动时检查淘汰策略
+//
+// 监控地址、地址信息和处理游标都不设过期时间，volatile-*策略和noeviction下不会被淘汰；
+// allkeys-*策略会在内存不足时淘汰这些键，导致监控地址丢失，因此记录警告。
+func (r *RedisClient) checkEvictionPolicy(ctx context.Context) {
+	info, err := r.client.Info(ctx, "memory").Result()
+	if err != nil {
+		log.Printf("检查Redis淘汰策略失败: %v", err)
+		return
+	}
+
+	fields := parseInfo(info)
+	policy := fields["maxmemory_policy"]
+	if fields["maxmemory"] != "0" && strings.HasPrefix(policy, "allkeys-") {
+		log.Printf("警告: Redis淘汰策略为 %s，内存不足时监控地址和处理游标可能被淘汰，建议使用 volatile-lru 或 noeviction", policy)
+	}
+}
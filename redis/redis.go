@@ -1,9 +1,17 @@
 package redis
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -11,19 +19,48 @@ import (
 	"tron-monitor/models"
 )
 
+// 转账列表transfers和区块高度索引transfers_by_block的保留条数
+const (
+	transferListSize  = 10000
+	transferIndexSize = 100000
+)
+
+// ErrQueueFull 区块队列已满，区块未入队
+var ErrQueueFull = errors.New("区块队列已满")
+
+// pushIfNotFullScript 队列未满时才LPUSH，返回入队后的长度，已满返回-1
+var pushIfNotFullScript = redis.NewScript(`
+if redis.call("LLEN", KEYS[1]) >= tonumber(ARGV[2]) then
+	return -1
+end
+return redis.call("LPUSH", KEYS[1], ARGV[1])
+`)
+
 // RedisClient Redis客户端
 type RedisClient struct {
 	client *redis.Client
 	config *config.Config
+
+	// 热点操作的并发限制，nil表示不限制
+	opSlots    chan struct{}
+	opRejected int64
+
+	// 被Redis以OOM拒绝的命令数
+	oomErrors int64
+
+	// 代币类型（大写） -> 转账列表保留条数
+	tokenListSizes map[string]int64
 }
 
 // NewRedisClient 创建Redis客户端
 func NewRedisClient(cfg *config.Config) (*RedisClient, error) {
 	client := redis.NewClient(&redis.Options{
-		Addr:     cfg.Redis.Addr,
-		Password: cfg.Redis.Password,
-		DB:       cfg.Redis.DB,
-		PoolSize: cfg.Redis.PoolSize,
+		Addr:         cfg.Redis.Addr,
+		Password:     cfg.Redis.Password,
+		DB:           cfg.Redis.DB,
+		PoolSize:     cfg.Redis.PoolSize,
+		MinIdleConns: cfg.Redis.MinIdleConns,
+		PoolTimeout:  cfg.Redis.PoolTimeout,
 	})
 
 	// 测试连接
@@ -34,10 +71,62 @@ func NewRedisClient(cfg *config.Config) (*RedisClient, error) {
 		return nil, fmt.Errorf("Redis连接失败: %w", err)
 	}
 
-	return &RedisClient{
-		client: client,
-		config: cfg,
-	}, nil
+	redisClient := &RedisClient{
+		client:         client,
+		config:         cfg,
+		tokenListSizes: make(map[string]int64),
+	}
+	// viper会把map的键转为小写，这里统一为代币类型的大写形式
+	for token, size := range cfg.Redis.TokenListSizes {
+		redisClient.tokenListSizes[strings.ToUpper(token)] = size
+	}
+	if cfg.Redis.MaxConcurrentOps > 0 {
+		redisClient.opSlots = make(chan struct{}, cfg.Redis.MaxConcurrentOps)
+	}
+	client.AddHook(oomHook{count: &redisClient.oomErrors})
+	redisClient.checkEvictionPolicy(ctx)
+
+	return redisClient, nil
+}
+
+// acquireOp 占用一个热点操作名额，等待超过redis.op_acquire_timeout时快速失败
+func (r *RedisClient) acquireOp(ctx context.Context) (func(), error) {
+	if r.opSlots == nil {
+		return func() {}, nil
+	}
+
+	timer := time.NewTimer(r.config.Redis.OpAcquireTimeout)
+	defer timer.Stop()
+
+	select {
+	case r.opSlots <- struct{}{}:
+		return func() { <-r.opSlots }, nil
+	case <-timer.C:
+		atomic.AddInt64(&r.opRejected, 1)
+		return nil, fmt.Errorf("Redis并发操作已达上限 %d", cap(r.opSlots))
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// GetPoolStats 获取连接池统计信息
+func (r *RedisClient) GetPoolStats() map[string]interface{} {
+	poolStats := r.client.PoolStats()
+	stats := map[string]interface{}{
+		"hits":        poolStats.Hits,
+		"misses":      poolStats.Misses,
+		"timeouts":    poolStats.Timeouts,
+		"total_conns": poolStats.TotalConns,
+		"idle_conns":  poolStats.IdleConns,
+		"stale_conns": poolStats.StaleConns,
+		"pool_size":   r.config.Redis.PoolSize,
+	}
+	if r.opSlots != nil {
+		stats["ops_in_flight"] = len(r.opSlots)
+		stats["ops_rejected"] = atomic.LoadInt64(&r.opRejected)
+	}
+
+	return stats
 }
 
 // Close 关闭Redis连接
@@ -46,32 +135,72 @@ func (r *RedisClient) Close() error {
 }
 
 // PushBlockData 推送区块数据到队列
+//
+// 队列为FIFO：新区块LPUSH到头部，工作线程从尾部BRPOP最早的区块。
+// 队列满时按monitor.queue_full_policy处理：block策略下不入队并返回ErrQueueFull，由调用方等待后重试；
+// drop_oldest策略下仍然入队，并从尾部裁掉最早的未处理区块。
 func (r *RedisClient) PushBlockData(ctx context.Context, blockData *models.BlockData) error {
-	data, err := json.Marshal(blockData)
+	data, err := encodeBlockData(r.config.Redis.QueueCodec, blockData)
 	if err != nil {
 		return fmt.Errorf("序列化区块数据失败: %w", err)
 	}
 
 	key := "block_queue"
-	err = r.client.LPush(ctx, key, data).Err()
+	queueSize := int64(r.config.Monitor.QueueSize)
+
+	if r.config.Monitor.QueueFullPolicy == "drop_oldest" {
+		length, err := r.client.LPush(ctx, key, data).Result()
+		if err != nil {
+			return fmt.Errorf("推送区块数据到队列失败: %w", err)
+		}
+		if length > queueSize {
+			r.client.LTrim(ctx, key, 0, queueSize-1)
+		}
+		return nil
+	}
+
+	// 检查长度与入队在脚本中原子完成，避免多个生产者同时越过上限
+	length, err := pushIfNotFullScript.Run(ctx, r.client, []string{key}, data, queueSize).Int64()
 	if err != nil {
 		return fmt.Errorf("推送区块数据到队列失败: %w", err)
 	}
+	if length < 0 {
+		return ErrQueueFull
+	}
+
+	return nil
+}
 
-	// 限制队列大小
-	r.client.LTrim(ctx, key, 0, int64(r.config.Monitor.QueueSize-1))
+// RequeueBlockData 将已出队的区块（处理失败重试或停止时未处理完）放回队列
+//
+// 这些区块此前已被队列接纳，block策略下不检查队列上限（最多超出工作线程数个区块），
+// 不会因队列已满进入死信队列，也避免工作线程互相等待对方消化队列；drop_oldest策略与PushBlockData相同。
+func (r *RedisClient) RequeueBlockData(ctx context.Context, blockData *models.BlockData) error {
+	if r.config.Monitor.QueueFullPolicy == "drop_oldest" {
+		return r.PushBlockData(ctx, blockData)
+	}
 
+	data, err := encodeBlockData(r.config.Redis.QueueCodec, blockData)
+	if err != nil {
+		return fmt.Errorf("序列化区块数据失败: %w", err)
+	}
+	if err := r.client.LPush(ctx, "block_queue", data).Err(); err != nil {
+		return fmt.Errorf("推送区块数据到队列失败: %w", err)
+	}
 	return nil
 }
 
 // PopBlockData 从队列弹出区块数据
 func (r *RedisClient) PopBlockData(ctx context.Context) (*models.BlockData, error) {
 	key := "block_queue"
-	result, err := r.client.BRPop(ctx, 5*time.Second, key).Result()
+	result, err := r.client.BRPop(ctx, r.config.Monitor.IdlePollInterval, key).Result()
 	if err != nil {
 		if err == redis.Nil {
 			return nil, nil // 队列为空
 		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err() // 调用方已取消，不视为Redis错误
+		}
 		return nil, fmt.Errorf("从队列弹出区块数据失败: %w", err)
 	}
 
@@ -79,107 +208,909 @@ func (r *RedisClient) PopBlockData(ctx context.Context) (*models.BlockData, erro
 		return nil, fmt.Errorf("队列数据格式错误")
 	}
 
-	var blockData models.BlockData
-	if err := json.Unmarshal([]byte(result[1]), &blockData); err != nil {
+	blockData, err := decodeBlockData([]byte(result[1]))
+	if err != nil {
 		return nil, fmt.Errorf("反序列化区块数据失败: %w", err)
 	}
 
-	return &blockData, nil
+	return blockData, nil
+}
+
+// PushDeadLetterBlock 将处理失败的区块放入死信队列
+func (r *RedisClient) PushDeadLetterBlock(ctx context.Context, entry *models.DeadLetterBlock) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("序列化死信区块失败: %w", err)
+	}
+
+	key := "block_dlq"
+	if err := r.client.LPush(ctx, key, data).Err(); err != nil {
+		return fmt.Errorf("推送死信区块失败: %w", err)
+	}
+	r.client.LTrim(ctx, key, 0, 9999) // 保留最近10000条死信
+
+	return nil
+}
+
+// GetDeadLetterBlocks 获取死信队列中的区块（从新到旧）
+func (r *RedisClient) GetDeadLetterBlocks(ctx context.Context, limit int64) ([]*models.DeadLetterBlock, error) {
+	key := "block_dlq"
+	data, err := r.client.LRange(ctx, key, 0, limit-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("获取死信区块失败: %w", err)
+	}
+
+	var entries []*models.DeadLetterBlock
+	for _, item := range data {
+		var entry models.DeadLetterBlock
+		if err := json.Unmarshal([]byte(item), &entry); err != nil {
+			continue // 跳过无效数据
+		}
+		entries = append(entries, &entry)
+	}
+
+	return entries, nil
+}
+
+// ReplayDeadLetterBlocks 将死信队列中最旧的limit个区块重新放回处理队列，返回重放数量
+func (r *RedisClient) ReplayDeadLetterBlocks(ctx context.Context, limit int64) (int64, error) {
+	return r.ReplayDeadLetterBlocksWith(ctx, limit, func(blockData *models.BlockData) error {
+		return r.PushBlockData(ctx, blockData)
+	})
+}
+
+// ReplayDeadLetterBlocksWith 将死信队列中最旧的limit个区块依次交给replay处理，返回重放数量
+//
+// replay失败时区块放回死信队列末尾（最旧的位置）并停止。
+func (r *RedisClient) ReplayDeadLetterBlocksWith(ctx context.Context, limit int64, replay func(*models.BlockData) error) (int64, error) {
+	key := "block_dlq"
+	var replayed int64
+	for replayed < limit {
+		item, err := r.client.RPop(ctx, key).Result()
+		if err != nil {
+			if err == redis.Nil {
+				break // 死信队列已空
+			}
+			return replayed, fmt.Errorf("弹出死信区块失败: %w", err)
+		}
+
+		var entry models.DeadLetterBlock
+		if err := json.Unmarshal([]byte(item), &entry); err != nil || entry.Block == nil {
+			continue // 跳过无效数据
+		}
+
+		entry.Block.Attempts = 0
+		if err := replay(entry.Block); err != nil {
+			// 放回死信队列，避免丢失
+			r.client.RPush(ctx, key, item)
+			return replayed, err
+		}
+		replayed++
+	}
+
+	return replayed, nil
+}
+
+// PushTransferDeadLetter 将保存失败的转账事件放入转账死信队列
+func (r *RedisClient) PushTransferDeadLetter(ctx context.Context, event *models.TransferEvent, reason string) error {
+	data, err := json.Marshal(&models.DeadLetterTransfer{
+		Event:    event,
+		Error:    reason,
+		FailedAt: time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("序列化死信转账事件失败: %w", err)
+	}
+
+	key := "transfer_dlq"
+	if err := r.client.LPush(ctx, key, data).Err(); err != nil {
+		return fmt.Errorf("推送死信转账事件失败: %w", err)
+	}
+	r.client.LTrim(ctx, key, 0, 99999) // 保留最近100000条死信
+
+	return nil
+}
+
+// ReplayTransferDeadLetters 重新保存转账死信队列中最旧的limit个事件，返回重放数量
+//
+// 保存失败时事件放回死信队列末尾（最旧的位置）并停止。保存按转账记录去重，已保存过的事件不会重复写入。
+func (r *RedisClient) ReplayTransferDeadLetters(ctx context.Context, limit int64) (int64, error) {
+	return r.ReplayTransferDeadLettersWith(ctx, limit, nil)
+}
+
+// ReplayTransferDeadLettersWith 与ReplayTransferDeadLetters相同，保存前先用prepare补充事件（如地址标签），prepare可以为nil
+func (r *RedisClient) ReplayTransferDeadLettersWith(ctx context.Context, limit int64, prepare func(*models.TransferEvent)) (int64, error) {
+	key := "transfer_dlq"
+	var replayed int64
+	for replayed < limit {
+		item, err := r.client.RPop(ctx, key).Result()
+		if err != nil {
+			if err == redis.Nil {
+				break // 死信队列已空
+			}
+			return replayed, fmt.Errorf("弹出死信转账事件失败: %w", err)
+		}
+
+		var entry models.DeadLetterTransfer
+		if err := json.Unmarshal([]byte(item), &entry); err != nil || entry.Event == nil {
+			continue // 跳过无效数据
+		}
+
+		if prepare != nil {
+			prepare(entry.Event)
+		}
+		if err := r.SaveTransferEvent(ctx, entry.Event); err != nil {
+			// 放回死信队列，避免丢失
+			r.client.RPush(ctx, key, item)
+			return replayed, err
+		}
+		replayed++
+	}
+
+	return replayed, nil
+}
+
+// GetTransferDeadLetters 获取转账死信队列中的事件（从新到旧）
+func (r *RedisClient) GetTransferDeadLetters(ctx context.Context, limit int64) ([]*models.DeadLetterTransfer, error) {
+	key := "transfer_dlq"
+	data, err := r.client.LRange(ctx, key, 0, limit-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("获取死信转账事件失败: %w", err)
+	}
+
+	var entries []*models.DeadLetterTransfer
+	for _, item := range data {
+		var entry models.DeadLetterTransfer
+		if err := json.Unmarshal([]byte(item), &entry); err != nil {
+			continue // 跳过无效数据
+		}
+		entries = append(entries, &entry)
+	}
+
+	return entries, nil
+}
+
+// SaveTransferEvent 保存转账事件
+//
+// 转账记录、各列表、区块索引和分组统计在同一个MULTI/EXEC中写入，要么全部成功要么全部不生效，
+// 失败后可整体重试。转账记录已存在（保存重试时上次EXEC其实已成功，或重复处理同一区块）时不再写入，
+// 避免列表出现重复条目、分组统计重复计数。已有记录来自另一个区块（区块哈希不同，即交易在重组后被新区块
+// 重新打包）时照常写入，原记录的列表条目和统计由撤销重组转账时扣除。
+func (r *RedisClient) SaveTransferEvent(ctx context.Context, event *models.TransferEvent) error {
+	release, err := r.acquireOp(ctx)
+	if err != nil {
+		return fmt.Errorf("保存转账事件失败: %w", err)
+	}
+	defer release()
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("序列化转账事件失败: %w", err)
+	}
+
+	key := transferKey(event)
+	saved := false
+	err = r.client.Watch(ctx, func(tx *redis.Tx) error {
+		existing, err := tx.Get(ctx, key).Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if err == nil && !reincluded(existing, event) {
+			return nil
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, data, 24*time.Hour)
+
+			// 不涉及监控地址的全链大额转账只保存到大额转账列表
+			if event.WhaleOnly {
+				pipe.LPush(ctx, "whale_transfers", data)
+				pipe.LTrim(ctx, "whale_transfers", 0, 9999) // 保留最近10000条大额转账记录
+				return nil
+			}
+
+			// 添加到转账列表
+			listKey := "transfers"
+			pipe.LPush(ctx, listKey, data)
+			pipe.LTrim(ctx, listKey, 0, transferListSize-1) // 保留最近10000条记录
+
+			// 按区块高度索引，用于区块范围查询
+			indexKey := "transfers_by_block"
+			pipe.ZAdd(ctx, indexKey, &redis.Z{Score: float64(event.BlockHeight), Member: data})
+			pipe.ZRemRangeByRank(ctx, indexKey, 0, -transferIndexSize-1) // 保留区块高度最高的100000条记录
+
+			// 如果是USDT转账，单独保存到USDT转账列表
+			if event.IsUSDT {
+				usdtListKey := "usdt_transfers"
+				pipe.LPush(ctx, usdtListKey, data)
+				pipe.LTrim(ctx, usdtListKey, 0, 9999) // 保留最近10000条USDT转账记录
+			}
+
+			// 按代币类型保存到独立列表
+			if size := r.tokenListSize(event.TokenType); size > 0 {
+				tokenListKey := tokenListKey(event.TokenType)
+				pipe.LPush(ctx, tokenListKey, data)
+				pipe.LTrim(ctx, tokenListKey, 0, size-1)
+			}
+
+			// 全链大额转账单独保存
+			if event.Whale {
+				whaleListKey := "whale_transfers"
+				pipe.LPush(ctx, whaleListKey, data)
+				pipe.LTrim(ctx, whaleListKey, 0, 9999) // 保留最近10000条大额转账记录
+			}
+
+			// 按分组保存转账记录并累计统计
+			for _, group := range event.Groups {
+				groupListKey := fmt.Sprintf("group_transfers:%s", group)
+				pipe.LPush(ctx, groupListKey, data)
+				pipe.LTrim(ctx, groupListKey, 0, 9999) // 每个分组保留最近10000条记录
+			}
+			countGroups(ctx, pipe, event, 1)
+			return nil
+		})
+		saved = err == nil
+		return err
+	}, key)
+	if err != nil {
+		return fmt.Errorf("保存转账事件失败: %w", wrapOOM(err))
+	}
+
+	// 发布实时转账事件
+	if saved {
+		r.client.Publish(ctx, r.channel("transfers_live"), data)
+	}
+
+	return nil
+}
+
+// reincluded 判断已保存的转账记录是否来自另一个区块：两者都记录了区块哈希且不同
+func reincluded(stored string, event *models.TransferEvent) bool {
+	if event.BlockHash == "" {
+		return false
+	}
+	var current models.TransferEvent
+	if err := json.Unmarshal([]byte(stored), &current); err != nil {
+		return false
+	}
+	return current.BlockHash != "" && current.BlockHash != event.BlockHash
+}
+
+// countGroups 按sign（1或-1）累计或扣减转账所属分组的笔数和按代币标识的金额合计
+func countGroups(ctx context.Context, pipe redis.Pipeliner, event *models.TransferEvent, sign int64) {
+	for _, group := range event.Groups {
+		groupStatsKey := fmt.Sprintf("group_stats:%s", group)
+		pipe.HIncrBy(ctx, groupStatsKey, "count", sign)
+		pipe.HIncrByFloat(ctx, groupStatsKey, "volume:"+models.NetFlowToken(event), float64(sign)*event.Amount)
+	}
+}
+
+// deleteTransferKey 删除转账记录，记录存在时同时扣减其分组统计，返回删除的键数
+func (r *RedisClient) deleteTransferKey(ctx context.Context, key string, event *models.TransferEvent) (int64, error) {
+	n, err := r.client.Del(ctx, key).Result()
+	if err != nil || n == 0 || len(event.Groups) == 0 {
+		return n, err
+	}
+	_, err = r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		countGroups(ctx, pipe, event, -1)
+		return nil
+	})
+	return n, err
+}
+
+// RevertTransfer 撤销所在区块已被重组的转账：删除转账记录及其在列表和区块索引中的条目，
+// 并在 transfers_reverted 频道发布撤销事件，供已收到该转账的下游对账
+//
+// 列表按保存时的序列化内容精确匹配，event必须与保存时一致。转账带有区块哈希时，
+// 交易已被新区块重新打包并保存的记录（区块哈希不同）不会被删除。
+func (r *RedisClient) RevertTransfer(ctx context.Context, event *models.TransferEvent, reverted *models.TransferReverted) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("序列化转账事件失败: %w", err)
+	}
+
+	key := transferKey(event)
+	keep := false
+	if event.BlockHash != "" {
+		stored, err := r.client.Get(ctx, key).Result()
+		if err != nil && err != redis.Nil {
+			return fmt.Errorf("获取转账事件失败: %w", err)
+		}
+		keep = err == nil && reincluded(stored, event)
+	}
+	if !keep {
+		if _, err := r.deleteTransferKey(ctx, key, event); err != nil {
+			return fmt.Errorf("删除转账事件失败: %w", err)
+		}
+	}
+	for _, listKey := range []string{"transfers", "usdt_transfers", "whale_transfers", tokenListKey(event.TokenType)} {
+		r.client.LRem(ctx, listKey, 0, data)
+	}
+	for _, group := range event.Groups {
+		r.client.LRem(ctx, fmt.Sprintf("group_transfers:%s", group), 0, data)
+	}
+	r.client.ZRem(ctx, "transfers_by_block", data)
+
+	payload, err := json.Marshal(reverted)
+	if err != nil {
+		return fmt.Errorf("序列化撤销事件失败: %w", err)
+	}
+	if err := r.client.Publish(ctx, r.channel("transfers_reverted"), payload).Err(); err != nil {
+		return fmt.Errorf("发布撤销事件失败: %w", err)
+	}
+
+	return nil
+}
+
+// channel 返回带redis.namespace前缀的发布订阅频道名，发布订阅不区分数据库，同一Redis上的多个实例需要用前缀隔离
+func (r *RedisClient) channel(name string) string {
+	if r.config.Redis.Namespace == "" {
+		return name
+	}
+	return r.config.Redis.Namespace + ":" + name
+}
+
+// SubscribeTransfers 订阅实时转账事件，返回事件通道和取消订阅函数
+func (r *RedisClient) SubscribeTransfers(ctx context.Context) (<-chan *models.TransferEvent, func() error, error) {
+	pubsub := r.client.Subscribe(ctx, r.channel("transfers_live"))
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, nil, fmt.Errorf("订阅实时转账事件失败: %w", err)
+	}
+
+	events := make(chan *models.TransferEvent, 64)
+	go func() {
+		defer close(events)
+		for msg := range pubsub.Channel() {
+			var event models.TransferEvent
+			if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+				continue // 跳过无效数据
+			}
+
+			select {
+			case events <- &event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return events, pubsub.Close, nil
+}
+
+// SavePermissionUpdate 保存账户权限变更事件
+func (r *RedisClient) SavePermissionUpdate(ctx context.Context, event *models.PermissionUpdateEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("序列化权限变更事件失败: %w", err)
+	}
+
+	key := "permission_updates"
+	if err := r.client.LPush(ctx, key, data).Err(); err != nil {
+		return fmt.Errorf("保存权限变更事件失败: %w", err)
+	}
+	r.client.LTrim(ctx, key, 0, 999) // 保留最近1000条记录
+
+	return nil
+}
+
+// GetRecentPermissionUpdates 获取最近的账户权限变更事件
+func (r *RedisClient) GetRecentPermissionUpdates(ctx context.Context, limit int64) ([]*models.PermissionUpdateEvent, error) {
+	key := "permission_updates"
+	data, err := r.client.LRange(ctx, key, 0, limit-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("获取权限变更事件失败: %w", err)
+	}
+
+	var events []*models.PermissionUpdateEvent
+	for _, item := range data {
+		var event models.PermissionUpdateEvent
+		if err := json.Unmarshal([]byte(item), &event); err != nil {
+			continue // 跳过无效数据
+		}
+		events = append(events, &event)
+	}
+
+	return events, nil
+}
+
+// SaveRawTransaction 以gzip压缩保存原始交易JSON，返回存储键
+//
+// 压缩后超过maxBytes的交易不保存，返回空键。
+func (r *RedisClient) SaveRawTransaction(ctx context.Context, txHash string, raw []byte, ttl time.Duration, maxBytes int) (string, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(raw); err != nil {
+		return "", fmt.Errorf("压缩原始交易失败: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return "", fmt.Errorf("压缩原始交易失败: %w", err)
+	}
+
+	if buf.Len() > maxBytes {
+		return "", nil
+	}
+
+	key := fmt.Sprintf("raw_tx:%s", txHash)
+	if err := r.client.Set(ctx, key, buf.Bytes(), ttl).Err(); err != nil {
+		return "", fmt.Errorf("保存原始交易失败: %w", err)
+	}
+
+	return key, nil
+}
+
+// GetRawTransaction 获取并解压原始交易JSON，不存在时返回nil
+func (r *RedisClient) GetRawTransaction(ctx context.Context, txHash string) ([]byte, error) {
+	key := fmt.Sprintf("raw_tx:%s", txHash)
+	data, err := r.client.Get(ctx, key).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("获取原始交易失败: %w", err)
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("解压原始交易失败: %w", err)
+	}
+	defer zr.Close()
+
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("解压原始交易失败: %w", err)
+	}
+
+	return raw, nil
+}
+
+// SaveContractEvent 保存自定义合约事件
+func (r *RedisClient) SaveContractEvent(ctx context.Context, event *models.ContractEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("序列化合约事件失败: %w", err)
+	}
+
+	key := "contract_events"
+	if err := r.client.LPush(ctx, key, data).Err(); err != nil {
+		return fmt.Errorf("保存合约事件失败: %w", err)
+	}
+	r.client.LTrim(ctx, key, 0, 9999) // 保留最近10000条记录
+
+	return nil
+}
+
+// GetRecentContractEvents 获取最近的自定义合约事件
+func (r *RedisClient) GetRecentContractEvents(ctx context.Context, limit int64) ([]*models.ContractEvent, error) {
+	key := "contract_events"
+	data, err := r.client.LRange(ctx, key, 0, limit-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("获取合约事件失败: %w", err)
+	}
+
+	var events []*models.ContractEvent
+	for _, item := range data {
+		var event models.ContractEvent
+		if err := json.Unmarshal([]byte(item), &event); err != nil {
+			continue // 跳过无效数据
+		}
+		events = append(events, &event)
+	}
+
+	return events, nil
+}
+
+// SaveDecodeFailure 保存无法解码的合约调用记录
+func (r *RedisClient) SaveDecodeFailure(ctx context.Context, failure *models.DecodeFailure) error {
+	data, err := json.Marshal(failure)
+	if err != nil {
+		return fmt.Errorf("序列化解码失败记录失败: %w", err)
+	}
+
+	key := "decode_failures"
+	if err := r.client.LPush(ctx, key, data).Err(); err != nil {
+		return fmt.Errorf("保存解码失败记录失败: %w", err)
+	}
+	r.client.LTrim(ctx, key, 0, r.config.Monitor.DecodeFailureMaxRecords-1)
+
+	return nil
+}
+
+// GetRecentDecodeFailures 获取最近的解码失败记录
+func (r *RedisClient) GetRecentDecodeFailures(ctx context.Context, limit int64) ([]*models.DecodeFailure, error) {
+	key := "decode_failures"
+	data, err := r.client.LRange(ctx, key, 0, limit-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("获取解码失败记录失败: %w", err)
+	}
+
+	var failures []*models.DecodeFailure
+	for _, item := range data {
+		var failure models.DecodeFailure
+		if err := json.Unmarshal([]byte(item), &failure); err != nil {
+			continue // 跳过无效数据
+		}
+		failures = append(failures, &failure)
+	}
+
+	return failures, nil
+}
+
+// tokenTypes 转账事件的代币类型，每种类型有独立的转账列表
+var tokenTypes = []string{"TRX", "TRC10", "TRC20", "USDT", "TRC721"}
+
+// tokenListKey 代币类型的转账列表键
+func tokenListKey(tokenType string) string {
+	return fmt.Sprintf("transfers:%s", strings.ToUpper(tokenType))
+}
+
+// tokenListSize 代币类型的转账列表保留条数，未单独配置时使用redis.token_list_size
+func (r *RedisClient) tokenListSize(tokenType string) int64 {
+	if size, ok := r.tokenListSizes[strings.ToUpper(tokenType)]; ok {
+		return size
+	}
+	return r.config.Redis.TokenListSize
+}
+
+// transferKey 转账事件的键：交易哈希，同一交易日志中的其他Transfer事件追加日志序号
+func transferKey(event *models.TransferEvent) string {
+	if event.LogIndex > 0 {
+		return fmt.Sprintf("transfer:%s:%d", event.TxHash, event.LogIndex)
+	}
+	return fmt.Sprintf("transfer:%s", event.TxHash)
+}
+
+// GetTransferEvent 获取转账事件
+func (r *RedisClient) GetTransferEvent(ctx context.Context, txHash string) (*models.TransferEvent, error) {
+	key := fmt.Sprintf("transfer:%s", txHash)
+	data, err := r.client.Get(ctx, key).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("获取转账事件失败: %w", err)
+	}
+
+	var event models.TransferEvent
+	if err := json.Unmarshal([]byte(data), &event); err != nil {
+		return nil, fmt.Errorf("反序列化转账事件失败: %w", err)
+	}
+
+	return &event, nil
+}
+
+// GetStoredTransfer 获取与event对应（交易哈希和日志序号相同）的已保存转账，不存在时返回nil
+func (r *RedisClient) GetStoredTransfer(ctx context.Context, event *models.TransferEvent) (*models.TransferEvent, error) {
+	data, err := r.client.Get(ctx, transferKey(event)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("获取已保存的转账事件失败: %w", err)
+	}
+
+	var stored models.TransferEvent
+	if err := json.Unmarshal([]byte(data), &stored); err != nil {
+		return nil, fmt.Errorf("反序列化转账事件失败: %w", err)
+	}
+
+	return &stored, nil
+}
+
+// AddWatchAddress 添加监控地址
+//
+// entry.Group为空表示不属于任何分组，entry.Token为空表示匹配任意代币。
+func (r *RedisClient) AddWatchAddress(ctx context.Context, entry models.WatchAddress) error {
+	address := entry.Address
+	key := "watch_addresses"
+	err := r.client.SAdd(ctx, key, address).Err()
+	if err != nil {
+		return fmt.Errorf("添加监控地址失败: %w", err)
+	}
+
+	// 记录地址所属分组
+	if entry.Group != "" {
+		if err := r.client.HSet(ctx, "address_groups", address, entry.Group).Err(); err != nil {
+			return fmt.Errorf("保存地址分组失败: %w", err)
+		}
+		r.client.SAdd(ctx, "groups", entry.Group)
+	}
+
+	// 记录代币范围，未指定时清除之前的范围
+	if entry.Token != "" {
+		if err := r.client.HSet(ctx, "watch_scopes", address, entry.Token).Err(); err != nil {
+			return fmt.Errorf("保存监控代币范围失败: %w", err)
+		}
+	} else {
+		r.client.HDel(ctx, "watch_scopes", address)
+	}
+
+	// 保存地址信息
+	addrInfo := models.WatchAddress{
+		Address: address,
+		Group:   entry.Group,
+		Token:   entry.Token,
+		AddedAt: time.Now(),
+	}
+
+	addrData, err := json.Marshal(addrInfo)
+	if err != nil {
+		return fmt.Errorf("序列化地址信息失败: %w", err)
+	}
+
+	addrKey := fmt.Sprintf("address_info:%s", address)
+	err = r.client.Set(ctx, addrKey, addrData, 0).Err()
+	if err != nil {
+		return fmt.Errorf("保存地址信息失败: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveWatchAddress 移除监控地址
+func (r *RedisClient) RemoveWatchAddress(ctx context.Context, address string) error {
+	key := "watch_addresses"
+	err := r.client.SRem(ctx, key, address).Err()
+	if err != nil {
+		return fmt.Errorf("移除监控地址失败: %w", err)
+	}
+
+	// 删除地址信息和分组
+	addrKey := fmt.Sprintf("address_info:%s", address)
+	r.client.Del(ctx, addrKey)
+	r.client.HDel(ctx, "address_groups", address)
+	r.client.HDel(ctx, "watch_scopes", address)
+
+	return nil
+}
+
+// GetWatchScopes 获取限定了代币范围的监控地址（地址 -> 代币类型或合约地址）
+func (r *RedisClient) GetWatchScopes(ctx context.Context) (map[string]string, error) {
+	scopes, err := r.client.HGetAll(ctx, "watch_scopes").Result()
+	if err != nil {
+		return nil, fmt.Errorf("获取监控代币范围失败: %w", err)
+	}
+
+	return scopes, nil
+}
+
+// GetAddressGroups 获取监控地址所属的分组（地址 -> 分组名）
+func (r *RedisClient) GetAddressGroups(ctx context.Context) (map[string]string, error) {
+	groups, err := r.client.HGetAll(ctx, "address_groups").Result()
+	if err != nil {
+		return nil, fmt.Errorf("获取地址分组失败: %w", err)
+	}
+
+	return groups, nil
+}
+
+// GetGroupStats 获取所有分组的聚合统计
+func (r *RedisClient) GetGroupStats(ctx context.Context) ([]*models.GroupStats, error) {
+	names, err := r.client.SMembers(ctx, "groups").Result()
+	if err != nil {
+		return nil, fmt.Errorf("获取分组列表失败: %w", err)
+	}
+	sort.Strings(names)
+
+	stats := make([]*models.GroupStats, 0, len(names))
+	for _, name := range names {
+		fields, err := r.client.HGetAll(ctx, fmt.Sprintf("group_stats:%s", name)).Result()
+		if err != nil {
+			return nil, fmt.Errorf("获取分组 %s 统计失败: %w", name, err)
+		}
+
+		groupStats := &models.GroupStats{Name: name, Volume: make(map[string]float64)}
+		for field, value := range fields {
+			if field == "count" {
+				groupStats.TransferCount, _ = strconv.ParseInt(value, 10, 64)
+				continue
+			}
+			if token := strings.TrimPrefix(field, "volume:"); token != field {
+				groupStats.Volume[token], _ = strconv.ParseFloat(value, 64)
+			}
+		}
+		stats = append(stats, groupStats)
+	}
+
+	return stats, nil
+}
+
+// GetGroupTransfers 获取分组最近的转账记录
+func (r *RedisClient) GetGroupTransfers(ctx context.Context, group string, limit int64) ([]*models.TransferEvent, error) {
+	key := fmt.Sprintf("group_transfers:%s", group)
+	data, err := r.client.LRange(ctx, key, 0, limit-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("获取分组转账记录失败: %w", err)
+	}
+
+	var events []*models.TransferEvent
+	for _, item := range data {
+		var event models.TransferEvent
+		if err := json.Unmarshal([]byte(item), &event); err != nil {
+			continue // 跳过无效数据
+		}
+		events = append(events, &event)
+	}
+
+	r.sortBlockOrder(events)
+	return events, nil
 }
 
-// SaveTransferEvent 保存转账事件
-func (r *RedisClient) SaveTransferEvent(ctx context.Context, event *models.TransferEvent) error {
-	data, err := json.Marshal(event)
-	if err != nil {
-		return fmt.Errorf("序列化转账事件失败: %w", err)
-	}
-
-	// 使用交易哈希作为键
-	key := fmt.Sprintf("transfer:%s", event.TxHash)
-	err = r.client.Set(ctx, key, data, 24*time.Hour).Err()
+// GetRecentTransfersByToken 获取指定代币类型最近的转账记录
+func (r *RedisClient) GetRecentTransfersByToken(ctx context.Context, tokenType string, limit int64) ([]*models.TransferEvent, error) {
+	data, err := r.client.LRange(ctx, tokenListKey(tokenType), 0, limit-1).Result()
 	if err != nil {
-		return fmt.Errorf("保存转账事件失败: %w", err)
+		return nil, fmt.Errorf("获取 %s 转账记录失败: %w", tokenType, err)
 	}
 
-	// 添加到转账列表
-	listKey := "transfers"
-	r.client.LPush(ctx, listKey, data)
-	r.client.LTrim(ctx, listKey, 0, 9999) // 保留最近10000条记录
-
-	// 如果是USDT转账，单独保存到USDT转账列表
-	if event.IsUSDT {
-		usdtListKey := "usdt_transfers"
-		r.client.LPush(ctx, usdtListKey, data)
-		r.client.LTrim(ctx, usdtListKey, 0, 9999) // 保留最近10000条USDT转账记录
+	var events []*models.TransferEvent
+	for _, item := range data {
+		var event models.TransferEvent
+		if err := json.Unmarshal([]byte(item), &event); err != nil {
+			continue // 跳过无效数据
+		}
+		events = append(events, &event)
 	}
+	r.sortBlockOrder(events)
 
-	return nil
+	return events, nil
 }
 
-// GetTransferEvent 获取转账事件
-func (r *RedisClient) GetTransferEvent(ctx context.Context, txHash string) (*models.TransferEvent, error) {
-	key := fmt.Sprintf("transfer:%s", txHash)
-	data, err := r.client.Get(ctx, key).Result()
-	if err != nil {
-		if err == redis.Nil {
-			return nil, nil
+// PurgeAddressData 删除地址相关的转账记录、权限变更记录和地址信息（尽力而为），返回各类数据删除的条数
+//
+// 单条记录删除失败不会中断清理，错误会汇总返回。
+func (r *RedisClient) PurgeAddressData(ctx context.Context, address string) (map[string]int64, error) {
+	removed := make(map[string]int64)
+	var errs []string
+
+	involves := func(item string) bool {
+		var event models.TransferEvent
+		if err := json.Unmarshal([]byte(item), &event); err != nil {
+			return false
 		}
-		return nil, fmt.Errorf("获取转账事件失败: %w", err)
+		return event.Source == address || event.Destination == address
 	}
 
-	var event models.TransferEvent
-	if err := json.Unmarshal([]byte(data), &event); err != nil {
-		return nil, fmt.Errorf("反序列化转账事件失败: %w", err)
+	// 转账列表
+	transferKeys := make(map[string]*models.TransferEvent)
+	listKeys := []string{"transfers", "usdt_transfers", "whale_transfers"}
+	for _, tokenType := range tokenTypes {
+		listKeys = append(listKeys, tokenListKey(tokenType))
+	}
+	groups, err := r.client.SMembers(ctx, "groups").Result()
+	if err != nil {
+		errs = append(errs, fmt.Sprintf("读取分组列表失败: %v", err))
+	}
+	for _, group := range groups {
+		listKeys = append(listKeys, fmt.Sprintf("group_transfers:%s", group))
+	}
+	for _, listKey := range listKeys {
+		items, err := r.filterList(ctx, listKey, involves)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("清理 %s 失败: %v", listKey, err))
+			continue
+		}
+		removed[listKey] += int64(len(items))
+		for _, item := range items {
+			var event models.TransferEvent
+			json.Unmarshal([]byte(item), &event)
+			transferKeys[transferKey(&event)] = &event
+		}
 	}
 
-	return &event, nil
-}
+	// 区块高度索引，先按地址字符串粗筛再精确匹配
+	indexKey := "transfers_by_block"
+	iter := r.client.ZScan(ctx, indexKey, 0, "*"+address+"*", 1000).Iterator()
+	for iter.Next(ctx) {
+		member := iter.Val()
+		if !iter.Next(ctx) {
+			break // ZSCAN结果为成员和分数交替出现
+		}
+		if !involves(member) {
+			continue
+		}
+		if err := r.client.ZRem(ctx, indexKey, member).Err(); err != nil {
+			errs = append(errs, fmt.Sprintf("删除 %s 记录失败: %v", indexKey, err))
+			continue
+		}
+		removed[indexKey]++
 
-// AddWatchAddress 添加监控地址
-func (r *RedisClient) AddWatchAddress(ctx context.Context, address string) error {
-	key := "watch_addresses"
-	err := r.client.SAdd(ctx, key, address).Err()
-	if err != nil {
-		return fmt.Errorf("添加监控地址失败: %w", err)
+		var event models.TransferEvent
+		json.Unmarshal([]byte(member), &event)
+		transferKeys[transferKey(&event)] = &event
+	}
+	if err := iter.Err(); err != nil {
+		errs = append(errs, fmt.Sprintf("扫描 %s 失败: %v", indexKey, err))
 	}
 
-	// 保存地址信息
-	addrInfo := models.WatchAddress{
-		Address: address,
-		AddedAt: time.Now(),
+	// 按交易哈希保存的转账事件，同时扣减分组统计
+	for key, event := range transferKeys {
+		n, err := r.deleteTransferKey(ctx, key, event)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("删除转账事件 %s 失败: %v", key, err))
+			continue
+		}
+		removed["transfer"] += n
 	}
-	
-	addrData, err := json.Marshal(addrInfo)
+
+	// 权限变更记录
+	permissionKey := "permission_updates"
+	items, err := r.filterList(ctx, permissionKey, func(item string) bool {
+		var event models.PermissionUpdateEvent
+		return json.Unmarshal([]byte(item), &event) == nil && event.Owner == address
+	})
 	if err != nil {
-		return fmt.Errorf("序列化地址信息失败: %w", err)
+		errs = append(errs, fmt.Sprintf("清理 %s 失败: %v", permissionKey, err))
+	} else {
+		removed[permissionKey] += int64(len(items))
 	}
 
-	addrKey := fmt.Sprintf("address_info:%s", address)
-	err = r.client.Set(ctx, addrKey, addrData, 0).Err()
+	// 地址信息
+	n, err := r.client.Del(ctx, fmt.Sprintf("address_info:%s", address)).Result()
 	if err != nil {
-		return fmt.Errorf("保存地址信息失败: %w", err)
+		errs = append(errs, fmt.Sprintf("删除地址信息失败: %v", err))
+	} else {
+		removed["address_info"] = n
 	}
 
-	return nil
+	if len(errs) > 0 {
+		return removed, fmt.Errorf("清理地址数据部分失败: %s", strings.Join(errs, "; "))
+	}
+	return removed, nil
 }
 
-// RemoveWatchAddress 移除监控地址
-func (r *RedisClient) RemoveWatchAddress(ctx context.Context, address string) error {
-	key := "watch_addresses"
-	err := r.client.SRem(ctx, key, address).Err()
-	if err != nil {
-		return fmt.Errorf("移除监控地址失败: %w", err)
-	}
+// filterList 一次读取列表，在MULTI中用保留的条目整体替换列表，返回被删除的条目
+//
+// 读取前WATCH列表，期间有新写入时事务失败并重新读取，最多重试5次。
+func (r *RedisClient) filterList(ctx context.Context, key string, drop func(item string) bool) ([]string, error) {
+	var removed []string
+	var err error
+	for attempt := 0; attempt < 5; attempt++ {
+		err = r.client.Watch(ctx, func(tx *redis.Tx) error {
+			items, err := tx.LRange(ctx, key, 0, -1).Result()
+			if err != nil {
+				return err
+			}
 
-	// 删除地址信息
-	addrKey := fmt.Sprintf("address_info:%s", address)
-	r.client.Del(ctx, addrKey)
+			removed = removed[:0]
+			kept := make([]interface{}, 0, len(items))
+			for _, item := range items {
+				if drop(item) {
+					removed = append(removed, item)
+				} else {
+					kept = append(kept, item)
+				}
+			}
+			if len(removed) == 0 {
+				return nil
+			}
 
-	return nil
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Del(ctx, key)
+				if len(kept) > 0 {
+					pipe.RPush(ctx, key, kept...)
+				}
+				return nil
+			})
+			return err
+		}, key)
+		if err != redis.TxFailedErr {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return removed, nil
 }
 
 // GetWatchAddresses 获取所有监控地址
 func (r *RedisClient) GetWatchAddresses(ctx context.Context) ([]string, error) {
+	release, err := r.acquireOp(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("获取监控地址失败: %w", err)
+	}
+	defer release()
+
 	key := "watch_addresses"
 	addresses, err := r.client.SMembers(ctx, key).Result()
 	if err != nil {
@@ -189,6 +1120,38 @@ func (r *RedisClient) GetWatchAddresses(ctx context.Context) ([]string, error) {
 	return addresses, nil
 }
 
+// GetAddressInfos 批量获取地址统计信息，没有统计信息的地址不返回
+func (r *RedisClient) GetAddressInfos(ctx context.Context, addresses []string) ([]*models.WatchAddress, error) {
+	if len(addresses) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, len(addresses))
+	for i, address := range addresses {
+		keys[i] = fmt.Sprintf("address_info:%s", address)
+	}
+
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("获取地址信息失败: %w", err)
+	}
+
+	infos := make([]*models.WatchAddress, 0, len(values))
+	for _, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue // 键不存在
+		}
+		var info models.WatchAddress
+		if err := json.Unmarshal([]byte(data), &info); err != nil {
+			continue // 跳过无效数据
+		}
+		infos = append(infos, &info)
+	}
+
+	return infos, nil
+}
+
 // IsWatchAddress 检查是否为监控地址
 func (r *RedisClient) IsWatchAddress(ctx context.Context, address string) (bool, error) {
 	key := "watch_addresses"
@@ -200,14 +1163,25 @@ func (r *RedisClient) IsWatchAddress(ctx context.Context, address string) (bool,
 	return exists, nil
 }
 
+// GetAddressLabels 获取地址标签
+func (r *RedisClient) GetAddressLabels(ctx context.Context) (map[string]string, error) {
+	key := "address_labels"
+	labels, err := r.client.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("获取地址标签失败: %w", err)
+	}
+
+	return labels, nil
+}
+
 // UpdateAddressStats 更新地址统计信息
 func (r *RedisClient) UpdateAddressStats(ctx context.Context, address string, event *models.TransferEvent) error {
 	addrKey := fmt.Sprintf("address_info:%s", address)
-	
+
 	// 获取现有地址信息
 	addrData, err := r.client.Get(ctx, addrKey).Result()
 	var addrInfo models.WatchAddress
-	
+
 	if err == redis.Nil {
 		// 地址信息不存在，创建新的
 		addrInfo = models.WatchAddress{
@@ -276,6 +1250,143 @@ func (r *RedisClient) GetSystemStats(ctx context.Context) (*models.SystemStats,
 	return &stats, nil
 }
 
+// SaveStatsSnapshot 记录一次统计快照，每个指标一个有序集合（分数为Unix秒），并清理超过保留时长的数据点
+func (r *RedisClient) SaveStatsSnapshot(ctx context.Context, at time.Time, metrics map[string]int64, retention time.Duration) error {
+	ts := at.Unix()
+	cutoff := strconv.FormatInt(at.Add(-retention).Unix(), 10)
+
+	for metric, value := range metrics {
+		key := "stats_history:" + metric
+		// 成员带上时间戳，避免相同数值的数据点互相覆盖
+		member := fmt.Sprintf("%d:%d", ts, value)
+		if err := r.client.ZAdd(ctx, key, &redis.Z{Score: float64(ts), Member: member}).Err(); err != nil {
+			return fmt.Errorf("保存统计快照失败: %w", err)
+		}
+		r.client.ZRemRangeByScore(ctx, key, "-inf", "("+cutoff)
+	}
+
+	return nil
+}
+
+// GetStatsHistory 获取指标在[from, to]时间范围内的数据点，按时间升序
+func (r *RedisClient) GetStatsHistory(ctx context.Context, metric string, from, to time.Time) ([]models.StatsPoint, error) {
+	key := "stats_history:" + metric
+	data, err := r.client.ZRangeByScore(ctx, key, &redis.ZRangeBy{
+		Min: strconv.FormatInt(from.Unix(), 10),
+		Max: strconv.FormatInt(to.Unix(), 10),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("获取统计历史失败: %w", err)
+	}
+
+	points := make([]models.StatsPoint, 0, len(data))
+	for _, item := range data {
+		var point models.StatsPoint
+		if _, err := fmt.Sscanf(item, "%d:%d", &point.Timestamp, &point.Value); err != nil {
+			continue // 跳过无效数据
+		}
+		points = append(points, point)
+	}
+
+	return points, nil
+}
+
+// SaveProcessorCursor 保存区块处理游标（已连续处理到的区块高度）
+//
+// 多个工作线程并发保存时只允许游标前进：已保存的游标不低于height时不写入（WATCH检查后写入，冲突时重试）。
+func (r *RedisClient) SaveProcessorCursor(ctx context.Context, height int64) error {
+	key := "processor_cursor"
+	var err error
+	for attempt := 0; attempt < 3; attempt++ {
+		err = r.client.Watch(ctx, func(tx *redis.Tx) error {
+			current, err := tx.Get(ctx, key).Int64()
+			if err != nil && err != redis.Nil {
+				return err
+			}
+			if err == nil && current >= height {
+				return nil
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Set(ctx, key, height, 0)
+				return nil
+			})
+			return err
+		}, key)
+		if err != redis.TxFailedErr {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("保存区块处理游标失败: %w", err)
+	}
+
+	return nil
+}
+
+// GetProcessorCursor 读取区块处理游标，没有时返回0
+func (r *RedisClient) GetProcessorCursor(ctx context.Context) (int64, error) {
+	key := "processor_cursor"
+	height, err := r.client.Get(ctx, key).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("读取区块处理游标失败: %w", err)
+	}
+
+	return height, nil
+}
+
+// SavePendingConfirmations 保存等待确认的区块（高度 -> 序列化内容），重启后继续等待确认
+func (r *RedisClient) SavePendingConfirmations(ctx context.Context, blocks map[int64][]byte) error {
+	if len(blocks) == 0 {
+		return nil
+	}
+
+	values := make([]interface{}, 0, len(blocks)*2)
+	for height, data := range blocks {
+		values = append(values, strconv.FormatInt(height, 10), data)
+	}
+	if err := r.client.HSet(ctx, "pending_confirmations", values...).Err(); err != nil {
+		return fmt.Errorf("保存待确认区块失败: %w", err)
+	}
+	return nil
+}
+
+// DeletePendingConfirmations 删除已确认或已丢弃的待确认区块
+func (r *RedisClient) DeletePendingConfirmations(ctx context.Context, heights ...int64) error {
+	if len(heights) == 0 {
+		return nil
+	}
+
+	fields := make([]string, len(heights))
+	for i, height := range heights {
+		fields[i] = strconv.FormatInt(height, 10)
+	}
+	if err := r.client.HDel(ctx, "pending_confirmations", fields...).Err(); err != nil {
+		return fmt.Errorf("删除待确认区块失败: %w", err)
+	}
+	return nil
+}
+
+// GetPendingConfirmations 读取所有等待确认的区块，跳过无效的高度
+func (r *RedisClient) GetPendingConfirmations(ctx context.Context) (map[int64][]byte, error) {
+	fields, err := r.client.HGetAll(ctx, "pending_confirmations").Result()
+	if err != nil {
+		return nil, fmt.Errorf("读取待确认区块失败: %w", err)
+	}
+
+	blocks := make(map[int64][]byte, len(fields))
+	for field, data := range fields {
+		height, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			continue // 跳过无效数据
+		}
+		blocks[height] = []byte(data)
+	}
+	return blocks, nil
+}
+
 // GetQueueSize 获取队列大小
 func (r *RedisClient) GetQueueSize(ctx context.Context) (int64, error) {
 	key := "block_queue"
@@ -314,6 +1425,69 @@ func (r *RedisClient) GetRecentTransfers(ctx context.Context, limit int64) ([]*m
 		}
 		events = append(events, &event)
 	}
+	r.sortBlockOrder(events)
+
+	return events, nil
+}
+
+// sortBlockOrder 启用redis.block_ordered时将转账按区块从新到旧、区块内按交易、合约和日志序号从小到大排序
+//
+// 转账按保存先后LPUSH，同一区块内顺序相反，多个工作线程并发保存时还会交错。
+func (r *RedisClient) sortBlockOrder(events []*models.TransferEvent) {
+	if !r.config.Redis.BlockOrdered {
+		return
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		a, b := events[i], events[j]
+		if a.BlockHeight != b.BlockHeight {
+			return a.BlockHeight > b.BlockHeight
+		}
+		if a.TxIndex != b.TxIndex {
+			return a.TxIndex < b.TxIndex
+		}
+		if a.ContractIndex != b.ContractIndex {
+			return a.ContractIndex < b.ContractIndex
+		}
+		return a.LogIndex < b.LogIndex
+	})
+}
+
+// GetTransfersSince 获取游标之后的转账记录，按时间升序返回，最多limit条
+//
+// 游标为事件ID（见TransferEvent.EventID，同一交易的多笔转账按日志序号区分）时返回该事件之后保存的记录；
+// 为区块时间（毫秒）时返回时间晚于该值的记录。游标已超出保留范围时返回最近的limit条。
+func (r *RedisClient) GetTransfersSince(ctx context.Context, sinceID string, sinceTimestamp int64, limit int64) ([]*models.TransferEvent, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	key := "transfers"
+	data, err := r.client.LRange(ctx, key, 0, limit-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("获取游标之后的转账记录失败: %w", err)
+	}
+
+	// 列表从新到旧排列，遇到游标即停止
+	var events []*models.TransferEvent
+	for _, item := range data {
+		var event models.TransferEvent
+		if err := json.Unmarshal([]byte(item), &event); err != nil {
+			continue // 跳过无效数据
+		}
+		if sinceID != "" && event.EventID() == sinceID {
+			break
+		}
+		if sinceID == "" && event.Timestamp <= sinceTimestamp {
+			break
+		}
+		events = append(events, &event)
+	}
+
+	// 反转为从旧到新
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
 
 	return events, nil
 }
@@ -335,5 +1509,166 @@ func (r *RedisClient) GetRecentUSDTTransfers(ctx context.Context, limit int64) (
 		events = append(events, &event)
 	}
 
+	r.sortBlockOrder(events)
 	return events, nil
 }
+
+// GetRecentWhaleTransfers 获取最近的全链大额USDT转账记录
+func (r *RedisClient) GetRecentWhaleTransfers(ctx context.Context, limit int64) ([]*models.TransferEvent, error) {
+	key := "whale_transfers"
+	data, err := r.client.LRange(ctx, key, 0, limit-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("获取最近大额转账记录失败: %w", err)
+	}
+
+	var events []*models.TransferEvent
+	for _, item := range data {
+		var event models.TransferEvent
+		if err := json.Unmarshal([]byte(item), &event); err != nil {
+			continue // 跳过无效数据
+		}
+		events = append(events, &event)
+	}
+
+	return events, nil
+}
+
+// GetTransfersByBlockRange 获取区块高度在[fromBlock, toBlock]闭区间内的转账记录，按区块高度升序
+//
+// truncated为true表示结果不完整：匹配的记录超过limit，或索引已满且fromBlock不高于索引中最早的区块
+// （更早的记录已被淘汰）。
+func (r *RedisClient) GetTransfersByBlockRange(ctx context.Context, fromBlock, toBlock, limit int64) ([]*models.TransferEvent, bool, error) {
+	key := "transfers_by_block"
+	data, err := r.client.ZRangeByScore(ctx, key, &redis.ZRangeBy{
+		Min:   strconv.FormatInt(fromBlock, 10),
+		Max:   strconv.FormatInt(toBlock, 10),
+		Count: limit + 1,
+	}).Result()
+	if err != nil {
+		return nil, false, fmt.Errorf("按区块范围获取转账记录失败: %w", err)
+	}
+
+	truncated := int64(len(data)) > limit
+	if truncated {
+		data = data[:limit]
+	} else {
+		size, err := r.client.ZCard(ctx, key).Result()
+		if err != nil {
+			return nil, false, fmt.Errorf("按区块范围获取转账记录失败: %w", err)
+		}
+		if size >= transferIndexSize {
+			oldest, err := r.client.ZRangeWithScores(ctx, key, 0, 0).Result()
+			if err != nil {
+				return nil, false, fmt.Errorf("按区块范围获取转账记录失败: %w", err)
+			}
+			truncated = len(oldest) > 0 && float64(fromBlock) <= oldest[0].Score
+		}
+	}
+
+	var events []*models.TransferEvent
+	for _, item := range data {
+		var event models.TransferEvent
+		if err := json.Unmarshal([]byte(item), &event); err != nil {
+			continue // 跳过无效数据
+		}
+		events = append(events, &event)
+	}
+
+	return events, truncated, nil
+}
+
+// GetTransfersByTimeRange 获取区块时间（毫秒）在[from, to]内的转账记录
+//
+// 扫描完整的最近转账列表（最多10000条），历史同步写入的记录在列表中不一定按时间排序，
+// 因此不按时间提前结束扫描。列表已满且from不晚于列表中最早的区块时间时，更早的记录可能已被淘汰，
+// truncated返回true。
+func (r *RedisClient) GetTransfersByTimeRange(ctx context.Context, from, to int64) ([]*models.TransferEvent, bool, error) {
+	var events []*models.TransferEvent
+	var scanned, oldest int64
+	err := r.streamTransferList(ctx, "transfers", transferListSize, func(event *models.TransferEvent) error {
+		if scanned == 0 || event.Timestamp < oldest {
+			oldest = event.Timestamp
+		}
+		scanned++
+		if event.Timestamp >= from && event.Timestamp <= to {
+			events = append(events, event)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("按时间范围获取转账记录失败: %w", err)
+	}
+	return events, scanned >= transferListSize && from <= oldest, nil
+}
+
+// StreamRecentTransfers 分块流式读取最近的转账记录，按从新到旧的顺序逐条回调
+func (r *RedisClient) StreamRecentTransfers(ctx context.Context, limit int64, fn func(*models.TransferEvent) error) error {
+	return r.streamTransferList(ctx, "transfers", limit, fn)
+}
+
+// streamTransferList 以LRANGE窗口分块读取转账列表，避免一次性加载全部记录
+//
+// 列表在读取期间可能被LPUSH插入新记录，导致后续窗口整体后移。每个窗口会多读取
+// 上一窗口的最后一条记录用于定位，跳过因后移而重复的记录。
+func (r *RedisClient) streamTransferList(ctx context.Context, key string, limit int64, fn func(*models.TransferEvent) error) error {
+	chunkSize := r.config.Redis.StreamChunkSize
+	var delivered, start int64
+	var last string
+
+	for delivered < limit {
+		size := chunkSize
+		if remaining := limit - delivered; remaining < size {
+			size = remaining
+		}
+
+		// 除第一个窗口外，向前多读一条作为定位锚点
+		from := start
+		if last != "" {
+			from = start - 1
+		}
+		data, err := r.client.LRange(ctx, key, from, start+size-1).Result()
+		if err != nil {
+			return fmt.Errorf("分块读取转账记录失败: %w", err)
+		}
+		if len(data) == 0 {
+			return nil // 列表在读取期间被截短或重建
+		}
+
+		if last != "" {
+			// 找不到锚点时按未发生后移处理
+			skip := 1
+			for i, item := range data {
+				if item == last {
+					skip = i + 1
+					break
+				}
+			}
+			start += int64(skip - 1)
+			data = data[skip:]
+		}
+
+		if len(data) == 0 {
+			return nil
+		}
+
+		for _, item := range data {
+			if delivered >= limit {
+				return nil
+			}
+
+			var event models.TransferEvent
+			if err := json.Unmarshal([]byte(item), &event); err != nil {
+				continue // 跳过无效数据
+			}
+			if err := fn(&event); err != nil {
+				return err
+			}
+			delivered++
+		}
+
+		start += int64(len(data))
+		last = data[len(data)-1]
+	}
+
+	return nil
+}
@@ -0,0 +1,597 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"tron-monitor/config"
+	"tron-monitor/models"
+)
+
+const (
+	testWatchAddr = "TJRabPrwbZy45sbavfcjinPJC18kjpRTv8"
+	testOtherAddr = "TUpMhErZL2fhh4sVNULAbNKLokS4GjC1F4"
+)
+
+// newTestClient 启动内存Redis并按最小配置连接
+func newTestClient(t testing.TB) *RedisClient {
+	t.Helper()
+	return newTestClientWithConfig(t, "")
+}
+
+// newTestClientWithConfig 启动内存Redis并连接，extra为追加的YAML片段
+func newTestClientWithConfig(t testing.TB, extra string) *RedisClient {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("watch_addresses:\n  - \""+testWatchAddr+"\"\n"+extra), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.LoadConfig(path)
+	if err != nil {
+		t.Fatalf("加载测试配置失败: %v", err)
+	}
+	cfg.Redis.Addr = miniredis.RunT(t).Addr()
+	client, err := NewRedisClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// groupStats 返回指定分组的统计，没有时返回nil
+func groupStats(t testing.TB, client *RedisClient, name string) *models.GroupStats {
+	t.Helper()
+	stats, err := client.GetGroupStats(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range stats {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+func TestGroupStatsByTokenAndIdempotent(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+	if err := client.AddWatchAddress(ctx, models.WatchAddress{Address: testWatchAddr, Group: "exchange"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tokenA := &models.TransferEvent{TxHash: "a", BlockHeight: 1, TokenType: "TRC20", ContractAddress: "TContractA", Source: testOtherAddr, Destination: testWatchAddr, Amount: 10, Groups: []string{"exchange"}}
+	tokenB := &models.TransferEvent{TxHash: "b", BlockHeight: 1, TokenType: "TRC20", ContractAddress: "TContractB", Source: testOtherAddr, Destination: testWatchAddr, Amount: 5, Groups: []string{"exchange"}}
+	for _, event := range []*models.TransferEvent{tokenA, tokenB, tokenA} { // tokenA 模拟保存重试
+		if err := client.SaveTransferEvent(ctx, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats := groupStats(t, client, "exchange")
+	if stats == nil || stats.TransferCount != 2 {
+		t.Fatalf("重复保存同一转账不应重复计数: %+v", stats)
+	}
+	if stats.Volume["TRC20:TContractA"] != 10 || stats.Volume["TRC20:TContractB"] != 5 || stats.Volume["TRC20"] != 0 {
+		t.Errorf("金额应按代币标识分别累计: %v", stats.Volume)
+	}
+
+	if err := client.RevertTransfer(ctx, tokenA, &models.TransferReverted{TxHash: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	stats = groupStats(t, client, "exchange")
+	if stats.TransferCount != 1 || stats.Volume["TRC20:TContractA"] != 0 {
+		t.Errorf("撤销转账应扣减分组统计: %+v", stats)
+	}
+
+	removed, err := client.PurgeAddressData(ctx, testWatchAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed["group_transfers:exchange"] != 1 {
+		t.Errorf("清理地址数据应删除分组转账记录: %v", removed)
+	}
+	if events, _ := client.GetGroupTransfers(ctx, "exchange", 100); len(events) != 0 {
+		t.Errorf("清理后分组转账列表应为空: %v", events)
+	}
+	if stats = groupStats(t, client, "exchange"); stats.TransferCount != 0 || stats.Volume["TRC20:TContractB"] != 0 {
+		t.Errorf("清理地址数据应扣减分组统计: %+v", stats)
+	}
+}
+
+func TestSaveTransferEventRetryDoesNotDuplicate(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+
+	event := &models.TransferEvent{TxHash: "a", BlockHeight: 1, TokenType: "USDT", IsUSDT: true, Source: testOtherAddr, Destination: testWatchAddr, Amount: 1}
+	for i := 0; i < 2; i++ {
+		if err := client.SaveTransferEvent(ctx, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, key := range []string{"transfers", "usdt_transfers"} {
+		if n := client.client.LLen(ctx, key).Val(); n != 1 {
+			t.Errorf("重复保存后 %s 应只有1条记录，实际 %d", key, n)
+		}
+	}
+	if n := client.client.ZCard(ctx, "transfers_by_block").Val(); n != 1 {
+		t.Errorf("重复保存后区块索引应只有1条记录，实际 %d", n)
+	}
+}
+
+func TestReplayTransferDeadLetters(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+
+	for _, hash := range []string{"a", "b"} {
+		event := &models.TransferEvent{TxHash: hash, BlockHeight: 1, TokenType: "TRX", Source: testOtherAddr, Destination: testWatchAddr, Amount: 1}
+		if err := client.PushTransferDeadLetter(ctx, event, "OOM"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a 在进入死信队列前其实已保存成功，重放不应重复写入
+	if err := client.SaveTransferEvent(ctx, &models.TransferEvent{TxHash: "a", BlockHeight: 1, TokenType: "TRX", Source: testOtherAddr, Destination: testWatchAddr, Amount: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	replayed, err := client.ReplayTransferDeadLetters(ctx, 100)
+	if err != nil || replayed != 2 {
+		t.Fatalf("应重放2个事件，实际 %d，错误 %v", replayed, err)
+	}
+	if entries, _ := client.GetTransferDeadLetters(ctx, 100); len(entries) != 0 {
+		t.Errorf("重放后死信队列应为空: %d", len(entries))
+	}
+	events, err := client.GetRecentTransfers(ctx, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Errorf("重放后应有2条转账记录，实际 %d", len(events))
+	}
+}
+
+func TestSaveProcessorCursorOnlyAdvances(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+
+	for _, height := range []int64{100, 105, 103} {
+		if err := client.SaveProcessorCursor(ctx, height); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cursor, err := client.GetProcessorCursor(ctx); err != nil || cursor != 105 {
+		t.Errorf("较低的游标不应覆盖已保存的游标，实际 %d，错误 %v", cursor, err)
+	}
+}
+
+func TestPurgeAddressDataKeepsOtherEntriesInOrder(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+
+	const thirdAddr = "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t"
+	var want []string
+	for i := 0; i < 200; i++ {
+		event := &models.TransferEvent{TxHash: fmt.Sprintf("tx%d", i), BlockHeight: int64(i), TokenType: "TRX", Source: thirdAddr, Destination: testOtherAddr, Amount: 1}
+		if i%3 == 0 {
+			event.Destination = testWatchAddr
+		} else {
+			want = append([]string{event.TxHash}, want...)
+		}
+		if err := client.SaveTransferEvent(ctx, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := client.PurgeAddressData(ctx, testWatchAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed["transfers"] != 67 || removed["transfer"] != 67 {
+		t.Errorf("应删除67条转账记录: %v", removed)
+	}
+	items := client.client.LRange(ctx, "transfers", 0, -1).Val()
+	got := make([]string, len(items))
+	for i, item := range items {
+		var event models.TransferEvent
+		json.Unmarshal([]byte(item), &event)
+		got[i] = event.TxHash
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("清理后其他记录应保持原顺序:\ngot:  %v\nwant: %v", got, want)
+	}
+}
+
+func TestTransferRangeQueriesReportTruncation(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+	for i := int64(1); i <= 3; i++ {
+		event := &models.TransferEvent{TxHash: fmt.Sprintf("tx%d", i), BlockHeight: 100 + i, Timestamp: 1000 * i, Source: testOtherAddr, Destination: testWatchAddr, Amount: 1}
+		if err := client.SaveTransferEvent(ctx, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	events, truncated, err := client.GetTransfersByBlockRange(ctx, 101, 103, 10)
+	if err != nil || truncated || len(events) != 3 {
+		t.Fatalf("完整结果: %d 条, truncated=%v, err=%v", len(events), truncated, err)
+	}
+	events, truncated, err = client.GetTransfersByBlockRange(ctx, 101, 103, 2)
+	if err != nil || !truncated || len(events) != 2 {
+		t.Fatalf("超过limit应截断并标记: %d 条, truncated=%v, err=%v", len(events), truncated, err)
+	}
+
+	events, truncated, err = client.GetTransfersByTimeRange(ctx, 0, 5000)
+	if err != nil || truncated || len(events) != 3 {
+		t.Fatalf("列表未满时不应标记截断: %d 条, truncated=%v, err=%v", len(events), truncated, err)
+	}
+
+	// 填满转账列表（原有记录被淘汰），最早保留的区块时间为4000：不晚于它的范围可能缺少已淘汰的记录
+	filler := make([]interface{}, transferListSize)
+	for i := range filler {
+		data, _ := json.Marshal(&models.TransferEvent{TxHash: fmt.Sprintf("filler%d", i), Timestamp: 4000})
+		filler[i] = data
+	}
+	if err := client.client.LPush(ctx, "transfers", filler...).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.client.LTrim(ctx, "transfers", 0, transferListSize-1).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if _, truncated, err = client.GetTransfersByTimeRange(ctx, 0, 5000); err != nil || !truncated {
+		t.Errorf("范围早于保留的记录时应标记截断: truncated=%v, err=%v", truncated, err)
+	}
+	if _, truncated, err = client.GetTransfersByTimeRange(ctx, 4500, 5000); err != nil || truncated {
+		t.Errorf("范围在保留的记录内时不应标记截断: truncated=%v, err=%v", truncated, err)
+	}
+}
+
+func TestGetTransfersSinceEventID(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+	var saved []*models.TransferEvent
+	for i := 0; i < 3; i++ { // 同一交易的3笔转账
+		event := &models.TransferEvent{TxHash: "multi", LogIndex: i, BlockHeight: 100, Timestamp: 1000, Source: testOtherAddr, Destination: testWatchAddr, Amount: float64(i + 1)}
+		if err := client.SaveTransferEvent(ctx, event); err != nil {
+			t.Fatal(err)
+		}
+		saved = append(saved, event)
+	}
+	next := &models.TransferEvent{TxHash: "next", BlockHeight: 101, Timestamp: 4000, Source: testOtherAddr, Destination: testWatchAddr, Amount: 1}
+	if err := client.SaveTransferEvent(ctx, next); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		since string
+		want  []string
+	}{
+		{saved[0].EventID(), []string{"multi:1", "multi:2", "next"}},
+		{saved[1].EventID(), []string{"multi:2", "next"}},
+		{"next", nil},
+	} {
+		events, err := client.GetTransfersSince(ctx, tc.since, 0, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, event := range events {
+			got = append(got, event.EventID())
+		}
+		if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("since=%s: 返回 %v，期望 %v", tc.since, got, tc.want)
+		}
+	}
+}
+
+// 阻塞在BRPOP时取消上下文应立即返回上下文错误，而不是等满idle_poll_interval或返回Redis错误
+func TestPopBlockDataReturnsOnCancel(t *testing.T) {
+	client := newTestClient(t)
+	client.config.Monitor.IdlePollInterval = 30 * time.Second
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	blockData, err := client.PopBlockData(ctx)
+	if !errors.Is(err, context.Canceled) || blockData != nil {
+		t.Fatalf("取消后应返回context.Canceled，实际 %v, %v", blockData, err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("取消后 %v 才返回", elapsed)
+	}
+}
+
+// 分块流式读取跨越多个窗口时按列表顺序逐条返回，读取期间插入新记录不重复、列表被清空不出错
+func TestStreamRecentTransfersAcrossChunks(t *testing.T) {
+	client := newTestClient(t)
+	client.config.Redis.StreamChunkSize = 3
+	ctx := context.Background()
+	for i := 1; i <= 10; i++ {
+		event := &models.TransferEvent{TxHash: fmt.Sprintf("%064x", i), Source: testOtherAddr, Destination: testWatchAddr, Amount: float64(i), TokenType: "TRX"}
+		if err := client.SaveTransferEvent(ctx, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var hashes []string
+	err := client.StreamRecentTransfers(ctx, 100, func(event *models.TransferEvent) error {
+		hashes = append(hashes, event.TxHash)
+		if len(hashes) == 4 {
+			// 读取期间插入的新记录使后续窗口整体后移
+			return client.SaveTransferEvent(ctx, &models.TransferEvent{TxHash: fmt.Sprintf("%064x", 99), TokenType: "TRX"})
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hashes) != 10 {
+		t.Fatalf("应返回10条记录，实际 %d 条: %v", len(hashes), hashes)
+	}
+	for i, hash := range hashes {
+		if want := fmt.Sprintf("%064x", 10-i); hash != want {
+			t.Fatalf("第 %d 条为 %s，期望 %s", i+1, hash, want)
+		}
+	}
+
+	// 列表在两个窗口之间被清空（如PurgeAddressData重建列表）
+	count := 0
+	err = client.StreamRecentTransfers(ctx, 100, func(event *models.TransferEvent) error {
+		count++
+		if count == 3 {
+			return client.client.Del(ctx, "transfers").Err()
+		}
+		return nil
+	})
+	if err != nil || count != 3 {
+		t.Errorf("列表清空后应停止读取，实际读取 %d 条，错误 %v", count, err)
+	}
+}
+
+func TestBlockQueueKeepsUnconsumedBlocksWhenFull(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+	client.config.Monitor.QueueSize = 3
+
+	popHeights := func() []int64 {
+		t.Helper()
+		var heights []int64
+		for {
+			if size, err := client.GetQueueSize(ctx); err != nil || size == 0 {
+				return heights
+			}
+			block, err := client.PopBlockData(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			heights = append(heights, block.Height)
+		}
+	}
+
+	// 默认block策略：超出容量的区块被拒绝，已入队的区块按FIFO全部保留
+	for height := int64(1); height <= 5; height++ {
+		err := client.PushBlockData(ctx, &models.BlockData{Height: height})
+		if height <= 3 && err != nil {
+			t.Fatalf("区块 %d 入队失败: %v", height, err)
+		}
+		if height > 3 && !errors.Is(err, ErrQueueFull) {
+			t.Fatalf("区块 %d 超出容量应返回ErrQueueFull，实际 %v", height, err)
+		}
+	}
+	if got := fmt.Sprint(popHeights()); got != "[1 2 3]" {
+		t.Errorf("block策略出队 %s，期望 [1 2 3]", got)
+	}
+
+	// drop_oldest策略：丢弃最早的区块，保留最新的区块并按FIFO出队
+	client.config.Monitor.QueueFullPolicy = "drop_oldest"
+	for height := int64(1); height <= 5; height++ {
+		if err := client.PushBlockData(ctx, &models.BlockData{Height: height}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := fmt.Sprint(popHeights()); got != "[3 4 5]" {
+		t.Errorf("drop_oldest策略出队 %s，期望 [3 4 5]", got)
+	}
+}
+
+// 统计历史按from/to窗口查询（含边界），超过保留时长的数据点在写入时清理，相同数值的数据点不互相覆盖
+func TestStatsHistoryWindowAndRetention(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+	start := time.Unix(1700000000, 0)
+
+	for i, value := range []int64{5, 5, 7, 9} {
+		at := start.Add(time.Duration(i) * time.Minute)
+		metrics := map[string]int64{"processed_blocks": value, "errors": int64(i)}
+		if err := client.SaveStatsSnapshot(ctx, at, metrics, 150*time.Second); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	format := func(points []models.StatsPoint) string {
+		var parts []string
+		for _, point := range points {
+			parts = append(parts, fmt.Sprintf("%d=%d", point.Timestamp-start.Unix(), point.Value))
+		}
+		return strings.Join(parts, ",")
+	}
+
+	points, err := client.GetStatsHistory(ctx, "processed_blocks", start, start.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := format(points); got != "60=5,120=7,180=9" {
+		t.Errorf("全部数据点 %s，期望最早的数据点超过保留时长被清理: 60=5,120=7,180=9", got)
+	}
+
+	points, err = client.GetStatsHistory(ctx, "processed_blocks", start.Add(time.Minute), start.Add(2*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := format(points); got != "60=5,120=7" {
+		t.Errorf("窗口内数据点 %s，期望 60=5,120=7", got)
+	}
+
+	points, err = client.GetStatsHistory(ctx, "errors", start.Add(3*time.Minute), start.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := format(points); got != "180=3" {
+		t.Errorf("errors窗口内数据点 %s，期望各指标单独记录: 180=3", got)
+	}
+}
+
+// 每种代币类型有独立的转账列表，按token_list_sizes覆盖保留条数（键不区分大小写），0表示不保存
+func TestPerTokenTransferLists(t *testing.T) {
+	client := newTestClientWithConfig(t, "redis:\n  token_list_size: 2\n  token_list_sizes:\n    trx: 3\n    TRC10: 0\n")
+	ctx := context.Background()
+
+	n := 0
+	save := func(tokenType string, count int) {
+		for i := 0; i < count; i++ {
+			n++
+			event := &models.TransferEvent{TxHash: fmt.Sprintf("%02d", n), TokenType: tokenType, IsUSDT: tokenType == "USDT"}
+			if err := client.SaveTransferEvent(ctx, event); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	save("TRX", 4)
+	save("USDT", 3)
+	save("TRC10", 2)
+	save("TRC20", 1)
+
+	for _, tc := range []struct {
+		symbol string
+		want   string
+	}{
+		{"TRX", "04,03,02"}, // 单独配置保留3条
+		{"usdt", "07,06"},   // 默认保留2条，查询不区分大小写
+		{"TRC10", ""},       // 0表示不保存
+		{"TRC20", "10"},
+		{"TRC721", ""},
+	} {
+		events, err := client.GetRecentTransfersByToken(ctx, tc.symbol, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, event := range events {
+			got = append(got, event.TxHash)
+		}
+		if strings.Join(got, ",") != tc.want {
+			t.Errorf("%s 转账列表 %v，期望 %s", tc.symbol, got, tc.want)
+		}
+	}
+
+	// 总列表不受代币列表保留条数影响
+	recent, err := client.GetRecentTransfers(ctx, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recent) != 10 {
+		t.Errorf("总转账列表 %d 条，期望 10", len(recent))
+	}
+}
+
+// 启用block_ordered时最近转账按区块从新到旧、区块内按交易和日志序号从小到大返回；关闭时按保存先后
+func TestRecentTransfersBlockOrder(t *testing.T) {
+	saved := []*models.TransferEvent{
+		{TxHash: "a", BlockHeight: 100, TxIndex: 2},
+		{TxHash: "b", BlockHeight: 101, TxIndex: 1},
+		{TxHash: "c", BlockHeight: 100, TxIndex: 0},
+		{TxHash: "d", BlockHeight: 101, TxIndex: 0, LogIndex: 2},
+		{TxHash: "d", BlockHeight: 101, TxIndex: 0, LogIndex: 1},
+		{TxHash: "e", BlockHeight: 100, TxIndex: 1},
+	}
+
+	for _, tc := range []struct {
+		extra string
+		want  string
+	}{
+		{"", "e,d:1,d:2,c,b,a"},
+		{"monitor:\n  record_tx_index: true\nredis:\n  block_ordered: true\n", "d:1,d:2,b,c,e,a"},
+	} {
+		client := newTestClientWithConfig(t, tc.extra)
+		ctx := context.Background()
+		for _, event := range saved {
+			if err := client.SaveTransferEvent(ctx, event); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		events, err := client.GetRecentTransfers(ctx, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, event := range events {
+			id := event.TxHash
+			if event.LogIndex > 0 {
+				id = fmt.Sprintf("%s:%d", id, event.LogIndex)
+			}
+			got = append(got, id)
+		}
+		if strings.Join(got, ",") != tc.want {
+			t.Errorf("%q: 最近转账顺序 %v，期望 %s", tc.extra, got, tc.want)
+		}
+	}
+}
+
+// 撤销重组转账时，存储中的记录已被新区块重新打包保存（区块哈希不同）则保留；区块哈希相同或未记录时删除
+func TestRevertTransferKeepsReincludedRecord(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+
+	orphaned := &models.TransferEvent{TxHash: "a", BlockHeight: 10, BlockHash: "hash-old", TokenType: "TRX", Source: testOtherAddr, Destination: testWatchAddr, Amount: 1}
+	reincluded := *orphaned
+	reincluded.BlockHeight, reincluded.BlockHash = 11, "hash-new"
+	for _, event := range []*models.TransferEvent{orphaned, &reincluded} {
+		if err := client.SaveTransferEvent(ctx, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := client.RevertTransfer(ctx, orphaned, &models.TransferReverted{TxHash: "a", BlockHash: "hash-old"}); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := client.GetTransferEvent(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored == nil || stored.BlockHash != "hash-new" || stored.BlockHeight != 11 {
+		t.Fatalf("已被新区块重新打包的记录应保留: %+v", stored)
+	}
+	recent, err := client.GetRecentTransfers(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recent) != 1 || recent[0].BlockHash != "hash-new" {
+		t.Errorf("转账列表应只保留新区块中的记录: %+v", recent)
+	}
+
+	for _, event := range []*models.TransferEvent{
+		{TxHash: "b", BlockHeight: 10, BlockHash: "hash-old", TokenType: "TRX", Source: testOtherAddr, Destination: testWatchAddr, Amount: 1},
+		{TxHash: "c", BlockHeight: 10, TokenType: "TRX", Source: testOtherAddr, Destination: testWatchAddr, Amount: 1},
+	} {
+		if err := client.SaveTransferEvent(ctx, event); err != nil {
+			t.Fatal(err)
+		}
+		if err := client.RevertTransfer(ctx, event, &models.TransferReverted{TxHash: event.TxHash}); err != nil {
+			t.Fatal(err)
+		}
+		if stored, err := client.GetTransferEvent(ctx, event.TxHash); err != nil || stored != nil {
+			t.Errorf("转账 %s 应被删除: %+v %v", event.TxHash, stored, err)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	_ "modernc.org/sqlite" // 纯Go实现的SQLite驱动
+
+	"tron-monitor/models"
+)
+
+// schema 转账表，完整事件以JSON保存在data列，区块高度单独建索引用于范围查询
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS transfers (
+		event_id       TEXT PRIMARY KEY,
+		tx_hash        TEXT NOT NULL,
+		block_height   INTEGER NOT NULL,
+		tx_index       INTEGER NOT NULL,
+		contract_index INTEGER NOT NULL,
+		log_index      INTEGER NOT NULL,
+		data           TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_transfers_block_height ON transfers (block_height, tx_index, contract_index, log_index)`,
+}
+
+// SQLStore 基于SQLite的转账存储
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore 打开（不存在时创建）path处的SQLite数据库并初始化表结构
+func NewSQLStore(path string) (*SQLStore, error) {
+	// WAL模式下读写互不阻塞；busy_timeout避免并发写入时立即返回SQLITE_BUSY
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("打开SQL转账存储失败: %w", err)
+	}
+	db.SetMaxOpenConns(1) // SQLite同一时间只允许一个写入者
+
+	for _, stmt := range schema {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("创建转账表失败: %w", err)
+		}
+	}
+	return &SQLStore{db: db}, nil
+}
+
+// SaveTransfer 保存转账，同一事件重复保存时覆盖（如交易被重新打包到其他区块）
+func (s *SQLStore) SaveTransfer(ctx context.Context, event *models.TransferEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("序列化转账事件失败: %w", err)
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT INTO transfers (event_id, tx_hash, block_height, tx_index, contract_index, log_index, data)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (event_id) DO UPDATE SET
+			block_height = excluded.block_height,
+			tx_index = excluded.tx_index,
+			contract_index = excluded.contract_index,
+			data = excluded.data`,
+		event.EventID(), event.TxHash, event.BlockHeight, event.TxIndex, event.ContractIndex, event.LogIndex, string(data))
+	if err != nil {
+		return fmt.Errorf("保存转账到SQL存储失败: %w", err)
+	}
+	return nil
+}
+
+// GetTransfer 按EventID获取转账，不存在时返回nil
+func (s *SQLStore) GetTransfer(ctx context.Context, eventID string) (*models.TransferEvent, error) {
+	var data string
+	err := s.db.QueryRowContext(ctx, `SELECT data FROM transfers WHERE event_id = ?`, eventID).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("从SQL存储获取转账失败: %w", err)
+	}
+
+	var event models.TransferEvent
+	if err := json.Unmarshal([]byte(data), &event); err != nil {
+		return nil, fmt.Errorf("反序列化转账事件失败: %w", err)
+	}
+	return &event, nil
+}
+
+// GetTransfersByBlockRange 获取区块高度在[fromBlock, toBlock]内的转账（闭区间），按区块和区块内位置排序
+func (s *SQLStore) GetTransfersByBlockRange(ctx context.Context, fromBlock, toBlock, limit int64) ([]*models.TransferEvent, bool, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT data FROM transfers
+		WHERE block_height BETWEEN ? AND ?
+		ORDER BY block_height, tx_index, contract_index, log_index
+		LIMIT ?`, fromBlock, toBlock, limit+1)
+	if err != nil {
+		return nil, false, fmt.Errorf("按区块范围查询SQL存储失败: %w", err)
+	}
+	defer rows.Close()
+
+	events := []*models.TransferEvent{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, false, fmt.Errorf("按区块范围查询SQL存储失败: %w", err)
+		}
+		var event models.TransferEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			continue // 跳过无效数据
+		}
+		events = append(events, &event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("按区块范围查询SQL存储失败: %w", err)
+	}
+
+	truncated := int64(len(events)) > limit
+	if truncated {
+		events = events[:limit]
+	}
+	return events, truncated, nil
+}
+
+// DeleteTransfer 删除转账，只删除仍在event所在区块的记录
+func (s *SQLStore) DeleteTransfer(ctx context.Context, event *models.TransferEvent) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM transfers WHERE event_id = ? AND block_height = ?`, event.EventID(), event.BlockHeight)
+	if err != nil {
+		return fmt.Errorf("从SQL存储删除转账失败: %w", err)
+	}
+	return nil
+}
+
+// Close 关闭数据库
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
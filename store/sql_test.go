@@ -0,0 +1,162 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tron-monitor/models"
+)
+
+// newTestStore 在临时目录创建SQLite存储
+func newTestStore(t *testing.T) (*SQLStore, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "transfers.db")
+	s, err := NewSQLStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s, path
+}
+
+// saveBlocks 在每个区块高度保存perBlock笔转账，区块内按倒序保存以检验排序
+func saveBlocks(t *testing.T, s *SQLStore, heights []int64, perBlock int) {
+	t.Helper()
+	for _, height := range heights {
+		for i := perBlock - 1; i >= 0; i-- {
+			event := &models.TransferEvent{
+				TxHash:      fmt.Sprintf("%060d%04d", height, i),
+				BlockHeight: height,
+				TxIndex:     i,
+				TokenType:   "TRX",
+				Amount:      float64(i + 1),
+			}
+			if err := s.SaveTransfer(context.Background(), event); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+// heightsOf 返回转账的区块高度和区块内序号，如 100/0
+func heightsOf(events []*models.TransferEvent) string {
+	var parts []string
+	for _, event := range events {
+		parts = append(parts, fmt.Sprintf("%d/%d", event.BlockHeight, event.TxIndex))
+	}
+	return strings.Join(parts, ",")
+}
+
+func TestGetTransfersByBlockRangeBoundaries(t *testing.T) {
+	s, _ := newTestStore(t)
+	saveBlocks(t, s, []int64{99, 100, 101, 105, 106}, 2)
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		from, to int64
+		want     string
+	}{
+		{"闭区间包含两端", 100, 105, "100/0,100/1,101/0,101/1,105/0,105/1"},
+		{"单个区块", 101, 101, "101/0,101/1"},
+		{"起点为空区块", 102, 105, "105/0,105/1"},
+		{"范围内没有转账", 102, 104, ""},
+		{"范围在所有转账之后", 200, 300, ""},
+		{"范围在所有转账之前", 1, 98, ""},
+	}
+	for _, tt := range tests {
+		events, truncated, err := s.GetTransfersByBlockRange(ctx, tt.from, tt.to, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := heightsOf(events); got != tt.want || truncated {
+			t.Errorf("%s [%d, %d]: 返回 %q（truncated=%v），期望 %q", tt.name, tt.from, tt.to, got, truncated, tt.want)
+		}
+		if events == nil {
+			t.Errorf("%s: 没有转账时应返回空切片而不是nil", tt.name)
+		}
+	}
+
+	events, truncated, err := s.GetTransfersByBlockRange(ctx, 99, 106, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := heightsOf(events); got != "99/0,99/1,100/0" || !truncated {
+		t.Errorf("超过limit时应截断并返回truncated: %q, %v", got, truncated)
+	}
+	if _, truncated, _ := s.GetTransfersByBlockRange(ctx, 99, 106, 10); truncated {
+		t.Error("恰好返回全部转账时不应标记truncated")
+	}
+}
+
+func TestBlockRangeQueryUsesIndex(t *testing.T) {
+	s, _ := newTestStore(t)
+	rows, err := s.db.Query(`EXPLAIN QUERY PLAN SELECT data FROM transfers WHERE block_height BETWEEN 1 AND 2 ORDER BY block_height, tx_index, contract_index, log_index`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var plan []string
+	for rows.Next() {
+		var id, parent, notused int
+		var detail string
+		if err := rows.Scan(&id, &parent, &notused, &detail); err != nil {
+			t.Fatal(err)
+		}
+		plan = append(plan, detail)
+	}
+	if joined := strings.Join(plan, "; "); !strings.Contains(joined, "idx_transfers_block_height") || strings.Contains(joined, "TEMP B-TREE") {
+		t.Errorf("区块范围查询应使用区块高度索引且无需额外排序: %s", joined)
+	}
+}
+
+func TestSQLStoreSaveGetDelete(t *testing.T) {
+	s, path := newTestStore(t)
+	ctx := context.Background()
+	event := &models.TransferEvent{TxHash: "aa", LogIndex: 2, BlockHeight: 100, TokenType: "USDT", Amount: 1.5, Source: "A", Destination: "B"}
+	if err := s.SaveTransfer(ctx, event); err != nil {
+		t.Fatal(err)
+	}
+
+	// 交易被重新打包到其他区块时覆盖原记录
+	moved := *event
+	moved.BlockHeight = 101
+	if err := s.SaveTransfer(ctx, &moved); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.GetTransfer(ctx, "aa:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.BlockHeight != 101 || got.Amount != 1.5 || got.Destination != "B" {
+		t.Fatalf("应返回覆盖后的记录: %+v", got)
+	}
+
+	// 撤销旧区块的记录不影响已按新区块保存的记录
+	if err := s.DeleteTransfer(ctx, event); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.GetTransfer(ctx, "aa:2"); got == nil {
+		t.Fatal("已按其他区块保存的记录不应被删除")
+	}
+
+	// 重新打开后数据仍在
+	s.Close()
+	reopened, err := NewSQLStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if got, _ := reopened.GetTransfer(ctx, "aa:2"); got == nil {
+		t.Fatal("重新打开后应能读取已保存的转账")
+	}
+	if err := reopened.DeleteTransfer(ctx, &moved); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := reopened.GetTransfer(ctx, "aa:2"); err != nil || got != nil {
+		t.Errorf("删除后应返回nil: %+v, %v", got, err)
+	}
+}
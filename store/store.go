@@ -0,0 +1,25 @@
+package store
+
+import (
+	"context"
+
+	"tron-monitor/models"
+)
+
+// TransferStore 转账持久存储，与Redis双写，保存不受Redis列表长度和过期时间限制的历史转账
+type TransferStore interface {
+	// SaveTransfer 保存转账，同一事件（EventID相同）重复保存时覆盖
+	SaveTransfer(ctx context.Context, event *models.TransferEvent) error
+
+	// GetTransfer 按EventID获取转账，不存在时返回nil
+	GetTransfer(ctx context.Context, eventID string) (*models.TransferEvent, error)
+
+	// GetTransfersByBlockRange 获取区块高度在[fromBlock, toBlock]内的转账，按区块和区块内位置排序，
+	// 最多返回limit条，超出时truncated为true
+	GetTransfersByBlockRange(ctx context.Context, fromBlock, toBlock, limit int64) ([]*models.TransferEvent, bool, error)
+
+	// DeleteTransfer 删除所在区块已被重组的转账，已按其他区块重新保存的记录不受影响
+	DeleteTransfer(ctx context.Context, event *models.TransferEvent) error
+
+	Close() error
+}
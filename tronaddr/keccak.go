@@ -0,0 +1,11 @@
+package tronaddr
+
+import "golang.org/x/crypto/sha3"
+
+// Keccak256 计算以太坊/TRON使用的Keccak-256哈希（原始Keccak填充，与标准SHA3-256不同），
+// 用于事件签名的topic和由公钥推导地址
+func Keccak256(data []byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	h.Write(data)
+	return h.Sum(nil)
+}
@@ -0,0 +1,25 @@
+package tronaddr
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestKeccak256(t *testing.T) {
+	cases := map[string]string{
+		"":                                  "c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470",
+		"Transfer(address,address,uint256)": "ddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef",
+		"Approval(address,address,uint256)": "8c5be1e5ebec7d5bd14f71427d1e84f3dd0314c0f7b2291e5b200ac8c7c3b925",
+	}
+	for input, want := range cases {
+		if got := hex.EncodeToString(Keccak256([]byte(input))); got != want {
+			t.Errorf("Keccak256(%q) = %s，期望 %s", input, got, want)
+		}
+	}
+
+	// 超过一个分块（136字节）的输入
+	long := make([]byte, 200)
+	if got := hex.EncodeToString(Keccak256(long)); len(got) != 64 {
+		t.Errorf("长输入的哈希长度错误: %s", got)
+	}
+}
@@ -0,0 +1,171 @@
+package tronaddr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcutil/base58"
+)
+
+// ToBase58 将地址统一为base58格式，已是base58（以T开头）或无法解析的地址原样返回
+func ToBase58(address string) string {
+	// 移除0x前缀
+	address = strings.TrimPrefix(address, "0x")
+
+	// 如果地址为空或已经是base58格式（以T开头），直接返回
+	if len(address) == 0 || strings.HasPrefix(address, "T") {
+		return address
+	}
+
+	tronAddress, err := HexToBase58(address)
+	if err != nil {
+		return address
+	}
+
+	return tronAddress
+}
+
+// HexToBase58 将TRON的十六进制地址转换为Base58Check格式的地址
+func HexToBase58(hexAddress string) (string, error) {
+	// 1. 解码十六进制字符串为字节数组
+	// TRON地址的十六进制表示通常以 "41" 开头
+	addressBytes, err := hex.DecodeString(hexAddress)
+	if err != nil {
+		return "", fmt.Errorf("解码十六进制地址失败: %v", err)
+	}
+
+	// 2. 计算校验和：对地址字节进行两次SHA256哈希，取结果的前4个字节
+	hash1 := sha256.Sum256(addressBytes)
+	hash2 := sha256.Sum256(hash1[:])
+	checksum := hash2[:4]
+
+	// 3. 将校验和追加到地址字节数组的末尾
+	payload := append(addressBytes, checksum...)
+
+	// 4. 使用Base58对拼接后的数据进行编码
+	return base58.Encode(payload), nil
+}
+
+// Base58ToHex 将Base58Check格式的地址转换为十六进制（小写，带41前缀），校验和不匹配时返回错误
+func Base58ToHex(address string) (string, error) {
+	payload := base58.Decode(address)
+	if len(payload) != 25 {
+		return "", fmt.Errorf("无效的base58地址: %s", address)
+	}
+
+	addressBytes, checksum := payload[:21], payload[21:]
+	hash1 := sha256.Sum256(addressBytes)
+	hash2 := sha256.Sum256(hash1[:])
+	if string(hash2[:4]) != string(checksum) {
+		return "", fmt.Errorf("地址校验和不匹配: %s", address)
+	}
+
+	return hex.EncodeToString(addressBytes), nil
+}
+
+// Normalize 将base58或十六进制（可带0x前缀、大小写不限、可省略41前缀）地址转换为规范的base58格式并校验
+func Normalize(address string) (string, error) {
+	address = strings.TrimSpace(address)
+	if strings.HasPrefix(address, "T") {
+		if _, err := Base58ToHex(address); err != nil {
+			return "", err
+		}
+		return address, nil
+	}
+
+	hexAddress := strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(address, "0x"), "0X"))
+	if len(hexAddress) == 40 {
+		hexAddress = "41" + hexAddress
+	}
+	if len(hexAddress) != 42 || !strings.HasPrefix(hexAddress, "41") {
+		return "", fmt.Errorf("无效的地址: %s", address)
+	}
+	return HexToBase58(hexAddress)
+}
+
+// NormalizeFields 递归地将数据中地址字段（键为address或以_address结尾）统一为base58格式
+func NormalizeFields(data interface{}) {
+	switch value := data.(type) {
+	case map[string]interface{}:
+		for key, field := range value {
+			if str, ok := field.(string); ok {
+				if key == "address" || strings.HasSuffix(key, "_address") {
+					value[key] = ToBase58(str)
+				}
+				continue
+			}
+			NormalizeFields(field)
+		}
+	case []interface{}:
+		for _, item := range value {
+			NormalizeFields(item)
+		}
+	}
+}
+
+// base58Alphabet TRON地址使用的base58字母表，不含容易混淆的0、O、I、l
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// ValidateBase58 校验base58地址，不合法时在错误信息中指出可能的原因（大小写被改写、混入非base58字符等）
+//
+// base58区分大小写，大小写错误的地址无法还原，只能拒绝。
+func ValidateBase58(address string) error {
+	if len(address) != 34 {
+		return fmt.Errorf("地址长度应为34个字符，实际为 %d: %s", len(address), address)
+	}
+	if address[0] == 't' {
+		return fmt.Errorf("地址 %s 以小写t开头：TRON地址区分大小写，应以大写T开头，可能是复制时被转换成了小写，请从钱包或区块浏览器重新复制", address)
+	}
+	if address[0] != 'T' {
+		return fmt.Errorf("地址 %s 应以T开头", address)
+	}
+	// 除开头的T外字母全部为小写或大写，多半是整体改写了大小写
+	rest := address[1:]
+	caseFolded := rest == strings.ToLower(rest) || rest == strings.ToUpper(rest)
+	if i := strings.IndexFunc(address, func(r rune) bool { return !strings.ContainsRune(base58Alphabet, r) }); i >= 0 {
+		if caseFolded {
+			return fmt.Errorf("地址 %s 的第 %d 个字符 %q 不是base58字符，且除开头的T外字母全部为小写或大写：base58地址区分大小写，很可能被改写了大小写，请从钱包或区块浏览器重新复制", address, i+1, address[i])
+		}
+		return fmt.Errorf("地址 %s 的第 %d 个字符 %q 不是base58字符（base58不使用0、O、I、l），请检查是否输错", address, i+1, address[i])
+	}
+	if _, err := Base58ToHex(address); err != nil {
+		if caseFolded {
+			return fmt.Errorf("地址 %s 校验和不匹配，且除开头的T外字母全部为小写或大写：base58地址区分大小写，很可能被改写了大小写，请从钱包或区块浏览器重新复制", address)
+		}
+		return fmt.Errorf("地址 %s 校验和不匹配，请检查是否有字符输错或大小写被改写", address)
+	}
+	return nil
+}
+
+// NormalizeWatchAddress 校验监控地址并返回规范的base58格式
+//
+// 十六进制地址（41前缀或0x前缀，大小写不限）没有大小写问题，allowHex为true时转换为base58，否则拒绝；
+// base58地址按ValidateBase58校验。
+func NormalizeWatchAddress(address string, allowHex bool) (string, error) {
+	address = strings.TrimSpace(address)
+	if isHexAddress(address) {
+		if !allowHex {
+			return "", fmt.Errorf("地址 %s 是十六进制格式，请使用以T开头的base58格式", address)
+		}
+		return Normalize(address)
+	}
+	if err := ValidateBase58(address); err != nil {
+		return "", err
+	}
+	return address, nil
+}
+
+// isHexAddress 判断是否为十六进制地址：40位，或以41开头的42位（可带0x前缀）
+func isHexAddress(address string) bool {
+	hexAddress := strings.TrimPrefix(strings.TrimPrefix(address, "0x"), "0X")
+	if len(hexAddress) == 42 && !strings.HasPrefix(hexAddress, "41") {
+		return false
+	}
+	if len(hexAddress) != 40 && len(hexAddress) != 42 {
+		return false
+	}
+	_, err := hex.DecodeString(hexAddress)
+	return err == nil
+}
@@ -0,0 +1,46 @@
+package tronaddr
+
+import (
+	"strings"
+	"testing"
+)
+
+const testAddr = "TJRabPrwbZy45sbavfcjinPJC18kjpRTv8"
+
+func TestNormalizeWatchAddress(t *testing.T) {
+	hexAddr, err := Base58ToHex(testAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, input := range []string{testAddr, " " + testAddr + " "} {
+		if got, err := NormalizeWatchAddress(input, false); err != nil || got != testAddr {
+			t.Errorf("%q: 应返回 %s，实际 %s, %v", input, testAddr, got, err)
+		}
+	}
+	for _, input := range []string{hexAddr, strings.ToUpper(hexAddr), "0x" + hexAddr[2:]} {
+		if got, err := NormalizeWatchAddress(input, true); err != nil || got != testAddr {
+			t.Errorf("%q: 十六进制地址应转换为 %s，实际 %s, %v", input, testAddr, got, err)
+		}
+	}
+
+	// 错误信息需要指出可能的原因
+	for _, tc := range []struct {
+		input    string
+		allowHex bool
+		hint     string
+	}{
+		{strings.ToLower(testAddr), false, "以小写t开头"},
+		{"T" + strings.ToLower(testAddr[1:]), false, "全部为小写或大写"},
+		{"T" + strings.ToUpper(testAddr[1:]), false, "全部为小写或大写"},
+		{testAddr[:33] + "9", false, "校验和不匹配"},
+		{testAddr[:33] + "O", false, "不是base58字符"},
+		{testAddr[:33], false, "长度应为34"},
+		{hexAddr, false, "十六进制格式"},
+	} {
+		_, err := NormalizeWatchAddress(tc.input, tc.allowHex)
+		if err == nil || !strings.Contains(err.Error(), tc.hint) {
+			t.Errorf("%q: 错误信息应包含 %q，实际 %v", tc.input, tc.hint, err)
+		}
+	}
+}